@@ -0,0 +1,238 @@
+// Package artnet makes a strip into an Art-Net node, which shows the DMX
+// data that lighting software sends it over UDP.
+package artnet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/mxcu/ledctl"
+)
+
+// Port is the UDP port Art-Net uses.
+const Port = 6454
+
+const (
+	opPoll      = 0x2000
+	opPollReply = 0x2100
+	opDMX       = 0x5000 // Called OpOutput in the spec
+
+	protocolVersion = 14
+
+	dmxHeaderSize   = 18
+	pollReplySize   = 239
+	pollMinimumSize = 12
+	maxSlots        = 512
+)
+
+var id = []byte("Art-Net\x00")
+
+// opCode returns the opcode of an Art-Net packet.
+func opCode(b []byte) (uint16, error) {
+	if len(b) < pollMinimumSize || !bytes.Equal(b[:8], id) {
+		return 0, errors.New("not an Art-Net packet")
+	}
+	return binary.LittleEndian.Uint16(b[8:]), nil
+}
+
+// DMX is an ArtDMX packet.
+type DMX struct {
+	// Sequence is the sequence number, from 1 to 255, or 0 if the sender
+	// doesn't use them.
+	Sequence uint8
+	// Physical is the input port the data came from on the sender.
+	Physical uint8
+	// Universe is the 15-bit port address the data is for.
+	Universe uint16
+	// Data is the DMX slots.
+	Data []byte
+}
+
+// ParseDMX parses an ArtDMX packet. Data refers to b, rather than being a
+// copy.
+func ParseDMX(b []byte) (*DMX, error) {
+	op, err := opCode(b)
+	if err != nil {
+		return nil, err
+	}
+	if op != opDMX {
+		return nil, fmt.Errorf("opcode %#04x isn't ArtDMX", op)
+	}
+	if len(b) < dmxHeaderSize {
+		return nil, fmt.Errorf("ArtDMX too short at %d bytes", len(b))
+	}
+	n := int(binary.BigEndian.Uint16(b[16:]))
+	if n > maxSlots || dmxHeaderSize+n > len(b) {
+		return nil, fmt.Errorf("invalid length %d for %d byte ArtDMX", n, len(b))
+	}
+	return &DMX{
+		Sequence: b[12],
+		Physical: b[13],
+		Universe: uint16(b[15]&0x7f)<<8 | uint16(b[14]),
+		Data:     b[dmxHeaderSize : dmxHeaderSize+n],
+	}, nil
+}
+
+// PollReply is the ArtPollReply a node sends so that controllers can find it.
+type PollReply struct {
+	// IP is the node's IPv4 address.
+	IP net.IP
+	// ShortName is the node's name, up to 17 bytes.
+	ShortName string
+	// LongName is a longer description of the node, up to 63 bytes.
+	LongName string
+	// Universe is the 15-bit port address of the node's one output.
+	Universe uint16
+}
+
+// Encode returns the ArtPollReply packet.
+func (r *PollReply) Encode() []byte {
+	b := make([]byte, pollReplySize)
+	copy(b, id)
+	binary.LittleEndian.PutUint16(b[8:], opPollReply)
+	if ip := r.IP.To4(); ip != nil {
+		copy(b[10:14], ip)
+	}
+	binary.LittleEndian.PutUint16(b[14:], Port)
+	b[18] = byte(r.Universe>>8) & 0x7f // NetSwitch
+	b[19] = byte(r.Universe>>4) & 0x0f // SubSwitch
+	copy(b[26:43], r.ShortName)
+	copy(b[44:107], r.LongName)
+	binary.BigEndian.PutUint16(b[172:], 1) // NumPorts
+	b[174] = 0x80                          // PortTypes[0]: outputs DMX512
+	b[182] = 0x80                          // GoodOutput[0]: data is being output
+	b[190] = byte(r.Universe) & 0x0f       // SwOut[0]
+	b[212] = 0x08                          // Status2: supports 15-bit port addresses
+	return b
+}
+
+// NodeConfig is the configuration for a Node.
+type NodeConfig struct {
+	// Universe is the 15-bit port address to show the data for.
+	Universe uint16
+	// Strip is the strip to show the data on. It has to have a NumColors
+	// method, like the controllers in ledctl do. Pixels take 3 DMX slots
+	// each, or 4 if the strip has a white channel.
+	Strip ledctl.Strip
+	// IP is the address the node tells controllers it has.
+	IP net.IP
+	// ShortName and LongName are the names the node tells controllers. If
+	// ShortName is empty, "ledctl" is used.
+	ShortName string
+	LongName  string
+}
+
+type colorStrip interface {
+	ledctl.Strip
+	NumColors() int
+}
+
+// Node is an Art-Net node that shows the data for one universe on a strip.
+type Node struct {
+	universe uint16
+	strip    colorStrip
+	reply    []byte
+}
+
+// NewNode creates a new Node.
+func NewNode(config NodeConfig) (*Node, error) {
+	strip, ok := config.Strip.(colorStrip)
+	if !ok {
+		return nil, fmt.Errorf("strip %T doesn't say how many colors it has", config.Strip)
+	}
+	if config.Universe > 0x7fff {
+		return nil, fmt.Errorf("universe %d out of range 0-32767", config.Universe)
+	}
+	name := config.ShortName
+	if name == "" {
+		name = "ledctl"
+	}
+	reply := PollReply{IP: config.IP, ShortName: name, LongName: config.LongName, Universe: config.Universe}
+	return &Node{universe: config.Universe, strip: strip, reply: reply.Encode()}, nil
+}
+
+// Handle deals with an Art-Net packet. ArtDMX for the node's universe is shown
+// on the strip, which is then flushed. For ArtPoll, it returns the
+// ArtPollReply to send back. Other packets are ignored.
+func (n *Node) Handle(b []byte) (reply []byte, err error) {
+	op, err := opCode(b)
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case opPoll:
+		return n.reply, nil
+	case opDMX:
+		dmx, err := ParseDMX(b)
+		if err != nil {
+			return nil, err
+		}
+		if dmx.Universe != n.universe {
+			return nil, nil
+		}
+		return nil, n.show(dmx.Data)
+	default:
+		return nil, nil
+	}
+}
+
+func (n *Node) show(data []byte) error {
+	numPixels := n.strip.NumPixels()
+	if n.strip.NumColors() == 4 {
+		for i := 0; i < numPixels && 4*i+3 < len(data); i++ {
+			n.strip.SetRGBWAt(i, ledctl.RGBW{R: data[4*i], G: data[4*i+1], B: data[4*i+2], W: data[4*i+3]})
+		}
+	} else {
+		for i := 0; i < numPixels && 3*i+2 < len(data); i++ {
+			n.strip.SetRGBAt(i, ledctl.RGB{R: data[3*i], G: data[3*i+1], B: data[3*i+2]})
+		}
+	}
+	return n.strip.Flush()
+}
+
+// Serve handles every packet read from conn, sending replies back to where
+// the packets came from, until reading from it or flushing the strip fails.
+// Packets that can't be parsed are skipped.
+func (n *Node) Serve(conn net.PacketConn) error {
+	buf := make([]byte, 1500)
+	for {
+		size, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		p := buf[:size]
+		if op, err := opCode(p); err != nil {
+			continue
+		} else if op == opDMX {
+			if _, err := ParseDMX(p); err != nil {
+				continue
+			}
+		}
+
+		reply, err := n.Handle(p)
+		if err != nil {
+			return err
+		}
+		if reply != nil {
+			conn.WriteTo(reply, from) // Ignore error; the controller will poll again
+		}
+	}
+}
+
+// ListenAndServe listens on the Art-Net port and serves a Node with the given
+// configuration, until something goes wrong.
+func ListenAndServe(config NodeConfig) error {
+	n, err := NewNode(config)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenPacket("udp4", fmt.Sprintf(":%d", Port))
+	if err != nil {
+		return fmt.Errorf("couldn't listen for Art-Net: %v", err)
+	}
+	defer conn.Close()
+	return n.Serve(conn)
+}
@@ -0,0 +1,138 @@
+package artnet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/mxcu/ledctl"
+)
+
+// dmxPacket returns an ArtDMX packet for the given universe and data.
+func dmxPacket(universe uint16, data []byte) []byte {
+	b := []byte{
+		'A', 'r', 't', '-', 'N', 'e', 't', 0x00,
+		0x00, 0x50, // OpCode, little endian
+		0x00, 0x0e, // ProtVer
+		0x05,                                // Sequence
+		0x00,                                // Physical
+		byte(universe), byte(universe >> 8), // SubUni, Net
+		byte(len(data) >> 8), byte(len(data)), // Length, big endian
+	}
+	return append(b, data...)
+}
+
+func TestParseDMX(t *testing.T) {
+	d, err := ParseDMX(dmxPacket(0x0123, []byte{1, 2, 3, 4, 5, 6}))
+	if err != nil {
+		t.Fatalf("ParseDMX: %v", err)
+	}
+	if d.Sequence != 5 || d.Universe != 0x0123 {
+		t.Errorf("got sequence %d, universe %#x, want 5, 0x123", d.Sequence, d.Universe)
+	}
+	if want := []byte{1, 2, 3, 4, 5, 6}; !bytes.Equal(d.Data, want) {
+		t.Errorf("Data got %v, want %v", d.Data, want)
+	}
+}
+
+func TestParseDMXInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{"short", []byte("Art-Net\x00")},
+		{"id", append([]byte("Art-Nat"), dmxPacket(0, []byte{1, 2})[7:]...)},
+		{"opcode", append(dmxPacket(0, nil)[:8], append([]byte{0x00, 0x20}, dmxPacket(0, nil)[10:]...)...)},
+		{"length", dmxPacket(0, []byte{1, 2})[:19]},
+	}
+	for _, test := range tests {
+		if _, err := ParseDMX(test.b); err == nil {
+			t.Errorf("%s: ParseDMX succeeded, want error", test.name)
+		}
+	}
+}
+
+func TestPollReplyEncode(t *testing.T) {
+	r := PollReply{IP: net.IPv4(192, 168, 1, 50), ShortName: "ledctl", LongName: "ledctl node", Universe: 0x0123}
+	b := r.Encode()
+	if len(b) != 239 {
+		t.Fatalf("got %d bytes, want 239", len(b))
+	}
+	if op, err := opCode(b); err != nil || op != opPollReply {
+		t.Errorf("opcode got %#04x (%v), want %#04x", op, err, opPollReply)
+	}
+	if got, want := net.IP(b[10:14]).String(), "192.168.1.50"; got != want {
+		t.Errorf("IP got %s, want %s", got, want)
+	}
+	if got := binary.LittleEndian.Uint16(b[14:]); got != Port {
+		t.Errorf("port got %d, want %d", got, Port)
+	}
+	if b[18] != 0x01 || b[19] != 0x02 || b[190] != 0x03 {
+		t.Errorf("net, subnet, universe got %#x, %#x, %#x, want 0x1, 0x2, 0x3", b[18], b[19], b[190])
+	}
+	if got := string(bytes.TrimRight(b[26:44], "\x00")); got != "ledctl" {
+		t.Errorf("short name got %q, want %q", got, "ledctl")
+	}
+	if got := string(bytes.TrimRight(b[44:108], "\x00")); got != "ledctl node" {
+		t.Errorf("long name got %q, want %q", got, "ledctl node")
+	}
+	if got := binary.BigEndian.Uint16(b[172:]); got != 1 {
+		t.Errorf("number of ports got %d, want 1", got)
+	}
+}
+
+func TestNode(t *testing.T) {
+	tests := []struct {
+		name      string
+		numColors int
+		want      []ledctl.RGBW
+	}{
+		{"RGB", 3, []ledctl.RGBW{{R: 1, G: 2, B: 3}, {R: 4, G: 5, B: 6}, {R: 7, G: 8, B: 9}}},
+		{"RGBW", 4, []ledctl.RGBW{{R: 1, G: 2, B: 3, W: 4}, {R: 5, G: 6, B: 7, W: 8}, {}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			strip := ledctl.NullStrip(3, test.numColors)
+			n, err := NewNode(NodeConfig{Universe: 1, Strip: strip})
+			if err != nil {
+				t.Fatalf("NewNode: %v", err)
+			}
+
+			reply, err := n.Handle(dmxPacket(1, []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}))
+			if err != nil || reply != nil {
+				t.Fatalf("Handle got %v, %v, want nil, nil", reply, err)
+			}
+			for i := range test.want {
+				if strip.RGBWAt(i) != test.want[i] {
+					t.Errorf("pixel %d got %v, want %v", i, strip.RGBWAt(i), test.want[i])
+				}
+			}
+
+			if _, err := n.Handle(dmxPacket(2, []byte{1, 2, 3})); err != nil {
+				t.Fatalf("Handle: %v", err)
+			}
+			if strip.Flushes() != 1 {
+				t.Errorf("got %d flushes, want 1", strip.Flushes())
+			}
+		})
+	}
+}
+
+func TestNodePoll(t *testing.T) {
+	n, err := NewNode(NodeConfig{Universe: 1, Strip: ledctl.NullStrip(0, 3)})
+	if err != nil {
+		t.Fatalf("NewNode: %v", err)
+	}
+	poll := []byte{'A', 'r', 't', '-', 'N', 'e', 't', 0x00, 0x00, 0x20, 0x00, 0x0e, 0x00, 0x00}
+	reply, err := n.Handle(poll)
+	if err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if op, err := opCode(reply); err != nil || op != opPollReply {
+		t.Errorf("reply opcode got %#04x (%v), want %#04x", op, err, opPollReply)
+	}
+	if got := string(bytes.TrimRight(reply[26:44], "\x00")); got != "ledctl" {
+		t.Errorf("short name got %q, want %q", got, "ledctl")
+	}
+}
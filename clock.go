@@ -0,0 +1,58 @@
+package ledctl
+
+import (
+	"time"
+)
+
+// FrameClock keeps an animation loop at a steady frame rate. Call Wait once
+// per frame, after rendering and flushing.
+type FrameClock struct {
+	interval time.Duration
+	next     time.Time
+	dropped  int
+	now      func() time.Time
+	sleep    func(time.Duration)
+}
+
+// NewFrameClock creates a FrameClock for the given number of frames per
+// second, which must be positive. The first frame starts now.
+func NewFrameClock(fps float64) *FrameClock {
+	if fps <= 0 {
+		panic("NewFrameClock called with non-positive fps")
+	}
+	return newFrameClock(fps, time.Now, time.Sleep)
+}
+
+func newFrameClock(fps float64, now func() time.Time, sleep func(time.Duration)) *FrameClock {
+	interval := time.Duration(float64(time.Second) / fps)
+	return &FrameClock{
+		interval: interval,
+		next:     now().Add(interval),
+		now:      now,
+		sleep:    sleep,
+	}
+}
+
+// Interval returns how long each frame lasts.
+func (c *FrameClock) Interval() time.Duration {
+	return c.interval
+}
+
+// Dropped returns how many frames have overrun their time so far.
+func (c *FrameClock) Dropped() int {
+	return c.dropped
+}
+
+// Wait sleeps for whatever is left of the current frame's time. If the frame
+// has overrun, it counts it as dropped and returns straight away, and the next
+// frame gets a full interval rather than trying to catch up.
+func (c *FrameClock) Wait() {
+	now := c.now()
+	if now.After(c.next) {
+		c.dropped++
+		c.next = now.Add(c.interval)
+		return
+	}
+	c.sleep(c.next.Sub(now))
+	c.next = c.next.Add(c.interval)
+}
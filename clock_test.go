@@ -0,0 +1,55 @@
+package ledctl
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock that only moves when it's told to, or slept on.
+type fakeClock struct {
+	t      time.Time
+	sleeps []time.Duration
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) sleep(d time.Duration) {
+	c.sleeps = append(c.sleeps, d)
+	c.t = c.t.Add(d)
+}
+
+func TestFrameClock(t *testing.T) {
+	fc := &fakeClock{t: time.Unix(1000, 0)}
+	c := newFrameClock(50, fc.now, fc.sleep)
+	if got, want := c.Interval(), 20*time.Millisecond; got != want {
+		t.Fatalf("Interval() got %v, want %v", got, want)
+	}
+
+	steps := []struct {
+		render      time.Duration
+		wantSleep   time.Duration
+		wantDropped int
+	}{
+		{5 * time.Millisecond, 15 * time.Millisecond, 0},
+		{20 * time.Millisecond, 0, 0},
+		{25 * time.Millisecond, -1, 1}, // Overran, so no sleep
+		{12 * time.Millisecond, 8 * time.Millisecond, 1},
+	}
+	for i, step := range steps {
+		fc.t = fc.t.Add(step.render)
+		fc.sleeps = nil
+		c.Wait()
+		if step.wantSleep < 0 {
+			if len(fc.sleeps) != 0 {
+				t.Errorf("frame %d slept %v, want no sleep", i, fc.sleeps)
+			}
+		} else if len(fc.sleeps) != 1 || fc.sleeps[0] != step.wantSleep {
+			t.Errorf("frame %d slept %v, want %v", i, fc.sleeps, step.wantSleep)
+		}
+		if got := c.Dropped(); got != step.wantDropped {
+			t.Errorf("frame %d Dropped() got %d, want %d", i, got, step.wantDropped)
+		}
+	}
+}
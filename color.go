@@ -0,0 +1,309 @@
+package ledctl
+
+import (
+	"image/color"
+	"math"
+)
+
+var (
+	_ color.Color = RGB{}
+	_ color.Color = RGBW{}
+)
+
+// RGBA implements color.Color. The pixel is always fully opaque.
+func (p RGB) RGBA() (r, g, b, a uint32) {
+	r = uint32(p.R)
+	r |= r << 8
+	g = uint32(p.G)
+	g |= g << 8
+	b = uint32(p.B)
+	b |= b << 8
+	return r, g, b, 0xffff
+}
+
+// RGBA implements color.Color. The white component is added to each of red,
+// green and blue, saturating at full brightness, since that's roughly what a
+// white LED looks like next to the colored ones. The pixel is always fully
+// opaque.
+func (p RGBW) RGBA() (r, g, b, a uint32) {
+	return RGB{addSat(p.R, p.W), addSat(p.G, p.W), addSat(p.B, p.W)}.RGBA()
+}
+
+func addSat(a, b uint8) uint8 {
+	if s := uint(a) + uint(b); s < 0xff {
+		return uint8(s)
+	}
+	return 0xff
+}
+
+// RGBColorModel and RGBWColorModel are the color.Models for RGB and RGBW.
+// (RGBModel and RGBWModel are already taken by the ColorModel constants.)
+// Colors that aren't opaque are converted as if drawn over black, which is
+// what an unlit LED looks like. RGBWColorModel leaves the white component at
+// zero.
+var (
+	RGBColorModel  color.Model = color.ModelFunc(rgbModel)
+	RGBWColorModel color.Model = color.ModelFunc(rgbwModel)
+)
+
+func rgbModel(c color.Color) color.Color {
+	if p, ok := c.(RGB); ok {
+		return p
+	}
+	r, g, b, _ := c.RGBA()
+	return RGB{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8)}
+}
+
+func rgbwModel(c color.Color) color.Color {
+	if p, ok := c.(RGBW); ok {
+		return p
+	}
+	r, g, b, _ := c.RGBA()
+	return RGBW{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), 0}
+}
+
+// HSV represents a color by hue, saturation and value. All three run from 0
+// to 255, with H going once around the color circle: 0 is red, 85 is green
+// and 170 is blue.
+type HSV struct {
+	H uint8
+	S uint8
+	V uint8
+}
+
+// div255 divides by 255, rounding to the nearest value.
+func div255(v uint) uint8 {
+	return uint8((v + 127) / 255)
+}
+
+// ToRGB converts the color to RGB.
+func (c HSV) ToRGB() RGB {
+	v, s := uint(c.V), uint(c.S)
+	if s == 0 {
+		return RGB{c.V, c.V, c.V}
+	}
+
+	// Split the circle into six sectors of 255 steps each.
+	h6 := uint(c.H) * 6
+	sector, f := h6/255, h6%255
+	p := div255(v * (255 - s))
+	q := div255(v * (255 - uint(div255(s*f))))
+	t := div255(v * (255 - uint(div255(s*(255-f)))))
+
+	switch sector {
+	case 0, 6:
+		return RGB{c.V, t, p}
+	case 1:
+		return RGB{q, c.V, p}
+	case 2:
+		return RGB{p, c.V, t}
+	case 3:
+		return RGB{p, q, c.V}
+	case 4:
+		return RGB{t, p, c.V}
+	default:
+		return RGB{c.V, p, q}
+	}
+}
+
+// ToHSV converts the color to HSV.
+func (p RGB) ToHSV() HSV {
+	r, g, b := int(p.R), int(p.G), int(p.B)
+	hi, lo := r, r
+	for _, c := range []int{g, b} {
+		if c > hi {
+			hi = c
+		}
+		if c < lo {
+			lo = c
+		}
+	}
+	delta := hi - lo
+	if delta == 0 {
+		return HSV{0, 0, uint8(hi)}
+	}
+
+	// hue is in sixths of the circle, [0, 6).
+	var hue float64
+	switch hi {
+	case r:
+		hue = float64(g-b) / float64(delta)
+		if hue < 0 {
+			hue += 6
+		}
+	case g:
+		hue = 2 + float64(b-r)/float64(delta)
+	default:
+		hue = 4 + float64(r-g)/float64(delta)
+	}
+
+	return HSV{
+		H: uint8(math.Round(hue * 255 / 6)),
+		S: uint8((delta*255 + hi/2) / hi),
+		V: uint8(hi),
+	}
+}
+
+// lerp linearly interpolates between a and b, with t running from 0 (a) to
+// 255 (b), rounding to the nearest value.
+func lerp(a, b, t uint8) uint8 {
+	return div255(uint(a)*(255-uint(t)) + uint(b)*uint(t))
+}
+
+// lerpN linearly interpolates between a and b at step i of n, with step 0
+// being a and step n being b, rounding to the nearest value.
+func lerpN(a, b uint8, i, n int) uint8 {
+	return uint8((int(a)*(n-i) + int(b)*i + n/2) / n)
+}
+
+// Blend mixes a and b, with t running from 0 (all a) to 255 (all b).
+func Blend(a, b RGB, t uint8) RGB {
+	return RGB{lerp(a.R, b.R, t), lerp(a.G, b.G, t), lerp(a.B, b.B, t)}
+}
+
+// BlendRGBW mixes a and b, with t running from 0 (all a) to 255 (all b).
+func BlendRGBW(a, b RGBW, t uint8) RGBW {
+	return RGBW{lerp(a.R, b.R, t), lerp(a.G, b.G, t), lerp(a.B, b.B, t), lerp(a.W, b.W, t)}
+}
+
+// subSat returns a-b, or 0 if that would be negative.
+func subSat(a, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+	return 0
+}
+
+// scale8 returns v scaled by s/255, rounding to the nearest value.
+func scale8(v, s uint8) uint8 {
+	return div255(uint(v) * uint(s))
+}
+
+// Luminance returns the brightness of p as the eye sees it, using the Rec.
+// 709 weights of red, green and blue.
+func (p RGB) Luminance() uint8 {
+	return uint8((2126*uint(p.R) + 7152*uint(p.G) + 722*uint(p.B) + 5000) / 10000)
+}
+
+// Grayscale returns the gray with the same luminance as p.
+func (p RGB) Grayscale() RGB {
+	l := p.Luminance()
+	return RGB{l, l, l}
+}
+
+// Add returns the sum of p and q, with each color saturating at 255.
+func (p RGB) Add(q RGB) RGB {
+	return RGB{addSat(p.R, q.R), addSat(p.G, q.G), addSat(p.B, q.B)}
+}
+
+// Sub returns q taken away from p, with each color stopping at 0.
+func (p RGB) Sub(q RGB) RGB {
+	return RGB{subSat(p.R, q.R), subSat(p.G, q.G), subSat(p.B, q.B)}
+}
+
+// Scale returns p scaled by s, from 0 (black) to 255 (unchanged).
+func (p RGB) Scale(s uint8) RGB {
+	return RGB{scale8(p.R, s), scale8(p.G, s), scale8(p.B, s)}
+}
+
+// Add returns the sum of p and q, with each color saturating at 255.
+func (p RGBW) Add(q RGBW) RGBW {
+	return RGBW{addSat(p.R, q.R), addSat(p.G, q.G), addSat(p.B, q.B), addSat(p.W, q.W)}
+}
+
+// Sub returns q taken away from p, with each color stopping at 0.
+func (p RGBW) Sub(q RGBW) RGBW {
+	return RGBW{subSat(p.R, q.R), subSat(p.G, q.G), subSat(p.B, q.B), subSat(p.W, q.W)}
+}
+
+// Scale returns p scaled by s, from 0 (black) to 255 (unchanged).
+func (p RGBW) Scale(s uint8) RGBW {
+	return RGBW{scale8(p.R, s), scale8(p.G, s), scale8(p.B, s), scale8(p.W, s)}
+}
+
+// Gradient fills dst with evenly spaced colors running from from (at the
+// first pixel) to to (at the last).
+func Gradient(dst []RGB, from, to RGB) {
+	n := len(dst) - 1
+	if n <= 0 {
+		for i := range dst {
+			dst[i] = from
+		}
+		return
+	}
+	for i := range dst {
+		dst[i] = RGB{lerpN(from.R, to.R, i, n), lerpN(from.G, to.G, i, n), lerpN(from.B, to.B, i, n)}
+	}
+}
+
+// GradientRGBW fills dst with evenly spaced colors running from from (at the
+// first pixel) to to (at the last).
+func GradientRGBW(dst []RGBW, from, to RGBW) {
+	n := len(dst) - 1
+	if n <= 0 {
+		for i := range dst {
+			dst[i] = from
+		}
+		return
+	}
+	for i := range dst {
+		dst[i] = RGBW{
+			lerpN(from.R, to.R, i, n),
+			lerpN(from.G, to.G, i, n),
+			lerpN(from.B, to.B, i, n),
+			lerpN(from.W, to.W, i, n),
+		}
+	}
+}
+
+// WhiteExtraction is an enumeration of the ways of deriving the white channel
+// of an RGBW pixel from an RGB color.
+type WhiteExtraction int
+
+const (
+	// WhiteNone leaves the white channel off.
+	WhiteNone WhiteExtraction = iota
+	// WhiteMin moves the common part of red, green and blue (their minimum)
+	// to the white channel.
+	WhiteMin
+	// WhiteAccurate is like WhiteMin, but allows for the white LED not being
+	// pure white: it's treated as the color of a typical neutral (~4500K)
+	// white LED, so warm colors get more white than cool ones.
+	WhiteAccurate
+)
+
+// neutralWhite is roughly what a neutral white LED looks like in RGB.
+var neutralWhite = RGB{255, 219, 186}
+
+// RGBToRGBW converts an RGB color to RGBW using the given white extraction.
+func RGBToRGBW(p RGB, mode WhiteExtraction) RGBW {
+	switch mode {
+	case WhiteMin:
+		w := p.R
+		if p.G < w {
+			w = p.G
+		}
+		if p.B < w {
+			w = p.B
+		}
+		return RGBW{p.R - w, p.G - w, p.B - w, w}
+	case WhiteAccurate:
+		// Find how bright the white LED can be without overshooting any channel.
+		w := uint(255)
+		for _, c := range [][2]uint8{{p.R, neutralWhite.R}, {p.G, neutralWhite.G}, {p.B, neutralWhite.B}} {
+			if lim := uint(c[0]) * 255 / uint(c[1]); lim < w {
+				w = lim
+			}
+		}
+		sub := func(c, white uint8) uint8 {
+			d := div255(w * uint(white))
+			if d > c {
+				return 0
+			}
+			return c - d
+		}
+		return RGBW{sub(p.R, neutralWhite.R), sub(p.G, neutralWhite.G), sub(p.B, neutralWhite.B), uint8(w)}
+	default:
+		return RGBW{p.R, p.G, p.B, 0}
+	}
+}
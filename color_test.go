@@ -0,0 +1,215 @@
+package ledctl
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestColorRoundTrip(t *testing.T) {
+	for _, p := range []RGB{{0, 0, 0}, {1, 2, 3}, {0x80, 0x7f, 0x10}, {255, 255, 255}} {
+		rgba := color.RGBAModel.Convert(p).(color.RGBA)
+		if want := (color.RGBA{p.R, p.G, p.B, 0xff}); rgba != want {
+			t.Errorf("RGBAModel.Convert(%v) got: %v, want: %v", p, rgba, want)
+		}
+		if got := RGBColorModel.Convert(rgba); got != p {
+			t.Errorf("RGBColorModel.Convert(%v) got: %v, want: %v", rgba, got, p)
+		}
+		if got, want := RGBWColorModel.Convert(rgba), (RGBW{p.R, p.G, p.B, 0}); got != want {
+			t.Errorf("RGBWColorModel.Convert(%v) got: %v, want: %v", rgba, got, want)
+		}
+	}
+}
+
+func TestRGBWRGBA(t *testing.T) {
+	tests := []struct {
+		p    RGBW
+		want color.RGBA
+	}{
+		{RGBW{1, 2, 3, 0}, color.RGBA{1, 2, 3, 0xff}},
+		{RGBW{0, 0, 0, 0x40}, color.RGBA{0x40, 0x40, 0x40, 0xff}},
+		{RGBW{0xf0, 0x10, 0, 0x20}, color.RGBA{0xff, 0x30, 0x20, 0xff}},
+	}
+
+	for _, test := range tests {
+		if got := color.RGBAModel.Convert(test.p); got != test.want {
+			t.Errorf("RGBAModel.Convert(%v) got: %v, want: %v", test.p, got, test.want)
+		}
+	}
+}
+
+func TestHSVToRGB(t *testing.T) {
+	tests := []struct {
+		hsv  HSV
+		want RGB
+	}{
+		{HSV{0, 255, 255}, RGB{255, 0, 0}},
+		{HSV{85, 255, 255}, RGB{0, 255, 0}},
+		{HSV{170, 255, 255}, RGB{0, 0, 255}},
+		{HSV{255, 255, 255}, RGB{255, 0, 0}},
+		{HSV{0, 255, 128}, RGB{128, 0, 0}},
+		{HSV{42, 0, 200}, RGB{200, 200, 200}},
+		{HSV{123, 0, 0}, RGB{0, 0, 0}},
+	}
+
+	for _, test := range tests {
+		if got := test.hsv.ToRGB(); got != test.want {
+			t.Errorf("%v.ToRGB() got: %v, want: %v", test.hsv, got, test.want)
+		}
+	}
+}
+
+func TestRGBToHSV(t *testing.T) {
+	tests := []struct {
+		rgb  RGB
+		want HSV
+	}{
+		{RGB{255, 0, 0}, HSV{0, 255, 255}},
+		{RGB{255, 255, 0}, HSV{43, 255, 255}},
+		{RGB{0, 255, 0}, HSV{85, 255, 255}},
+		{RGB{0, 255, 255}, HSV{128, 255, 255}},
+		{RGB{0, 0, 255}, HSV{170, 255, 255}},
+		{RGB{255, 0, 255}, HSV{213, 255, 255}},
+		{RGB{100, 100, 100}, HSV{0, 0, 100}},
+	}
+
+	for _, test := range tests {
+		got := test.rgb.ToHSV()
+		if got != test.want {
+			t.Errorf("%v.ToHSV() got: %v, want: %v", test.rgb, got, test.want)
+		}
+		// The secondaries' hues aren't exact, so they only come back close.
+		back := got.ToRGB()
+		for _, d := range []int{int(back.R) - int(test.rgb.R), int(back.G) - int(test.rgb.G), int(back.B) - int(test.rgb.B)} {
+			if abs(d) > 3 {
+				t.Errorf("%v round-tripped to %v", test.rgb, back)
+				break
+			}
+		}
+	}
+}
+
+func TestBlend(t *testing.T) {
+	a, b := RGB{0, 255, 10}, RGB{255, 0, 20}
+	tests := []struct {
+		t    uint8
+		want RGB
+	}{
+		{0, a},
+		{128, RGB{128, 127, 15}},
+		{255, b},
+	}
+
+	for _, test := range tests {
+		if got := Blend(a, b, test.t); got != test.want {
+			t.Errorf("Blend(%v, %v, %d) got: %v, want: %v", a, b, test.t, got, test.want)
+		}
+	}
+
+	aw, bw := RGBW{255, 255, 255, 255}, RGBW{255, 255, 255, 0}
+	if got, want := BlendRGBW(aw, bw, 255), bw; got != want {
+		t.Errorf("BlendRGBW(%v, %v, 255) got: %v, want: %v", aw, bw, got, want)
+	}
+	if got, want := BlendRGBW(aw, bw, 0), aw; got != want {
+		t.Errorf("BlendRGBW(%v, %v, 0) got: %v, want: %v", aw, bw, got, want)
+	}
+}
+
+func TestColorArithmetic(t *testing.T) {
+	a, b := RGB{250, 5, 100}, RGB{10, 10, 50}
+	if got, want := a.Add(b), (RGB{255, 15, 150}); got != want {
+		t.Errorf("%v.Add(%v) got: %v, want: %v", a, b, got, want)
+	}
+	if got, want := a.Sub(b), (RGB{240, 0, 50}); got != want {
+		t.Errorf("%v.Sub(%v) got: %v, want: %v", a, b, got, want)
+	}
+	for _, test := range []struct {
+		s    uint8
+		want RGB
+	}{
+		{0, RGB{}},
+		{128, RGB{125, 3, 50}},
+		{255, a},
+	} {
+		if got := a.Scale(test.s); got != test.want {
+			t.Errorf("%v.Scale(%d) got: %v, want: %v", a, test.s, got, test.want)
+		}
+	}
+
+	aw, bw := RGBW{250, 5, 100, 200}, RGBW{10, 10, 50, 100}
+	if got, want := aw.Add(bw), (RGBW{255, 15, 150, 255}); got != want {
+		t.Errorf("%v.Add(%v) got: %v, want: %v", aw, bw, got, want)
+	}
+	if got, want := aw.Sub(bw), (RGBW{240, 0, 50, 100}); got != want {
+		t.Errorf("%v.Sub(%v) got: %v, want: %v", aw, bw, got, want)
+	}
+	if got, want := aw.Scale(0), (RGBW{}); got != want {
+		t.Errorf("%v.Scale(0) got: %v, want: %v", aw, got, want)
+	}
+}
+
+func TestLuminance(t *testing.T) {
+	tests := []struct {
+		p    RGB
+		want uint8
+	}{
+		{RGB{}, 0},
+		{RGB{255, 0, 0}, 54},  // 0.2126 * 255 = 54.2
+		{RGB{0, 255, 0}, 182}, // 0.7152 * 255 = 182.4
+		{RGB{0, 0, 255}, 18},  // 0.0722 * 255 = 18.4
+		{RGB{255, 255, 255}, 255},
+		{RGB{100, 100, 100}, 100},
+	}
+	for _, test := range tests {
+		if got := test.p.Luminance(); got != test.want {
+			t.Errorf("%v.Luminance() got: %d, want: %d", test.p, got, test.want)
+		}
+	}
+	if got, want := (RGB{0, 255, 0}).Grayscale(), (RGB{182, 182, 182}); got != want {
+		t.Errorf("Grayscale() got: %v, want: %v", got, want)
+	}
+}
+
+func TestGradient(t *testing.T) {
+	dst := make([]RGB, 5)
+	Gradient(dst, RGB{0, 200, 255}, RGB{100, 0, 255})
+	want := []RGB{{0, 200, 255}, {25, 150, 255}, {50, 100, 255}, {75, 50, 255}, {100, 0, 255}}
+	for i := range want {
+		if dst[i] != want[i] {
+			t.Errorf("Gradient[%d] got: %v, want: %v", i, dst[i], want[i])
+		}
+	}
+
+	one := make([]RGB, 1)
+	Gradient(one, RGB{1, 2, 3}, RGB{4, 5, 6})
+	if one[0] != (RGB{1, 2, 3}) {
+		t.Errorf("single-pixel Gradient got: %v, want: %v", one[0], RGB{1, 2, 3})
+	}
+
+	dstw := make([]RGBW, 3)
+	GradientRGBW(dstw, RGBW{0, 0, 0, 0}, RGBW{255, 255, 255, 255})
+	if dstw[1] != (RGBW{128, 128, 128, 128}) || dstw[2] != (RGBW{255, 255, 255, 255}) {
+		t.Errorf("GradientRGBW got: %v", dstw)
+	}
+}
+
+func TestRGBToRGBW(t *testing.T) {
+	tests := []struct {
+		rgb  RGB
+		mode WhiteExtraction
+		want RGBW
+	}{
+		{RGB{255, 255, 255}, WhiteNone, RGBW{255, 255, 255, 0}},
+		{RGB{255, 255, 255}, WhiteMin, RGBW{0, 0, 0, 255}},
+		{RGB{200, 100, 50}, WhiteMin, RGBW{150, 50, 0, 50}},
+		{RGB{255, 0, 0}, WhiteMin, RGBW{255, 0, 0, 0}},
+		{RGB{255, 219, 186}, WhiteAccurate, RGBW{0, 0, 0, 255}},
+		{RGB{255, 255, 255}, WhiteAccurate, RGBW{0, 36, 69, 255}},
+		{RGB{0, 10, 10}, WhiteAccurate, RGBW{0, 10, 10, 0}},
+	}
+
+	for _, test := range tests {
+		if got := RGBToRGBW(test.rgb, test.mode); got != test.want {
+			t.Errorf("RGBToRGBW(%v, %d) got: %v, want: %v", test.rgb, test.mode, got, test.want)
+		}
+	}
+}
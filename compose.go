@@ -0,0 +1,112 @@
+package ledctl
+
+import (
+	"fmt"
+	"sync"
+)
+
+// BlendMode is how a layer of a Compositor is combined with the layers below
+// it.
+type BlendMode int
+
+const (
+	// BlendNormal covers the layers below.
+	BlendNormal BlendMode = iota
+	// BlendAdd adds to the layers below, saturating at full brightness.
+	BlendAdd
+	// BlendMultiply multiplies the layers below, so that it can only darken
+	// them.
+	BlendMultiply
+)
+
+// blend combines the pixel src of a layer with the pixel dst below it.
+func (m BlendMode) blend(dst, src RGBW, alpha uint8) RGBW {
+	switch m {
+	case BlendAdd:
+		return dst.Add(src.Scale(alpha))
+	case BlendMultiply:
+		product := RGBW{scale8(dst.R, src.R), scale8(dst.G, src.G), scale8(dst.B, src.B), scale8(dst.W, src.W)}
+		return BlendRGBW(dst, product, alpha)
+	default:
+		return BlendRGBW(dst, src, alpha)
+	}
+}
+
+// Layer is a layer of a Compositor.
+type Layer struct {
+	// Buffer has the pixels of the layer.
+	Buffer *FrameBuffer
+	// Mode is how the layer is combined with the ones below it.
+	Mode BlendMode
+	// Alpha is how much of the layer shows, from 0 (none) to 255 (all).
+	Alpha uint8
+}
+
+// Compositor combines layers of FrameBuffers into one frame, e.g. sparkles over
+// a background. It's safe to use from several goroutines.
+type Compositor struct {
+	mu        sync.Mutex
+	numPixels int
+	layers    []Layer
+}
+
+// NewCompositor returns a Compositor for layers of numPixels pixels, with no
+// layers yet.
+func NewCompositor(numPixels int) *Compositor {
+	return &Compositor{numPixels: numPixels}
+}
+
+// AddLayer adds a layer on top of the others, and returns its index.
+func (c *Compositor) AddLayer(layer Layer) (int, error) {
+	if layer.Buffer == nil || layer.Buffer.NumPixels() != c.numPixels {
+		return 0, fmt.Errorf("layer doesn't have %d pixels: %w", c.numPixels, ErrPixelCountMismatch)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.layers = append(c.layers, layer)
+	return len(c.layers) - 1, nil
+}
+
+// SetLayer changes the mode and alpha of the layer at index i.
+func (c *Compositor) SetLayer(i int, mode BlendMode, alpha uint8) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := checkIndex(i, len(c.layers)); err != nil {
+		return err
+	}
+	c.layers[i].Mode, c.layers[i].Alpha = mode, alpha
+	return nil
+}
+
+// Layers returns a copy of the layers, from the bottom up.
+func (c *Compositor) Layers() []Layer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]Layer(nil), c.layers...)
+}
+
+// Flatten blends the layers, from the bottom up over black, and copies the
+// result to dst like FrameBuffer.Blit does. If none of the layers are RGBW,
+// neither is the result. It doesn't flush dst.
+func (c *Compositor) Flatten(dst Strip) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	model := RGBModel
+	for _, l := range c.layers {
+		if l.Buffer.ColorModel() == RGBWModel {
+			model = RGBWModel
+		}
+	}
+	out := NewFrameBuffer(c.numPixels, model)
+	for _, l := range c.layers {
+		for i := range out.pixels {
+			out.pixels[i] = l.Mode.blend(out.pixels[i], l.Buffer.RGBWAt(i), l.Alpha)
+		}
+	}
+	return out.Blit(dst)
+}
@@ -0,0 +1,77 @@
+package ledctl
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCompositor(t *testing.T) {
+	tests := []struct {
+		mode  BlendMode
+		alpha uint8
+		want  RGB
+	}{
+		{BlendNormal, 255, RGB{200, 100, 100}},
+		{BlendNormal, 128, RGB{150, 75, 150}},
+		{BlendNormal, 0, RGB{100, 50, 200}},
+		{BlendAdd, 255, RGB{255, 150, 255}},
+		{BlendAdd, 128, RGB{200, 100, 250}},
+		{BlendMultiply, 255, RGB{78, 20, 78}},
+		{BlendMultiply, 128, RGB{89, 35, 139}},
+	}
+	for _, test := range tests {
+		bottom := NewFrameBuffer(2, RGBModel)
+		bottom.Fill(RGB{100, 50, 200})
+		top := NewFrameBuffer(2, RGBModel)
+		top.Fill(RGB{200, 100, 100})
+
+		c := NewCompositor(2)
+		if _, err := c.AddLayer(Layer{bottom, BlendNormal, 255}); err != nil {
+			t.Fatalf("AddLayer: %v", err)
+		}
+		if _, err := c.AddLayer(Layer{top, test.mode, test.alpha}); err != nil {
+			t.Fatalf("AddLayer: %v", err)
+		}
+		dst := NullStrip(2, 3)
+		if err := c.Flatten(dst); err != nil {
+			t.Fatalf("Flatten: %v", err)
+		}
+		for i := 0; i < 2; i++ {
+			if got := dst.RGBAt(i); got != test.want {
+				t.Errorf("mode %d, alpha %d: pixel %d got %v, want %v", test.mode, test.alpha, i, got, test.want)
+			}
+		}
+	}
+}
+
+func TestCompositorLayers(t *testing.T) {
+	c := NewCompositor(2)
+	if _, err := c.AddLayer(Layer{NewFrameBuffer(3, RGBModel), BlendNormal, 255}); !errors.Is(err, ErrPixelCountMismatch) {
+		t.Errorf("AddLayer with 3 pixels got %v, want ErrPixelCountMismatch", err)
+	}
+
+	fb := NewFrameBuffer(2, RGBWModel)
+	fb.FillRGBW(RGBW{0, 0, 0, 100})
+	i, err := c.AddLayer(Layer{fb, BlendNormal, 255})
+	if err != nil {
+		t.Fatalf("AddLayer: %v", err)
+	}
+	if err := c.SetLayer(i, BlendAdd, 255); err != nil {
+		t.Errorf("SetLayer: %v", err)
+	}
+	if err := c.SetLayer(i+1, BlendAdd, 255); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Errorf("SetLayer(%d) got %v, want ErrIndexOutOfRange", i+1, err)
+	}
+	if got := c.Layers(); len(got) != 1 || got[0].Mode != BlendAdd {
+		t.Errorf("Layers got %v, want one BlendAdd layer", got)
+	}
+
+	// An RGBW layer makes the result RGBW.
+	dst := NullStrip(2, 4)
+	if err := c.Flatten(dst); err != nil {
+		t.Fatalf("Flatten: %v", err)
+	}
+	if got, want := dst.RGBWAt(1), (RGBW{0, 0, 0, 100}); got != want {
+		t.Errorf("RGBWAt(1) got %v, want %v", got, want)
+	}
+}
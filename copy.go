@@ -0,0 +1,51 @@
+package ledctl
+
+import "fmt"
+
+// checkCopy returns ErrIndexOutOfRange unless count pixels starting at
+// srcStart fit in src, and starting at dstStart fit in a strip of dstLen
+// pixels.
+func checkCopy(src Strip, srcStart, dstStart, count, dstLen int) error {
+	if count < 0 {
+		return fmt.Errorf("negative count %d", count)
+	}
+	if dstStart < 0 || dstStart+count > dstLen {
+		return fmt.Errorf("destination [%d, %d) doesn't fit in %d pixels: %w", dstStart, dstStart+count, dstLen, ErrIndexOutOfRange)
+	}
+	srcLen := src.NumPixels()
+	if srcStart < 0 || srcStart+count > srcLen {
+		return fmt.Errorf("source [%d, %d) doesn't fit in %d pixels: %w", srcStart, srcStart+count, srcLen, ErrIndexOutOfRange)
+	}
+	return nil
+}
+
+// readPixels returns count pixels of src starting at start, and whether src
+// has a white channel, going by its NumColors method if it has one. Reading
+// them all up front makes copies within one strip safe when the ranges
+// overlap. The pixels are always 8-bit: an LPD8806's 7-bit ones are widened.
+func readPixels(src Strip, start, count int) ([]RGBW, bool) {
+	hasWhite := false
+	if s, ok := src.(interface{ NumColors() int }); ok {
+		hasWhite = s.NumColors() == 4
+	}
+	pixels := make([]RGBW, count)
+	for k := range pixels {
+		if hasWhite {
+			pixels[k] = src.RGBWAt(start + k)
+		} else {
+			rgb := src.RGBAt(start + k)
+			pixels[k] = RGBW{R: rgb.R, G: rgb.G, B: rgb.B}
+		}
+	}
+	if _, ok := src.(*LPD8806); ok {
+		for k, p := range pixels {
+			pixels[k] = RGBW{widen7(p.R), widen7(p.G), widen7(p.B), widen7(p.W)}
+		}
+	}
+	return pixels, hasWhite
+}
+
+// widen7 scales a 7-bit channel to 8 bits, so that 127 becomes 255.
+func widen7(v uint8) uint8 {
+	return v<<1 | v>>6
+}
@@ -0,0 +1,49 @@
+package effects
+
+import (
+	"math"
+	"time"
+
+	ledctl "github.com/mxcu/ledctl"
+)
+
+// Breathe fills the strip with c and pulses it smoothly from off to full and
+// back once every period, flushing FPS times a second until stop is closed.
+// Strips with a brightness, like ledctl.WS281x, are pulsed with it, leaving c
+// stored as it is, and get their brightness back when Breathe returns; it
+// then counts as full. Other strips are filled with c scaled down each frame.
+// It returns early if a flush fails.
+func Breathe(strip Strip, c ledctl.RGB, period time.Duration, stop <-chan struct{}) error {
+	return breathe(strip, c, period, stop, time.Now, ledctl.NewFrameClock(FPS).Wait)
+}
+
+func breathe(strip Strip, c ledctl.RGB, period time.Duration, stop <-chan struct{}, now func() time.Time, wait func()) error {
+	bs, hasBrightness := strip.(brightnessStrip)
+	var full uint8
+	if hasBrightness {
+		full = bs.Brightness()
+		defer bs.SetBrightness(full)
+		fill(strip, c)
+	}
+
+	start := now()
+	for !stopped(stop) {
+		level := breatheLevel(now().Sub(start), period)
+		if hasBrightness {
+			bs.SetBrightness(uint8(math.Round(level * float64(full))))
+		} else {
+			fill(strip, scale(c, level))
+		}
+		if err := strip.Flush(); err != nil {
+			return err
+		}
+		wait()
+	}
+	return nil
+}
+
+// breatheLevel returns the brightness, from 0 to 1, at time t into a breath:
+// a raised cosine, off at the start of each period and full halfway through.
+func breatheLevel(t, period time.Duration) float64 {
+	return (1 - math.Cos(2*math.Pi*float64(t)/float64(period))) / 2
+}
@@ -0,0 +1,68 @@
+package effects
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	ledctl "github.com/mxcu/ledctl"
+)
+
+// runBreathe runs breathe on strip for frames frames of a fake clock, calling
+// sample after each flush with the time into the breath.
+func runBreathe(t *testing.T, strip Strip, fs *fakeStrip, c ledctl.RGB, period time.Duration, frames int, sample func(time.Duration)) {
+	t.Helper()
+	var now time.Time
+	stop := make(chan struct{})
+	start := now
+	fs.onFlush = func(s *fakeStrip) {
+		sample(now.Sub(start))
+		if s.Flushes() == frames {
+			close(stop)
+		}
+	}
+	err := breathe(strip, c, period, stop, func() time.Time { return now }, func() { now = now.Add(time.Second / FPS) })
+	if err != nil {
+		t.Fatalf("breathe failed: %v", err)
+	}
+}
+
+func TestBreatheBrightness(t *testing.T) {
+	fs := newFakeStrip(3)
+	fs.brightness = 200
+	strip := dimmable{fs}
+	c := ledctl.RGB{R: 10, G: 20, B: 30}
+	period := time.Second
+
+	runBreathe(t, strip, fs, c, period, FPS+1, func(at time.Duration) {
+		want := 200 * (1 - math.Cos(2*math.Pi*float64(at)/float64(period))) / 2
+		if got := float64(fs.brightness); math.Abs(got-want) > 1 {
+			t.Errorf("at %v brightness %v, want %.1f", at, got, want)
+		}
+		for i, p := range fs.pixels() {
+			if p != c {
+				t.Errorf("at %v pixel %d is %v, want %v", at, i, p, c)
+			}
+		}
+	})
+
+	if fs.brightness != 200 {
+		t.Errorf("brightness after Breathe %d, want 200", fs.brightness)
+	}
+}
+
+func TestBreatheScaled(t *testing.T) {
+	fs := newFakeStrip(2)
+	c := ledctl.RGB{R: 200, G: 100, B: 0}
+	period := 500 * time.Millisecond
+
+	runBreathe(t, fs, fs, c, period, FPS/2+1, func(at time.Duration) {
+		level := (1 - math.Cos(2*math.Pi*float64(at)/float64(period))) / 2
+		if got, want := float64(fs.RGBAt(1).R), 200*level; math.Abs(got-want) > 1 {
+			t.Errorf("at %v red %v, want %.1f", at, got, want)
+		}
+	})
+	if got, want := fs.RGBAt(0), (ledctl.RGB{}); got != want {
+		t.Errorf("after a whole period got %v, want %v", got, want)
+	}
+}
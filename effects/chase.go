@@ -0,0 +1,39 @@
+package effects
+
+import (
+	"fmt"
+	"time"
+
+	ledctl "github.com/mxcu/ledctl"
+)
+
+// TheaterChase lights every spacing-th pixel with c and clears the rest,
+// flushing, then moves the lit pixels step places along and waits delay
+// before the next frame, until stop is closed. It returns early if a flush
+// fails.
+func TheaterChase(strip Strip, c ledctl.RGB, spacing, step int, delay time.Duration, stop <-chan struct{}) error {
+	return theaterChase(strip, c, spacing, step, stop, func() { time.Sleep(delay) })
+}
+
+func theaterChase(strip Strip, c ledctl.RGB, spacing, step int, stop <-chan struct{}, wait func()) error {
+	if spacing <= 0 {
+		return fmt.Errorf("invalid spacing %d", spacing)
+	}
+	offset := 0
+	for !stopped(stop) {
+		for i := 0; i < strip.NumPixels(); i++ {
+			if (i-offset)%spacing == 0 {
+				strip.SetRGBAt(i, c)
+			} else {
+				strip.SetRGBAt(i, ledctl.RGB{})
+			}
+		}
+		if err := strip.Flush(); err != nil {
+			return err
+		}
+		// Keep the offset in [0, spacing), whichever way it steps.
+		offset = ((offset+step)%spacing + spacing) % spacing
+		wait()
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package effects
+
+import (
+	"reflect"
+	"testing"
+
+	ledctl "github.com/mxcu/ledctl"
+)
+
+func TestTheaterChase(t *testing.T) {
+	tests := []struct {
+		name    string
+		spacing int
+		step    int
+		want    [][]int
+	}{
+		{"forwards", 3, 1, [][]int{{0, 3, 6}, {1, 4, 7}, {2, 5}, {0, 3, 6}}},
+		{"backwards", 3, -1, [][]int{{0, 3, 6}, {2, 5}, {1, 4, 7}, {0, 3, 6}}},
+		{"by two", 4, 2, [][]int{{0, 4}, {2, 6}, {0, 4}, {2, 6}}},
+	}
+
+	for _, test := range tests {
+		strip := newFakeStrip(8)
+		strip.SetRGBAt(1, ledctl.RGB{R: 9})
+		c := ledctl.RGB{G: 255}
+		stop := make(chan struct{})
+		var got [][]int
+		strip.onFlush = func(s *fakeStrip) {
+			got = append(got, s.lit())
+			for _, i := range s.lit() {
+				if s.RGBAt(i) != c {
+					t.Errorf("%s: pixel %d is %v, want %v", test.name, i, s.RGBAt(i), c)
+				}
+			}
+			if s.Flushes() == len(test.want) {
+				close(stop)
+			}
+		}
+		if err := theaterChase(strip, c, test.spacing, test.step, stop, func() {}); err != nil {
+			t.Fatalf("%s: theaterChase failed: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: lit %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	if err := theaterChase(newFakeStrip(8), ledctl.RGB{}, 0, 1, nil, func() {}); err == nil {
+		t.Errorf("theaterChase with spacing 0 didn't fail")
+	}
+}
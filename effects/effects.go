@@ -0,0 +1,51 @@
+// Package effects has ready-made animations and patterns for LED strips.
+package effects
+
+import (
+	"math"
+
+	ledctl "github.com/mxcu/ledctl"
+)
+
+// FPS is the frame rate of the effects that animate themselves.
+const FPS = 50
+
+// Strip is a ledctl.Strip that knows how many pixels it has, as all of
+// ledctl's strips and segments do.
+type Strip interface {
+	ledctl.Strip
+	// NumPixels returns the number of pixels in the strip.
+	NumPixels() int
+}
+
+// brightnessStrip is a strip with a global brightness, like ledctl.WS281x and
+// ledctl.LPD8806.
+type brightnessStrip interface {
+	SetBrightness(b uint8)
+	Brightness() uint8
+}
+
+// fill sets every pixel of strip to c.
+func fill(strip Strip, c ledctl.RGB) {
+	for i := 0; i < strip.NumPixels(); i++ {
+		strip.SetRGBAt(i, c)
+	}
+}
+
+// scale returns c with each channel multiplied by level, from 0 to 1.
+func scale(c ledctl.RGB, level float64) ledctl.RGB {
+	f := func(v uint8) uint8 {
+		return uint8(math.Round(float64(v) * level))
+	}
+	return ledctl.RGB{R: f(c.R), G: f(c.G), B: f(c.B)}
+}
+
+// stopped returns whether stop has been closed, without blocking.
+func stopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
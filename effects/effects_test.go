@@ -0,0 +1,53 @@
+package effects
+
+import (
+	ledctl "github.com/mxcu/ledctl"
+)
+
+// fakeStrip is a Null that also remembers its brightness, and calls onFlush
+// on each flush.
+type fakeStrip struct {
+	*ledctl.Null
+	brightness uint8
+	onFlush    func(s *fakeStrip)
+}
+
+func newFakeStrip(n int) *fakeStrip {
+	return &fakeStrip{Null: ledctl.NullStrip(n, 3), brightness: 255}
+}
+
+func (s *fakeStrip) Flush() error {
+	s.Null.Flush()
+	if s.onFlush != nil {
+		s.onFlush(s)
+	}
+	return nil
+}
+
+// pixels returns a copy of the pixels.
+func (s *fakeStrip) pixels() []ledctl.RGB {
+	pixels := make([]ledctl.RGB, s.NumPixels())
+	for i := range pixels {
+		pixels[i] = s.RGBAt(i)
+	}
+	return pixels
+}
+
+// lit returns the indexes of the pixels that aren't black.
+func (s *fakeStrip) lit() []int {
+	var lit []int
+	for i, p := range s.pixels() {
+		if p != (ledctl.RGB{}) {
+			lit = append(lit, i)
+		}
+	}
+	return lit
+}
+
+// dimmable is a fakeStrip with a brightness.
+type dimmable struct {
+	*fakeStrip
+}
+
+func (s dimmable) SetBrightness(b uint8) { s.brightness = b }
+func (s dimmable) Brightness() uint8     { return s.brightness }
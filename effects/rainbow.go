@@ -0,0 +1,17 @@
+package effects
+
+import (
+	ledctl "github.com/mxcu/ledctl"
+)
+
+// Rainbow spreads one turn of ledctl.Wheel over the strip, starting offset
+// along it, so that incrementing offset each frame scrolls the rainbow
+// towards the start. The pixels are set with SetRGBAt, so RGBW strips get
+// their white from their own white extraction, which is off by default. It
+// doesn't flush.
+func Rainbow(strip Strip, offset uint8) {
+	n := strip.NumPixels()
+	for i := 0; i < n; i++ {
+		strip.SetRGBAt(i, ledctl.Wheel(uint8(i*256/n)+offset))
+	}
+}
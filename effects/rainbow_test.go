@@ -0,0 +1,52 @@
+package effects
+
+import (
+	"testing"
+
+	ledctl "github.com/mxcu/ledctl"
+	rpi "github.com/mxcu/ledctl/rpi"
+)
+
+func TestRainbow(t *testing.T) {
+	strip := newFakeStrip(4)
+	Rainbow(strip, 0)
+	if got, want := strip.RGBAt(0), (ledctl.RGB{R: 255}); got != want {
+		t.Errorf("offset 0 first pixel %v, want %v", got, want)
+	}
+	if got, want := strip.RGBAt(3), ledctl.Wheel(192); got != want {
+		t.Errorf("offset 0 last pixel %v, want %v", got, want)
+	}
+	before := strip.pixels()
+
+	// A quarter turn on four pixels moves everything along by one.
+	Rainbow(strip, 64)
+	for i := range strip.pixels() {
+		if got, want := strip.RGBAt(i), before[(i+1)%4]; got != want {
+			t.Errorf("offset 64 pixel %d %v, want %v", i, got, want)
+		}
+	}
+
+	// Small steps shift the hue of each pixel a little.
+	Rainbow(strip, 1)
+	if got, want := strip.RGBAt(0), ledctl.Wheel(1); got != want {
+		t.Errorf("offset 1 first pixel %v, want %v", got, want)
+	}
+}
+
+func TestRainbowRGBW(t *testing.T) {
+	config := ledctl.DefaultWS281xConfig(3).WithColorOrder(ledctl.GRBWOrder).WithColorModel(ledctl.RGBWModel)
+	ws, err := ledctl.NewWS281xWithRPi(rpi.NewMockRPi(), config)
+	if err != nil {
+		t.Fatalf("NewWS281xWithRPi: %v", err)
+	}
+	defer ws.Close()
+	ws.FillRGBW(ledctl.RGBW{W: 255})
+
+	Rainbow(ws, 0)
+	for i := 0; i < 3; i++ {
+		want := ledctl.Wheel(uint8(i * 256 / 3))
+		if got := ws.RGBWAt(i); got != (ledctl.RGBW{R: want.R, G: want.G, B: want.B}) {
+			t.Errorf("pixel %d %v, want %v with white off", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package effects
+
+import (
+	"math"
+
+	ledctl "github.com/mxcu/ledctl"
+)
+
+// Comet is a moving dot of light with a fading tail, as made by Scanner.
+type Comet struct {
+	strip  Strip
+	c      ledctl.RGB
+	tail   int
+	bounce bool
+	decay  float64
+	dir    int
+	trail  []int // recent head positions, oldest first
+}
+
+// Scanner returns a Comet of color c with a tail of the given number of
+// pixels, for a KITT-style scanner. Each call to Step moves it along one
+// pixel. When bounce is true it turns around at each end of the strip;
+// otherwise it wraps around from the end to the start.
+func Scanner(strip Strip, c ledctl.RGB, tail int, bounce bool) *Comet {
+	if tail < 0 {
+		tail = 0
+	}
+	return &Comet{strip: strip, c: c, tail: tail, bounce: bounce, dir: 1}
+}
+
+// SetDecay sets how the tail fades. With the default of 0, it fades linearly
+// to nothing just past its end. A factor between 0 and 1 instead makes each
+// pixel of the tail that factor of the brightness of the one before it.
+func (s *Comet) SetDecay(factor float64) {
+	s.decay = factor
+}
+
+// Head returns the index of the brightest pixel, or -1 before the first Step.
+func (s *Comet) Head() int {
+	if len(s.trail) == 0 {
+		return -1
+	}
+	return s.trail[len(s.trail)-1]
+}
+
+// Step moves the comet along one pixel and draws it, clearing the rest of the
+// strip. It doesn't flush.
+func (s *Comet) Step() {
+	n := s.strip.NumPixels()
+	if n == 0 {
+		return
+	}
+	head := s.Head() + s.dir
+	if s.bounce {
+		if head >= n || head < 0 {
+			s.dir = -s.dir
+			head = s.Head() + s.dir
+		}
+		if head < 0 || head >= n {
+			// A single pixel has nowhere to go.
+			head = 0
+		}
+	} else {
+		head = (head%n + n) % n
+	}
+	s.trail = append(s.trail, head)
+	if len(s.trail) > s.tail+1 {
+		s.trail = s.trail[1:]
+	}
+
+	// Where the tail doubles back over itself after a bounce, the brighter
+	// part wins.
+	levels := make([]float64, n)
+	for j, i := range s.trail {
+		if l := s.level(len(s.trail) - 1 - j); l > levels[i] {
+			levels[i] = l
+		}
+	}
+	for i, l := range levels {
+		s.strip.SetRGBAt(i, scale(s.c, l))
+	}
+}
+
+// level returns the brightness, from 0 to 1, of the pixel k places behind the
+// head.
+func (s *Comet) level(k int) float64 {
+	if s.decay > 0 {
+		return math.Pow(s.decay, float64(k))
+	}
+	return float64(s.tail+1-k) / float64(s.tail+1)
+}
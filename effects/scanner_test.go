@@ -0,0 +1,67 @@
+package effects
+
+import (
+	"reflect"
+	"testing"
+
+	ledctl "github.com/mxcu/ledctl"
+)
+
+// reds returns the red channel of each pixel.
+func reds(s *fakeStrip) []uint8 {
+	r := make([]uint8, s.NumPixels())
+	for i, p := range s.pixels() {
+		r[i] = p.R
+	}
+	return r
+}
+
+func TestScannerBounce(t *testing.T) {
+	strip := newFakeStrip(4)
+	s := Scanner(strip, ledctl.RGB{R: 255}, 2, true)
+	if got := s.Head(); got != -1 {
+		t.Errorf("Head before Step got %d, want -1", got)
+	}
+
+	tests := []struct {
+		head int
+		reds []uint8
+	}{
+		{0, []uint8{255, 0, 0, 0}},
+		{1, []uint8{170, 255, 0, 0}},
+		{2, []uint8{85, 170, 255, 0}},
+		{3, []uint8{0, 85, 170, 255}},
+		{2, []uint8{0, 0, 255, 170}},
+		{1, []uint8{0, 255, 170, 85}},
+		{0, []uint8{255, 170, 85, 0}},
+		{1, []uint8{170, 255, 0, 0}},
+	}
+
+	for step, test := range tests {
+		s.Step()
+		if got := s.Head(); got != test.head {
+			t.Errorf("step %d Head got %d, want %d", step, got, test.head)
+		}
+		if got := reds(strip); !reflect.DeepEqual(got, test.reds) {
+			t.Errorf("step %d reds %v, want %v", step, got, test.reds)
+		}
+	}
+}
+
+func TestScannerWrap(t *testing.T) {
+	strip := newFakeStrip(3)
+	s := Scanner(strip, ledctl.RGB{R: 200}, 1, false)
+	s.SetDecay(0.25)
+
+	var heads []int
+	for step := 0; step < 5; step++ {
+		s.Step()
+		heads = append(heads, s.Head())
+	}
+	if want := []int{0, 1, 2, 0, 1}; !reflect.DeepEqual(heads, want) {
+		t.Errorf("heads %v, want %v", heads, want)
+	}
+	if got, want := reds(strip), []uint8{50, 200, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("reds %v, want %v", got, want)
+	}
+}
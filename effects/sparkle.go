@@ -0,0 +1,25 @@
+package effects
+
+import (
+	"math/rand"
+
+	ledctl "github.com/mxcu/ledctl"
+)
+
+// Sparkle sets each pixel of the strip to spark with probability density, and
+// to base otherwise, for one frame of a twinkle effect. Random numbers come
+// from rng, so that seeding it makes the sparkles repeatable, or from the
+// math/rand default source if rng is nil. It doesn't flush.
+func Sparkle(strip Strip, base, spark ledctl.RGB, density float64, rng *rand.Rand) {
+	random := rand.Float64
+	if rng != nil {
+		random = rng.Float64
+	}
+	for i := 0; i < strip.NumPixels(); i++ {
+		if random() < density {
+			strip.SetRGBAt(i, spark)
+		} else {
+			strip.SetRGBAt(i, base)
+		}
+	}
+}
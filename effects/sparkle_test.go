@@ -0,0 +1,43 @@
+package effects
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	ledctl "github.com/mxcu/ledctl"
+)
+
+func TestSparkle(t *testing.T) {
+	strip := newFakeStrip(20)
+	base, spark := ledctl.RGB{B: 10}, ledctl.RGB{R: 255, G: 255, B: 255}
+	rng := rand.New(rand.NewSource(1))
+
+	for frame, want := range [][]int{{6, 7, 8, 12, 19}, {0, 7, 11, 12, 15, 17}} {
+		Sparkle(strip, base, spark, 0.25, rng)
+		var got []int
+		for i, p := range strip.pixels() {
+			switch p {
+			case spark:
+				got = append(got, i)
+			case base:
+			default:
+				t.Errorf("frame %d pixel %d is %v, want base or spark", frame, i, p)
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("frame %d sparkled %v, want %v", frame, got, want)
+		}
+	}
+
+	Sparkle(strip, base, spark, 0, nil)
+	if got := strip.lit(); len(got) != 20 || strip.RGBAt(0) != base {
+		t.Errorf("density 0 didn't set every pixel to base: %v", strip.pixels())
+	}
+	Sparkle(strip, base, spark, 1, nil)
+	for i, p := range strip.pixels() {
+		if p != spark {
+			t.Errorf("density 1 pixel %d is %v, want %v", i, p, spark)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package effects
+
+import (
+	"math"
+	"time"
+
+	ledctl "github.com/mxcu/ledctl"
+)
+
+// ColorWipe lights the first round(fraction*NumPixels) pixels with c and
+// clears the rest, like a progress bar. fraction is clamped to [0, 1]. It
+// doesn't flush, so the caller decides when the strip shows it.
+func ColorWipe(strip Strip, c ledctl.RGB, fraction float64) {
+	fraction = math.Max(0, math.Min(1, fraction))
+	n := strip.NumPixels()
+	lit := int(math.Round(fraction * float64(n)))
+	for i := 0; i < n; i++ {
+		if i < lit {
+			strip.SetRGBAt(i, c)
+		} else {
+			strip.SetRGBAt(i, ledctl.RGB{})
+		}
+	}
+}
+
+// AnimateColorWipe clears the strip, then lights it with c one pixel per
+// frame from the start, flushing each frame and waiting delay between them. It
+// returns once every pixel is lit, when stop is closed, or if a flush fails.
+func AnimateColorWipe(strip Strip, c ledctl.RGB, delay time.Duration, stop <-chan struct{}) error {
+	return animateColorWipe(strip, c, stop, func() { time.Sleep(delay) })
+}
+
+func animateColorWipe(strip Strip, c ledctl.RGB, stop <-chan struct{}, wait func()) error {
+	n := strip.NumPixels()
+	for lit := 0; lit <= n && !stopped(stop); lit++ {
+		ColorWipe(strip, c, float64(lit)/float64(n))
+		if err := strip.Flush(); err != nil {
+			return err
+		}
+		if lit < n {
+			wait()
+		}
+	}
+	return nil
+}
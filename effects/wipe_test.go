@@ -0,0 +1,54 @@
+package effects
+
+import (
+	"reflect"
+	"testing"
+
+	ledctl "github.com/mxcu/ledctl"
+)
+
+func TestColorWipe(t *testing.T) {
+	tests := []struct {
+		fraction float64
+		want     int
+	}{
+		{0, 0},
+		{0.5, 5},
+		{1, 10},
+		{0.26, 3},
+		{-1, 0},
+		{2, 10},
+	}
+
+	c := ledctl.RGB{R: 1, G: 2, B: 3}
+	for _, test := range tests {
+		strip := newFakeStrip(10)
+		fill(strip, ledctl.RGB{B: 99})
+		ColorWipe(strip, c, test.fraction)
+		if got := len(strip.lit()); got != test.want {
+			t.Errorf("fraction %v lit %d pixels, want %d", test.fraction, got, test.want)
+		}
+		for i := 0; i < test.want; i++ {
+			if strip.RGBAt(i) != c {
+				t.Errorf("fraction %v pixel %d is %v, want %v", test.fraction, i, strip.RGBAt(i), c)
+			}
+		}
+		if strip.Flushes() != 0 {
+			t.Errorf("fraction %v flushed %d times, want 0", test.fraction, strip.Flushes())
+		}
+	}
+}
+
+func TestAnimateColorWipe(t *testing.T) {
+	strip := newFakeStrip(3)
+	var got []int
+	strip.onFlush = func(s *fakeStrip) {
+		got = append(got, len(s.lit()))
+	}
+	if err := animateColorWipe(strip, ledctl.RGB{G: 1}, nil, func() {}); err != nil {
+		t.Fatalf("animateColorWipe failed: %v", err)
+	}
+	if want := []int{0, 1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("lit counts %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,201 @@
+package ledctl
+
+import (
+	"fmt"
+	"sync"
+)
+
+// FrameBuffer is a Strip that only keeps its pixels in memory, so that frames
+// can be drawn and composed without any hardware, then copied to a real strip
+// with Blit. It's safe to use from several goroutines.
+type FrameBuffer struct {
+	mu     sync.RWMutex
+	pixels []RGBW
+	model  ColorModel
+}
+
+var _ Strip = (*FrameBuffer)(nil)
+
+// NewFrameBuffer returns a FrameBuffer of numPixels black pixels with the
+// given color model. As on a real strip, white is ignored with RGBModel.
+func NewFrameBuffer(numPixels int, model ColorModel) *FrameBuffer {
+	if model.NumColors() == 0 {
+		panic(fmt.Sprintf("NewFrameBuffer called with unknown color model %d", int(model)))
+	}
+	return &FrameBuffer{pixels: make([]RGBW, numPixels), model: model}
+}
+
+// NumPixels returns the number of pixels in the buffer.
+func (fb *FrameBuffer) NumPixels() int {
+	return len(fb.pixels)
+}
+
+// NumColors returns the number of colors per pixel.
+func (fb *FrameBuffer) NumColors() int {
+	return fb.model.NumColors()
+}
+
+// ColorModel returns the color model of the buffer.
+func (fb *FrameBuffer) ColorModel() ColorModel {
+	return fb.model
+}
+
+// RGBAt returns the RGB pixel at the given index.
+func (fb *FrameBuffer) RGBAt(i int) RGB {
+	fb.mu.RLock()
+	defer fb.mu.RUnlock()
+
+	return fb.pixels[i].ToRGB()
+}
+
+// SetRGBAt sets the RGB pixel at the given index, with white off.
+func (fb *FrameBuffer) SetRGBAt(i int, rgb RGB) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	fb.pixels[i] = rgb.ToRGBW(0)
+}
+
+// RGBWAt returns the RGBW pixel at the given index. With RGBModel, white is
+// always 0.
+func (fb *FrameBuffer) RGBWAt(i int) RGBW {
+	fb.mu.RLock()
+	defer fb.mu.RUnlock()
+
+	return fb.pixels[i]
+}
+
+// SetRGBWAt sets the RGBW pixel at the given index. With RGBModel, white is
+// ignored.
+func (fb *FrameBuffer) SetRGBWAt(i int, rgbw RGBW) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	fb.setRGBWAt(i, rgbw)
+}
+
+func (fb *FrameBuffer) setRGBWAt(i int, rgbw RGBW) {
+	if fb.model == RGBModel {
+		rgbw.W = 0
+	}
+	fb.pixels[i] = rgbw
+}
+
+// SetRGBs sets the RGB pixels to the given values.
+func (fb *FrameBuffer) SetRGBs(pixels []RGB) {
+	if len(pixels) != len(fb.pixels) {
+		panic("SetRGBs called with wrong number of pixels")
+	}
+
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	for i, p := range pixels {
+		fb.pixels[i] = p.ToRGBW(0)
+	}
+}
+
+// SetRGBWs sets the RGBW pixels to the given values.
+func (fb *FrameBuffer) SetRGBWs(pixels []RGBW) {
+	if len(pixels) != len(fb.pixels) {
+		panic("SetRGBWs called with wrong number of pixels")
+	}
+
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	for i, p := range pixels {
+		fb.setRGBWAt(i, p)
+	}
+}
+
+// Fill sets all pixels to the given RGB value, with white off.
+func (fb *FrameBuffer) Fill(rgb RGB) {
+	fb.FillRGBW(rgb.ToRGBW(0))
+}
+
+// FillRGBW sets all pixels to the given RGBW value. With RGBModel, white is
+// ignored.
+func (fb *FrameBuffer) FillRGBW(rgbw RGBW) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	for i := range fb.pixels {
+		fb.setRGBWAt(i, rgbw)
+	}
+}
+
+// Clear sets all pixels to black.
+func (fb *FrameBuffer) Clear() {
+	fb.FillRGBW(RGBW{})
+}
+
+// Shift moves every pixel n places towards the end of the buffer, or -n places
+// towards the start if n is negative. Pixels moved off one end are lost, and
+// the ones left empty at the other end are set to fill (with white off).
+func (fb *FrameBuffer) Shift(n int, fill RGB) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	lo, hi := 0, len(fb.pixels)
+	switch {
+	case n >= len(fb.pixels) || -n >= len(fb.pixels):
+	case n > 0:
+		copy(fb.pixels[n:], fb.pixels)
+		hi = n
+	case n < 0:
+		copy(fb.pixels, fb.pixels[-n:])
+		lo = len(fb.pixels) + n
+	default:
+		return
+	}
+	for i := lo; i < hi; i++ {
+		fb.pixels[i] = fill.ToRGBW(0)
+	}
+}
+
+// Blit copies the pixels to dst, which has to have as many. It doesn't flush
+// dst. If the buffer is RGB, dst gets RGB pixels, so an RGBW strip derives
+// their white as set by its SetWhiteExtraction. If the buffer is RGBW and dst
+// says with a NumColors method that it's RGB, white is dropped. dst may be the
+// buffer itself, or a strip built on it such as a Null.
+func (fb *FrameBuffer) Blit(dst Strip) error {
+	if n := dst.NumPixels(); n != len(fb.pixels) {
+		return fmt.Errorf("blit of %d pixels to strip of %d: %w", len(fb.pixels), n, ErrPixelCountMismatch)
+	}
+	dstRGB := false
+	if d, ok := dst.(interface{ NumColors() int }); ok {
+		dstRGB = d.NumColors() == 3
+	}
+
+	// dst's setters may need fb's lock, so they're only called once it's
+	// released.
+	fb.mu.RLock()
+	pixels := append([]RGBW(nil), fb.pixels...)
+	fb.mu.RUnlock()
+
+	for i, p := range pixels {
+		if fb.model == RGBModel || dstRGB {
+			dst.SetRGBAt(i, p.ToRGB())
+		} else {
+			dst.SetRGBWAt(i, p)
+		}
+	}
+	return nil
+}
+
+// Flush does nothing; use Blit to show the pixels on a strip.
+func (fb *FrameBuffer) Flush() error {
+	return nil
+}
+
+// Close does nothing.
+func (fb *FrameBuffer) Close() error {
+	return nil
+}
+
+// MaxLEDsPerChannel returns the number of pixels in the buffer, since there's
+// no hardware to set a limit.
+func (fb *FrameBuffer) MaxLEDsPerChannel() int {
+	return len(fb.pixels)
+}
@@ -0,0 +1,75 @@
+package ledctl
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFrameBuffer(t *testing.T) {
+	fb := NewFrameBuffer(4, RGBModel)
+	fb.SetRGBWAt(0, RGBW{1, 2, 3, 4})
+	if got, want := fb.RGBWAt(0), (RGBW{1, 2, 3, 0}); got != want {
+		t.Errorf("RGB buffer RGBWAt(0) got %v, want %v", got, want)
+	}
+
+	fb.Fill(RGB{5, 6, 7})
+	fb.Shift(1, RGB{9, 9, 9})
+	fb.Shift(-2, RGB{})
+	for i, want := range []RGB{{5, 6, 7}, {5, 6, 7}, {}, {}} {
+		if got := fb.RGBAt(i); got != want {
+			t.Errorf("after Shift, RGBAt(%d) got %v, want %v", i, got, want)
+		}
+	}
+
+	fb.Clear()
+	for i := 0; i < fb.NumPixels(); i++ {
+		if got := fb.RGBWAt(i); got != (RGBW{}) {
+			t.Errorf("after Clear, RGBWAt(%d) got %v, want black", i, got)
+		}
+	}
+}
+
+func TestFrameBufferBlit(t *testing.T) {
+	tests := []struct {
+		model ColorModel
+		dst   WS281xConfig
+		white WhiteExtraction
+		want  RGBW
+	}{
+		{RGBWModel, WS281xConfig{NumPixels: 2, ColorOrder: GRBWOrder, ColorModel: RGBWModel}, WhiteNone, RGBW{10, 20, 30, 40}},
+		{RGBWModel, WS281xConfig{NumPixels: 2, ColorOrder: GRBOrder, ColorModel: RGBModel}, WhiteNone, RGBW{10, 20, 30, 0}},
+		{RGBModel, WS281xConfig{NumPixels: 2, ColorOrder: GRBWOrder, ColorModel: RGBWModel}, WhiteMin, RGBW{0, 10, 20, 10}},
+		{RGBModel, WS281xConfig{NumPixels: 2, ColorOrder: GRBOrder, ColorModel: RGBModel}, WhiteNone, RGBW{10, 20, 30, 0}},
+	}
+	for _, test := range tests {
+		fb := NewFrameBuffer(2, test.model)
+		fb.SetRGBWAt(1, RGBW{10, 20, 30, 40})
+		dst := testWS281x(test.dst)
+		dst.SetWhiteExtraction(test.white)
+		if err := fb.Blit(dst); err != nil {
+			t.Fatalf("%v into %v: Blit: %v", test.model, test.dst.ColorModel, err)
+		}
+		if got := dst.RGBWAt(1); got != test.want {
+			t.Errorf("%v into %v: RGBWAt(1) got %v, want %v", test.model, test.dst.ColorModel, got, test.want)
+		}
+	}
+
+	fb := NewFrameBuffer(3, RGBModel)
+	if err := fb.Blit(NullStrip(2, 3)); !errors.Is(err, ErrPixelCountMismatch) {
+		t.Errorf("Blit into shorter strip got %v, want ErrPixelCountMismatch", err)
+	}
+
+	// Blitting into itself, or a Null built on it, mustn't deadlock.
+	fb.SetRGBAt(0, RGB{1, 2, 3})
+	if err := fb.Blit(fb); err != nil {
+		t.Errorf("Blit into itself: %v", err)
+	}
+	null := NullStrip(3, 3)
+	null.SetRGBAt(0, RGB{4, 5, 6})
+	if err := null.Blit(null); err != nil {
+		t.Errorf("Blit of a Null into itself: %v", err)
+	}
+	if got, want := null.RGBAt(0), (RGB{4, 5, 6}); got != want {
+		t.Errorf("Null RGBAt(0) after Blit got %v, want %v", got, want)
+	}
+}
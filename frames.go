@@ -0,0 +1,67 @@
+package ledctl
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// FrameWriter is a Strip that can be given whole frames of pixel data at once.
+type FrameWriter interface {
+	Strip
+	// NumColors returns the number of colors per pixel.
+	NumColors() int
+	// WriteFrame replaces all the pixels with data, which has NumColors bytes
+	// per pixel in the strip's color order.
+	WriteFrame(data []byte) error
+}
+
+var (
+	_ FrameWriter = (*WS281x)(nil)
+	_ FrameWriter = (*LPD8806)(nil)
+)
+
+// FrameReader reads frames of NumPixels*NumColors bytes from r, in the
+// strip's color order, and writes and flushes each one as soon as it's read.
+// It returns nil when r reaches EOF at the end of a frame. The strip has to be
+// a FrameWriter.
+func FrameReader(strip Strip, r io.Reader) error {
+	return FrameReaderInterval(strip, r, 0)
+}
+
+// FrameReaderInterval is like FrameReader, but flushes at most one frame per
+// interval, waiting before reading the next one if need be.
+func FrameReaderInterval(strip Strip, r io.Reader, interval time.Duration) error {
+	fw, ok := strip.(FrameWriter)
+	if !ok {
+		return fmt.Errorf("strip %T can't write frames", strip)
+	}
+
+	frame := make([]byte, fw.NumPixels()*fw.NumColors())
+	next := time.Now()
+	for {
+		_, err := io.ReadFull(r, frame)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't read frame: %w", err)
+		}
+
+		if interval > 0 {
+			time.Sleep(time.Until(next))
+			next = next.Add(interval)
+			if now := time.Now(); next.Before(now) {
+				// Don't try to catch up if the reader was slow.
+				next = now
+			}
+		}
+		if err := fw.WriteFrame(frame); err != nil {
+			return err
+		}
+		if err := fw.Flush(); err != nil {
+			return fmt.Errorf("couldn't flush frame: %w", err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package ledctl
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestFrameReader(t *testing.T) {
+	dev := &fakeDevice{}
+	la, err := newLPD8806(LPD8806Config{Device: dev, NumPixels: 2, ColorOrder: RGBOrder, ColorModel: RGBModel}, nil)
+	if err != nil {
+		t.Fatalf("newLPD8806: %v", err)
+	}
+	writes := len(dev.writes)
+
+	frames := []byte{
+		1, 2, 3, 4, 5, 6,
+		7, 8, 9, 10, 11, 12,
+	}
+	if err := FrameReader(la, bytes.NewReader(frames)); err != nil {
+		t.Fatalf("FrameReader: %v", err)
+	}
+	got := dev.writes[writes:]
+	want := [][]byte{
+		{0x81, 0x82, 0x83, 0x84, 0x85, 0x86, 0x00},
+		{0x87, 0x88, 0x89, 0x8A, 0x8B, 0x8C, 0x00},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d flushes, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(got[i], want[i]) {
+			t.Errorf("flush %d wrote % X, want % X", i, got[i], want[i])
+		}
+	}
+}
+
+func TestFrameReaderShortFrame(t *testing.T) {
+	la, err := newLPD8806(LPD8806Config{Device: &fakeDevice{}, NumPixels: 2, ColorModel: RGBModel}, nil)
+	if err != nil {
+		t.Fatalf("newLPD8806: %v", err)
+	}
+	err = FrameReader(la, bytes.NewReader([]byte{1, 2, 3, 4, 5, 6, 7}))
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("FrameReader got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestFrameReaderInterval(t *testing.T) {
+	la, err := newLPD8806(LPD8806Config{Device: &fakeDevice{}, NumPixels: 1, ColorModel: RGBModel}, nil)
+	if err != nil {
+		t.Fatalf("newLPD8806: %v", err)
+	}
+	start := time.Now()
+	if err := FrameReaderInterval(la, bytes.NewReader(make([]byte, 3*3)), 20*time.Millisecond); err != nil {
+		t.Fatalf("FrameReaderInterval: %v", err)
+	}
+	// The first frame goes out straight away, then one every interval.
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("3 frames took %v, want at least 40ms", elapsed)
+	}
+}
+
+func TestFrameReaderNotFrameWriter(t *testing.T) {
+	ts, err := NewTermStrip(TermStripConfig{Writer: io.Discard, NumPixels: 1})
+	if err != nil {
+		t.Fatalf("NewTermStrip: %v", err)
+	}
+	if err := FrameReader(ts, bytes.NewReader(nil)); err == nil {
+		t.Errorf("FrameReader on a TermStrip succeeded, want error")
+	}
+}
@@ -2,6 +2,9 @@ module github.com/mxcu/ledctl
 
 go 1.17
 
-require github.com/edsrzf/mmap-go v1.0.0
+require (
+	github.com/edsrzf/mmap-go v1.0.0
+	golang.org/x/image v0.5.0
+)
 
-require golang.org/x/sys v0.0.0-20201231184435-2d18734c6014 // indirect
+require golang.org/x/sys v0.0.0-20220722155257-8c9f86f7a55f // indirect
@@ -0,0 +1,25 @@
+package ledctl
+
+import (
+	"fmt"
+	"image"
+)
+
+// sampleImageRow returns n colors sampled evenly across row y of img, counting
+// from the top of its bounds, taking the middle of each of n equal parts of
+// the row.
+func sampleImageRow(img image.Image, y, n int) ([]RGB, error) {
+	b := img.Bounds()
+	if y < 0 || y >= b.Dy() {
+		return nil, fmt.Errorf("row %d not in [0, %d): %w", y, b.Dy(), ErrIndexOutOfRange)
+	}
+	if b.Dx() == 0 {
+		return nil, fmt.Errorf("image has no columns")
+	}
+	colors := make([]RGB, n)
+	for i := range colors {
+		x := b.Min.X + (2*i+1)*b.Dx()/(2*n)
+		colors[i] = rgbModel(img.At(x, b.Min.Y+y)).(RGB)
+	}
+	return colors, nil
+}
@@ -0,0 +1,57 @@
+package ledctl
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestSetFromImageRow(t *testing.T) {
+	// A gradient from left to right in red and blue, and top to bottom in
+	// green, offset so that the bounds don't start at (0, 0).
+	img := image.NewRGBA(image.Rect(10, 20, 18, 22))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 8; x++ {
+			img.Set(10+x, 20+y, color.RGBA{uint8(x * 32), uint8(y * 100), uint8(255 - x*32), 255})
+		}
+	}
+
+	ws := testWS281x(WS281xConfig{NumPixels: 4, ColorOrder: GRBOrder, ColorModel: RGBModel})
+	if err := ws.SetFromImageRow(img, 1); err != nil {
+		t.Fatalf("SetFromImageRow: %v", err)
+	}
+	for i, want := range []RGB{{32, 100, 223}, {96, 100, 159}, {160, 100, 95}, {224, 100, 31}} {
+		if got := ws.RGBAt(i); got != want {
+			t.Errorf("RGBAt(%d) got %v, want %v", i, got, want)
+		}
+	}
+
+	for _, row := range []int{-1, 2} {
+		if err := ws.SetFromImageRow(img, row); !errors.Is(err, ErrIndexOutOfRange) {
+			t.Errorf("SetFromImageRow(%d) got %v, want ErrIndexOutOfRange", row, err)
+		}
+	}
+}
+
+func TestLPD8806SetFromImageRow(t *testing.T) {
+	// A full-range gradient in red, which the strip's 7 bits have to halve
+	// rather than wrap.
+	img := image.NewRGBA(image.Rect(0, 0, 8, 1))
+	for x := 0; x < 8; x++ {
+		img.Set(x, 0, color.RGBA{uint8(x*32 + 31), 0, 0, 255})
+	}
+
+	la, err := newLPD8806(LPD8806Config{Device: &fakeDevice{}, NumPixels: 8, ColorModel: RGBModel}, nil)
+	if err != nil {
+		t.Fatalf("newLPD8806: %v", err)
+	}
+	if err := la.SetFromImageRow(img, 0); err != nil {
+		t.Fatalf("SetFromImageRow: %v", err)
+	}
+	for i := 0; i < 8; i++ {
+		if got, want := la.RGBAt(i), (RGB{R: uint8(i*16 + 15)}); got != want {
+			t.Errorf("RGBAt(%d) got %v, want %v", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package ledctl
+
+import (
+	"fmt"
+
+	rpi "github.com/mxcu/ledctl/rpi"
+)
+
+// APA102 controls an APA102 (DotStar) or SK9822 LED strip.
+type APA102 struct {
+	rp         *rpi.RPi
+	dev        Device
+	buffer     []byte
+	pixels     []byte
+	numPixels  int
+	brightness uint8
+	g          int
+	r          int
+	b          int
+}
+
+// APA102Config is the configuration for an APA102 or SK9822 LED strip.
+type APA102Config struct {
+	// Device is the SPI device to use. Usually, this is "/dev/spidev0.0".
+	// It isn't included in JSON.
+	Device Device `json:"-"`
+	// NumPixels is the number of pixels in the strip.
+	NumPixels int
+	// SPISpeed is the speed to use for the SPI. If zero, the current speed of
+	// the device is left alone.
+	SPISpeed uint32
+	// ColorOrder is the color order of the pixels. This is usually BGR for
+	// APA102s. Only 3-color orders are supported.
+	ColorOrder ColorOrder
+	// Brightness is the 5-bit global brightness (0-31) sent with every pixel.
+	// If zero, full brightness (31) is used.
+	Brightness uint8
+}
+
+const (
+	apa102StartFrameLen = 4
+	apa102PixelLen      = 4
+	apa102PixelHeader   = 0xE0
+	apa102MaxBrightness = 0x1F
+)
+
+// NewAPA102 creates a new APA102 LED strip controller.
+func NewAPA102(config APA102Config) (*APA102, error) {
+	rp, err := rpi.NewRPi()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't make RPi: %w", err)
+	}
+	return newAPA102(config, rp)
+}
+
+func newAPA102(config APA102Config, rp *rpi.RPi) (*APA102, error) {
+	offsets := offsets[config.ColorOrder]
+	if len(offsets) == 0 || offsets[3] != -1 {
+		return nil, fmt.Errorf("unsupported color order %v for APA102", config.ColorOrder)
+	}
+	brightness := config.Brightness
+	if brightness == 0 {
+		brightness = apa102MaxBrightness
+	}
+	if brightness > apa102MaxBrightness {
+		return nil, fmt.Errorf("brightness %d out of range 0-%d", brightness, apa102MaxBrightness)
+	}
+
+	// The end frame needs to clock out at least one extra bit for every two
+	// pixels, since each pixel delays the data by half a clock. SK9822s also
+	// want a full 32 bits, so that's the minimum.
+	numEnd := (config.NumPixels + 15) / 16
+	if numEnd < 4 {
+		numEnd = 4
+	}
+	numData := config.NumPixels * apa102PixelLen
+	buf := make([]byte, apa102StartFrameLen+numData+numEnd)
+	for i := apa102StartFrameLen; i < apa102StartFrameLen+numData; i += apa102PixelLen {
+		buf[i] = apa102PixelHeader | brightness
+	}
+	for i := apa102StartFrameLen + numData; i < len(buf); i++ {
+		buf[i] = 0xFF
+	}
+
+	ap := APA102{
+		rp:         rp,
+		dev:        config.Device,
+		buffer:     buf,
+		pixels:     buf[apa102StartFrameLen : apa102StartFrameLen+numData],
+		numPixels:  config.NumPixels,
+		brightness: brightness,
+		g:          offsets[0] + 1,
+		r:          offsets[1] + 1,
+		b:          offsets[2] + 1,
+	}
+
+	if config.SPISpeed != 0 {
+		err := setSPISpeed(rp, ap.dev.Fd(), config.SPISpeed)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &ap, nil
+}
+
+// Close does nothing.
+func (ap *APA102) Close() error {
+	return nil
+}
+
+// RPi returns the RPi object used to control the SPI.
+func (ap *APA102) RPi() *rpi.RPi {
+	return ap.rp
+}
+
+// NumPixels returns the number of pixels in the strip.
+func (ap *APA102) NumPixels() int {
+	return ap.numPixels
+}
+
+// MaxLEDsPerChannel returns the maximum number of LEDs per channel.
+func (ap *APA102) MaxLEDsPerChannel() int {
+	return 255
+}
+
+// Flush flushes the pixels to the LED strip.
+func (ap *APA102) Flush() error {
+	_, err := ap.dev.Write(ap.buffer)
+	return err
+}
+
+// RGBWAt returns the RGBW pixel at the given index. APA102s have no white
+// channel, so white is always zero.
+func (ap *APA102) RGBWAt(i int) RGBW {
+	rgb := ap.RGBAt(i)
+	return RGBW{rgb.R, rgb.G, rgb.B, 0}
+}
+
+// SetRGBWAt sets the RGBW pixel at the given index to the given value. APA102s
+// have no white channel, so white is ignored.
+func (ap *APA102) SetRGBWAt(i int, rgbw RGBW) {
+	ap.SetRGBAt(i, RGB{rgbw.R, rgbw.G, rgbw.B})
+}
+
+// SetRGBWs sets the RGBW pixels to the given values. APA102s have no white
+// channel, so white is ignored.
+func (ap *APA102) SetRGBWs(pixels []RGBW) {
+	if len(pixels) != ap.numPixels {
+		panic("SetRGBWs called with wrong number of pixels")
+	}
+
+	for i, p := range pixels {
+		ap.SetRGBAt(i, RGB{p.R, p.G, p.B})
+	}
+}
+
+// SetRGBWsErr is like SetRGBWs, but returns ErrPixelCountMismatch instead of panicking.
+func (ap *APA102) SetRGBWsErr(pixels []RGBW) error {
+	if len(pixels) != ap.numPixels {
+		return fmt.Errorf("SetRGBWs called with %d pixels, want %d: %w", len(pixels), ap.numPixels, ErrPixelCountMismatch)
+	}
+	ap.SetRGBWs(pixels)
+	return nil
+}
+
+// RGBAt returns the RGB pixel at the given index.
+func (ap *APA102) RGBAt(i int) RGB {
+	o := i * apa102PixelLen
+	return RGB{
+		ap.pixels[o+ap.r],
+		ap.pixels[o+ap.g],
+		ap.pixels[o+ap.b],
+	}
+}
+
+// SetRGBAt sets the RGB pixel at the given index to the given value.
+func (ap *APA102) SetRGBAt(i int, rgb RGB) {
+	o := i * apa102PixelLen
+	ap.pixels[o+ap.r] = rgb.R
+	ap.pixels[o+ap.g] = rgb.G
+	ap.pixels[o+ap.b] = rgb.B
+}
+
+// RGBAtChecked is like RGBAt, but returns ErrIndexOutOfRange if i is outside
+// the strip.
+func (ap *APA102) RGBAtChecked(i int) (RGB, error) {
+	if err := checkIndex(i, ap.numPixels); err != nil {
+		return RGB{}, err
+	}
+	return ap.RGBAt(i), nil
+}
+
+// SetRGBAtChecked is like SetRGBAt, but returns ErrIndexOutOfRange if i is
+// outside the strip.
+func (ap *APA102) SetRGBAtChecked(i int, rgb RGB) error {
+	if err := checkIndex(i, ap.numPixels); err != nil {
+		return err
+	}
+	ap.SetRGBAt(i, rgb)
+	return nil
+}
+
+// SetRGBs sets the RGB pixels to the given values.
+func (ap *APA102) SetRGBs(pixels []RGB) {
+	if len(pixels) != ap.numPixels {
+		panic("SetRGBs called with wrong number of pixels")
+	}
+
+	for i, p := range pixels {
+		ap.SetRGBAt(i, p)
+	}
+}
+
+// SetRGBsErr is like SetRGBs, but returns ErrPixelCountMismatch instead of panicking.
+func (ap *APA102) SetRGBsErr(pixels []RGB) error {
+	if len(pixels) != ap.numPixels {
+		return fmt.Errorf("SetRGBs called with %d pixels, want %d: %w", len(pixels), ap.numPixels, ErrPixelCountMismatch)
+	}
+	ap.SetRGBs(pixels)
+	return nil
+}
@@ -0,0 +1,69 @@
+package ledctl
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAPA102Flush(t *testing.T) {
+	dev := &fakeDevice{}
+	ap, err := newAPA102(APA102Config{
+		Device:     dev,
+		NumPixels:  3,
+		ColorOrder: BGROrder,
+		Brightness: 7,
+	}, nil)
+	if err != nil {
+		t.Fatalf("newAPA102: %v", err)
+	}
+
+	ap.SetRGBs([]RGB{{0x11, 0x22, 0x33}, {0x44, 0x55, 0x66}, {0x77, 0x88, 0x99}})
+	if err := ap.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	want := []byte{
+		0x00, 0x00, 0x00, 0x00, // start frame
+		0xE7, 0x33, 0x22, 0x11,
+		0xE7, 0x66, 0x55, 0x44,
+		0xE7, 0x99, 0x88, 0x77,
+		0xFF, 0xFF, 0xFF, 0xFF, // end frame
+	}
+	if got := dev.last(); !bytes.Equal(got, want) {
+		t.Errorf("Flush wrote % X, want % X", got, want)
+	}
+	if got, want := ap.RGBAt(1), (RGB{0x44, 0x55, 0x66}); got != want {
+		t.Errorf("RGBAt(1) got %v, want %v", got, want)
+	}
+}
+
+func TestAPA102Config(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  APA102Config
+		wantErr bool
+		wantLen int
+	}{
+		{"default brightness", APA102Config{NumPixels: 1}, false, 4 + 4 + 4},
+		{"long strip end frame", APA102Config{NumPixels: 100}, false, 4 + 400 + 7},
+		{"RGBW order", APA102Config{NumPixels: 1, ColorOrder: GRBWOrder}, true, 0},
+		{"brightness too high", APA102Config{NumPixels: 1, Brightness: 32}, true, 0},
+	}
+
+	for _, test := range tests {
+		ap, err := newAPA102(test.config, nil)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: got err %v, wantErr %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if len(ap.buffer) != test.wantLen {
+			t.Errorf("%s: got buffer length %d, want %d", test.name, len(ap.buffer), test.wantLen)
+		}
+		if ap.buffer[4] != 0xFF {
+			t.Errorf("%s: got pixel header %02X, want FF", test.name, ap.buffer[4])
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package ledctl
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	rpi "github.com/mxcu/ledctl/rpi"
+)
+
+// LPD6803 controls an LPD6803 LED strip. LPD6803s only have 5 bits per
+// color, so the colors are quantized when they're sent.
+type LPD6803 struct {
+	rp        *rpi.RPi
+	dev       Device
+	buffer    []byte
+	pixels    []RGB
+	numPixels int
+	g         uint
+	r         uint
+	b         uint
+}
+
+// LPD6803Config is the configuration for an LPD6803 LED strip.
+type LPD6803Config struct {
+	// Device is the SPI device to use. Usually, this is "/dev/spidev0.0".
+	// It isn't included in JSON.
+	Device Device `json:"-"`
+	// NumPixels is the number of pixels in the strip.
+	NumPixels int
+	// SPISpeed is the speed to use for the SPI. If zero, the current speed of
+	// the device is left alone.
+	SPISpeed uint32
+	// ColorOrder is the order of the three 5-bit colors in each pixel, from
+	// the most significant. This is usually GRB. Only 3-color orders are
+	// supported.
+	ColorOrder ColorOrder
+}
+
+const (
+	lpd6803StartFrameLen = 4
+	lpd6803PixelLen      = 2
+	lpd6803PixelFlag     = 0x8000
+)
+
+// NewLPD6803 creates a new LPD6803 LED strip controller.
+func NewLPD6803(config LPD6803Config) (*LPD6803, error) {
+	rp, err := rpi.NewRPi()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't make RPi: %w", err)
+	}
+	return newLPD6803(config, rp)
+}
+
+func newLPD6803(config LPD6803Config, rp *rpi.RPi) (*LPD6803, error) {
+	offsets := offsets[config.ColorOrder]
+	if len(offsets) == 0 || offsets[3] != -1 {
+		return nil, fmt.Errorf("unsupported color order %v for LPD6803", config.ColorOrder)
+	}
+
+	// After the start frame of 32 zero bits, the pixels need one more clock
+	// pulse each to latch the data, so the end frame has a bit per pixel.
+	numEnd := (config.NumPixels + 7) / 8
+	if numEnd < 4 {
+		numEnd = 4
+	}
+	numData := config.NumPixels * lpd6803PixelLen
+
+	ld := LPD6803{
+		rp:        rp,
+		dev:       config.Device,
+		buffer:    make([]byte, lpd6803StartFrameLen+numData+numEnd),
+		pixels:    make([]RGB, config.NumPixels),
+		numPixels: config.NumPixels,
+		g:         uint(10 - 5*offsets[0]),
+		r:         uint(10 - 5*offsets[1]),
+		b:         uint(10 - 5*offsets[2]),
+	}
+
+	if config.SPISpeed != 0 {
+		err := setSPISpeed(rp, ld.dev.Fd(), config.SPISpeed)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &ld, nil
+}
+
+// Close does nothing.
+func (ld *LPD6803) Close() error {
+	return nil
+}
+
+// RPi returns the RPi object used to control the SPI.
+func (ld *LPD6803) RPi() *rpi.RPi {
+	return ld.rp
+}
+
+// NumPixels returns the number of pixels in the strip.
+func (ld *LPD6803) NumPixels() int {
+	return ld.numPixels
+}
+
+// MaxLEDsPerChannel returns the maximum number of LEDs per channel.
+func (ld *LPD6803) MaxLEDsPerChannel() int {
+	return 255
+}
+
+// pack returns the 16 bits that send rgb: the flag bit, then the top 5 bits
+// of each color.
+func (ld *LPD6803) pack(rgb RGB) uint16 {
+	return lpd6803PixelFlag |
+		uint16(rgb.G>>3)<<ld.g |
+		uint16(rgb.R>>3)<<ld.r |
+		uint16(rgb.B>>3)<<ld.b
+}
+
+// Flush flushes the pixels to the LED strip.
+func (ld *LPD6803) Flush() error {
+	data := ld.buffer[lpd6803StartFrameLen:]
+	for i, p := range ld.pixels {
+		binary.BigEndian.PutUint16(data[i*lpd6803PixelLen:], ld.pack(p))
+	}
+	_, err := ld.dev.Write(ld.buffer)
+	return err
+}
+
+// RGBWAt returns the RGBW pixel at the given index. LPD6803s have no white
+// channel, so white is always zero.
+func (ld *LPD6803) RGBWAt(i int) RGBW {
+	rgb := ld.RGBAt(i)
+	return RGBW{rgb.R, rgb.G, rgb.B, 0}
+}
+
+// SetRGBWAt sets the RGBW pixel at the given index to the given value.
+// LPD6803s have no white channel, so white is ignored.
+func (ld *LPD6803) SetRGBWAt(i int, rgbw RGBW) {
+	ld.SetRGBAt(i, RGB{rgbw.R, rgbw.G, rgbw.B})
+}
+
+// SetRGBWs sets the RGBW pixels to the given values. LPD6803s have no white
+// channel, so white is ignored.
+func (ld *LPD6803) SetRGBWs(pixels []RGBW) {
+	if len(pixels) != ld.numPixels {
+		panic("SetRGBWs called with wrong number of pixels")
+	}
+
+	for i, p := range pixels {
+		ld.SetRGBAt(i, RGB{p.R, p.G, p.B})
+	}
+}
+
+// SetRGBWsErr is like SetRGBWs, but returns ErrPixelCountMismatch instead of panicking.
+func (ld *LPD6803) SetRGBWsErr(pixels []RGBW) error {
+	if len(pixels) != ld.numPixels {
+		return fmt.Errorf("SetRGBWs called with %d pixels, want %d: %w", len(pixels), ld.numPixels, ErrPixelCountMismatch)
+	}
+	ld.SetRGBWs(pixels)
+	return nil
+}
+
+// RGBAt returns the RGB pixel at the given index, as it was set rather than
+// as quantized.
+func (ld *LPD6803) RGBAt(i int) RGB {
+	return ld.pixels[i]
+}
+
+// SetRGBAt sets the RGB pixel at the given index to the given value.
+func (ld *LPD6803) SetRGBAt(i int, rgb RGB) {
+	ld.pixels[i] = rgb
+}
+
+// RGBAtChecked is like RGBAt, but returns ErrIndexOutOfRange if i is outside
+// the strip.
+func (ld *LPD6803) RGBAtChecked(i int) (RGB, error) {
+	if err := checkIndex(i, ld.numPixels); err != nil {
+		return RGB{}, err
+	}
+	return ld.RGBAt(i), nil
+}
+
+// SetRGBAtChecked is like SetRGBAt, but returns ErrIndexOutOfRange if i is
+// outside the strip.
+func (ld *LPD6803) SetRGBAtChecked(i int, rgb RGB) error {
+	if err := checkIndex(i, ld.numPixels); err != nil {
+		return err
+	}
+	ld.SetRGBAt(i, rgb)
+	return nil
+}
+
+// SetRGBs sets the RGB pixels to the given values.
+func (ld *LPD6803) SetRGBs(pixels []RGB) {
+	if len(pixels) != ld.numPixels {
+		panic("SetRGBs called with wrong number of pixels")
+	}
+
+	copy(ld.pixels, pixels)
+}
+
+// SetRGBsErr is like SetRGBs, but returns ErrPixelCountMismatch instead of panicking.
+func (ld *LPD6803) SetRGBsErr(pixels []RGB) error {
+	if len(pixels) != ld.numPixels {
+		return fmt.Errorf("SetRGBs called with %d pixels, want %d: %w", len(pixels), ld.numPixels, ErrPixelCountMismatch)
+	}
+	ld.SetRGBs(pixels)
+	return nil
+}
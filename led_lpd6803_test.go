@@ -0,0 +1,58 @@
+package ledctl
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLPD6803Pack(t *testing.T) {
+	ld, err := newLPD6803(LPD6803Config{Device: &fakeDevice{}, NumPixels: 1}, nil)
+	if err != nil {
+		t.Fatalf("newLPD6803: %v", err)
+	}
+	tests := []struct {
+		rgb  RGB
+		want uint16
+	}{
+		{RGB{}, 0x8000},
+		{RGB{255, 255, 255}, 0xFFFF},
+		{RGB{R: 255}, 0x83E0},
+		{RGB{G: 255}, 0xFC00},
+		{RGB{B: 255}, 0x801F},
+		{RGB{R: 0x07, G: 0x08, B: 0x10}, 0x8402}, // R rounds down to 0
+	}
+	for _, test := range tests {
+		if got := ld.pack(test.rgb); got != test.want {
+			t.Errorf("pack(%v) got %04X, want %04X", test.rgb, got, test.want)
+		}
+	}
+}
+
+func TestLPD6803Flush(t *testing.T) {
+	dev := &fakeDevice{}
+	ld, err := newLPD6803(LPD6803Config{Device: dev, NumPixels: 2, ColorOrder: RGBOrder}, nil)
+	if err != nil {
+		t.Fatalf("newLPD6803: %v", err)
+	}
+	ld.SetRGBs([]RGB{{R: 255}, {B: 0x80}})
+	if err := ld.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	want := []byte{
+		0x00, 0x00, 0x00, 0x00, // start frame
+		0xFC, 0x00,
+		0x80, 0x10,
+		0x00, 0x00, 0x00, 0x00, // end frame
+	}
+	if got := dev.last(); !bytes.Equal(got, want) {
+		t.Errorf("Flush wrote % X, want % X", got, want)
+	}
+	if got, want := ld.RGBAt(1), (RGB{B: 0x80}); got != want {
+		t.Errorf("RGBAt(1) got %v, want %v", got, want)
+	}
+
+	if _, err := newLPD6803(LPD6803Config{NumPixels: 1, ColorOrder: GRBWOrder}, nil); err == nil {
+		t.Errorf("newLPD6803 with RGBW order succeeded, want error")
+	}
+}
@@ -1,29 +1,60 @@
 package ledctl
 
 import (
+	"bytes"
 	"fmt"
+	"image"
+	"sync"
+	"time"
 
 	rpi "github.com/mxcu/ledctl/rpi"
 )
 
 // LPD8806 controls an LPD8806 LED strip.
+//
+// All of its methods are safe to call from multiple goroutines at once: the
+// setters, Flush and Close take an exclusive lock, and the getters a shared
+// one.
 type LPD8806 struct {
-	rp        *rpi.RPi
-	dev       Device
-	pixels    []byte
-	buffer    []byte
-	numColors int
-	numPixels int
-	g         int
-	r         int
-	b         int
-	w         int
+	mu         sync.RWMutex
+	rp         *rpi.RPi
+	dev        Device
+	pixels     []byte
+	buffer     []byte
+	numColors  int
+	numPixels  int
+	brightness uint8
+	gamma      float64
+	correction ColorCorrection
+	gammaTable [256]uint8
+	outTable   [256]uint8
+	outB       uint8
+	outOK      bool
+	white      WhiteExtraction
+	reversed   bool
+	powerLimit float64
+	encodedB   uint8
+	floor      uint8
+	caps       [4]uint8
+	dither     []uint8
+	dirty      dirtyRange
+	skip       bool
+	lastSent   []byte
+	sentOK     bool
+	skipped    int
+	observer   func(FlushStats)
+	closed     bool
+	g          int
+	r          int
+	b          int
+	w          int
 }
 
 // LPD8806Config is the configuration for an LPD8806 LED strip.
 type LPD8806Config struct {
 	// Device is the SPI device to use. Usually, this is "/dev/spidev0.0".
-	Device Device
+	// It isn't included in JSON.
+	Device Device `json:"-"`
 	// NumPixels is the number of pixels in the strip.
 	NumPixels int
 	// SPISpeed is the speed to use for the SPI. This is usually 12000000.
@@ -37,45 +68,78 @@ type LPD8806Config struct {
 
 // NewLPD8806 creates a new LPD8806 LED strip controller.
 func NewLPD8806(config LPD8806Config) (*LPD8806, error) {
-	numReset := (config.NumPixels + 31) / 32
-	val := make([]byte, config.NumPixels*config.ColorModel.NumColors()+numReset)
-	offsets := offsets[config.ColorOrder]
-
 	rp, err := rpi.NewRPi()
 	if err != nil {
-		return nil, fmt.Errorf("couldn't make RPi: %v", err)
+		return nil, fmt.Errorf("couldn't make RPi: %w", err)
+	}
+	return newLPD8806(config, rp)
+}
+
+// NewLPD8806WithRPi is like NewLPD8806, but uses rp instead of making its own
+// RPi, so that it can share one with other controllers. Close never frees rp.
+func NewLPD8806WithRPi(rp *rpi.RPi, config LPD8806Config) (*LPD8806, error) {
+	return newLPD8806(config, rp)
+}
+
+func newLPD8806(config LPD8806Config, rp *rpi.RPi) (*LPD8806, error) {
+	if err := checkOrderModel(config.ColorOrder, config.ColorModel); err != nil {
+		return nil, err
 	}
 
+	numReset := (config.NumPixels + 31) / 32
+	numBytes := config.NumPixels * config.ColorModel.NumColors()
+	offsets := offsets[config.ColorOrder]
+
 	la := LPD8806{
-		rp:        rp,
-		dev:       config.Device,
-		pixels:    val[:config.NumPixels*config.ColorModel.NumColors()],
-		buffer:    val,
-		numColors: config.ColorModel.NumColors(),
-		numPixels: config.NumPixels,
-		g:         offsets[0],
-		r:         offsets[1],
-		b:         offsets[2],
-		w:         offsets[3],
+		rp:         rp,
+		dev:        config.Device,
+		pixels:     make([]byte, numBytes),
+		buffer:     make([]byte, numBytes+numReset),
+		numColors:  config.ColorModel.NumColors(),
+		numPixels:  config.NumPixels,
+		brightness: 255,
+		caps:       [4]uint8{255, 255, 255, 255},
+		gamma:      1,
+		gammaTable: makeGamma7Table(makeGammaTable(1)),
+		dirty:      dirtyRange{0, config.NumPixels},
+		g:          offsets[0],
+		r:          offsets[1],
+		b:          offsets[2],
+		w:          offsets[3],
 	}
 
 	if config.SPISpeed != 0 {
-		err := rp.SetSPISpeed(la.dev.Fd(), config.SPISpeed)
+		err := setSPISpeed(rp, la.dev.Fd(), config.SPISpeed)
 		if err != nil {
-			return nil, fmt.Errorf("couldn't set SPI speed: %v", err)
+			return nil, err
 		}
 	}
 
 	firstReset := make([]byte, numReset)
-	_, err = la.dev.Write(firstReset)
+	_, err := la.dev.Write(firstReset)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't reset: %v", err)
+		return nil, fmt.Errorf("couldn't reset: %w", err)
 	}
 	return &la, nil
 }
 
-// Close does nothing.
+// Close turns all the LEDs off, so that they don't stay lit after the program
+// stops. The stored pixels are left alone. Closing it again does nothing.
 func (la *LPD8806) Close() error {
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	if la.closed {
+		return nil
+	}
+	la.closed = true
+	blank := make([]byte, len(la.buffer))
+	for i := range la.pixels {
+		blank[i] = 0x80
+	}
+	if _, err := la.dev.Write(blank); err != nil {
+		return fmt.Errorf("couldn't blank strip: %w", err)
+	}
 	return nil
 }
 
@@ -91,37 +155,679 @@ func (la *LPD8806) MaxLEDsPerChannel() int {
 
 // Flush flushes the pixels to the LED strip.
 func (la *LPD8806) Flush() error {
-	_, err := la.dev.Write(la.buffer)
-	return err
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	stats := FlushStats{PixelsChanged: la.dirty.size()}
+	start := time.Now()
+	la.encode(0, la.numPixels)
+	stats.EncodeDuration = time.Since(start)
+	la.dirty.reset()
+	return la.send(stats)
+}
+
+// FlushPartial is like Flush, but only re-encodes the pixels that have been
+// changed since the last flush. The whole strip is still written.
+func (la *LPD8806) FlushPartial() error {
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	if la.dither != nil {
+		// Dithered pixels change from frame to frame even when they weren't set.
+		la.dirty.markAll(la.numPixels)
+	} else if la.powerLimit > 0 && la.outputBrightness() != la.encodedB {
+		// The power limit moved the brightness, so every pixel changes.
+		la.dirty.markAll(la.numPixels)
+	}
+	stats := FlushStats{PixelsChanged: la.dirty.size()}
+	start := time.Now()
+	la.encode(la.dirty.lo, la.dirty.hi)
+	stats.EncodeDuration = time.Since(start)
+	la.dirty.reset()
+	return la.send(stats)
+}
+
+// send writes the frame just encoded, unless it's skipped, then tells the
+// observer about the flush.
+func (la *LPD8806) send(stats FlushStats) error {
+	if la.unchanged() {
+		stats.Skipped = true
+	} else {
+		start := time.Now()
+		if _, err := la.dev.Write(la.buffer); err != nil {
+			// Part of the frame may have got through, so nothing can be
+			// skipped until a whole one has.
+			la.sentOK = false
+			return err
+		}
+		stats.TransmitDuration = time.Since(start)
+		la.remember()
+	}
+	if la.observer != nil {
+		la.observer(stats)
+	}
+	return nil
+}
+
+// SetFlushObserver sets a function to be called at the end of every
+// successful flush, with what it did and how long it took. The controller is
+// locked while it's called, so it mustn't call the controller's methods. nil
+// removes it.
+func (la *LPD8806) SetFlushObserver(observer func(FlushStats)) {
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	la.observer = observer
+}
+
+// SetSkipUnchanged sets whether flushes that would write exactly the same
+// frame as the last one skip writing it. It's off by default, so that every
+// flush takes the same time.
+func (la *LPD8806) SetSkipUnchanged(on bool) {
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	la.skip = on
+	la.lastSent = nil
+	la.sentOK = false
+}
+
+// SkipUnchanged returns whether SetSkipUnchanged turned skipping on.
+func (la *LPD8806) SkipUnchanged() bool {
+	la.mu.RLock()
+	defer la.mu.RUnlock()
+
+	return la.skip
+}
+
+// SkippedFlushes returns how many flushes have been skipped because nothing
+// changed.
+func (la *LPD8806) SkippedFlushes() int {
+	la.mu.RLock()
+	defer la.mu.RUnlock()
+
+	return la.skipped
+}
+
+// unchanged returns whether the frame just encoded should be skipped, because
+// skipping is on and it's the same as the last one written.
+func (la *LPD8806) unchanged() bool {
+	if la.skip && la.sentOK && bytes.Equal(la.buffer, la.lastSent) {
+		la.skipped++
+		return true
+	}
+	return false
+}
+
+// remember records the frame just written, for unchanged to compare the next
+// one with.
+func (la *LPD8806) remember() {
+	if la.skip {
+		la.lastSent = append(la.lastSent[:0], la.buffer...)
+		la.sentOK = true
+	}
+}
+
+// encode copies the pixels [lo, hi) into the output buffer, applying the gamma
+// and brightness on the way. The reset bytes at the end of the buffer stay
+// zero.
+func (la *LPD8806) encode(lo, hi int) {
+	brightness := la.outputBrightness()
+	la.encodedB = brightness
+	floor := la.floor
+	if floor > 0x7F {
+		floor = 0x7F
+	}
+	outTable := la.outputTable(brightness)
+	for i := lo * la.numColors; i < hi*la.numColors; i++ {
+		in := la.pixels[i] & 0x7F
+		var v uint8
+		if la.dither != nil {
+			v = ditherBrightness(la.gamma7(in), brightness, &la.dither[i])
+		} else {
+			v = outTable[in]
+		}
+		c := la.caps[i%la.numColors]
+		if c != 255 {
+			v = scaleBrightness(v, c)
+		}
+		// A cap of 0 turns the channel off, which the floor mustn't undo.
+		la.buffer[i] = 0x80 | applyFloor(v, floor, in != 0 && c != 0, brightness)
+	}
+}
+
+// makeGamma7Table returns the gamma table for 7-bit values: each of the first
+// 128 entries widens its index to 8 bits for table, then narrows the result
+// again. The rest are 0.
+func makeGamma7Table(table [256]uint8) [256]uint8 {
+	var t7 [256]uint8
+	for v := range t7[:0x80] {
+		t7[v] = table[v<<1|v>>6] >> 1
+	}
+	return t7
+}
+
+// gamma7 applies the gamma to a 7-bit value.
+func (la *LPD8806) gamma7(v uint8) uint8 {
+	return la.gammaTable[v]
+}
+
+// outputTable returns the table that applies the gamma and brightness to a
+// 7-bit channel in one lookup, remaking it if either has changed since it was
+// made.
+func (la *LPD8806) outputTable(brightness uint8) *[256]uint8 {
+	if !la.outOK || la.outB != brightness {
+		la.outTable = makeOutputTable(&la.gammaTable, brightness)
+		la.outB = brightness
+		la.outOK = true
+	}
+	return &la.outTable
+}
+
+// Pixels returns the pixel buffer, with NumColors bytes per pixel in the
+// strip's color order. It's the live buffer, not a copy, so changes to it show
+// up in the next Flush. They aren't seen by FlushPartial, and aren't protected
+// by the controller's lock.
+// LPD8806s only have 7 bits per color; the top bit of each byte is ignored.
+func (la *LPD8806) Pixels() []byte {
+	return la.pixels
+}
+
+// NumPixels returns the number of pixels in the strip.
+func (la *LPD8806) NumPixels() int {
+	return la.numPixels
+}
+
+// NumColors returns the number of colors per pixel.
+func (la *LPD8806) NumColors() int {
+	return la.numColors
+}
+
+// WriteFrame replaces all the pixels with data, which must have NumColors
+// bytes per pixel, already in the strip's color order. Only the bottom 7 bits
+// of each byte are used. Like the other setters, it doesn't flush.
+func (la *LPD8806) WriteFrame(data []byte) error {
+	if len(data) != len(la.pixels) {
+		return fmt.Errorf("frame has %d bytes, want %d: %w", len(data), len(la.pixels), ErrPixelCountMismatch)
+	}
+
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	for i, v := range data {
+		la.pixels[i] = 0x80 | v
+	}
+	la.dirty.markAll(la.numPixels)
+	return nil
+}
+
+// Snapshot returns a copy of the pixels, which can be given to Restore later.
+func (la *LPD8806) Snapshot() []byte {
+	la.mu.RLock()
+	defer la.mu.RUnlock()
+
+	return append([]byte(nil), la.pixels...)
+}
+
+// Restore sets the pixels back to a copy returned by Snapshot. Like the other
+// setters, it doesn't flush.
+func (la *LPD8806) Restore(snapshot []byte) error {
+	if len(snapshot) != len(la.pixels) {
+		return fmt.Errorf("snapshot has %d bytes, want %d: %w", len(snapshot), len(la.pixels), ErrPixelCountMismatch)
+	}
+
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	copy(la.pixels, snapshot)
+	la.dirty.markAll(la.numPixels)
+	return nil
+}
+
+// Segment returns a view of length pixels starting at start, which can be
+// used like a strip of its own.
+func (la *LPD8806) Segment(start, length int) (*Segment, error) {
+	return NewSegment(la, start, length)
+}
+
+// SetBrightness sets the brightness that all pixels are scaled by when they're
+// flushed, where 255 is full brightness and 0 is off. The stored pixel values
+// are unaffected.
+func (la *LPD8806) SetBrightness(b uint8) {
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	la.brightness = b
+	la.dirty.markAll(la.numPixels)
+}
+
+// Brightness returns the brightness set by SetBrightness.
+func (la *LPD8806) Brightness() uint8 {
+	la.mu.RLock()
+	defer la.mu.RUnlock()
+
+	return la.brightness
+}
+
+// SetGamma sets the gamma correction applied to each channel when the pixels
+// are flushed. The default of 1 leaves the pixels unchanged; 2.2 or so makes
+// fades look more even to the eye. The stored pixel values are unaffected.
+func (la *LPD8806) SetGamma(gamma float64) {
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	if gamma == la.gamma {
+		return
+	}
+	la.gamma = gamma
+	la.gammaTable = makeGamma7Table(makeCorrectionTable(la.correction, gamma))
+	la.outOK = false
+	la.dirty.markAll(la.numPixels)
+}
+
+// SetChannelCaps sets the maximum output of each channel, which is scaled by
+// cap/255 when the pixels are flushed, e.g. to white-balance a strip whose
+// white is much brighter than its colors. On an RGB strip, w is ignored. The
+// default caps of 255 leave the channels alone, and a cap of 0 keeps its
+// channel off even with SetMinBrightness.
+func (la *LPD8806) SetChannelCaps(r, g, b, w uint8) {
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	la.caps[la.r], la.caps[la.g], la.caps[la.b] = r, g, b
+	if la.w >= 0 {
+		la.caps[la.w] = w
+	}
+	la.dirty.markAll(la.numPixels)
+}
+
+// ChannelCaps returns the caps set by SetChannelCaps. On an RGB strip, w is
+// always 255.
+func (la *LPD8806) ChannelCaps() (r, g, b, w uint8) {
+	la.mu.RLock()
+	defer la.mu.RUnlock()
+
+	w = 255
+	if la.w >= 0 {
+		w = la.caps[la.w]
+	}
+	return la.caps[la.r], la.caps[la.g], la.caps[la.b], w
+}
+
+// SetMinBrightness sets the floor that any channel that isn't 0 is raised to
+// when the pixels are flushed, after the gamma, brightness and dithering, so
+// that slow fades don't blink out before they reach 0. Channels that are 0
+// stay off, as does everything with a brightness of 0. The default of 0 turns
+// it off. LPD8806s only have 7 bits per color, so floors over 127 are treated
+// as 127.
+func (la *LPD8806) SetMinBrightness(floor uint8) {
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	la.floor = floor
+	la.dirty.markAll(la.numPixels)
+}
+
+// MinBrightness returns the floor set by SetMinBrightness.
+func (la *LPD8806) MinBrightness() uint8 {
+	la.mu.RLock()
+	defer la.mu.RUnlock()
+
+	return la.floor
+}
+
+// Gamma returns the gamma set by SetGamma.
+func (la *LPD8806) Gamma() float64 {
+	la.mu.RLock()
+	defer la.mu.RUnlock()
+
+	return la.gamma
+}
+
+// SetColorCorrection sets how each channel is corrected when the pixels are
+// flushed. The default, GammaCorrection, uses the gamma set by SetGamma;
+// SRGBCorrection suits sRGB sources such as video better, being closer to
+// what they were mastered for near black.
+func (la *LPD8806) SetColorCorrection(c ColorCorrection) {
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	if c == la.correction {
+		return
+	}
+	la.correction = c
+	la.gammaTable = makeGamma7Table(makeCorrectionTable(c, la.gamma))
+	la.outOK = false
+	la.dirty.markAll(la.numPixels)
+}
+
+// ColorCorrection returns the color correction set by SetColorCorrection.
+func (la *LPD8806) ColorCorrection() ColorCorrection {
+	la.mu.RLock()
+	defer la.mu.RUnlock()
+
+	return la.correction
+}
+
+// SetDithering turns temporal dithering on or off. With it on, the rounding
+// error from applying the gamma and brightness to each channel is carried
+// over to the next Flush, which matters all the more with only 7 bits per
+// channel. It's off by default.
+func (la *LPD8806) SetDithering(on bool) {
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	if on == (la.dither != nil) {
+		return
+	}
+	la.dither = nil
+	if on {
+		la.dither = newDither(len(la.pixels))
+	}
+}
+
+// Dithering returns whether dithering was turned on by SetDithering.
+func (la *LPD8806) Dithering() bool {
+	la.mu.RLock()
+	defer la.mu.RUnlock()
+
+	return la.dither != nil
+}
+
+// SetPowerLimit makes Flush dim all the pixels evenly, on top of the
+// brightness, whenever they'd otherwise draw more than maxMilliamps as
+// estimated with DefaultChannelMilliamps and DefaultIdleMilliamps. Zero, the
+// default, means no limit.
+func (la *LPD8806) SetPowerLimit(maxMilliamps float64) {
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	la.powerLimit = maxMilliamps
+	la.dirty.markAll(la.numPixels)
 }
 
-// RGBWAt returns the RGBW pixel at the given index.
-// If numColors is 3, then white is an undefined value.
+// PowerLimit returns the limit set by SetPowerLimit.
+func (la *LPD8806) PowerLimit() float64 {
+	la.mu.RLock()
+	defer la.mu.RUnlock()
+
+	return la.powerLimit
+}
+
+// EstimatedMilliamps estimates the current the strip draws with its current
+// pixels, gamma and brightness, ignoring any power limit. Each channel is
+// taken to draw perChannelMax at full brightness, or DefaultChannelMilliamps
+// if perChannelMax is zero, and each pixel to draw idle on top.
+func (la *LPD8806) EstimatedMilliamps(perChannelMax, idle float64) float64 {
+	la.mu.RLock()
+	defer la.mu.RUnlock()
+
+	return estimateMilliamps(la.level(), 127, la.numPixels, la.brightness, perChannelMax, idle)
+}
+
+// level returns the sum of all the gamma-corrected 7-bit channel values.
+func (la *LPD8806) level() float64 {
+	level := 0
+	for _, v := range la.pixels {
+		v &= 0x7F
+		level += int(la.gamma7(v))
+	}
+	return float64(level)
+}
+
+// outputBrightness returns the brightness to encode with: the set brightness,
+// lowered if need be to stay within the power limit.
+func (la *LPD8806) outputBrightness() uint8 {
+	if la.powerLimit <= 0 {
+		return la.brightness
+	}
+	return limitBrightness(la.level(), 127, la.numPixels, la.brightness, la.powerLimit)
+}
+
+// Clear sets all pixels to black. Like the other setters, it doesn't flush.
+func (la *LPD8806) Clear() {
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	for i := range la.pixels {
+		la.pixels[i] = 0x80
+	}
+	la.dirty.markAll(la.numPixels)
+}
+
+// Fill sets all pixels to the given RGB value.
+func (la *LPD8806) Fill(rgb RGB) {
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	for i := 0; i < la.numPixels; i++ {
+		la.setRGBAt(i, rgb)
+	}
+}
+
+// SetRange sets count pixels from start to the given RGB value. Pixels that
+// would be past the end of the strip are left out; it only returns
+// ErrIndexOutOfRange, without setting anything, if start isn't in
+// [0, NumPixels()] or count is negative. A start of NumPixels() sets nothing.
+func (la *LPD8806) SetRange(start, count int, rgb RGB) error {
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	count, err := clipRange(start, count, la.numPixels)
+	if err != nil {
+		return err
+	}
+	for i := start; i < start+count; i++ {
+		la.setRGBAt(la.phys(i), rgb)
+	}
+	return nil
+}
+
+// SetRangeSlice sets the pixels from start to the given RGB values, clipped
+// like SetRange.
+func (la *LPD8806) SetRangeSlice(start int, colors []RGB) error {
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	count, err := clipRange(start, len(colors), la.numPixels)
+	if err != nil {
+		return err
+	}
+	for i, rgb := range colors[:count] {
+		la.setRGBAt(la.phys(start+i), rgb)
+	}
+	return nil
+}
+
+// SetFromImageRow sets the pixels to colors sampled evenly across the given
+// row of img, counting from the top of its bounds, as if they were set with
+// SetRGBAt once scaled from 8 bits to the strip's 7. It returns
+// ErrIndexOutOfRange if img doesn't have the row.
+func (la *LPD8806) SetFromImageRow(img image.Image, row int) error {
+	colors, err := sampleImageRow(img, row, la.numPixels)
+	if err != nil {
+		return err
+	}
+
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	for i, rgb := range colors {
+		la.setRGBAt(la.phys(i), rgb7(rgb))
+	}
+	return nil
+}
+
+// SetTestPattern sets all pixels to full red, green, blue or white for phase
+// 0, 1, 2 or 3, repeating for higher phases. Watching which color lights in
+// each phase shows the strip's color order; see GuessColorOrder.
+func (la *LPD8806) SetTestPattern(phase int) {
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	rgbw := testPatternColor(phase, la.numColors)
+	for i := 0; i < la.numPixels; i++ {
+		la.setRGBWAt(i, rgbw)
+	}
+}
+
+// FillRGBW sets all pixels to the given RGBW value. On an RGB strip, white is
+// ignored.
+func (la *LPD8806) FillRGBW(rgbw RGBW) {
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	for i := 0; i < la.numPixels; i++ {
+		la.setRGBWAt(i, rgbw)
+	}
+}
+
+// Shift moves every pixel n places towards the end of the strip, or -n places
+// towards the start if n is negative. Pixels moved off one end are lost, and
+// the ones left empty at the other end are set to fill (with white off).
+func (la *LPD8806) Shift(n int, fill RGB) {
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	if la.reversed {
+		n = -n
+	}
+	lo, hi := 0, la.numPixels
+	switch {
+	case n >= la.numPixels || -n >= la.numPixels:
+	case n > 0:
+		copy(la.pixels[n*la.numColors:], la.pixels)
+		hi = n
+	case n < 0:
+		copy(la.pixels, la.pixels[-n*la.numColors:])
+		lo = la.numPixels + n
+	default:
+		return
+	}
+	for i := lo; i < hi; i++ {
+		for j := 0; j < la.numColors; j++ {
+			la.pixels[i*la.numColors+j] = 0x80
+		}
+		la.setRGBAt(i, fill)
+	}
+	la.dirty.markAll(la.numPixels)
+}
+
+// Rotate moves every pixel n places towards the end of the strip, or -n places
+// towards the start if n is negative, wrapping pixels moved off one end around
+// to the other.
+func (la *LPD8806) Rotate(n int) {
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	if la.numPixels == 0 {
+		return
+	}
+	if la.reversed {
+		n = -n
+	}
+	n %= la.numPixels
+	if n < 0 {
+		n += la.numPixels
+	}
+	if n == 0 {
+		return
+	}
+	// Rotating right by k is reversing the whole thing, then each side of k.
+	k := n * la.numColors
+	reverseBytes(la.pixels)
+	reverseBytes(la.pixels[:k])
+	reverseBytes(la.pixels[k:])
+	la.dirty.markAll(la.numPixels)
+}
+
+// SetReversed sets whether the strip runs backwards, so that index 0 is the
+// pixel furthest from the controller. It applies to the pixel setters and
+// getters, including Shift and Rotate, but not to Pixels, WriteFrame or
+// snapshots, which always deal in the order the pixels are sent.
+func (la *LPD8806) SetReversed(on bool) {
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	la.reversed = on
+}
+
+// Reversed returns whether the strip was reversed by SetReversed.
+func (la *LPD8806) Reversed() bool {
+	la.mu.RLock()
+	defer la.mu.RUnlock()
+
+	return la.reversed
+}
+
+// phys returns the physical index of the pixel at logical index i.
+func (la *LPD8806) phys(i int) int {
+	if la.reversed {
+		return la.numPixels - 1 - i
+	}
+	return i
+}
+
+// SetWhiteExtraction sets how the RGB setters derive the white channel on an
+// RGBW strip. The default, WhiteNone, turns it off. It has no effect on RGB
+// strips.
+func (la *LPD8806) SetWhiteExtraction(mode WhiteExtraction) {
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	la.white = mode
+}
+
+// WhiteExtraction returns the mode set by SetWhiteExtraction.
+func (la *LPD8806) WhiteExtraction() WhiteExtraction {
+	la.mu.RLock()
+	defer la.mu.RUnlock()
+
+	return la.white
+}
+
+// RGBWAt returns the RGBW pixel at the given index. On an RGB strip, white
+// is always 0.
 func (la *LPD8806) RGBWAt(i int) RGBW {
-	o := i * la.numColors
-	return RGBW{
-		la.pixels[o+la.r] & 0x7F,
-		la.pixels[o+la.g] & 0x7F,
-		la.pixels[o+la.b] & 0x7F,
-		la.pixels[o+la.w] & 0x7F,
+	la.mu.RLock()
+	defer la.mu.RUnlock()
+
+	o := la.phys(i) * la.numColors
+	rgbw := RGBW{R: la.pixels[o+la.r] & 0x7F, G: la.pixels[o+la.g] & 0x7F, B: la.pixels[o+la.b] & 0x7F}
+	if la.w >= 0 {
+		rgbw.W = la.pixels[o+la.w] & 0x7F
 	}
+	return rgbw
 }
 
-// SetRGBWAt sets the RGBW pixel at the given index to the given value.
-// If numColors is 3, then white is an undefined value.
+// SetRGBWAt sets the RGBW pixel at the given index to the given value. On an
+// RGB strip, white is ignored.
 func (la *LPD8806) SetRGBWAt(i int, rgbw RGBW) {
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	la.setRGBWAt(la.phys(i), rgbw)
+}
+
+func (la *LPD8806) setRGBWAt(i int, rgbw RGBW) {
 	o := i * la.numColors
 	la.pixels[o+la.r] = 0x80 | rgbw.R
 	la.pixels[o+la.g] = 0x80 | rgbw.G
 	la.pixels[o+la.b] = 0x80 | rgbw.B
-	la.pixels[o+la.w] = 0x80 | rgbw.W
+	if la.w >= 0 {
+		la.pixels[o+la.w] = 0x80 | rgbw.W
+	}
+	la.dirty.mark(i)
 }
 
-// SetRGBWs sets the RGBW pixels to the given values.
-// If numColors is 3, then white is an undefined value.
+// SetRGBWs sets the RGBW pixels to the given values. It panics on an RGB
+// strip.
 func (la *LPD8806) SetRGBWs(pixels []RGBW) {
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
 	if la.numColors != 4 {
-		panic("SetRGBWs called on WS281x with numColors != 4")
+		panic("SetRGBWs called on LPD8806 with numColors != 4")
 	}
 	if len(pixels) != la.numPixels {
 		panic("SetRGBWs called with wrong number of pixels")
@@ -129,17 +835,35 @@ func (la *LPD8806) SetRGBWs(pixels []RGBW) {
 
 	a := 0
 	for i := 0; i < len(la.pixels); i += 4 {
-		la.pixels[a+la.r] = 0x80 | pixels[i].R
-		la.pixels[a+la.g] = 0x80 | pixels[i].G
-		la.pixels[a+la.b] = 0x80 | pixels[i].B
-		la.pixels[a+la.w] = 0x80 | pixels[i].W
+		p := pixels[la.phys(a)]
+		la.pixels[i+la.r] = 0x80 | p.R
+		la.pixels[i+la.g] = 0x80 | p.G
+		la.pixels[i+la.b] = 0x80 | p.B
+		la.pixels[i+la.w] = 0x80 | p.W
 		a++
 	}
+	la.dirty.markAll(la.numPixels)
+}
+
+// SetRGBWsErr is like SetRGBWs, but returns ErrWrongColorModel or
+// ErrPixelCountMismatch instead of panicking.
+func (la *LPD8806) SetRGBWsErr(pixels []RGBW) error {
+	if la.numColors != 4 {
+		return fmt.Errorf("SetRGBWs called on RGB strip: %w", ErrWrongColorModel)
+	}
+	if len(pixels) != la.numPixels {
+		return fmt.Errorf("SetRGBWs called with %d pixels, want %d: %w", len(pixels), la.numPixels, ErrPixelCountMismatch)
+	}
+	la.SetRGBWs(pixels)
+	return nil
 }
 
 // RGBAt returns the RGB pixel at the given index.
 func (la *LPD8806) RGBAt(i int) RGB {
-	o := i * la.numColors
+	la.mu.RLock()
+	defer la.mu.RUnlock()
+
+	o := la.phys(i) * la.numColors
 	return RGB{
 		la.pixels[o+la.r] & 0x7F,
 		la.pixels[o+la.g] & 0x7F,
@@ -147,16 +871,85 @@ func (la *LPD8806) RGBAt(i int) RGB {
 	}
 }
 
-// SetRGBAt sets the RGB pixel at the given index to the given value.
+// SetRGBAt sets the RGB pixel at the given index to the given value. On an
+// RGBW strip, white is derived as set by SetWhiteExtraction.
 func (la *LPD8806) SetRGBAt(i int, rgb RGB) {
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	la.setRGBAt(la.phys(i), rgb)
+}
+
+// rgb7 scales an 8-bit color to the 7 bits per channel that LPD8806s have.
+func rgb7(rgb RGB) RGB {
+	return RGB{rgb.R >> 1, rgb.G >> 1, rgb.B >> 1}
+}
+
+func (la *LPD8806) setRGBAt(i int, rgb RGB) {
+	if la.w >= 0 {
+		la.setRGBWAt(i, RGBToRGBW(rgb, la.white))
+		return
+	}
 	o := i * la.numColors
 	la.pixels[o+la.r] = 0x80 | rgb.R
 	la.pixels[o+la.g] = 0x80 | rgb.G
 	la.pixels[o+la.b] = 0x80 | rgb.B
+	la.dirty.mark(i)
+}
+
+// CopyFrom copies count pixels from src, starting at srcStart, to this strip,
+// starting at dstStart. src may be this strip, in which case the ranges may
+// overlap. Pixels are converted between RGB and RGBW as needed: white is
+// derived as set by SetWhiteExtraction, or added to the other channels when
+// this strip has none. Pixels from strips with 8 bits per color are scaled to
+// 7. It returns ErrIndexOutOfRange if either range doesn't fit.
+func (la *LPD8806) CopyFrom(src Strip, srcStart, dstStart, count int) error {
+	if err := checkCopy(src, srcStart, dstStart, count, la.numPixels); err != nil {
+		return err
+	}
+	pixels, hasWhite := readPixels(src, srcStart, count)
+
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	for k, p := range pixels {
+		i := la.phys(dstStart + k)
+		switch {
+		case !hasWhite:
+			la.setRGBAt(i, rgb7(RGB{p.R, p.G, p.B}))
+		case la.w >= 0:
+			la.setRGBWAt(i, RGBW{p.R >> 1, p.G >> 1, p.B >> 1, p.W >> 1})
+		default:
+			la.setRGBAt(i, rgb7(rgbModel(p).(RGB)))
+		}
+	}
+	return nil
+}
+
+// RGBAtChecked is like RGBAt, but returns ErrIndexOutOfRange if i is outside
+// the strip.
+func (la *LPD8806) RGBAtChecked(i int) (RGB, error) {
+	if err := checkIndex(i, la.numPixels); err != nil {
+		return RGB{}, err
+	}
+	return la.RGBAt(i), nil
+}
+
+// SetRGBAtChecked is like SetRGBAt, but returns ErrIndexOutOfRange if i is
+// outside the strip.
+func (la *LPD8806) SetRGBAtChecked(i int, rgb RGB) error {
+	if err := checkIndex(i, la.numPixels); err != nil {
+		return err
+	}
+	la.SetRGBAt(i, rgb)
+	return nil
 }
 
 // SetRGBs sets the RGB pixels to the given values.
 func (la *LPD8806) SetRGBs(pixels []RGB) {
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
 	if la.numColors != 3 {
 		panic("SetRGBs called on RGBW strip")
 	}
@@ -166,9 +959,24 @@ func (la *LPD8806) SetRGBs(pixels []RGB) {
 
 	a := 0
 	for i := 0; i < len(la.pixels); i += 3 {
-		la.pixels[i+la.r] = 0x80 | pixels[a].R
-		la.pixels[i+la.g] = 0x80 | pixels[a].G
-		la.pixels[i+la.b] = 0x80 | pixels[a].B
+		p := pixels[la.phys(a)]
+		la.pixels[i+la.r] = 0x80 | p.R
+		la.pixels[i+la.g] = 0x80 | p.G
+		la.pixels[i+la.b] = 0x80 | p.B
 		a++
 	}
+	la.dirty.markAll(la.numPixels)
+}
+
+// SetRGBsErr is like SetRGBs, but returns ErrWrongColorModel or
+// ErrPixelCountMismatch instead of panicking.
+func (la *LPD8806) SetRGBsErr(pixels []RGB) error {
+	if la.numColors != 3 {
+		return fmt.Errorf("SetRGBs called on RGBW strip: %w", ErrWrongColorModel)
+	}
+	if len(pixels) != la.numPixels {
+		return fmt.Errorf("SetRGBs called with %d pixels, want %d: %w", len(pixels), la.numPixels, ErrPixelCountMismatch)
+	}
+	la.SetRGBs(pixels)
+	return nil
 }
@@ -0,0 +1,470 @@
+package ledctl
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestLPD8806Brightness(t *testing.T) {
+	dev := &fakeDevice{}
+	la, err := newLPD8806(LPD8806Config{
+		Device:     dev,
+		NumPixels:  2,
+		ColorOrder: RGBOrder,
+		ColorModel: RGBModel,
+	}, nil)
+	if err != nil {
+		t.Fatalf("newLPD8806: %v", err)
+	}
+	la.SetRGBs([]RGB{{127, 64, 1}, {0, 3, 100}})
+
+	if err := la.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	want := []byte{0xFF, 0xC0, 0x81, 0x80, 0x83, 0xE4, 0x00}
+	if got := dev.last(); !bytes.Equal(got, want) {
+		t.Errorf("brightness 255 wrote % X, want % X", got, want)
+	}
+
+	la.SetBrightness(128)
+	if err := la.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	want = []byte{0xC0, 0xA0, 0x81, 0x80, 0x82, 0xB2, 0x00}
+	if got := dev.last(); !bytes.Equal(got, want) {
+		t.Errorf("brightness 128 wrote % X, want % X", got, want)
+	}
+	if got, want := la.RGBAt(0), (RGB{127, 64, 1}); got != want {
+		t.Errorf("RGBAt(0) got %v, want %v", got, want)
+	}
+}
+
+func TestLPD8806SetRange(t *testing.T) {
+	dev := &fakeDevice{}
+	la, err := newLPD8806(LPD8806Config{Device: dev, NumPixels: 3, ColorOrder: RGBOrder, ColorModel: RGBModel}, nil)
+	if err != nil {
+		t.Fatalf("newLPD8806: %v", err)
+	}
+
+	if err := la.SetRange(1, 5, RGB{2, 4, 6}); err != nil {
+		t.Errorf("SetRange got error %v", err)
+	}
+	if err := la.SetRangeSlice(0, []RGB{{8, 10, 12}}); err != nil {
+		t.Errorf("SetRangeSlice got error %v", err)
+	}
+	// A huge count mustn't overflow, and start can be the end of the strip.
+	if err := la.SetRange(2, math.MaxInt, RGB{2, 4, 6}); err != nil {
+		t.Errorf("SetRange(2, math.MaxInt) got error %v", err)
+	}
+	if err := la.SetRange(3, 1, RGB{}); err != nil {
+		t.Errorf("SetRange(3, 1) got error %v", err)
+	}
+	if err := la.SetRange(4, 1, RGB{}); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Errorf("SetRange(4, 1) got error %v, want ErrIndexOutOfRange", err)
+	}
+	if err := la.SetRangeSlice(-1, nil); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Errorf("SetRangeSlice(-1) got error %v, want ErrIndexOutOfRange", err)
+	}
+
+	if err := la.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	want := []byte{0x88, 0x8A, 0x8C, 0x82, 0x84, 0x86, 0x82, 0x84, 0x86, 0x00}
+	if got := dev.last(); !bytes.Equal(got, want) {
+		t.Errorf("wrote % X, want % X", got, want)
+	}
+}
+
+func TestLPD8806Fill(t *testing.T) {
+	la, err := newLPD8806(LPD8806Config{Device: &fakeDevice{}, NumPixels: 5, ColorModel: RGBModel}, nil)
+	if err != nil {
+		t.Fatalf("newLPD8806: %v", err)
+	}
+
+	la.Fill(RGB{5, 6, 7})
+	for _, i := range []int{0, 3, 4} {
+		if got, want := la.RGBAt(i), (RGB{5, 6, 7}); got != want {
+			t.Errorf("after Fill, RGBAt(%d) got %v, want %v", i, got, want)
+		}
+	}
+
+	la.Clear()
+	for i := 0; i < 5; i++ {
+		if got := la.RGBAt(i); got != (RGB{}) {
+			t.Errorf("after Clear, RGBAt(%d) got %v, want black", i, got)
+		}
+	}
+	for i, v := range la.pixels {
+		if v != 0x80 {
+			t.Errorf("after Clear, pixels[%d] got %02X, want 80", i, v)
+		}
+	}
+}
+
+func TestLPD8806SetRGBWs(t *testing.T) {
+	la, err := newLPD8806(LPD8806Config{
+		Device:     &fakeDevice{},
+		NumPixels:  3,
+		ColorOrder: GRBWOrder,
+		ColorModel: RGBWModel,
+	}, nil)
+	if err != nil {
+		t.Fatalf("newLPD8806: %v", err)
+	}
+	pixels := []RGBW{{1, 2, 3, 4}, {5, 6, 7, 8}, {9, 10, 11, 12}}
+	la.SetRGBWs(pixels)
+
+	for i, want := range pixels {
+		if got := la.RGBWAt(i); got != want {
+			t.Errorf("RGBWAt(%d) got %v, want %v", i, got, want)
+		}
+	}
+	want := []byte{
+		0x82, 0x81, 0x83, 0x84,
+		0x86, 0x85, 0x87, 0x88,
+		0x8A, 0x89, 0x8B, 0x8C,
+	}
+	if !bytes.Equal(la.pixels, want) {
+		t.Errorf("pixels got % X, want % X", la.pixels, want)
+	}
+}
+
+func TestLPD8806FlushPartial(t *testing.T) {
+	dev := &fakeDevice{}
+	la, err := newLPD8806(LPD8806Config{Device: dev, NumPixels: 4, ColorOrder: RGBOrder, ColorModel: RGBModel}, nil)
+	if err != nil {
+		t.Fatalf("newLPD8806: %v", err)
+	}
+	la.Fill(RGB{1, 2, 3})
+	if err := la.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	prev := dev.last()
+
+	// Change a pixel without marking it dirty, which FlushPartial mustn't notice.
+	la.pixels[0] = 0x80 | 0x7F
+	la.SetRGBAt(2, RGB{4, 5, 6})
+	if err := la.FlushPartial(); err != nil {
+		t.Fatalf("FlushPartial: %v", err)
+	}
+	got := dev.last()
+	for i := range got {
+		changed := i >= 6 && i < 9
+		if (got[i] != prev[i]) != changed {
+			t.Errorf("byte %d got %02X, previous frame %02X, should change: %v", i, got[i], prev[i], changed)
+		}
+	}
+	if want := []byte{0x84, 0x85, 0x86}; !bytes.Equal(got[6:9], want) {
+		t.Errorf("pixel 2 got % X, want % X", got[6:9], want)
+	}
+}
+
+func TestLPD8806WriteFrame(t *testing.T) {
+	la, err := newLPD8806(LPD8806Config{Device: &fakeDevice{}, NumPixels: 2, ColorOrder: RGBOrder, ColorModel: RGBModel}, nil)
+	if err != nil {
+		t.Fatalf("newLPD8806: %v", err)
+	}
+
+	for _, n := range []int{0, 5, 7} {
+		if err := la.WriteFrame(make([]byte, n)); !errors.Is(err, ErrPixelCountMismatch) {
+			t.Errorf("WriteFrame of %d bytes got: %v, want: %v", n, err, ErrPixelCountMismatch)
+		}
+	}
+
+	if err := la.WriteFrame([]byte{0x00, 0x01, 0x7F, 0x80, 0xFF, 0x10}); err != nil {
+		t.Fatalf("WriteFrame: %v", err)
+	}
+	if want := []byte{0x80, 0x81, 0xFF, 0x80, 0xFF, 0x90}; !bytes.Equal(la.pixels, want) {
+		t.Errorf("pixels got % X, want % X", la.pixels, want)
+	}
+	if got, want := la.RGBAt(0), (RGB{0x00, 0x01, 0x7F}); got != want {
+		t.Errorf("RGBAt(0) got %v, want %v", got, want)
+	}
+}
+
+func TestLPD8806Dithering(t *testing.T) {
+	dev := &fakeDevice{}
+	la, err := newLPD8806(LPD8806Config{Device: dev, NumPixels: 1, ColorOrder: RGBOrder, ColorModel: RGBModel}, nil)
+	if err != nil {
+		t.Fatalf("newLPD8806: %v", err)
+	}
+	la.SetRGBAt(0, RGB{3, 0, 0})
+	la.SetBrightness(100)
+	la.SetDithering(true)
+
+	const frames = 510
+	sum := 0
+	for f := 0; f < frames; f++ {
+		if err := la.FlushPartial(); err != nil {
+			t.Fatalf("FlushPartial: %v", err)
+		}
+		sum += int(dev.last()[0] & 0x7F)
+	}
+	// 3*100/255 is 1.18, which rounds to 1 without dithering.
+	if got, want := float64(sum)/frames, 3*100/255.0; got < want-0.005 || got > want+0.005 {
+		t.Errorf("averaged %v, want %v", got, want)
+	}
+}
+
+func TestLPD8806Close(t *testing.T) {
+	dev := &fakeDevice{}
+	la, err := newLPD8806(LPD8806Config{Device: dev, NumPixels: 2, ColorModel: RGBModel}, nil)
+	if err != nil {
+		t.Fatalf("newLPD8806: %v", err)
+	}
+	la.Fill(RGB{127, 64, 1})
+	if err := la.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	if err := la.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	// Every channel is zero, with the top bit that LPD8806s need set.
+	want := []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x00}
+	if got := dev.last(); !bytes.Equal(got, want) {
+		t.Errorf("Close wrote % X, want % X", got, want)
+	}
+
+	writes := len(dev.writes)
+	if err := la.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+	if len(dev.writes) != writes {
+		t.Errorf("second Close wrote to the device")
+	}
+}
+
+func TestLPD8806ColorModelBridging(t *testing.T) {
+	la, err := newLPD8806(LPD8806Config{Device: &fakeDevice{}, NumPixels: 2, ColorOrder: GRBWOrder, ColorModel: RGBWModel}, nil)
+	if err != nil {
+		t.Fatalf("newLPD8806: %v", err)
+	}
+	la.SetRGBWAt(0, RGBW{1, 2, 3, 4})
+	la.SetRGBAt(0, RGB{10, 20, 30})
+	if got, want := la.RGBWAt(0), (RGBW{10, 20, 30, 0}); got != want {
+		t.Errorf("RGBW strip after SetRGBAt got %v, want %v", got, want)
+	}
+
+	la, err = newLPD8806(LPD8806Config{Device: &fakeDevice{}, NumPixels: 2, ColorOrder: GRBOrder, ColorModel: RGBModel}, nil)
+	if err != nil {
+		t.Fatalf("newLPD8806: %v", err)
+	}
+	la.SetRGBWAt(1, RGBW{1, 2, 3, 4})
+	la.SetRGBWAt(0, RGBW{5, 6, 7, 8})
+	if got, want := la.RGBWAt(1), (RGBW{1, 2, 3, 0}); got != want {
+		t.Errorf("RGB strip RGBWAt(1) got %v, want %v", got, want)
+	}
+}
+
+func TestLPD8806Reversed(t *testing.T) {
+	la, err := newLPD8806(LPD8806Config{Device: &fakeDevice{}, NumPixels: 3, ColorOrder: RGBOrder, ColorModel: RGBModel}, nil)
+	if err != nil {
+		t.Fatalf("newLPD8806: %v", err)
+	}
+	la.SetReversed(true)
+
+	la.SetRGBAt(0, RGB{1, 2, 3})
+	if got, want := la.Pixels()[6:], []byte{0x81, 0x82, 0x83}; !bytes.Equal(got, want) {
+		t.Errorf("after SetRGBAt(0) last pixel % X, want % X", got, want)
+	}
+	la.Rotate(1)
+	if got, want := la.RGBAt(1), (RGB{1, 2, 3}); got != want {
+		t.Errorf("after Rotate, RGBAt(1) got %v, want %v", got, want)
+	}
+}
+
+func TestLPD8806CopyFrom(t *testing.T) {
+	src := testWS281x(WS281xConfig{NumPixels: 2, ColorOrder: GRBWOrder, ColorModel: RGBWModel})
+	src.SetRGBWs([]RGBW{{100, 150, 200, 20}, {255, 128, 0, 0}})
+
+	la, err := newLPD8806(LPD8806Config{Device: &fakeDevice{}, NumPixels: 3, ColorOrder: GRBOrder, ColorModel: RGBModel}, nil)
+	if err != nil {
+		t.Fatalf("newLPD8806: %v", err)
+	}
+	if err := la.CopyFrom(src, 0, 1, 2); err != nil {
+		t.Fatalf("CopyFrom failed: %v", err)
+	}
+	// The white is added to the other channels, then 8 bits become 7.
+	for i, want := range []RGB{{0, 0, 0}, {60, 85, 110}, {127, 64, 0}} {
+		if got := la.RGBAt(i); got != want {
+			t.Errorf("RGBAt(%d) got %v, want %v", i, got, want)
+		}
+	}
+
+	// Copying back widens the 7 bits to 8 again.
+	dst := testWS281x(WS281xConfig{NumPixels: 1, ColorOrder: GRBOrder, ColorModel: RGBModel})
+	if err := dst.CopyFrom(la, 2, 0, 1); err != nil {
+		t.Fatalf("CopyFrom failed: %v", err)
+	}
+	if got, want := dst.RGBAt(0), (RGB{255, 129, 0}); got != want {
+		t.Errorf("WS281x RGBAt(0) got %v, want %v", got, want)
+	}
+}
+
+func TestLPD8806SkipUnchanged(t *testing.T) {
+	dev := &fakeDevice{}
+	la, err := newLPD8806(LPD8806Config{Device: dev, NumPixels: 2, ColorModel: RGBModel}, nil)
+	if err != nil {
+		t.Fatalf("newLPD8806: %v", err)
+	}
+	la.SetSkipUnchanged(true)
+	writes := len(dev.writes)
+
+	la.SetRGBAt(0, RGB{1, 2, 3})
+	for i := 0; i < 2; i++ {
+		if err := la.Flush(); err != nil {
+			t.Fatalf("Flush: %v", err)
+		}
+	}
+	if got, want := len(dev.writes)-writes, 1; got != want {
+		t.Errorf("two identical frames wrote %d times, want %d", got, want)
+	}
+	la.SetRGBAt(1, RGB{4, 5, 6})
+	if err := la.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if got, want := len(dev.writes)-writes, 2; got != want {
+		t.Errorf("changed frame wrote %d times in all, want %d", got, want)
+	}
+	if got, want := la.SkippedFlushes(), 1; got != want {
+		t.Errorf("SkippedFlushes() got %d, want %d", got, want)
+	}
+}
+
+func TestLPD8806SkipUnchangedAfterError(t *testing.T) {
+	dev := &fakeDevice{}
+	la, err := newLPD8806(LPD8806Config{Device: dev, NumPixels: 2, ColorModel: RGBModel}, nil)
+	if err != nil {
+		t.Fatalf("newLPD8806: %v", err)
+	}
+	la.SetSkipUnchanged(true)
+	la.SetRGBAt(0, RGB{1, 2, 3})
+	dev.err = errors.New("write failed")
+	if err := la.Flush(); err == nil {
+		t.Fatalf("Flush to a failing device got no error")
+	}
+
+	// The frame never got through, so the same one must be written again.
+	dev.err = nil
+	writes := len(dev.writes)
+	if err := la.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if got, want := len(dev.writes)-writes, 1; got != want {
+		t.Errorf("frame after a failed write wrote %d times, want %d", got, want)
+	}
+	if got, want := la.SkippedFlushes(), 0; got != want {
+		t.Errorf("SkippedFlushes() got %d, want %d", got, want)
+	}
+}
+
+func TestLPD8806FlushObserver(t *testing.T) {
+	dev := &fakeDevice{}
+	la, err := newLPD8806(LPD8806Config{Device: dev, NumPixels: 10, ColorModel: RGBModel}, nil)
+	if err != nil {
+		t.Fatalf("newLPD8806: %v", err)
+	}
+	var got []FlushStats
+	la.SetFlushObserver(func(s FlushStats) { got = append(got, s) })
+	la.SetSkipUnchanged(true)
+
+	if err := la.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	la.SetRGBAt(2, RGB{1, 2, 3})
+	la.SetRGBAt(4, RGB{1, 2, 3})
+	if err := la.FlushPartial(); err != nil {
+		t.Fatalf("FlushPartial: %v", err)
+	}
+	if err := la.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	// Dithering re-encodes every pixel, so they all count as changed.
+	la.SetDithering(true)
+	la.SetRGBAt(0, RGB{1, 2, 3})
+	if err := la.FlushPartial(); err != nil {
+		t.Fatalf("FlushPartial: %v", err)
+	}
+
+	if len(got) != 4 {
+		t.Fatalf("observer called %d times, want 4", len(got))
+	}
+	for i, want := range []struct {
+		changed int
+		skipped bool
+	}{{10, false}, {3, false}, {0, true}, {10, false}} {
+		if s := got[i]; s.PixelsChanged != want.changed || s.Skipped != want.skipped {
+			t.Errorf("flush %d: got %+v, want %d pixels changed and skipped %v", i, s, want.changed, want.skipped)
+		}
+	}
+}
+
+func TestLPD8806MinBrightnessClamp(t *testing.T) {
+	dev := &fakeDevice{}
+	la, err := newLPD8806(LPD8806Config{Device: dev, NumPixels: 1, ColorOrder: RGBOrder, ColorModel: RGBModel}, nil)
+	if err != nil {
+		t.Fatalf("newLPD8806: %v", err)
+	}
+	la.SetRGBAt(0, RGB{R: 2})
+	la.SetMinBrightness(200)
+	if got := la.MinBrightness(); got != 200 {
+		t.Errorf("MinBrightness() got %d, want 200", got)
+	}
+	if err := la.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	// The floor is clamped to the 7 bits there are, and 0 stays off.
+	if got, want := dev.last()[:3], []byte{0xFF, 0x80, 0x80}; !bytes.Equal(got, want) {
+		t.Errorf("wrote % X, want % X", got, want)
+	}
+}
+
+func TestLPD8806ZeroCapWithFloor(t *testing.T) {
+	dev := &fakeDevice{}
+	la, err := newLPD8806(LPD8806Config{Device: dev, NumPixels: 1, ColorOrder: RGBOrder, ColorModel: RGBModel}, nil)
+	if err != nil {
+		t.Fatalf("newLPD8806: %v", err)
+	}
+	la.SetRGBAt(0, RGB{R: 2, G: 2, B: 2})
+	la.SetMinBrightness(10)
+	la.SetChannelCaps(0, 255, 255, 255)
+	if err := la.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	// The floor doesn't light the red channel that the cap turned off.
+	if got, want := dev.last()[:3], []byte{0x80, 0x8A, 0x8A}; !bytes.Equal(got, want) {
+		t.Errorf("wrote % X, want % X", got, want)
+	}
+}
+
+func TestLPD8806GammaThenBrightness(t *testing.T) {
+	dev := &fakeDevice{}
+	la, err := newLPD8806(LPD8806Config{Device: dev, NumPixels: 2, ColorOrder: RGBOrder, ColorModel: RGBModel}, nil)
+	if err != nil {
+		t.Fatalf("newLPD8806: %v", err)
+	}
+	in := []uint8{0, 1, 40, 64, 100, 127}
+	la.SetRGBs([]RGB{{in[0], in[1], in[2]}, {in[3], in[4], in[5]}})
+	for _, gamma := range []float64{1, 2.2} {
+		for _, brightness := range []uint8{255, 128, 3} {
+			la.SetGamma(gamma)
+			la.SetBrightness(brightness)
+			if err := la.Flush(); err != nil {
+				t.Fatalf("Flush: %v", err)
+			}
+			// The 7-bit value is widened for the 8-bit gamma, narrowed, then
+			// scaled by the brightness.
+			table := makeGammaTable(gamma)
+			got := dev.last()
+			for i, v := range in {
+				want := 0x80 | scaleBrightness(table[v<<1|v>>6]>>1, brightness)
+				if got[i] != want {
+					t.Errorf("gamma %v brightness %d: %d sent as %#x, want %#x", gamma, brightness, v, got[i], want)
+				}
+			}
+		}
+	}
+}
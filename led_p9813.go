@@ -0,0 +1,187 @@
+package ledctl
+
+import (
+	"fmt"
+
+	rpi "github.com/mxcu/ledctl/rpi"
+)
+
+// P9813 controls a chain of P9813 LEDs, such as Grove Chainable RGB LEDs.
+type P9813 struct {
+	rp        *rpi.RPi
+	dev       Device
+	buffer    []byte
+	pixels    []byte
+	numPixels int
+}
+
+// P9813Config is the configuration for a chain of P9813 LEDs.
+type P9813Config struct {
+	// Device is the SPI device to use. Usually, this is "/dev/spidev0.0".
+	// It isn't included in JSON.
+	Device Device `json:"-"`
+	// NumPixels is the number of pixels in the chain.
+	NumPixels int
+	// SPISpeed is the speed to use for the SPI. If zero, the current speed of
+	// the device is left alone.
+	SPISpeed uint32
+}
+
+const (
+	p9813StartFrameLen = 4
+	p9813EndFrameLen   = 4
+	p9813PixelLen      = 4
+	p9813PixelHeader   = 0xC0
+)
+
+// NewP9813 creates a new P9813 LED controller.
+func NewP9813(config P9813Config) (*P9813, error) {
+	rp, err := rpi.NewRPi()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't make RPi: %w", err)
+	}
+	return newP9813(config, rp)
+}
+
+func newP9813(config P9813Config, rp *rpi.RPi) (*P9813, error) {
+	numData := config.NumPixels * p9813PixelLen
+	buf := make([]byte, p9813StartFrameLen+numData+p9813EndFrameLen)
+	p := P9813{
+		rp:        rp,
+		dev:       config.Device,
+		buffer:    buf,
+		pixels:    buf[p9813StartFrameLen : p9813StartFrameLen+numData],
+		numPixels: config.NumPixels,
+	}
+	for i := 0; i < p.numPixels; i++ {
+		p.SetRGBAt(i, RGB{})
+	}
+
+	if config.SPISpeed != 0 {
+		err := setSPISpeed(rp, p.dev.Fd(), config.SPISpeed)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &p, nil
+}
+
+// p9813Flag returns the byte sent before each pixel. It's a checksum of sorts:
+// the inverted top two bits of blue, green and red, under two set bits.
+func p9813Flag(rgb RGB) byte {
+	return p9813PixelHeader | (^rgb.B>>6&3)<<4 | (^rgb.G>>6&3)<<2 | ^rgb.R>>6&3
+}
+
+// Close does nothing.
+func (p *P9813) Close() error {
+	return nil
+}
+
+// RPi returns the RPi object used to control the SPI.
+func (p *P9813) RPi() *rpi.RPi {
+	return p.rp
+}
+
+// NumPixels returns the number of pixels in the chain.
+func (p *P9813) NumPixels() int {
+	return p.numPixels
+}
+
+// MaxLEDsPerChannel returns the maximum number of LEDs per channel.
+func (p *P9813) MaxLEDsPerChannel() int {
+	return 255
+}
+
+// Flush flushes the pixels to the LEDs.
+func (p *P9813) Flush() error {
+	_, err := p.dev.Write(p.buffer)
+	return err
+}
+
+// RGBWAt returns the RGBW pixel at the given index. P9813s have no white
+// channel, so white is always zero.
+func (p *P9813) RGBWAt(i int) RGBW {
+	rgb := p.RGBAt(i)
+	return RGBW{rgb.R, rgb.G, rgb.B, 0}
+}
+
+// SetRGBWAt sets the RGBW pixel at the given index to the given value. P9813s
+// have no white channel, so white is ignored.
+func (p *P9813) SetRGBWAt(i int, rgbw RGBW) {
+	p.SetRGBAt(i, RGB{rgbw.R, rgbw.G, rgbw.B})
+}
+
+// SetRGBWs sets the RGBW pixels to the given values. P9813s have no white
+// channel, so white is ignored.
+func (p *P9813) SetRGBWs(pixels []RGBW) {
+	if len(pixels) != p.numPixels {
+		panic("SetRGBWs called with wrong number of pixels")
+	}
+
+	for i, px := range pixels {
+		p.SetRGBAt(i, RGB{px.R, px.G, px.B})
+	}
+}
+
+// SetRGBWsErr is like SetRGBWs, but returns ErrPixelCountMismatch instead of panicking.
+func (p *P9813) SetRGBWsErr(pixels []RGBW) error {
+	if len(pixels) != p.numPixels {
+		return fmt.Errorf("SetRGBWs called with %d pixels, want %d: %w", len(pixels), p.numPixels, ErrPixelCountMismatch)
+	}
+	p.SetRGBWs(pixels)
+	return nil
+}
+
+// RGBAt returns the RGB pixel at the given index.
+func (p *P9813) RGBAt(i int) RGB {
+	o := i * p9813PixelLen
+	return RGB{R: p.pixels[o+3], G: p.pixels[o+2], B: p.pixels[o+1]}
+}
+
+// SetRGBAt sets the RGB pixel at the given index to the given value.
+func (p *P9813) SetRGBAt(i int, rgb RGB) {
+	o := i * p9813PixelLen
+	p.pixels[o] = p9813Flag(rgb)
+	p.pixels[o+1] = rgb.B
+	p.pixels[o+2] = rgb.G
+	p.pixels[o+3] = rgb.R
+}
+
+// RGBAtChecked is like RGBAt, but returns ErrIndexOutOfRange if i is outside
+// the chain.
+func (p *P9813) RGBAtChecked(i int) (RGB, error) {
+	if err := checkIndex(i, p.numPixels); err != nil {
+		return RGB{}, err
+	}
+	return p.RGBAt(i), nil
+}
+
+// SetRGBAtChecked is like SetRGBAt, but returns ErrIndexOutOfRange if i is
+// outside the chain.
+func (p *P9813) SetRGBAtChecked(i int, rgb RGB) error {
+	if err := checkIndex(i, p.numPixels); err != nil {
+		return err
+	}
+	p.SetRGBAt(i, rgb)
+	return nil
+}
+
+// SetRGBs sets the RGB pixels to the given values.
+func (p *P9813) SetRGBs(pixels []RGB) {
+	if len(pixels) != p.numPixels {
+		panic("SetRGBs called with wrong number of pixels")
+	}
+
+	for i, px := range pixels {
+		p.SetRGBAt(i, px)
+	}
+}
+
+// SetRGBsErr is like SetRGBs, but returns ErrPixelCountMismatch instead of panicking.
+func (p *P9813) SetRGBsErr(pixels []RGB) error {
+	if len(pixels) != p.numPixels {
+		return fmt.Errorf("SetRGBs called with %d pixels, want %d: %w", len(pixels), p.numPixels, ErrPixelCountMismatch)
+	}
+	p.SetRGBs(pixels)
+	return nil
+}
@@ -0,0 +1,50 @@
+package ledctl
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestP9813Flag(t *testing.T) {
+	tests := []struct {
+		rgb  RGB
+		want byte
+	}{
+		{RGB{}, 0xFF},
+		{RGB{255, 255, 255}, 0xC0},
+		{RGB{R: 255}, 0xFC},
+		{RGB{G: 255}, 0xF3},
+		{RGB{B: 255}, 0xCF},
+		{RGB{R: 0x40, G: 0x80, B: 0xC0}, 0xC0 | 0<<4 | 1<<2 | 2},
+	}
+	for _, test := range tests {
+		if got := p9813Flag(test.rgb); got != test.want {
+			t.Errorf("p9813Flag(%v) got %02X, want %02X", test.rgb, got, test.want)
+		}
+	}
+}
+
+func TestP9813Flush(t *testing.T) {
+	dev := &fakeDevice{}
+	p, err := newP9813(P9813Config{Device: dev, NumPixels: 2}, nil)
+	if err != nil {
+		t.Fatalf("newP9813: %v", err)
+	}
+	p.SetRGBAt(0, RGB{0x11, 0x22, 0x33})
+	if err := p.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	want := []byte{
+		0x00, 0x00, 0x00, 0x00, // start frame
+		0xFF, 0x33, 0x22, 0x11,
+		0xFF, 0x00, 0x00, 0x00, // still black
+		0x00, 0x00, 0x00, 0x00, // end frame
+	}
+	if got := dev.last(); !bytes.Equal(got, want) {
+		t.Errorf("Flush wrote % X, want % X", got, want)
+	}
+	if got, want := p.RGBAt(0), (RGB{0x11, 0x22, 0x33}); got != want {
+		t.Errorf("RGBAt(0) got %v, want %v", got, want)
+	}
+}
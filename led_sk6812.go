@@ -0,0 +1,56 @@
+package ledctl
+
+import (
+	"fmt"
+)
+
+// sk6812Reset_us is the reset time for SK6812s. The datasheet asks for 80µs,
+// which is longer than the WS281x's 55µs.
+const sk6812Reset_us = 80
+
+// SK6812Config is the configuration for an SK6812 RGBW LED strip. SK6812s are
+// electrically WS281x-compatible, so they're driven by a WS281x controller.
+type SK6812Config struct {
+	// NumPixels is the number of pixels in the strip.
+	NumPixels int
+	// ColorOrder is the color order of the pixels. This must be a 4-color
+	// order, usually GRBW.
+	ColorOrder ColorOrder
+	// PWMFrequency is the frequency to use for the PWM. This is usually
+	// 800000.
+	PWMFrequency uint
+	// DMAChannel is the DMA channel to use. This is usually 10, but it depends
+	// on which Pi you're using. BE CAREFUL, this may damage your Pi if you get
+	// it wrong.
+	DMAChannel int
+	// GPIOPins is a list of GPIO pins to use for the PWM. Usually, this is a
+	// single-item list containing the pin that you're using for the data line.
+	GPIOPins []int
+	// ResetUs is how long, in microseconds, the data line is held low after
+	// each frame. If zero, 80 is used.
+	ResetUs uint
+}
+
+// NewSK6812 creates a new WS281x LED strip controller set up for an SK6812
+// RGBW strip.
+func NewSK6812(config SK6812Config) (*WS281x, error) {
+	offsets, ok := offsets[config.ColorOrder]
+	if !ok || offsets[3] == -1 {
+		return nil, fmt.Errorf("SK6812 needs a 4-color order (e.g. GRBW), got %v", config.ColorOrder)
+	}
+
+	resetUs := config.ResetUs
+	if resetUs == 0 {
+		resetUs = sk6812Reset_us
+	}
+
+	return NewWS281x(WS281xConfig{
+		NumPixels:    config.NumPixels,
+		ColorOrder:   config.ColorOrder,
+		ColorModel:   RGBWModel,
+		PWMFrequency: config.PWMFrequency,
+		DMAChannel:   config.DMAChannel,
+		GPIOPins:     config.GPIOPins,
+		ResetUs:      resetUs,
+	})
+}
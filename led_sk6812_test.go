@@ -0,0 +1,19 @@
+package ledctl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewSK6812ColorOrder(t *testing.T) {
+	for _, order := range []ColorOrder{GRBOrder, RGBOrder, BGROrder} {
+		_, err := NewSK6812(SK6812Config{NumPixels: 10, ColorOrder: order})
+		if err == nil {
+			t.Errorf("NewSK6812 with order %d didn't fail", order)
+			continue
+		}
+		if !strings.Contains(err.Error(), "4-color order") {
+			t.Errorf("NewSK6812 with order %d got err %q, want a color order error", order, err)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package ledctl
+
+import (
+	"fmt"
+	"time"
+
+	rpi "github.com/mxcu/ledctl/rpi"
+)
+
+// ws2801Latch is how long the clock has to idle before a WS2801 latches the
+// data it has received. The datasheet says 500µs; a little extra doesn't hurt.
+const ws2801Latch = 600 * time.Microsecond
+
+// WS2801 controls a WS2801 LED strip.
+type WS2801 struct {
+	rp        *rpi.RPi
+	dev       Device
+	pixels    []byte
+	numColors int
+	numPixels int
+	white     WhiteExtraction
+	g         int
+	r         int
+	b         int
+	w         int
+}
+
+// WS2801Config is the configuration for a WS2801 LED strip.
+type WS2801Config struct {
+	// Device is the SPI device to use. Usually, this is "/dev/spidev0.0".
+	// It isn't included in JSON.
+	Device Device `json:"-"`
+	// NumPixels is the number of pixels in the strip.
+	NumPixels int
+	// SPISpeed is the speed to use for the SPI. WS2801s are usually happy
+	// with anything up to 1000000 or so. If zero, the current speed of the
+	// device is left alone.
+	SPISpeed uint32
+	// ColorOrder is the color order of the pixels. This is usually RGB, but
+	// some strips have different orders.
+	ColorOrder ColorOrder
+	// ColorModel is the color model of the pixels.
+	ColorModel ColorModel
+}
+
+// NewWS2801 creates a new WS2801 LED strip controller.
+func NewWS2801(config WS2801Config) (*WS2801, error) {
+	rp, err := rpi.NewRPi()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't make RPi: %w", err)
+	}
+	return newWS2801(config, rp)
+}
+
+func newWS2801(config WS2801Config, rp *rpi.RPi) (*WS2801, error) {
+	if err := checkOrderModel(config.ColorOrder, config.ColorModel); err != nil {
+		return nil, err
+	}
+
+	offsets := offsets[config.ColorOrder]
+	ws := WS2801{
+		rp:        rp,
+		dev:       config.Device,
+		pixels:    make([]byte, config.NumPixels*config.ColorModel.NumColors()),
+		numColors: config.ColorModel.NumColors(),
+		numPixels: config.NumPixels,
+		g:         offsets[0],
+		r:         offsets[1],
+		b:         offsets[2],
+		w:         offsets[3],
+	}
+
+	if config.SPISpeed != 0 {
+		err := setSPISpeed(rp, ws.dev.Fd(), config.SPISpeed)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &ws, nil
+}
+
+// Close does nothing.
+func (ws *WS2801) Close() error {
+	return nil
+}
+
+// RPi returns the RPi object used to control the SPI.
+func (ws *WS2801) RPi() *rpi.RPi {
+	return ws.rp
+}
+
+// NumPixels returns the number of pixels in the strip.
+func (ws *WS2801) NumPixels() int {
+	return ws.numPixels
+}
+
+// MaxLEDsPerChannel returns the maximum number of LEDs per channel.
+func (ws *WS2801) MaxLEDsPerChannel() int {
+	return 255
+}
+
+// Flush flushes the pixels to the LED strip. It doesn't return until the
+// strip has latched the new data, so the next Flush can't corrupt it.
+func (ws *WS2801) Flush() error {
+	_, err := ws.dev.Write(ws.pixels)
+	if err != nil {
+		return err
+	}
+	time.Sleep(ws2801Latch)
+	return nil
+}
+
+// SetWhiteExtraction sets how the RGB setters derive the white channel on an
+// RGBW strip. The default, WhiteNone, turns it off. It has no effect on RGB
+// strips.
+func (ws *WS2801) SetWhiteExtraction(mode WhiteExtraction) {
+	ws.white = mode
+}
+
+// WhiteExtraction returns the mode set by SetWhiteExtraction.
+func (ws *WS2801) WhiteExtraction() WhiteExtraction {
+	return ws.white
+}
+
+// RGBWAt returns the RGBW pixel at the given index. On an RGB strip, white
+// is always 0.
+func (ws *WS2801) RGBWAt(i int) RGBW {
+	o := i * ws.numColors
+	rgbw := RGBW{R: ws.pixels[o+ws.r], G: ws.pixels[o+ws.g], B: ws.pixels[o+ws.b]}
+	if ws.w >= 0 {
+		rgbw.W = ws.pixels[o+ws.w]
+	}
+	return rgbw
+}
+
+// SetRGBWAt sets the RGBW pixel at the given index to the given value. On an
+// RGB strip, white is ignored.
+func (ws *WS2801) SetRGBWAt(i int, rgbw RGBW) {
+	o := i * ws.numColors
+	ws.pixels[o+ws.r] = rgbw.R
+	ws.pixels[o+ws.g] = rgbw.G
+	ws.pixels[o+ws.b] = rgbw.B
+	if ws.w >= 0 {
+		ws.pixels[o+ws.w] = rgbw.W
+	}
+}
+
+// SetRGBWs sets the RGBW pixels to the given values.
+func (ws *WS2801) SetRGBWs(pixels []RGBW) {
+	if ws.numColors != 4 {
+		panic("SetRGBWs called on WS2801 with numColors != 4")
+	}
+	if len(pixels) != ws.numPixels {
+		panic("SetRGBWs called with wrong number of pixels")
+	}
+
+	a := 0
+	for i := 0; i < len(ws.pixels); i += 4 {
+		ws.pixels[i+ws.r] = pixels[a].R
+		ws.pixels[i+ws.g] = pixels[a].G
+		ws.pixels[i+ws.b] = pixels[a].B
+		ws.pixels[i+ws.w] = pixels[a].W
+		a++
+	}
+}
+
+// SetRGBWsErr is like SetRGBWs, but returns ErrWrongColorModel or
+// ErrPixelCountMismatch instead of panicking.
+func (ws *WS2801) SetRGBWsErr(pixels []RGBW) error {
+	if ws.numColors != 4 {
+		return fmt.Errorf("SetRGBWs called on RGB strip: %w", ErrWrongColorModel)
+	}
+	if len(pixels) != ws.numPixels {
+		return fmt.Errorf("SetRGBWs called with %d pixels, want %d: %w", len(pixels), ws.numPixels, ErrPixelCountMismatch)
+	}
+	ws.SetRGBWs(pixels)
+	return nil
+}
+
+// RGBAt returns the RGB pixel at the given index.
+func (ws *WS2801) RGBAt(i int) RGB {
+	o := i * ws.numColors
+	return RGB{
+		ws.pixels[o+ws.r],
+		ws.pixels[o+ws.g],
+		ws.pixels[o+ws.b],
+	}
+}
+
+// SetRGBAt sets the RGB pixel at the given index to the given value. On an
+// RGBW strip, white is derived as set by SetWhiteExtraction.
+func (ws *WS2801) SetRGBAt(i int, rgb RGB) {
+	if ws.w >= 0 {
+		ws.SetRGBWAt(i, RGBToRGBW(rgb, ws.white))
+		return
+	}
+	o := i * ws.numColors
+	ws.pixels[o+ws.r] = rgb.R
+	ws.pixels[o+ws.g] = rgb.G
+	ws.pixels[o+ws.b] = rgb.B
+}
+
+// RGBAtChecked is like RGBAt, but returns ErrIndexOutOfRange if i is outside
+// the strip.
+func (ws *WS2801) RGBAtChecked(i int) (RGB, error) {
+	if err := checkIndex(i, ws.numPixels); err != nil {
+		return RGB{}, err
+	}
+	return ws.RGBAt(i), nil
+}
+
+// SetRGBAtChecked is like SetRGBAt, but returns ErrIndexOutOfRange if i is
+// outside the strip.
+func (ws *WS2801) SetRGBAtChecked(i int, rgb RGB) error {
+	if err := checkIndex(i, ws.numPixels); err != nil {
+		return err
+	}
+	ws.SetRGBAt(i, rgb)
+	return nil
+}
+
+// SetRGBs sets the RGB pixels to the given values.
+func (ws *WS2801) SetRGBs(pixels []RGB) {
+	if ws.numColors != 3 {
+		panic("SetRGBs called on RGBW strip")
+	}
+	if len(pixels) != ws.numPixels {
+		panic("SetRGBs called with wrong number of pixels")
+	}
+
+	a := 0
+	for i := 0; i < len(ws.pixels); i += 3 {
+		ws.pixels[i+ws.r] = pixels[a].R
+		ws.pixels[i+ws.g] = pixels[a].G
+		ws.pixels[i+ws.b] = pixels[a].B
+		a++
+	}
+}
+
+// SetRGBsErr is like SetRGBs, but returns ErrWrongColorModel or
+// ErrPixelCountMismatch instead of panicking.
+func (ws *WS2801) SetRGBsErr(pixels []RGB) error {
+	if ws.numColors != 3 {
+		return fmt.Errorf("SetRGBs called on RGBW strip: %w", ErrWrongColorModel)
+	}
+	if len(pixels) != ws.numPixels {
+		return fmt.Errorf("SetRGBs called with %d pixels, want %d: %w", len(pixels), ws.numPixels, ErrPixelCountMismatch)
+	}
+	ws.SetRGBs(pixels)
+	return nil
+}
@@ -0,0 +1,57 @@
+package ledctl
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWS2801Flush(t *testing.T) {
+	tests := []struct {
+		name  string
+		order ColorOrder
+		want  []byte
+	}{
+		{"RGB", RGBOrder, []byte{0x11, 0x22, 0x33, 0x44, 0x55, 0x66}},
+		{"GRB", GRBOrder, []byte{0x22, 0x11, 0x33, 0x55, 0x44, 0x66}},
+		{"BGR", BGROrder, []byte{0x33, 0x22, 0x11, 0x66, 0x55, 0x44}},
+	}
+
+	for _, test := range tests {
+		dev := &fakeDevice{}
+		ws, err := newWS2801(WS2801Config{
+			Device:     dev,
+			NumPixels:  2,
+			ColorOrder: test.order,
+			ColorModel: RGBModel,
+		}, nil)
+		if err != nil {
+			t.Fatalf("%s: newWS2801: %v", test.name, err)
+		}
+		ws.SetRGBs([]RGB{{0x11, 0x22, 0x33}, {0x44, 0x55, 0x66}})
+
+		start := time.Now()
+		if err := ws.Flush(); err != nil {
+			t.Fatalf("%s: Flush: %v", test.name, err)
+		}
+		if elapsed := time.Since(start); elapsed < ws2801Latch {
+			t.Errorf("%s: Flush returned after %v, want at least %v", test.name, elapsed, ws2801Latch)
+		}
+		if got := dev.last(); !bytes.Equal(got, test.want) {
+			t.Errorf("%s: Flush wrote % X, want % X", test.name, got, test.want)
+		}
+	}
+}
+
+func TestWS2801SetRGBsPanics(t *testing.T) {
+	ws, err := newWS2801(WS2801Config{Device: &fakeDevice{}, NumPixels: 2, ColorModel: RGBModel}, nil)
+	if err != nil {
+		t.Fatalf("newWS2801: %v", err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("SetRGBs with wrong number of pixels didn't panic")
+		}
+	}()
+	ws.SetRGBs([]RGB{{}})
+}
@@ -1,19 +1,64 @@
 package ledctl
 
 import (
+	"context"
 	"fmt"
+	"image"
+	"log"
+	"sync"
+	"time"
 
 	rpi "github.com/mxcu/ledctl/rpi"
 )
 
 // WS281x controls a WS281x LED strip.
+//
+// All of its methods are safe to call from multiple goroutines at once: the
+// setters, Flush and Close take an exclusive lock, and the getters a shared
+// one.
 type WS281x struct {
+	mu         sync.RWMutex
 	pixDMAUint []uint32
 	pixDMA     *rpi.DMABuf
 	rp         *rpi.RPi
 	pixels     []byte
+	front      []byte
+	deep       []uint16
+	frontDeep  []uint16
+	deepTable  []uint16
+	palette    Palette
+	white      WhiteExtraction
+	reversed   bool
+	indexes    []uint8
 	numPixels  int
 	numColors  int
+	channels   int
+	chanPixels int
+	separate   bool
+	source     DMASource
+	resetUs    uint
+	dmaBytes   uint
+	brightness uint8
+	gamma      float64
+	correction ColorCorrection
+	gammaTable [256]uint8
+	outTable   [256]uint8
+	outB       uint8
+	outOK      bool
+	powerLimit float64
+	encodedB   uint8
+	floor      uint8
+	caps       [4]uint8
+	dither     []uint8
+	corrected  []byte
+	dirty      dirtyRange
+	skip       bool
+	lastSent   []uint32
+	sentOK     bool
+	skipped    int
+	observer   func(FlushStats)
+	closed     bool
+	timeout    time.Duration
 	g          int
 	r          int
 	b          int
@@ -22,6 +67,20 @@ type WS281x struct {
 
 const ledReset_us = 55
 
+// DMASource is the peripheral that the DMA feeds to send the data to the
+// strip.
+type DMASource int
+
+const (
+	// PWMSource uses the PWM, on GPIO 12 or 18 (or 13 or 19 for the second
+	// channel). It can't be used at the same time as the onboard audio.
+	PWMSource DMASource = iota
+	// PCMSource uses the PCM, on GPIO 21. It leaves the onboard audio alone,
+	// but can't be used at the same time as I2S audio, and only has one
+	// channel.
+	PCMSource
+)
+
 // WS281xConfig is the configuration for a WS281x LED strip.
 type WS281xConfig struct {
 	// NumPixels is the number of pixels in the strip.
@@ -36,81 +95,253 @@ type WS281xConfig struct {
 	PWMFrequency uint
 	// DMAChannel is the DMA channel to use. This is usually 10, but it depends
 	// on which Pi you're using. BE CAREFUL, this may damage your Pi if you get
-	// it wrong.
+	// it wrong. Channels known to be reserved are rejected.
 	DMAChannel int
 	// GPIOPins is a list of GPIO pins to use for the PWM. Usually, this is a
 	// single-item list containing the pin that you're using for the data line.
+	// The pin at index i has to be one that PWM channel i can be routed to on
+	// the detected Pi, such as 12 or 18 for the first channel. With
+	// PCMSource, it has to be the single pin 21.
+	//
+	// With two pins, each PWM channel drives its own strip of NumPixels
+	// pixels, and the WS281x has twice as many: those of the second pin's
+	// strip come after those of the first. Segment can address each one.
+	// Note that this doubles NumPixels for two-pin configs that used to
+	// send the same pixels on both pins; set MirrorChannels to keep that.
 	GPIOPins []int
+	// MirrorChannels makes both pins in GPIOPins send the same NumPixels
+	// pixels instead, e.g. to split the load of one long display over two
+	// data lines. It does nothing with a single pin.
+	MirrorChannels bool
+	// ResetUs is how long, in microseconds, the data line is held low after
+	// each frame so that the LEDs latch it. If zero, 55 is used, which suits
+	// WS2812s. SK6812s and some WS2813s want 80 or more; short strips may get
+	// away with less for a higher frame rate.
+	ResetUs uint
+	// DMASource is the peripheral that sends the data. The default is
+	// PWMSource. GPIOPins has to suit it.
+	DMASource DMASource
+	// StrictAudioCheck makes NewWS281x fail with an error wrapping
+	// rpi.ErrPWMInUse when the onboard audio looks like it's using the PWM.
+	// Otherwise it only logs a warning, since Raspberry Pi OS turns the audio
+	// on by default and it only garbles the LEDs while something is playing.
+	StrictAudioCheck bool
+	// FlushTimeout is how long a flush waits for the previous frame to finish
+	// sending before it gives up with an error wrapping rpi.ErrDMATimeout. If
+	// zero, it waits for as long as the RPi does.
+	FlushTimeout time.Duration
+}
+
+// DefaultWS281xConfig returns the config for the usual WS2812 strip of
+// numPixels RGB pixels in GRB order, driven at 800kHz on GPIO 18 with DMA
+// channel 10. The With methods change it from there, e.g.
+//
+//	DefaultWS281xConfig(60).WithColorOrder(RGBOrder)
+func DefaultWS281xConfig(numPixels int) WS281xConfig {
+	return WS281xConfig{
+		NumPixels:    numPixels,
+		ColorOrder:   GRBOrder,
+		ColorModel:   RGBModel,
+		PWMFrequency: 800000,
+		DMAChannel:   10,
+		GPIOPins:     []int{18},
+	}
+}
+
+// WithColorOrder returns a copy of the config with the given color order.
+func (c WS281xConfig) WithColorOrder(order ColorOrder) WS281xConfig {
+	c.ColorOrder = order
+	return c
+}
+
+// WithColorModel returns a copy of the config with the given color model.
+func (c WS281xConfig) WithColorModel(model ColorModel) WS281xConfig {
+	c.ColorModel = model
+	return c
+}
+
+// WithDMAChannel returns a copy of the config with the given DMA channel.
+func (c WS281xConfig) WithDMAChannel(channel int) WS281xConfig {
+	c.DMAChannel = channel
+	return c
+}
+
+// WithGPIOPins returns a copy of the config with the given GPIO pins.
+func (c WS281xConfig) WithGPIOPins(pins ...int) WS281xConfig {
+	c.GPIOPins = append([]int(nil), pins...)
+	return c
 }
 
 // NewWS281x creates a new WS281x LED strip controller.
 func NewWS281x(config WS281xConfig) (*WS281x, error) {
+	if err := checkOrderModel(config.ColorOrder, config.ColorModel); err != nil {
+		return nil, err
+	}
+
 	rp, err := rpi.NewRPi()
 	if err != nil {
-		return nil, fmt.Errorf("couldn't init RPi: %v", err)
+		return nil, fmt.Errorf("couldn't init RPi: %w", err)
 	}
+	return NewWS281xWithRPi(rp, config)
+}
 
-	offsets := offsets[config.ColorOrder]
-	wa := WS281x{
-		numPixels: config.NumPixels,
-		numColors: config.ColorModel.NumColors(),
-		pixels:    make([]byte, config.NumPixels*config.ColorModel.NumColors()),
-		rp:        rp,
-		g:         offsets[0],
-		r:         offsets[1],
-		b:         offsets[2],
-		w:         offsets[3],
-	}
-
-	bytes := wa.pwmByteCount(config.PWMFrequency)
+// checkPWMAudio is how NewWS281xWithRPi checks for the onboard audio, which
+// tests can replace.
+var checkPWMAudio = (*rpi.RPi).CheckPWMAudio
+
+// NewWS281xWithRPi is like NewWS281x, but uses rp instead of making its own
+// RPi, so that it can share one with other controllers. Close only frees what
+// the WS281x itself set up, never rp. A Pi only has one PWM, though, so only
+// one WS281x can use each RPi.
+func NewWS281xWithRPi(rp *rpi.RPi, config WS281xConfig) (*WS281x, error) {
+	if err := checkOrderModel(config.ColorOrder, config.ColorModel); err != nil {
+		return nil, err
+	}
+
+	if err := rpi.CheckDMAChannel(config.DMAChannel); err != nil {
+		return nil, err
+	}
+	switch config.DMASource {
+	case PWMSource:
+		if err := rp.CheckPWMPins(config.GPIOPins); err != nil {
+			return nil, err
+		}
+		if err := checkPWMAudio(rp); err != nil {
+			if config.StrictAudioCheck {
+				return nil, err
+			}
+			log.Printf("warning: %v\n", err)
+		}
+	case PCMSource:
+		if err := rp.CheckPCMPins(config.GPIOPins); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown DMA source %d", config.DMASource)
+	}
+
+	wa := makeWS281x(config)
+	wa.rp = rp
+
+	var err error
+	bytes := wa.dmaBytes
 	wa.pixDMA, err = rp.GetDMABuf(bytes)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't get DMA buffer: %v", err)
+		return nil, fmt.Errorf("couldn't get DMA buffer: %w", err)
 	}
 
 	wa.pixDMAUint = wa.pixDMA.Uint32Slice()
 	err = rp.InitDMA(config.DMAChannel)
 	if err != nil {
 		rp.FreeDMABuf(wa.pixDMA) // Ignore error
-		return nil, fmt.Errorf("couldn't init registers: %v", err)
+		return nil, fmt.Errorf("couldn't init registers: %w", err)
 	}
 
 	err = rp.InitGPIO()
 	if err != nil {
 		rp.FreeDMABuf(wa.pixDMA) // Ignore error
-		return nil, fmt.Errorf("couldn't init GPIO: %v", err)
+		return nil, fmt.Errorf("couldn't init GPIO: %w", err)
 	}
 
-	err = rp.InitPWM(config.PWMFrequency, wa.pixDMA, bytes, config.GPIOPins)
-	if err != nil {
-		rp.FreeDMABuf(wa.pixDMA) // Ignore error
-		return nil, fmt.Errorf("couldn't init PWM: %v", err)
+	if config.DMASource == PCMSource {
+		err = rp.InitPCM(config.PWMFrequency, wa.pixDMA, bytes, config.GPIOPins[0])
+		if err != nil {
+			rp.FreeDMABuf(wa.pixDMA) // Ignore error
+			return nil, fmt.Errorf("couldn't init PCM: %w", err)
+		}
+	} else {
+		err = rp.InitPWM(config.PWMFrequency, wa.pixDMA, bytes, config.GPIOPins)
+		if err != nil {
+			rp.FreeDMABuf(wa.pixDMA) // Ignore error
+			return nil, fmt.Errorf("couldn't init PWM: %w", err)
+		}
 	}
 
-	return &wa, nil
+	return wa, nil
 }
 
-// Close closes the WS281x LED strip controller.
+// makeWS281x sets up everything in a WS281x that doesn't touch the hardware.
+func makeWS281x(config WS281xConfig) *WS281x {
+	offsets := offsets[config.ColorOrder]
+	resetUs := config.ResetUs
+	if resetUs == 0 {
+		resetUs = ledReset_us
+	}
+	// The PWM has two channels, whose words take turns in the buffer. The
+	// PCM only has one.
+	channels := rpi.RPI_PWM_CHANNELS
+	if config.DMASource == PCMSource {
+		channels = 1
+	}
+	// Unless they're mirrored, each pin gets its own NumPixels pixels.
+	numPixels := config.NumPixels
+	separate := len(config.GPIOPins) > 1 && !config.MirrorChannels && channels > 1
+	if separate {
+		numPixels *= channels
+	}
+	ws := &WS281x{
+		numPixels:  numPixels,
+		numColors:  config.ColorModel.NumColors(),
+		channels:   channels,
+		chanPixels: config.NumPixels,
+		separate:   separate,
+		source:     config.DMASource,
+		pixels:     make([]byte, numPixels*config.ColorModel.NumColors()),
+		resetUs:    resetUs,
+		timeout:    config.FlushTimeout,
+		brightness: 255,
+		caps:       [4]uint8{255, 255, 255, 255},
+		gamma:      1,
+		gammaTable: makeGammaTable(1),
+		dirty:      dirtyRange{0, numPixels},
+		g:          offsets[0],
+		r:          offsets[1],
+		b:          offsets[2],
+		w:          offsets[3],
+	}
+	ws.dmaBytes = ws.pwmByteCount(config.PWMFrequency)
+	return ws
+}
+
+// Close closes the WS281x LED strip controller. Closing it again does nothing.
 func (ws *WS281x) Close() error {
-	ws.rp.StopPWM()
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.closed {
+		return nil
+	}
+	// Stopping the PWM or PCM mid-frame would cut off the last one, which
+	// is usually the blank frame that turns the LEDs off. The hardware is
+	// stopped even if the wait fails, though.
+	werr := ws.waitForDMAEnd(context.Background())
+	if ws.source == PCMSource {
+		ws.rp.StopPCM()
+	} else {
+		ws.rp.StopPWM()
+	}
 
 	if err := ws.rp.FreeDMABuf(ws.pixDMA); err != nil {
-		return fmt.Errorf("couldn't free DMA buffer: %v", err)
+		return fmt.Errorf("couldn't free DMA buffer: %w", err)
+	}
+	ws.closed = true
+	if werr != nil {
+		return fmt.Errorf("couldn't wait for the last frame: %w", werr)
 	}
 
 	return nil
 }
 
 // pwmByteCount calculates the number of bytes needed to store the data for PWM
-// to send - three bits per WS281x bit, plus enough bits to provide an
-// appropriate reset time afterwards at the given frequency. It returns that
-// byte count.
+// (or PCM) to send - three bits per WS281x bit, plus enough bits to provide an
+// appropriate reset time afterwards at the given frequency, for each channel.
+// It returns that byte count.
 func (ws *WS281x) pwmByteCount(freq uint) uint {
 	// Every bit transmitted needs 3 bits of buffer, because bits are transmitted as
 	// ‾|__ (0) or ‾‾|_ (1). Each color of each pixel needs 8 "real" bits.
-	bits := uint(3 * ws.numColors * ws.numPixels * 8)
+	bits := uint(3 * ws.numColors * ws.chanPixels * 8)
 
-	// freq is typically 800kHz, so for LED_RESET_US=55 us, this gives us
+	// freq is typically 800kHz, so for the default resetUs=55 us, this gives us
 	// ((55 * (800000 * 3)) / 1000000
 	// ((55 * 2400000) / 1000000
 	// 132000000 / 1000000
@@ -118,7 +349,7 @@ func (ws *WS281x) pwmByteCount(freq uint) uint {
 	// Taking this the other way, 132 bits of buffer is 132/3=44 "real" bits.
 	// With each "real" bit taking 1/800000th of a second, this will take
 	// 44/800000ths of a second, which is 0.000055s - 55 us.
-	bits += ((ledReset_us * (freq * 3)) / 1000000)
+	bits += ((ws.resetUs * (freq * 3)) / 1000000)
 
 	// This isn't a PDP-11, so there are 8 bits in a byte
 	bytes := bits / 8
@@ -127,11 +358,41 @@ func (ws *WS281x) pwmByteCount(freq uint) uint {
 	bytes -= bytes % 4
 	bytes += 4
 
-	bytes *= rpi.RPI_PWM_CHANNELS
+	bytes *= uint(ws.channels)
 
 	return bytes
 }
 
+// DMAStats describes the DMA buffer of a WS281x.
+type DMAStats struct {
+	// AllocatedBytes is the size of the buffer, not counting the DMA control
+	// block in front of it.
+	AllocatedBytes int
+	// PixelBytes is how much of it holds the symbols for the pixels, for all
+	// channels.
+	PixelBytes int
+	// ResetBytes is the rest, which holds the low signal that latches the
+	// pixels, and rounding up to whole words.
+	ResetBytes int
+}
+
+// DMABufferBytes returns the size of the DMA buffer allocated for the pixels.
+// It needs to be physically contiguous, so long strips can fail to get one.
+func (ws *WS281x) DMABufferBytes() int {
+	return int(ws.dmaBytes)
+}
+
+// DMAStats returns how the DMA buffer is used.
+func (ws *WS281x) DMAStats() DMAStats {
+	// 3 bits of symbols per bit, so 3 bytes per byte.
+	pixelBytes := 3 * ws.numColors * ws.chanPixels * ws.channels
+	return DMAStats{
+		AllocatedBytes: int(ws.dmaBytes),
+		PixelBytes:     pixelBytes,
+		ResetBytes:     int(ws.dmaBytes) - pixelBytes,
+	}
+}
+
 // RPi returns the RPi object that this WS281x is using.
 func (ws *WS281x) RPi() *rpi.RPi {
 	return ws.rp
@@ -143,31 +404,725 @@ func (ws *WS281x) MaxLEDsPerChannel() int {
 	return 255
 }
 
-// RGBWAt returns the RGBW pixel at the given index.
-// If numColors is 3, then white is an undefined value.
+// Pixels returns the pixel buffer, with NumColors bytes per pixel in the
+// strip's color order. It's the live buffer, not a copy, so changes to it show
+// up in the next Flush. They aren't seen by FlushPartial, and aren't protected
+// by the controller's lock. With double buffering on, it's the back buffer.
+func (ws *WS281x) Pixels() []byte {
+	return ws.pixels
+}
+
+// NumPixels returns the number of pixels in the strip.
+func (ws *WS281x) NumPixels() int {
+	return ws.numPixels
+}
+
+// NumColors returns the number of colors per pixel.
+func (ws *WS281x) NumColors() int {
+	return ws.numColors
+}
+
+// WriteFrame replaces all the pixels with data, which must have NumColors
+// bytes per pixel, already in the strip's color order. Like the other setters,
+// it doesn't flush.
+func (ws *WS281x) WriteFrame(data []byte) error {
+	if len(data) != len(ws.pixels) {
+		return fmt.Errorf("frame has %d bytes, want %d: %w", len(data), len(ws.pixels), ErrPixelCountMismatch)
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	copy(ws.pixels, data)
+	ws.syncDeep(0, len(ws.pixels))
+	ws.dirty.markAll(ws.numPixels)
+	return nil
+}
+
+// Snapshot returns a copy of the pixels, which can be given to Restore later.
+func (ws *WS281x) Snapshot() []byte {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	return append([]byte(nil), ws.pixels...)
+}
+
+// Restore sets the pixels back to a copy returned by Snapshot. Like the other
+// setters, it doesn't flush.
+func (ws *WS281x) Restore(snapshot []byte) error {
+	if len(snapshot) != len(ws.pixels) {
+		return fmt.Errorf("snapshot has %d bytes, want %d: %w", len(snapshot), len(ws.pixels), ErrPixelCountMismatch)
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	copy(ws.pixels, snapshot)
+	ws.syncDeep(0, len(ws.pixels))
+	ws.dirty.markAll(ws.numPixels)
+	return nil
+}
+
+// Segment returns a view of length pixels starting at start, which can be
+// used like a strip of its own.
+func (ws *WS281x) Segment(start, length int) (*Segment, error) {
+	return NewSegment(ws, start, length)
+}
+
+// SetBrightness sets the brightness that all pixels are scaled by when they're
+// flushed, where 255 is full brightness and 0 is off. The stored pixel values
+// are unaffected.
+func (ws *WS281x) SetBrightness(b uint8) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.brightness = b
+	ws.dirty.markAll(ws.numPixels)
+}
+
+// Brightness returns the brightness set by SetBrightness.
+func (ws *WS281x) Brightness() uint8 {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	return ws.brightness
+}
+
+// SetGamma sets the gamma correction applied to each channel when the pixels
+// are flushed. The default of 1 leaves the pixels unchanged; 2.2 or so makes
+// fades look more even to the eye. The stored pixel values are unaffected.
+func (ws *WS281x) SetGamma(gamma float64) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if gamma == ws.gamma {
+		return
+	}
+	ws.gamma = gamma
+	ws.gammaTable = makeCorrectionTable(ws.correction, gamma)
+	ws.outOK = false
+	ws.deepTable = nil
+	ws.dirty.markAll(ws.numPixels)
+}
+
+// SetChannelCaps sets the maximum output of each channel, which is scaled by
+// cap/255 when the pixels are flushed, e.g. to white-balance a strip whose
+// white is much brighter than its colors. On an RGB strip, w is ignored. The
+// default caps of 255 leave the channels alone, and a cap of 0 keeps its
+// channel off even with SetMinBrightness.
+func (ws *WS281x) SetChannelCaps(r, g, b, w uint8) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.caps[ws.r], ws.caps[ws.g], ws.caps[ws.b] = r, g, b
+	if ws.w >= 0 {
+		ws.caps[ws.w] = w
+	}
+	ws.dirty.markAll(ws.numPixels)
+}
+
+// ChannelCaps returns the caps set by SetChannelCaps. On an RGB strip, w is
+// always 255.
+func (ws *WS281x) ChannelCaps() (r, g, b, w uint8) {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	w = 255
+	if ws.w >= 0 {
+		w = ws.caps[ws.w]
+	}
+	return ws.caps[ws.r], ws.caps[ws.g], ws.caps[ws.b], w
+}
+
+// SetMinBrightness sets the floor that any channel that isn't 0 is raised to
+// when the pixels are flushed, after the gamma, brightness and dithering, so
+// that slow fades don't blink out before they reach 0. Channels that are 0
+// stay off, as does everything with a brightness of 0. The default of 0 turns
+// it off.
+func (ws *WS281x) SetMinBrightness(floor uint8) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.floor = floor
+	ws.dirty.markAll(ws.numPixels)
+}
+
+// MinBrightness returns the floor set by SetMinBrightness.
+func (ws *WS281x) MinBrightness() uint8 {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	return ws.floor
+}
+
+// Gamma returns the gamma set by SetGamma.
+func (ws *WS281x) Gamma() float64 {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	return ws.gamma
+}
+
+// SetColorCorrection sets how each channel is corrected when the pixels are
+// flushed. The default, GammaCorrection, uses the gamma set by SetGamma;
+// SRGBCorrection suits sRGB sources such as video better, being closer to
+// what they were mastered for near black.
+func (ws *WS281x) SetColorCorrection(c ColorCorrection) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if c == ws.correction {
+		return
+	}
+	ws.correction = c
+	ws.gammaTable = makeCorrectionTable(c, ws.gamma)
+	ws.outOK = false
+	ws.deepTable = nil
+	ws.dirty.markAll(ws.numPixels)
+}
+
+// ColorCorrection returns the color correction set by SetColorCorrection.
+func (ws *WS281x) ColorCorrection() ColorCorrection {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	return ws.correction
+}
+
+// SetDoubleBuffering turns double buffering on or off. With it on, the setters
+// and getters work on a back buffer, and flushes send the front buffer, which
+// only changes when SwapBuffers is called. That way, a frame can be rendered
+// bit by bit without a flush ever sending half of it. It's off by default.
+func (ws *WS281x) SetDoubleBuffering(on bool) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if on == (ws.front != nil) {
+		return
+	}
+	ws.front = nil
+	ws.frontDeep = nil
+	if on {
+		ws.front = append([]byte(nil), ws.pixels...)
+		ws.frontDeep = append([]uint16(nil), ws.deep...)
+	}
+}
+
+// DoubleBuffering returns whether double buffering was turned on by
+// SetDoubleBuffering.
+func (ws *WS281x) DoubleBuffering() bool {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	return ws.front != nil
+}
+
+// SwapBuffers makes the back buffer the front buffer, so that the next flush
+// sends it. The back buffer keeps the same pixels, ready for the next frame to
+// be drawn over them. It does nothing if double buffering is off.
+func (ws *WS281x) SwapBuffers() {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.front == nil {
+		return
+	}
+	copy(ws.front, ws.pixels)
+	if ws.deep != nil {
+		ws.frontDeep = append(ws.frontDeep[:0], ws.deep...)
+	}
+	ws.dirty.markAll(ws.numPixels)
+}
+
+// output returns the buffer that flushes send: the front buffer if double
+// buffering is on, and the only buffer otherwise.
+func (ws *WS281x) output() []byte {
+	if ws.front != nil {
+		return ws.front
+	}
+	return ws.pixels
+}
+
+// output16 returns the 16-bit values that go with output, or nil if none were
+// ever set.
+func (ws *WS281x) output16() []uint16 {
+	if ws.front != nil {
+		return ws.frontDeep
+	}
+	return ws.deep
+}
+
+// SetPalette puts the strip in indexed mode, where each pixel is a palette
+// index set by SetIndexAt, and flushes look each one up in p, which can have
+// at most 256 colors. Changing the palette recolors the whole strip at once,
+// which makes palette-cycling animations cheap. A nil palette turns indexed
+// mode off again. The indexes start at 0 and aren't double buffered.
+//
+// The RGB pixels are kept but not shown, so indexed mode takes a byte per
+// pixel more memory, not less.
+func (ws *WS281x) SetPalette(p Palette) error {
+	if len(p) > 256 {
+		return fmt.Errorf("palette has %d colors, want at most 256", len(p))
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.palette = nil
+	if p != nil {
+		ws.palette = append(Palette{}, p...)
+		if ws.indexes == nil {
+			ws.indexes = make([]uint8, ws.numPixels)
+		}
+	}
+	ws.dirty.markAll(ws.numPixels)
+	return nil
+}
+
+// Palette returns a copy of the palette set by SetPalette.
+func (ws *WS281x) Palette() Palette {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	if ws.palette == nil {
+		return nil
+	}
+	return append(Palette{}, ws.palette...)
+}
+
+// SetIndexAt sets the palette index of the pixel at the given index. Indexes
+// past the end of the palette show as black. It returns ErrNoPalette if the
+// strip isn't in indexed mode, and ErrIndexOutOfRange if i is outside the
+// strip.
+func (ws *WS281x) SetIndexAt(i int, idx uint8) error {
+	if err := checkIndex(i, ws.numPixels); err != nil {
+		return err
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.palette == nil {
+		return ErrNoPalette
+	}
+	p := ws.phys(i)
+	ws.indexes[p] = idx
+	ws.dirty.mark(p)
+	return nil
+}
+
+// IndexAt returns the palette index of the pixel at the given index.
+func (ws *WS281x) IndexAt(i int) uint8 {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	if ws.indexes == nil {
+		return 0
+	}
+	return ws.indexes[ws.phys(i)]
+}
+
+// paletteByte returns the output byte j in indexed mode, looking its pixel up
+// in the palette. White is always off.
+func (ws *WS281x) paletteByte(j int) uint8 {
+	rgb := ws.palette.At(ws.indexes[j/ws.numColors])
+	switch j % ws.numColors {
+	case ws.r:
+		return rgb.R
+	case ws.g:
+		return rgb.G
+	case ws.b:
+		return rgb.B
+	default:
+		return 0
+	}
+}
+
+// SetDithering turns temporal dithering on or off. With it on, the rounding
+// error from applying the gamma and brightness to each channel is carried
+// over to the next Flush, so that over several frames dim colors average out
+// to their exact value instead of banding. It's off by default.
+func (ws *WS281x) SetDithering(on bool) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if on == (ws.dither != nil) {
+		return
+	}
+	ws.dither = nil
+	if on {
+		ws.dither = newDither(len(ws.pixels))
+	}
+}
+
+// Dithering returns whether dithering was turned on by SetDithering.
+func (ws *WS281x) Dithering() bool {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	return ws.dither != nil
+}
+
+// SetPowerLimit makes Flush dim all the pixels evenly, on top of the
+// brightness, whenever they'd otherwise draw more than maxMilliamps as
+// estimated with DefaultChannelMilliamps and DefaultIdleMilliamps. Zero, the
+// default, means no limit.
+func (ws *WS281x) SetPowerLimit(maxMilliamps float64) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.powerLimit = maxMilliamps
+	ws.dirty.markAll(ws.numPixels)
+}
+
+// PowerLimit returns the limit set by SetPowerLimit.
+func (ws *WS281x) PowerLimit() float64 {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	return ws.powerLimit
+}
+
+// EstimatedMilliamps estimates the current the strip draws with its current
+// pixels, gamma and brightness, ignoring any power limit. Each channel is
+// taken to draw perChannelMax at full brightness, or DefaultChannelMilliamps
+// if perChannelMax is zero, and each pixel to draw idle on top.
+func (ws *WS281x) EstimatedMilliamps(perChannelMax, idle float64) float64 {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	return estimateMilliamps(ws.level(), 255, ws.numPixels, ws.brightness, perChannelMax, idle)
+}
+
+// level returns the sum of all the gamma-corrected channel values.
+func (ws *WS281x) level() float64 {
+	level := 0
+	for j, v := range ws.output() {
+		if ws.palette != nil {
+			v = ws.paletteByte(j)
+		}
+		level += int(ws.gammaTable[v])
+	}
+	return float64(level)
+}
+
+// outputBrightness returns the brightness to encode with: the set brightness,
+// lowered if need be to stay within the power limit.
+func (ws *WS281x) outputBrightness() uint8 {
+	if ws.powerLimit <= 0 {
+		return ws.brightness
+	}
+	return limitBrightness(ws.level(), 255, ws.numPixels, ws.brightness, ws.powerLimit)
+}
+
+// Clear sets all pixels to black. Like the other setters, it doesn't flush.
+func (ws *WS281x) Clear() {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	for i := range ws.pixels {
+		ws.pixels[i] = 0
+	}
+	ws.syncDeep(0, len(ws.pixels))
+	ws.dirty.markAll(ws.numPixels)
+}
+
+// Fill sets all pixels to the given RGB value.
+func (ws *WS281x) Fill(rgb RGB) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	for i := 0; i < ws.numPixels; i++ {
+		ws.setRGBAt(i, rgb)
+	}
+}
+
+// SetRange sets count pixels from start to the given RGB value. Pixels that
+// would be past the end of the strip are left out; it only returns
+// ErrIndexOutOfRange, without setting anything, if start isn't in
+// [0, NumPixels()] or count is negative. A start of NumPixels() sets nothing.
+func (ws *WS281x) SetRange(start, count int, rgb RGB) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	count, err := clipRange(start, count, ws.numPixels)
+	if err != nil {
+		return err
+	}
+	for i := start; i < start+count; i++ {
+		ws.setRGBAt(ws.phys(i), rgb)
+	}
+	return nil
+}
+
+// SetRangeSlice sets the pixels from start to the given RGB values, clipped
+// like SetRange.
+func (ws *WS281x) SetRangeSlice(start int, colors []RGB) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	count, err := clipRange(start, len(colors), ws.numPixels)
+	if err != nil {
+		return err
+	}
+	for i, rgb := range colors[:count] {
+		ws.setRGBAt(ws.phys(start+i), rgb)
+	}
+	return nil
+}
+
+// SetFromImageRow sets the pixels to colors sampled evenly across the given
+// row of img, counting from the top of its bounds, as if they were set with
+// SetRGBAt. It returns ErrIndexOutOfRange if img doesn't have the row.
+func (ws *WS281x) SetFromImageRow(img image.Image, row int) error {
+	colors, err := sampleImageRow(img, row, ws.numPixels)
+	if err != nil {
+		return err
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	for i, rgb := range colors {
+		ws.setRGBAt(ws.phys(i), rgb)
+	}
+	return nil
+}
+
+// SetTestPattern sets all pixels to full red, green, blue or white for phase
+// 0, 1, 2 or 3, repeating for higher phases. Watching which color lights in
+// each phase shows the strip's color order; see GuessColorOrder.
+func (ws *WS281x) SetTestPattern(phase int) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	rgbw := testPatternColor(phase, ws.numColors)
+	for i := 0; i < ws.numPixels; i++ {
+		ws.setRGBWAt(i, rgbw)
+	}
+}
+
+// FillRGBW sets all pixels to the given RGBW value. On an RGB strip, white is
+// ignored.
+func (ws *WS281x) FillRGBW(rgbw RGBW) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	for i := 0; i < ws.numPixels; i++ {
+		ws.setRGBWAt(i, rgbw)
+	}
+}
+
+// Shift moves every pixel n places towards the end of the strip, or -n places
+// towards the start if n is negative. Pixels moved off one end are lost, and
+// the ones left empty at the other end are set to fill (with white off).
+func (ws *WS281x) Shift(n int, fill RGB) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.reversed && ws.separate {
+		ws.moveLogical(n, false, fill)
+		return
+	}
+	if ws.reversed {
+		n = -n
+	}
+	lo, hi := 0, ws.numPixels
+	switch {
+	case n >= ws.numPixels || -n >= ws.numPixels:
+	case n > 0:
+		copy(ws.pixels[n*ws.numColors:], ws.pixels)
+		if ws.deep != nil {
+			copy(ws.deep[n*ws.numColors:], ws.deep)
+		}
+		hi = n
+	case n < 0:
+		copy(ws.pixels, ws.pixels[-n*ws.numColors:])
+		if ws.deep != nil {
+			copy(ws.deep, ws.deep[-n*ws.numColors:])
+		}
+		lo = ws.numPixels + n
+	default:
+		return
+	}
+	for i := lo; i < hi; i++ {
+		for j := 0; j < ws.numColors; j++ {
+			ws.pixels[i*ws.numColors+j] = 0
+		}
+		ws.setRGBAt(i, fill)
+	}
+	ws.syncDeep(lo*ws.numColors, hi*ws.numColors)
+	ws.dirty.markAll(ws.numPixels)
+}
+
+// Rotate moves every pixel n places towards the end of the strip, or -n places
+// towards the start if n is negative, wrapping pixels moved off one end around
+// to the other.
+func (ws *WS281x) Rotate(n int) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.numPixels == 0 {
+		return
+	}
+	if ws.reversed && ws.separate {
+		ws.moveLogical(n, true, RGB{})
+		return
+	}
+	if ws.reversed {
+		n = -n
+	}
+	n %= ws.numPixels
+	if n < 0 {
+		n += ws.numPixels
+	}
+	if n == 0 {
+		return
+	}
+	// Rotating right by k is reversing the whole thing, then each side of k.
+	k := n * ws.numColors
+	reverseBytes(ws.pixels)
+	reverseBytes(ws.pixels[:k])
+	reverseBytes(ws.pixels[k:])
+	if ws.deep != nil {
+		reverseUint16s(ws.deep)
+		reverseUint16s(ws.deep[:k])
+		reverseUint16s(ws.deep[k:])
+	}
+	ws.dirty.markAll(ws.numPixels)
+}
+
+// moveLogical is Shift, or Rotate if wrap is set, for reversed separate strips,
+// whose logical order isn't simply the physical order backwards. It goes pixel
+// by pixel through phys instead.
+func (ws *WS281x) moveLogical(n int, wrap bool, fill RGB) {
+	nc := ws.numColors
+	old := append([]byte(nil), ws.pixels...)
+	var oldDeep []uint16
+	if ws.deep != nil {
+		oldDeep = append([]uint16(nil), ws.deep...)
+	}
+	for i := 0; i < ws.numPixels; i++ {
+		from := i - n
+		if wrap {
+			from = (from%ws.numPixels + ws.numPixels) % ws.numPixels
+		}
+		to := ws.phys(i) * nc
+		if from < 0 || from >= ws.numPixels {
+			for j := 0; j < nc; j++ {
+				ws.pixels[to+j] = 0
+			}
+			ws.setRGBAt(ws.phys(i), fill)
+			ws.syncDeep(to, to+nc)
+			continue
+		}
+		f := ws.phys(from) * nc
+		copy(ws.pixels[to:to+nc], old[f:f+nc])
+		if oldDeep != nil {
+			copy(ws.deep[to:to+nc], oldDeep[f:f+nc])
+		}
+	}
+	ws.dirty.markAll(ws.numPixels)
+}
+
+// SetReversed sets whether the strip runs backwards, so that index 0 is the
+// pixel furthest from the controller. It applies to the pixel setters and
+// getters, including Shift and Rotate, but not to Pixels, WriteFrame or
+// snapshots, which always deal in the order the pixels are sent.
+func (ws *WS281x) SetReversed(on bool) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.reversed = on
+}
+
+// Reversed returns whether the strip was reversed by SetReversed.
+func (ws *WS281x) Reversed() bool {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	return ws.reversed
+}
+
+// phys returns the physical index of the pixel at logical index i. Each
+// pin's strip is reversed on its own, so a pixel stays on its strip.
+func (ws *WS281x) phys(i int) int {
+	if !ws.reversed {
+		return i
+	}
+	if ws.separate {
+		first := i / ws.chanPixels * ws.chanPixels
+		return first + ws.chanPixels - 1 - (i - first)
+	}
+	return ws.numPixels - 1 - i
+}
+
+// SetWhiteExtraction sets how the RGB setters derive the white channel on an
+// RGBW strip. The default, WhiteNone, turns it off. It has no effect on RGB
+// strips.
+func (ws *WS281x) SetWhiteExtraction(mode WhiteExtraction) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.white = mode
+}
+
+// WhiteExtraction returns the mode set by SetWhiteExtraction.
+func (ws *WS281x) WhiteExtraction() WhiteExtraction {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	return ws.white
+}
+
+// RGBWAt returns the RGBW pixel at the given index. On an RGB strip, white
+// is always 0.
 func (ws *WS281x) RGBWAt(i int) RGBW {
-	o := i * ws.numColors
-	return RGBW{
-		ws.pixels[o+ws.r],
-		ws.pixels[o+ws.g],
-		ws.pixels[o+ws.b],
-		ws.pixels[o+ws.w],
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	o := ws.phys(i) * ws.numColors
+	rgbw := RGBW{R: ws.pixels[o+ws.r], G: ws.pixels[o+ws.g], B: ws.pixels[o+ws.b]}
+	if ws.w >= 0 {
+		rgbw.W = ws.pixels[o+ws.w]
 	}
+	return rgbw
 }
 
-// SetRGBWAt sets the RGBW pixel at the given index to the given value.
-// If numColors is 3, then white is an undefined value.
+// SetRGBWAt sets the RGBW pixel at the given index to the given value. On an
+// RGB strip, white is ignored.
 func (ws *WS281x) SetRGBWAt(i int, rgbw RGBW) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.setRGBWAt(ws.phys(i), rgbw)
+}
+
+func (ws *WS281x) setRGBWAt(i int, rgbw RGBW) {
 	o := i * ws.numColors
 	ws.pixels[o+ws.r] = rgbw.R
 	ws.pixels[o+ws.g] = rgbw.G
 	ws.pixels[o+ws.b] = rgbw.B
-	ws.pixels[o+ws.w] = rgbw.W
+	if ws.w >= 0 {
+		ws.pixels[o+ws.w] = rgbw.W
+	}
+	if ws.deep != nil {
+		ws.deep[o+ws.r] = uint16(rgbw.R) * 257
+		ws.deep[o+ws.g] = uint16(rgbw.G) * 257
+		ws.deep[o+ws.b] = uint16(rgbw.B) * 257
+		if ws.w >= 0 {
+			ws.deep[o+ws.w] = uint16(rgbw.W) * 257
+		}
+	}
+	ws.dirty.mark(i)
 }
 
-// SetRGBWs sets the RGBW pixels to the given values.
-// If numColors is 3, then white is an undefined value.
+// SetRGBWs sets the RGBW pixels to the given values. It panics on an RGB
+// strip.
 func (ws *WS281x) SetRGBWs(pixels []RGBW) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
 	if ws.numColors != 4 {
 		panic("SetRGBWs called on WS281x with numColors != 4")
 	}
@@ -177,17 +1132,36 @@ func (ws *WS281x) SetRGBWs(pixels []RGBW) {
 
 	a := 0
 	for i := 0; i < len(ws.pixels); i += 4 {
-		ws.pixels[a+ws.r] = pixels[i].R
-		ws.pixels[a+ws.g] = pixels[i].G
-		ws.pixels[a+ws.b] = pixels[i].B
-		ws.pixels[a+ws.w] = pixels[i].W
+		p := pixels[ws.phys(a)]
+		ws.pixels[i+ws.r] = p.R
+		ws.pixels[i+ws.g] = p.G
+		ws.pixels[i+ws.b] = p.B
+		ws.pixels[i+ws.w] = p.W
 		a++
 	}
+	ws.syncDeep(0, len(ws.pixels))
+	ws.dirty.markAll(ws.numPixels)
+}
+
+// SetRGBWsErr is like SetRGBWs, but returns ErrWrongColorModel or
+// ErrPixelCountMismatch instead of panicking.
+func (ws *WS281x) SetRGBWsErr(pixels []RGBW) error {
+	if ws.numColors != 4 {
+		return fmt.Errorf("SetRGBWs called on RGB strip: %w", ErrWrongColorModel)
+	}
+	if len(pixels) != ws.numPixels {
+		return fmt.Errorf("SetRGBWs called with %d pixels, want %d: %w", len(pixels), ws.numPixels, ErrPixelCountMismatch)
+	}
+	ws.SetRGBWs(pixels)
+	return nil
 }
 
 // RGBAt returns the RGB pixel at the given index.
 func (ws *WS281x) RGBAt(i int) RGB {
-	o := i * ws.numColors
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	o := ws.phys(i) * ws.numColors
 	return RGB{
 		ws.pixels[o+ws.r],
 		ws.pixels[o+ws.g],
@@ -195,16 +1169,143 @@ func (ws *WS281x) RGBAt(i int) RGB {
 	}
 }
 
-// SetRGBAt sets the RGB pixel at the given index to the given value.
+// SetRGBAt sets the RGB pixel at the given index to the given value. On an
+// RGBW strip, white is derived as set by SetWhiteExtraction.
 func (ws *WS281x) SetRGBAt(i int, rgb RGB) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.setRGBAt(ws.phys(i), rgb)
+}
+
+func (ws *WS281x) setRGBAt(i int, rgb RGB) {
+	if ws.w >= 0 {
+		ws.setRGBWAt(i, RGBToRGBW(rgb, ws.white))
+		return
+	}
 	o := i * ws.numColors
 	ws.pixels[o+ws.r] = rgb.R
 	ws.pixels[o+ws.g] = rgb.G
 	ws.pixels[o+ws.b] = rgb.B
+	if ws.deep != nil {
+		ws.deep[o+ws.r] = uint16(rgb.R) * 257
+		ws.deep[o+ws.g] = uint16(rgb.G) * 257
+		ws.deep[o+ws.b] = uint16(rgb.B) * 257
+	}
+	ws.dirty.mark(i)
+}
+
+// SetRGB16At sets the RGB pixel at the given index to the given 16-bit value.
+// The gamma and brightness are applied to the full 16 bits when the pixel is
+// flushed, and only then is it rounded to 8 bits, which keeps slow fades
+// smooth, especially with dithering on. RGBAt returns the top 8 bits of each
+// channel, and setting the pixel with an 8-bit setter replaces the 16-bit value.
+func (ws *WS281x) SetRGB16At(i int, rgb RGB16) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	p := ws.phys(i)
+	ws.setRGBAt(p, rgb.RGB())
+	o := p * ws.numColors
+	deep := ws.deep16()
+	deep[o+ws.r] = rgb.R
+	deep[o+ws.g] = rgb.G
+	deep[o+ws.b] = rgb.B
+}
+
+// SetRGBW16At is like SetRGB16At for an RGBW pixel. On an RGB strip, white is
+// ignored.
+func (ws *WS281x) SetRGBW16At(i int, rgbw RGBW16) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	p := ws.phys(i)
+	ws.setRGBWAt(p, rgbw.RGBW())
+	o := p * ws.numColors
+	deep := ws.deep16()
+	deep[o+ws.r] = rgbw.R
+	deep[o+ws.g] = rgbw.G
+	deep[o+ws.b] = rgbw.B
+	if ws.w >= 0 {
+		deep[o+ws.w] = rgbw.W
+	}
+}
+
+// deep16 returns the 16-bit pixel values, allocating them the first time a
+// 16-bit setter is used.
+func (ws *WS281x) deep16() []uint16 {
+	if ws.deep == nil {
+		ws.deep = make([]uint16, len(ws.pixels))
+		ws.syncDeep(0, len(ws.pixels))
+	}
+	return ws.deep
+}
+
+// syncDeep sets the 16-bit values of the pixel bytes [lo, hi) from their 8-bit
+// values, for setters that only write the 8-bit ones. It does nothing until a
+// 16-bit setter has been used.
+func (ws *WS281x) syncDeep(lo, hi int) {
+	if ws.deep == nil {
+		return
+	}
+	for k := lo; k < hi; k++ {
+		ws.deep[k] = uint16(ws.pixels[k]) * 257
+	}
+}
+
+// CopyFrom copies count pixels from src, starting at srcStart, to this strip,
+// starting at dstStart. src may be this strip, in which case the ranges may
+// overlap. Pixels are converted between RGB and RGBW as needed: white is
+// derived as set by SetWhiteExtraction, or added to the other channels when
+// this strip has none. Pixels from an LPD8806, with 7 bits per color, are
+// scaled to 8. It returns ErrIndexOutOfRange if either range doesn't fit.
+func (ws *WS281x) CopyFrom(src Strip, srcStart, dstStart, count int) error {
+	if err := checkCopy(src, srcStart, dstStart, count, ws.numPixels); err != nil {
+		return err
+	}
+	pixels, hasWhite := readPixels(src, srcStart, count)
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	for k, p := range pixels {
+		i := ws.phys(dstStart + k)
+		switch {
+		case !hasWhite:
+			ws.setRGBAt(i, RGB{p.R, p.G, p.B})
+		case ws.w >= 0:
+			ws.setRGBWAt(i, p)
+		default:
+			ws.setRGBAt(i, rgbModel(p).(RGB))
+		}
+	}
+	return nil
+}
+
+// RGBAtChecked is like RGBAt, but returns ErrIndexOutOfRange if i is outside
+// the strip.
+func (ws *WS281x) RGBAtChecked(i int) (RGB, error) {
+	if err := checkIndex(i, ws.numPixels); err != nil {
+		return RGB{}, err
+	}
+	return ws.RGBAt(i), nil
+}
+
+// SetRGBAtChecked is like SetRGBAt, but returns ErrIndexOutOfRange if i is
+// outside the strip.
+func (ws *WS281x) SetRGBAtChecked(i int, rgb RGB) error {
+	if err := checkIndex(i, ws.numPixels); err != nil {
+		return err
+	}
+	ws.SetRGBAt(i, rgb)
+	return nil
 }
 
 // SetRGBs sets the RGB pixels to the given values.
 func (ws *WS281x) SetRGBs(pixels []RGB) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
 	if ws.numColors != 3 {
 		panic("SetRGBs called on RGBW strip")
 	}
@@ -214,11 +1315,27 @@ func (ws *WS281x) SetRGBs(pixels []RGB) {
 
 	a := 0
 	for i := 0; i < len(ws.pixels); i += 3 {
-		ws.pixels[i+ws.r] = pixels[a].R
-		ws.pixels[i+ws.g] = pixels[a].G
-		ws.pixels[i+ws.b] = pixels[a].B
+		p := pixels[ws.phys(a)]
+		ws.pixels[i+ws.r] = p.R
+		ws.pixels[i+ws.g] = p.G
+		ws.pixels[i+ws.b] = p.B
 		a++
 	}
+	ws.syncDeep(0, len(ws.pixels))
+	ws.dirty.markAll(ws.numPixels)
+}
+
+// SetRGBsErr is like SetRGBs, but returns ErrWrongColorModel or
+// ErrPixelCountMismatch instead of panicking.
+func (ws *WS281x) SetRGBsErr(pixels []RGB) error {
+	if ws.numColors != 3 {
+		return fmt.Errorf("SetRGBs called on RGBW strip: %w", ErrWrongColorModel)
+	}
+	if len(pixels) != ws.numPixels {
+		return fmt.Errorf("SetRGBs called with %d pixels, want %d: %w", len(pixels), ws.numPixels, ErrPixelCountMismatch)
+	}
+	ws.SetRGBs(pixels)
+	return nil
 }
 
 const (
@@ -226,40 +1343,325 @@ const (
 	symbolLow  = 0x4 // 1 0 0
 )
 
-// Flush flushes the current pixel buffer to the LEDs.
+// symbolTable maps each byte to the 24 bits of PWM symbols that send it, most
+// significant bit first.
+var symbolTable = func() [256]uint32 {
+	var table [256]uint32
+	for v := range table {
+		for k := 7; k >= 0; k-- {
+			symbol := uint32(symbolLow)
+			if v&(1<<uint(k)) != 0 {
+				symbol = symbolHigh
+			}
+			table[v] = table[v]<<3 | symbol
+		}
+	}
+	return table
+}()
+
+// EncodeWS281x encodes pixels, which holds whole pixels of numColors bytes
+// that are ready to send, into the PWM symbols that send them to a WS281x
+// strip, most significant bit first. Each byte takes 24 bits, so out needs at
+// least (len(pixels)*24+31)/32 words. The bits of the last word after the
+// symbols are left alone. This is what Flush does with the pixels once the
+// gamma, brightness and so on have been applied, for one channel.
+func EncodeWS281x(pixels []byte, numColors int, out []uint32) {
+	if numColors <= 0 || len(pixels)%numColors != 0 {
+		panic("EncodeWS281x called with partial pixels")
+	}
+	if len(out) < (len(pixels)*24+31)/32 {
+		panic("EncodeWS281x called with too few words")
+	}
+	packSymbols(pixels, out, 1, 0, 1)
+}
+
+// outputTable returns the table that applies the gamma and brightness to a
+// channel in one lookup, remaking it if either has changed since it was made.
+func (ws *WS281x) outputTable(brightness uint8) *[256]uint8 {
+	if !ws.outOK || ws.outB != brightness {
+		ws.outTable = makeOutputTable(&ws.gammaTable, brightness)
+		ws.outB = brightness
+		ws.outOK = true
+	}
+	return &ws.outTable
+}
+
+// packSymbols writes the symbols for src into the words of channels [cLo, cHi)
+// of out, whose channels take turns every stride words.
+func packSymbols(src []byte, out []uint32, stride, cLo, cHi int) {
+	pos := 0
+	var acc uint64 // symbol bits waiting to be written, in the low nbits bits
+	nbits := uint(0)
+	for _, v := range src {
+		acc = acc<<24 | uint64(symbolTable[v])
+		nbits += 24
+		if nbits >= 32 {
+			nbits -= 32
+			word := uint32(acc >> nbits)
+			for c := cLo; c < cHi; c++ {
+				out[pos+c] = word
+			}
+			pos += stride
+		}
+	}
+	if nbits > 0 {
+		// Only overwrite the top of the last word, since the rest belongs to the next byte
+		// (or is after the end of the pixels).
+		keep := uint32(1)<<(32-nbits) - 1
+		for c := cLo; c < cHi; c++ {
+			out[pos+c] = out[pos+c]&keep | uint32(acc<<(32-nbits))
+		}
+	}
+}
+
+// Flush flushes the current pixel buffer to the LEDs. It returns ErrClosed
+// once the strip has been closed.
 func (ws *WS281x) Flush() error {
+	return ws.FlushContext(context.Background())
+}
+
+// FlushContext is like Flush, but gives up waiting for the previous frame to
+// finish sending and returns ctx.Err() if ctx is done first.
+func (ws *WS281x) FlushContext(ctx context.Context) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	// Close freed the DMA buffer, so there's nothing left to send from.
+	if ws.closed {
+		return ErrClosed
+	}
+
 	// We need to wait for DMA to be done before we start touching the buffer it's outputting
-	err := ws.rp.WaitForDMAEnd()
+	start := time.Now()
+	err := ws.waitForDMAEnd(ctx)
 	if err != nil {
-		return fmt.Errorf("pre-DMA wait failed: %v", err)
-	}
-
-	// TODO: channels, do properly - this just assumes both channels show the same thing
-	for c := 0; c < 2; c++ {
-		rpPos := c
-		bitPos := 31
-		for i := 0; i < ws.numPixels; i++ {
-			for j := 0; j < ws.numColors; j++ {
-				for k := 7; k >= 0; k-- {
-					symbol := symbolLow
-					if (ws.pixels[i*ws.numColors+j] & (1 << uint(k))) != 0 {
-						symbol = symbolHigh
-					}
-					for l := 2; l >= 0; l-- {
-						ws.pixDMAUint[rpPos] &= ^(1 << uint(bitPos))
-						if (symbol & (1 << uint(l))) != 0 {
-							ws.pixDMAUint[rpPos] |= 1 << uint(bitPos)
-						}
-						bitPos--
-						if bitPos < 0 {
-							rpPos += 2
-							bitPos = 31
-						}
-					}
-				}
-			}
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
+		return fmt.Errorf("pre-DMA wait failed: %w", err)
 	}
-	ws.rp.StartDMA(ws.pixDMA)
+	waited := time.Since(start)
+
+	stats := FlushStats{PixelsChanged: ws.dirty.size()}
+	start = time.Now()
+	ws.encode(0, ws.numPixels)
+	stats.EncodeDuration = time.Since(start)
+	ws.dirty.reset()
+	ws.send(stats, waited)
 	return nil
 }
+
+// FlushPartial is like Flush, but only re-encodes the pixels that have been
+// changed since the last flush. The whole buffer is still sent to the LEDs.
+func (ws *WS281x) FlushPartial() error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.closed {
+		return ErrClosed
+	}
+
+	start := time.Now()
+	err := ws.waitForDMAEnd(context.Background())
+	if err != nil {
+		return fmt.Errorf("pre-DMA wait failed: %w", err)
+	}
+	waited := time.Since(start)
+
+	if ws.dither != nil {
+		// Dithered pixels change from frame to frame even when they weren't set.
+		ws.dirty.markAll(ws.numPixels)
+	} else if ws.powerLimit > 0 && ws.outputBrightness() != ws.encodedB {
+		// The power limit moved the brightness, so every pixel changes.
+		ws.dirty.markAll(ws.numPixels)
+	}
+	stats := FlushStats{PixelsChanged: ws.dirty.size()}
+	start = time.Now()
+	ws.encode(ws.dirty.lo, ws.dirty.hi)
+	stats.EncodeDuration = time.Since(start)
+	ws.dirty.reset()
+	ws.send(stats, waited)
+	return nil
+}
+
+// send starts the DMA for the frame just encoded, unless it's skipped, then
+// tells the observer about the flush. waited is how long the flush waited for
+// the previous frame.
+func (ws *WS281x) send(stats FlushStats, waited time.Duration) {
+	if ws.unchanged() {
+		stats.Skipped = true
+	} else {
+		start := time.Now()
+		ws.rp.StartDMA(ws.pixDMA)
+		waited += time.Since(start)
+	}
+	stats.TransmitDuration = waited
+	if ws.observer != nil {
+		ws.observer(stats)
+	}
+}
+
+// SetFlushObserver sets a function to be called at the end of every
+// successful flush, with what it did and how long it took. The controller is
+// locked while it's called, so it mustn't call the controller's methods. nil
+// removes it.
+func (ws *WS281x) SetFlushObserver(observer func(FlushStats)) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.observer = observer
+}
+
+// SetSkipUnchanged sets whether flushes that would send exactly the same
+// frame as the last one skip sending it. It's off by default, so that every
+// flush takes the same time.
+func (ws *WS281x) SetSkipUnchanged(on bool) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.skip = on
+	ws.lastSent = nil
+	ws.sentOK = false
+}
+
+// SkipUnchanged returns whether SetSkipUnchanged turned skipping on.
+func (ws *WS281x) SkipUnchanged() bool {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	return ws.skip
+}
+
+// SkippedFlushes returns how many flushes have been skipped because nothing
+// changed.
+func (ws *WS281x) SkippedFlushes() int {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	return ws.skipped
+}
+
+// unchanged returns whether the frame just encoded should be skipped, because
+// skipping is on and it's the same as the last one sent. If it isn't, it's
+// remembered as the last one sent.
+func (ws *WS281x) unchanged() bool {
+	if !ws.skip {
+		return false
+	}
+	if ws.sentOK && equalWords(ws.pixDMAUint, ws.lastSent) {
+		ws.skipped++
+		return true
+	}
+	ws.lastSent = append(ws.lastSent[:0], ws.pixDMAUint...)
+	ws.sentOK = true
+	return false
+}
+
+// equalWords is slices.Equal, which needs a newer Go than go.mod asks for.
+func equalWords(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// waitForDMAEnd waits for the previous frame to finish sending, giving up when
+// ctx is done or after the flush timeout, if there is one.
+func (ws *WS281x) waitForDMAEnd(ctx context.Context) error {
+	if ws.timeout <= 0 {
+		return ws.rp.WaitForDMAEndContext(ctx)
+	}
+	tctx, cancel := context.WithTimeout(ctx, ws.timeout)
+	defer cancel()
+	err := ws.rp.WaitForDMAEndContext(tctx)
+	if err != nil && ctx.Err() == nil && tctx.Err() != nil {
+		return fmt.Errorf("%w after %v", rpi.ErrDMATimeout, ws.timeout)
+	}
+	return err
+}
+
+// encode encodes the pixels [lo, hi) into PWM symbols in the DMA buffer,
+// applying the gamma and brightness on the way.
+func (ws *WS281x) encode(lo, hi int) {
+	if lo >= hi {
+		return
+	}
+	brightness := ws.outputBrightness()
+	ws.encodedB = brightness
+	if !ws.separate {
+		// One strip's pixels, sent on every channel.
+		ws.encodeChannel(0, lo, hi, 0, ws.channels, brightness)
+		return
+	}
+	for c := 0; c < ws.channels; c++ {
+		first := c * ws.chanPixels
+		clo, chi := lo-first, hi-first
+		if clo < 0 {
+			clo = 0
+		}
+		if chi > ws.chanPixels {
+			chi = ws.chanPixels
+		}
+		if clo < chi {
+			ws.encodeChannel(first, clo, chi, c, c+1, brightness)
+		}
+	}
+}
+
+// encodeChannel encodes the pixels [lo, hi) of the strip starting at pixel
+// first into the words of channels [cLo, cHi).
+func (ws *WS281x) encodeChannel(first, lo, hi, cLo, cHi int, brightness uint8) {
+	// Every 4 bytes make 96 bits of symbols, which is exactly 3 words, so start at the
+	// last multiple of 4 bytes to get a word boundary.
+	from := lo * ws.numColors / 4 * 4
+	to := hi * ws.numColors
+	base := first * ws.numColors
+
+	rpPos := from / 4 * 3 * ws.channels
+	if cap(ws.corrected) < to-from {
+		ws.corrected = make([]byte, len(ws.pixels))
+	}
+	corrected := ws.corrected[:to-from]
+	outTable := ws.outputTable(brightness)
+
+	deep := ws.output16()
+	if ws.palette != nil {
+		deep = nil
+	}
+	if deep != nil && ws.deepTable == nil {
+		ws.deepTable = makeCorrectionTable16(ws.correction, ws.gamma)
+	}
+	for i, v := range ws.output()[base+from : base+to] {
+		k := base + from + i
+		if ws.palette != nil {
+			v = ws.paletteByte(k)
+		}
+		var out uint8
+		on := v != 0
+		if deep != nil {
+			on = deep[k] != 0
+			d := ws.deepTable[deep[k]]
+			if ws.dither != nil {
+				out = ditherBrightness16(d, brightness, &ws.dither[k])
+			} else {
+				out = scaleBrightness16(d, brightness)
+			}
+		} else if ws.dither != nil {
+			out = ditherBrightness(ws.gammaTable[v], brightness, &ws.dither[k])
+		} else {
+			out = outTable[v]
+		}
+		c := ws.caps[k%ws.numColors]
+		if c != 255 {
+			out = scaleBrightness(out, c)
+		}
+		// A cap of 0 turns the channel off, which the floor mustn't undo.
+		corrected[i] = applyFloor(out, ws.floor, on && c != 0, brightness)
+	}
+	packSymbols(corrected, ws.pixDMAUint[rpPos:], ws.channels, cLo, cHi)
+}
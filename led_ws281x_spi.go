@@ -0,0 +1,390 @@
+package ledctl
+
+import (
+	"fmt"
+	"sync"
+
+	rpi "github.com/mxcu/ledctl/rpi"
+)
+
+// WS281xSPISpeed is the SPI speed that makes each WS281x bit take three SPI
+// bits, as WS281xSPI encodes them, at the WS281x's 800kHz.
+const WS281xSPISpeed = 2400000
+
+// spidevBufSize is the most the spidev driver sends in one write by default.
+const spidevBufSize = 4096
+
+// WS281xSPI controls a WS281x LED strip with its data line on the SPI MOSI
+// pin, for pins or Pis that can't do PWM. Each bit is sent as the same three
+// symbol bits that WS281x uses with PWM. It's safe to use from several
+// goroutines.
+type WS281xSPI struct {
+	mu         sync.RWMutex
+	rp         *rpi.RPi
+	dev        Device
+	pixels     []byte
+	buf        []byte
+	resetBytes int
+	numColors  int
+	numPixels  int
+	brightness uint8
+	gamma      float64
+	gammaTable [256]uint8
+	outTable   [256]uint8
+	reversed   bool
+	white      WhiteExtraction
+	g          int
+	r          int
+	b          int
+	w          int
+}
+
+// WS281xSPIConfig is the configuration for a WS281x LED strip driven over SPI.
+type WS281xSPIConfig struct {
+	// Device is the SPI device to use. Usually, this is "/dev/spidev0.0".
+	// It isn't included in JSON.
+	Device Device `json:"-"`
+	// NumPixels is the number of pixels in the strip.
+	NumPixels int
+	// SPISpeed is the speed to use for the SPI. This should be
+	// WS281xSPISpeed, or close to it. If zero, the current speed of the
+	// device is left alone and assumed to be WS281xSPISpeed.
+	SPISpeed uint32
+	// ColorOrder is the color order of the pixels. This is usually GRB.
+	ColorOrder ColorOrder
+	// ColorModel is the color model of the pixels.
+	ColorModel ColorModel
+}
+
+// NewWS281xSPI creates a new WS281x LED strip controller that drives the
+// strip over SPI.
+func NewWS281xSPI(config WS281xSPIConfig) (*WS281xSPI, error) {
+	rp, err := rpi.NewRPi()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't make RPi: %w", err)
+	}
+	return newWS281xSPI(config, rp)
+}
+
+func newWS281xSPI(config WS281xSPIConfig, rp *rpi.RPi) (*WS281xSPI, error) {
+	if err := checkOrderModel(config.ColorOrder, config.ColorModel); err != nil {
+		return nil, err
+	}
+
+	speed := config.SPISpeed
+	if speed == 0 {
+		speed = WS281xSPISpeed
+	}
+	// The line has to be held low for the reset time after each frame.
+	resetBits := int(uint64(speed) * ledReset_us / 1000000)
+	resetBytes := (resetBits + 7) / 8
+
+	numColors := config.ColorModel.NumColors()
+	offsets := offsets[config.ColorOrder]
+	ws := WS281xSPI{
+		rp:         rp,
+		dev:        config.Device,
+		pixels:     make([]byte, config.NumPixels*numColors),
+		buf:        make([]byte, 3*config.NumPixels*numColors+resetBytes),
+		resetBytes: resetBytes,
+		numColors:  numColors,
+		numPixels:  config.NumPixels,
+		brightness: 255,
+		gamma:      1,
+		gammaTable: makeGammaTable(1),
+		g:          offsets[0],
+		r:          offsets[1],
+		b:          offsets[2],
+		w:          offsets[3],
+	}
+	if max := ws.MaxLEDsPerChannel(); config.NumPixels > max {
+		return nil, fmt.Errorf("%d pixels don't fit in one SPI transfer, which takes at most %d", config.NumPixels, max)
+	}
+	ws.outTable = makeOutputTable(&ws.gammaTable, ws.brightness)
+
+	if config.SPISpeed != 0 {
+		err := setSPISpeed(rp, ws.dev.Fd(), config.SPISpeed)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &ws, nil
+}
+
+// Close does nothing.
+func (ws *WS281xSPI) Close() error {
+	return nil
+}
+
+// RPi returns the RPi object used to control the SPI.
+func (ws *WS281xSPI) RPi() *rpi.RPi {
+	return ws.rp
+}
+
+// NumPixels returns the number of pixels in the strip.
+func (ws *WS281xSPI) NumPixels() int {
+	return ws.numPixels
+}
+
+// MaxLEDsPerChannel returns the maximum number of LEDs per channel. It's
+// limited by how much spidev will send in one write.
+func (ws *WS281xSPI) MaxLEDsPerChannel() int {
+	return (spidevBufSize - ws.resetBytes) / (3 * ws.numColors)
+}
+
+// Flush encodes the pixels and writes them to the SPI device.
+func (ws *WS281xSPI) Flush() error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.encode()
+	_, err := ws.dev.Write(ws.buf)
+	return err
+}
+
+// encode applies the gamma and brightness to each pixel byte, and expands it
+// into the 24 symbol bits that send it, as WS281x does for PWM. The reset
+// bytes at the end of buf stay 0.
+func (ws *WS281xSPI) encode() {
+	for i, v := range ws.pixels {
+		s := symbolTable[ws.outTable[v]]
+		ws.buf[3*i] = byte(s >> 16)
+		ws.buf[3*i+1] = byte(s >> 8)
+		ws.buf[3*i+2] = byte(s)
+	}
+}
+
+// SetBrightness sets the brightness that all pixels are scaled by when they're
+// flushed, where 255 is full brightness and 0 is off. The stored pixel values
+// are unaffected.
+func (ws *WS281xSPI) SetBrightness(b uint8) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.brightness = b
+	ws.outTable = makeOutputTable(&ws.gammaTable, b)
+}
+
+// Brightness returns the brightness set by SetBrightness.
+func (ws *WS281xSPI) Brightness() uint8 {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	return ws.brightness
+}
+
+// SetGamma sets the gamma correction applied to each channel when the pixels
+// are flushed. The default of 1 leaves the pixels unchanged; 2.2 or so makes
+// fades look more even to the eye. The stored pixel values are unaffected.
+func (ws *WS281xSPI) SetGamma(gamma float64) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.gamma = gamma
+	ws.gammaTable = makeGammaTable(gamma)
+	ws.outTable = makeOutputTable(&ws.gammaTable, ws.brightness)
+}
+
+// Gamma returns the gamma set by SetGamma.
+func (ws *WS281xSPI) Gamma() float64 {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	return ws.gamma
+}
+
+// SetReversed sets whether the strip runs backwards, so that index 0 is the
+// pixel furthest from the controller.
+func (ws *WS281xSPI) SetReversed(on bool) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.reversed = on
+}
+
+// Reversed returns whether the strip was reversed by SetReversed.
+func (ws *WS281xSPI) Reversed() bool {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	return ws.reversed
+}
+
+// phys returns the physical index of the pixel at logical index i.
+func (ws *WS281xSPI) phys(i int) int {
+	if ws.reversed {
+		return ws.numPixels - 1 - i
+	}
+	return i
+}
+
+// SetWhiteExtraction sets how the RGB setters derive the white channel on an
+// RGBW strip. The default, WhiteNone, turns it off. It has no effect on RGB
+// strips.
+func (ws *WS281xSPI) SetWhiteExtraction(mode WhiteExtraction) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.white = mode
+}
+
+// WhiteExtraction returns the mode set by SetWhiteExtraction.
+func (ws *WS281xSPI) WhiteExtraction() WhiteExtraction {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	return ws.white
+}
+
+// RGBWAt returns the RGBW pixel at the given index. On an RGB strip, white
+// is always 0.
+func (ws *WS281xSPI) RGBWAt(i int) RGBW {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	o := ws.phys(i) * ws.numColors
+	rgbw := RGBW{R: ws.pixels[o+ws.r], G: ws.pixels[o+ws.g], B: ws.pixels[o+ws.b]}
+	if ws.w >= 0 {
+		rgbw.W = ws.pixels[o+ws.w]
+	}
+	return rgbw
+}
+
+// SetRGBWAt sets the RGBW pixel at the given index to the given value. On an
+// RGB strip, white is ignored.
+func (ws *WS281xSPI) SetRGBWAt(i int, rgbw RGBW) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.setRGBWAt(ws.phys(i), rgbw)
+}
+
+func (ws *WS281xSPI) setRGBWAt(i int, rgbw RGBW) {
+	o := i * ws.numColors
+	ws.pixels[o+ws.r] = rgbw.R
+	ws.pixels[o+ws.g] = rgbw.G
+	ws.pixels[o+ws.b] = rgbw.B
+	if ws.w >= 0 {
+		ws.pixels[o+ws.w] = rgbw.W
+	}
+}
+
+// SetRGBWs sets the RGBW pixels to the given values.
+func (ws *WS281xSPI) SetRGBWs(pixels []RGBW) {
+	if ws.numColors != 4 {
+		panic("SetRGBWs called on WS281xSPI with numColors != 4")
+	}
+	if len(pixels) != ws.numPixels {
+		panic("SetRGBWs called with wrong number of pixels")
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	a := 0
+	for i := 0; i < len(ws.pixels); i += 4 {
+		p := pixels[ws.phys(a)]
+		ws.pixels[i+ws.r] = p.R
+		ws.pixels[i+ws.g] = p.G
+		ws.pixels[i+ws.b] = p.B
+		ws.pixels[i+ws.w] = p.W
+		a++
+	}
+}
+
+// SetRGBWsErr is like SetRGBWs, but returns ErrWrongColorModel or
+// ErrPixelCountMismatch instead of panicking.
+func (ws *WS281xSPI) SetRGBWsErr(pixels []RGBW) error {
+	if ws.numColors != 4 {
+		return fmt.Errorf("SetRGBWs called on RGB strip: %w", ErrWrongColorModel)
+	}
+	if len(pixels) != ws.numPixels {
+		return fmt.Errorf("SetRGBWs called with %d pixels, want %d: %w", len(pixels), ws.numPixels, ErrPixelCountMismatch)
+	}
+	ws.SetRGBWs(pixels)
+	return nil
+}
+
+// RGBAt returns the RGB pixel at the given index.
+func (ws *WS281xSPI) RGBAt(i int) RGB {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	o := ws.phys(i) * ws.numColors
+	return RGB{
+		ws.pixels[o+ws.r],
+		ws.pixels[o+ws.g],
+		ws.pixels[o+ws.b],
+	}
+}
+
+// SetRGBAt sets the RGB pixel at the given index to the given value. On an
+// RGBW strip, white is derived as set by SetWhiteExtraction.
+func (ws *WS281xSPI) SetRGBAt(i int, rgb RGB) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	i = ws.phys(i)
+	if ws.w >= 0 {
+		ws.setRGBWAt(i, RGBToRGBW(rgb, ws.white))
+		return
+	}
+	o := i * ws.numColors
+	ws.pixels[o+ws.r] = rgb.R
+	ws.pixels[o+ws.g] = rgb.G
+	ws.pixels[o+ws.b] = rgb.B
+}
+
+// RGBAtChecked is like RGBAt, but returns ErrIndexOutOfRange if i is outside
+// the strip.
+func (ws *WS281xSPI) RGBAtChecked(i int) (RGB, error) {
+	if err := checkIndex(i, ws.numPixels); err != nil {
+		return RGB{}, err
+	}
+	return ws.RGBAt(i), nil
+}
+
+// SetRGBAtChecked is like SetRGBAt, but returns ErrIndexOutOfRange if i is
+// outside the strip.
+func (ws *WS281xSPI) SetRGBAtChecked(i int, rgb RGB) error {
+	if err := checkIndex(i, ws.numPixels); err != nil {
+		return err
+	}
+	ws.SetRGBAt(i, rgb)
+	return nil
+}
+
+// SetRGBs sets the RGB pixels to the given values.
+func (ws *WS281xSPI) SetRGBs(pixels []RGB) {
+	if ws.numColors != 3 {
+		panic("SetRGBs called on RGBW strip")
+	}
+	if len(pixels) != ws.numPixels {
+		panic("SetRGBs called with wrong number of pixels")
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	a := 0
+	for i := 0; i < len(ws.pixels); i += 3 {
+		p := pixels[ws.phys(a)]
+		ws.pixels[i+ws.r] = p.R
+		ws.pixels[i+ws.g] = p.G
+		ws.pixels[i+ws.b] = p.B
+		a++
+	}
+}
+
+// SetRGBsErr is like SetRGBs, but returns ErrWrongColorModel or
+// ErrPixelCountMismatch instead of panicking.
+func (ws *WS281xSPI) SetRGBsErr(pixels []RGB) error {
+	if ws.numColors != 3 {
+		return fmt.Errorf("SetRGBs called on RGBW strip: %w", ErrWrongColorModel)
+	}
+	if len(pixels) != ws.numPixels {
+		return fmt.Errorf("SetRGBs called with %d pixels, want %d: %w", len(pixels), ws.numPixels, ErrPixelCountMismatch)
+	}
+	ws.SetRGBs(pixels)
+	return nil
+}
@@ -0,0 +1,80 @@
+package ledctl
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWS281xSPIFlush(t *testing.T) {
+	dev := &fakeDevice{}
+	ws, err := newWS281xSPI(WS281xSPIConfig{
+		Device:     dev,
+		NumPixels:  1,
+		ColorOrder: GRBOrder,
+		ColorModel: RGBModel,
+	}, nil)
+	if err != nil {
+		t.Fatalf("newWS281xSPI: %v", err)
+	}
+	ws.SetRGBAt(0, RGB{R: 0x80, G: 0x01, B: 0xff})
+	if err := ws.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	want := []byte{
+		0x92, 0x49, 0x26, // G 0x01: 100 100 100 100 100 100 100 110
+		0xd2, 0x49, 0x24, // R 0x80: 110 100 100 100 100 100 100 100
+		0xdb, 0x6d, 0xb6, // B 0xff: 110 110 110 110 110 110 110 110
+	}
+	// 55µs at 2.4MHz is 132 bits of reset, which rounds up to 17 bytes.
+	want = append(want, make([]byte, 17)...)
+	if got := dev.last(); !bytes.Equal(got, want) {
+		t.Errorf("Flush wrote % X, want % X", got, want)
+	}
+}
+
+func TestWS281xSPIBrightnessReversed(t *testing.T) {
+	dev := &fakeDevice{}
+	ws, err := newWS281xSPI(WS281xSPIConfig{
+		Device:     dev,
+		NumPixels:  2,
+		ColorOrder: RGBOrder,
+		ColorModel: RGBModel,
+	}, nil)
+	if err != nil {
+		t.Fatalf("newWS281xSPI: %v", err)
+	}
+	ws.SetReversed(true)
+	ws.SetRGBAt(0, RGB{R: 0xff})
+	ws.SetBrightness(128)
+	ws.SetGamma(2.2)
+	if got, want := ws.RGBAt(0), (RGB{R: 0xff}); got != want {
+		t.Errorf("RGBAt(0) got %v, want %v", got, want)
+	}
+	if err := ws.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	// Pixel 0 is the last one sent, at the gamma then the brightness.
+	want := []uint8{0, 0, 0, scaleBrightness(255, 128), 0, 0}
+	got := dev.last()
+	for i, v := range want {
+		s := symbolTable[v]
+		if !bytes.Equal(got[3*i:3*i+3], []byte{byte(s >> 16), byte(s >> 8), byte(s)}) {
+			t.Errorf("byte %d sent as % X, want the symbols for %#x", i, got[3*i:3*i+3], v)
+		}
+	}
+}
+
+func TestWS281xSPITooManyPixels(t *testing.T) {
+	config := WS281xSPIConfig{Device: &fakeDevice{}, ColorOrder: GRBOrder, ColorModel: RGBModel}
+	// 4096 bytes less 17 of reset, at 9 bytes a pixel.
+	config.NumPixels = 453
+	if _, err := newWS281xSPI(config, nil); err != nil {
+		t.Errorf("newWS281xSPI with 453 pixels: %v", err)
+	}
+	config.NumPixels = 454
+	if _, err := newWS281xSPI(config, nil); err == nil {
+		t.Errorf("newWS281xSPI with 454 pixels got no error")
+	}
+}
@@ -0,0 +1,1187 @@
+package ledctl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	rpi "github.com/mxcu/ledctl/rpi"
+)
+
+const testPWMFrequency = 800000
+
+// testWS281x makes a WS281x with an ordinary memory buffer standing in for
+// the DMA buffer, so that encoding can be tested without a Pi.
+func testWS281x(config WS281xConfig) *WS281x {
+	ws := makeWS281x(config)
+	ws.pixDMAUint = make([]uint32, ws.pwmByteCount(testPWMFrequency)/4)
+	return ws
+}
+
+// decodeWS281x turns the PWM symbols for channel 0 back into bytes.
+func decodeWS281x(ws *WS281x) []byte {
+	return decodeWS281xChannel(ws, 0)
+}
+
+// decodeWS281xChannel turns the PWM symbols for a channel back into bytes.
+func decodeWS281xChannel(ws *WS281x, channel int) []byte {
+	out := make([]byte, ws.chanPixels*ws.numColors)
+	bit := 0
+	for i := range out {
+		for k := 7; k >= 0; k-- {
+			var symbol uint32
+			for l := 0; l < 3; l++ {
+				word := ws.pixDMAUint[(bit/32)*ws.channels+channel]
+				symbol = symbol<<1 | (word>>uint(31-bit%32))&1
+				bit++
+			}
+			if symbol == symbolHigh {
+				out[i] |= 1 << uint(k)
+			}
+		}
+	}
+	return out
+}
+
+func TestEncodeWS281x(t *testing.T) {
+	tests := []struct {
+		pixels    []byte
+		numColors int
+		want      []uint32
+	}{
+		// 0 is 100 and 1 is 110 for every bit, so 0x00 is 100100100...
+		{[]byte{0x00, 0x00, 0x00}, 3, []uint32{0x92492492, 0x49249249, 0x24FFFFFF}},
+		{[]byte{0x01, 0x80, 0xFF}, 3, []uint32{0x924926D2, 0x4924DB6D, 0xB6FFFFFF}},
+		{[]byte{0xFF, 0x00, 0xFF, 0x00}, 4, []uint32{0xDB6DB692, 0x4924DB6D, 0xB6924924}},
+		{[]byte{}, 3, []uint32{0xFFFFFFFF}},
+	}
+	for _, test := range tests {
+		out := []uint32{0xFFFFFFFF, 0xFFFFFFFF, 0xFFFFFFFF}[:len(test.want)]
+		EncodeWS281x(test.pixels, test.numColors, out)
+		for i := range test.want {
+			if out[i] != test.want[i] {
+				t.Errorf("% X: word %d got %08X, want %08X", test.pixels, i, out[i], test.want[i])
+			}
+		}
+	}
+}
+
+func TestWS281xBrightness(t *testing.T) {
+	ws := testWS281x(WS281xConfig{NumPixels: 2, ColorOrder: RGBOrder, ColorModel: RGBModel})
+	ws.SetRGBs([]RGB{{255, 128, 1}, {0, 3, 200}})
+
+	ws.encode(0, ws.numPixels)
+	if got, want := decodeWS281x(ws), []byte{255, 128, 1, 0, 3, 200}; !bytes.Equal(got, want) {
+		t.Errorf("brightness 255 encoded %v, want %v", got, want)
+	}
+
+	ws.SetBrightness(128)
+	ws.encode(0, ws.numPixels)
+	if got, want := decodeWS281x(ws), []byte{128, 64, 1, 0, 2, 100}; !bytes.Equal(got, want) {
+		t.Errorf("brightness 128 encoded %v, want %v", got, want)
+	}
+	if got, want := ws.RGBAt(0), (RGB{255, 128, 1}); got != want {
+		t.Errorf("RGBAt(0) got %v, want %v", got, want)
+	}
+}
+
+func TestWS281xMinBrightness(t *testing.T) {
+	ws := testWS281x(WS281xConfig{NumPixels: 1, ColorOrder: RGBOrder, ColorModel: RGBModel})
+	ws.SetRGBAt(0, RGB{1, 0, 200})
+	ws.SetGamma(2.2)
+	ws.SetMinBrightness(5)
+
+	ws.encode(0, ws.numPixels)
+	if got, want := decodeWS281x(ws), []byte{5, 0, 149}; !bytes.Equal(got, want) {
+		t.Errorf("floor 5 encoded %v, want %v", got, want)
+	}
+
+	ws.SetBrightness(0)
+	ws.encode(0, ws.numPixels)
+	if got, want := decodeWS281x(ws), []byte{0, 0, 0}; !bytes.Equal(got, want) {
+		t.Errorf("floor 5 at brightness 0 encoded %v, want %v", got, want)
+	}
+}
+
+func TestWS281xChannelCaps(t *testing.T) {
+	ws := testWS281x(WS281xConfig{NumPixels: 1, ColorOrder: RGBWOrder, ColorModel: RGBWModel})
+	ws.SetRGBWAt(0, RGBW{200, 100, 50, 200})
+
+	ws.SetChannelCaps(255, 255, 255, 128)
+	ws.encode(0, ws.numPixels)
+	if got, want := decodeWS281x(ws), []byte{200, 100, 50, 100}; !bytes.Equal(got, want) {
+		t.Errorf("white cap 128 encoded %v, want %v", got, want)
+	}
+	if r, g, b, w := ws.ChannelCaps(); r != 255 || g != 255 || b != 255 || w != 128 {
+		t.Errorf("ChannelCaps got %d, %d, %d, %d, want 255, 255, 255, 128", r, g, b, w)
+	}
+
+	ws.SetChannelCaps(0, 255, 255, 255)
+	ws.encode(0, ws.numPixels)
+	if got, want := decodeWS281x(ws), []byte{0, 100, 50, 200}; !bytes.Equal(got, want) {
+		t.Errorf("red cap 0 encoded %v, want %v", got, want)
+	}
+}
+
+func TestWS281xGamma(t *testing.T) {
+	ws := testWS281x(WS281xConfig{NumPixels: 1, ColorOrder: RGBOrder, ColorModel: RGBModel})
+	ws.SetRGBAt(0, RGB{255, 128, 0})
+
+	ws.SetGamma(2.2)
+	ws.encode(0, ws.numPixels)
+	if got, want := decodeWS281x(ws), []byte{255, 56, 0}; !bytes.Equal(got, want) {
+		t.Errorf("gamma 2.2 encoded %v, want %v", got, want)
+	}
+
+	ws.SetGamma(1)
+	ws.encode(0, ws.numPixels)
+	if got, want := decodeWS281x(ws), []byte{255, 128, 0}; !bytes.Equal(got, want) {
+		t.Errorf("gamma 1 encoded %v, want %v", got, want)
+	}
+}
+
+func TestWS281xOutputTable(t *testing.T) {
+	ws := testWS281x(WS281xConfig{NumPixels: 1, ColorOrder: RGBOrder, ColorModel: RGBModel})
+	for _, gamma := range []float64{1, 2.2, 2.8} {
+		ws.SetGamma(gamma)
+		gammaTable := makeGammaTable(gamma)
+		for _, brightness := range []uint8{0, 1, 100, 128, 255} {
+			table := ws.outputTable(brightness)
+			for v := 0; v < 256; v++ {
+				if got, want := table[v], scaleBrightness(gammaTable[v], brightness); got != want {
+					t.Errorf("gamma %v, brightness %d: %d got %d, want %d", gamma, brightness, v, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestWS281xColorCorrection(t *testing.T) {
+	ws := testWS281x(WS281xConfig{NumPixels: 1, ColorOrder: RGBOrder, ColorModel: RGBModel})
+	ws.SetRGBAt(0, RGB{255, 128, 10})
+	ws.SetGamma(2.2)
+
+	tests := []struct {
+		correction ColorCorrection
+		want       []byte
+	}{
+		{GammaCorrection, []byte{255, 56, 0}},
+		{SRGBCorrection, []byte{255, 55, 1}},
+		{NoCorrection, []byte{255, 128, 10}},
+	}
+
+	for _, test := range tests {
+		ws.SetColorCorrection(test.correction)
+		ws.encode(0, ws.numPixels)
+		if got := decodeWS281x(ws); !bytes.Equal(got, test.want) {
+			t.Errorf("correction %d encoded %v, want %v", test.correction, got, test.want)
+		}
+	}
+	if got := ws.Gamma(); got != 2.2 {
+		t.Errorf("Gamma() got %v, want 2.2", got)
+	}
+}
+
+func TestWS281xSetRange(t *testing.T) {
+	c := RGB{1, 2, 3}
+	tests := []struct {
+		start, count int
+		want         []RGB
+		err          error
+	}{
+		{1, 2, []RGB{{}, c, c, {}}, nil},
+		{0, 0, []RGB{{}, {}, {}, {}}, nil},
+		{2, 5, []RGB{{}, {}, c, c}, nil},
+		{4, 1, []RGB{{}, {}, {}, {}}, nil},
+		{-1, 2, []RGB{{}, {}, {}, {}}, ErrIndexOutOfRange},
+		{5, 1, []RGB{{}, {}, {}, {}}, ErrIndexOutOfRange},
+		{1, -1, []RGB{{}, {}, {}, {}}, ErrIndexOutOfRange},
+	}
+	for _, test := range tests {
+		ws := testWS281x(WS281xConfig{NumPixels: 4, ColorOrder: GRBOrder, ColorModel: RGBModel})
+		err := ws.SetRange(test.start, test.count, c)
+		if !errors.Is(err, test.err) || (err == nil) != (test.err == nil) {
+			t.Errorf("SetRange(%d, %d) got error %v, want %v", test.start, test.count, err, test.err)
+		}
+		for i, want := range test.want {
+			if got := ws.RGBAt(i); got != want {
+				t.Errorf("after SetRange(%d, %d), RGBAt(%d) got %v, want %v", test.start, test.count, i, got, want)
+			}
+		}
+	}
+
+	ws := testWS281x(WS281xConfig{NumPixels: 4, ColorOrder: GRBOrder, ColorModel: RGBModel})
+	if err := ws.SetRangeSlice(2, []RGB{{1, 1, 1}, {2, 2, 2}, {3, 3, 3}}); err != nil {
+		t.Errorf("SetRangeSlice got error %v", err)
+	}
+	for i, want := range []RGB{{}, {}, {1, 1, 1}, {2, 2, 2}} {
+		if got := ws.RGBAt(i); got != want {
+			t.Errorf("after SetRangeSlice, RGBAt(%d) got %v, want %v", i, got, want)
+		}
+	}
+	if err := ws.SetRangeSlice(-1, []RGB{{9, 9, 9}}); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Errorf("SetRangeSlice(-1) got error %v, want ErrIndexOutOfRange", err)
+	}
+}
+
+func TestWS281xFill(t *testing.T) {
+	ws := testWS281x(WS281xConfig{NumPixels: 5, ColorOrder: GRBWOrder, ColorModel: RGBWModel})
+
+	ws.FillRGBW(RGBW{1, 2, 3, 4})
+	for _, i := range []int{0, 2, 4} {
+		if got, want := ws.RGBWAt(i), (RGBW{1, 2, 3, 4}); got != want {
+			t.Errorf("after FillRGBW, RGBWAt(%d) got %v, want %v", i, got, want)
+		}
+	}
+
+	ws.Fill(RGB{5, 6, 7})
+	for _, i := range []int{0, 3, 4} {
+		if got, want := ws.RGBWAt(i), (RGBW{5, 6, 7, 0}); got != want {
+			t.Errorf("after Fill, RGBWAt(%d) got %v, want %v", i, got, want)
+		}
+	}
+
+	ws.Clear()
+	for i := 0; i < 5; i++ {
+		if got := ws.RGBWAt(i); got != (RGBW{}) {
+			t.Errorf("after Clear, RGBWAt(%d) got %v, want black", i, got)
+		}
+	}
+	if n := testing.AllocsPerRun(10, func() { ws.Fill(RGB{1, 2, 3}) }); n != 0 {
+		t.Errorf("Fill allocated %v times", n)
+	}
+}
+
+func TestWS281xSetRGBWs(t *testing.T) {
+	ws := testWS281x(WS281xConfig{NumPixels: 3, ColorOrder: GRBWOrder, ColorModel: RGBWModel})
+	pixels := []RGBW{{1, 2, 3, 4}, {5, 6, 7, 8}, {9, 10, 11, 12}}
+	ws.SetRGBWs(pixels)
+
+	for i, want := range pixels {
+		if got := ws.RGBWAt(i); got != want {
+			t.Errorf("RGBWAt(%d) got %v, want %v", i, got, want)
+		}
+	}
+	if want := []byte{2, 1, 3, 4, 6, 5, 7, 8, 10, 9, 11, 12}; !bytes.Equal(ws.pixels, want) {
+		t.Errorf("pixels got %v, want %v", ws.pixels, want)
+	}
+}
+
+func TestWS281xColorOrders(t *testing.T) {
+	tests := []struct {
+		order ColorOrder
+		want  []byte
+	}{
+		{GRBWOrder, []byte{2, 1, 3, 4}},
+		{RGBWOrder, []byte{1, 2, 3, 4}},
+		{BGRWOrder, []byte{3, 2, 1, 4}},
+		{GBRWOrder, []byte{2, 3, 1, 4}},
+		{BRGWOrder, []byte{3, 1, 2, 4}},
+		{RBGWOrder, []byte{1, 3, 2, 4}},
+	}
+
+	for _, test := range tests {
+		ws := testWS281x(WS281xConfig{NumPixels: 1, ColorOrder: test.order, ColorModel: RGBWModel})
+		ws.SetRGBWAt(0, RGBW{1, 2, 3, 4})
+		if !bytes.Equal(ws.pixels, test.want) {
+			t.Errorf("%v: pixels got %v, want %v", test.order, ws.pixels, test.want)
+		}
+		if got := ws.RGBWAt(0); got != (RGBW{1, 2, 3, 4}) {
+			t.Errorf("%v: RGBWAt(0) got %v", test.order, got)
+		}
+	}
+}
+
+func TestWS281xResetUs(t *testing.T) {
+	config := WS281xConfig{NumPixels: 10, ColorModel: RGBModel}
+	def := makeWS281x(config)
+	config.ResetUs = ledReset_us
+	explicit := makeWS281x(config)
+	if got, want := def.pwmByteCount(testPWMFrequency), explicit.pwmByteCount(testPWMFrequency); got != want {
+		t.Errorf("default ResetUs got %d bytes, want %d", got, want)
+	}
+
+	prev := explicit.pwmByteCount(testPWMFrequency)
+	for _, us := range []uint{80, 300, 1000} {
+		config.ResetUs = us
+		ws := makeWS281x(config)
+		got := ws.pwmByteCount(testPWMFrequency)
+		if got <= prev {
+			t.Errorf("ResetUs %d got %d bytes, want more than %d", us, got, prev)
+		}
+		prev = got
+	}
+}
+
+// encodeReference is the original bit-by-bit encoder, kept to check encode against.
+func encodeReference(ws *WS281x) {
+	for c := 0; c < 2; c++ {
+		rpPos := c
+		bitPos := 31
+		for i := 0; i < ws.numPixels; i++ {
+			for j := 0; j < ws.numColors; j++ {
+				val := scaleBrightness(ws.gammaTable[ws.pixels[i*ws.numColors+j]], ws.brightness)
+				for k := 7; k >= 0; k-- {
+					symbol := symbolLow
+					if (val & (1 << uint(k))) != 0 {
+						symbol = symbolHigh
+					}
+					for l := 2; l >= 0; l-- {
+						ws.pixDMAUint[rpPos] &= ^(1 << uint(bitPos))
+						if (symbol & (1 << uint(l))) != 0 {
+							ws.pixDMAUint[rpPos] |= 1 << uint(bitPos)
+						}
+						bitPos--
+						if bitPos < 0 {
+							rpPos += 2
+							bitPos = 31
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestWS281xEncodeMatchesReference(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, n := range []int{1, 2, 3, 7, 60, 300} {
+		for _, model := range []ColorModel{RGBModel, RGBWModel} {
+			order := GRBOrder
+			if model == RGBWModel {
+				order = GRBWOrder
+			}
+			ws := testWS281x(WS281xConfig{NumPixels: n, ColorOrder: order, ColorModel: model})
+			ref := testWS281x(WS281xConfig{NumPixels: n, ColorOrder: order, ColorModel: model})
+			rnd.Read(ws.pixels)
+			copy(ref.pixels, ws.pixels)
+			// Garbage in the buffer must be treated the same way, too.
+			for i := range ws.pixDMAUint {
+				ws.pixDMAUint[i] = rnd.Uint32()
+				ref.pixDMAUint[i] = ws.pixDMAUint[i]
+			}
+
+			ws.encode(0, ws.numPixels)
+			encodeReference(ref)
+			for i := range ws.pixDMAUint {
+				if ws.pixDMAUint[i] != ref.pixDMAUint[i] {
+					t.Errorf("%d pixels, %d colors: word %d got %08X, want %08X",
+						n, model.NumColors(), i, ws.pixDMAUint[i], ref.pixDMAUint[i])
+					break
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkWS281xEncode(b *testing.B) {
+	ws := testWS281x(WS281xConfig{NumPixels: 300, ColorModel: RGBModel})
+	rand.Read(ws.pixels)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ws.encode(0, ws.numPixels)
+	}
+}
+
+func BenchmarkWS281xEncodeReference(b *testing.B) {
+	ws := testWS281x(WS281xConfig{NumPixels: 300, ColorModel: RGBModel})
+	rand.Read(ws.pixels)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		encodeReference(ws)
+	}
+}
+
+func TestWS281xEncodeDirty(t *testing.T) {
+	for _, model := range []ColorModel{RGBModel, RGBWModel} {
+		order := GRBOrder
+		if model == RGBWModel {
+			order = GRBWOrder
+		}
+		for _, changed := range []int{0, 1, 4, 9} {
+			ws := testWS281x(WS281xConfig{NumPixels: 10, ColorOrder: order, ColorModel: model})
+			ws.Fill(RGB{1, 2, 3})
+			ws.encode(0, ws.numPixels)
+			ws.dirty.reset()
+			prev := append([]uint32(nil), ws.pixDMAUint...)
+
+			// Change a pixel without marking it dirty, which FlushPartial mustn't notice.
+			other := (changed + 5) % 10
+			ws.pixels[other*ws.numColors] = 0xFF
+			ws.SetRGBAt(changed, RGB{0xAA, 0xBB, 0xCC})
+			ws.encode(ws.dirty.lo, ws.dirty.hi)
+
+			got := decodeWS281x(ws)
+			want := make([]byte, len(ws.pixels))
+			copy(want, ws.pixels)
+			want[other*ws.numColors] = decodeWS281xWords(ws, prev)[other*ws.numColors]
+			if !bytes.Equal(got, want) {
+				t.Errorf("%d colors, changed %d: encoded %v, want %v", model.NumColors(), changed, got, want)
+			}
+		}
+	}
+}
+
+// decodeWS281xWords is like decodeWS281x, but decodes the given words instead of the DMA buffer.
+func decodeWS281xWords(ws *WS281x, words []uint32) []byte {
+	saved := ws.pixDMAUint
+	defer func() { ws.pixDMAUint = saved }()
+	ws.pixDMAUint = words
+	return decodeWS281x(ws)
+}
+
+func TestWS281xFlushContextCancelled(t *testing.T) {
+	ws := testWS281x(WS281xConfig{NumPixels: 10, ColorModel: RGBModel})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- ws.FlushContext(ctx) }()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("FlushContext got: %v, want: %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("FlushContext didn't return")
+	}
+}
+
+func TestWS281xWriteFrame(t *testing.T) {
+	ws := testWS281x(WS281xConfig{NumPixels: 2, ColorOrder: GRBOrder, ColorModel: RGBModel})
+
+	if err := ws.WriteFrame(make([]byte, 5)); !errors.Is(err, ErrPixelCountMismatch) {
+		t.Errorf("WriteFrame of 5 bytes got: %v, want: %v", err, ErrPixelCountMismatch)
+	}
+	if err := ws.WriteFrame([]byte{1, 2, 3, 4, 5, 6}); err != nil {
+		t.Fatalf("WriteFrame: %v", err)
+	}
+	if got, want := ws.RGBAt(1), (RGB{5, 4, 6}); got != want {
+		t.Errorf("RGBAt(1) got %v, want %v", got, want)
+	}
+}
+
+func TestWS281xDithering(t *testing.T) {
+	ws := testWS281x(WS281xConfig{NumPixels: 1, ColorOrder: RGBOrder, ColorModel: RGBModel})
+	ws.SetRGBAt(0, RGB{5, 100, 0})
+	ws.SetBrightness(123)
+	ideal := []float64{5 * 123 / 255.0, 100 * 123 / 255.0, 0}
+
+	ws.encode(0, ws.numPixels)
+	if got, want := decodeWS281x(ws), []byte{2, 48, 0}; !bytes.Equal(got, want) {
+		t.Errorf("without dithering encoded %v, want %v", got, want)
+	}
+
+	ws.SetDithering(true)
+	const frames = 1000
+	sums := make([]float64, 3)
+	for f := 0; f < frames; f++ {
+		ws.encode(0, ws.numPixels)
+		for i, v := range decodeWS281x(ws) {
+			sums[i] += float64(v)
+		}
+	}
+	for i, sum := range sums {
+		if got := sum / frames; math.Abs(got-ideal[i]) > 0.01 {
+			t.Errorf("channel %d averaged %v, want %v", i, got, ideal[i])
+		}
+	}
+}
+
+func TestWS281xFlushMock(t *testing.T) {
+	t.Setenv(rpi.MockEnv, "1")
+	ws, err := NewWS281x(WS281xConfig{
+		NumPixels:    3,
+		ColorOrder:   GRBOrder,
+		ColorModel:   RGBModel,
+		PWMFrequency: testPWMFrequency,
+		DMAChannel:   10,
+		GPIOPins:     []int{18},
+	})
+	if err != nil {
+		t.Fatalf("NewWS281x: %v", err)
+	}
+	if !ws.RPi().IsMock() {
+		t.Fatalf("RPi().IsMock() got false, want true")
+	}
+
+	ws.SetRGBs([]RGB{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}})
+	if err := ws.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if got, want := decodeWS281x(ws), []byte{2, 1, 3, 5, 4, 6, 8, 7, 9}; !bytes.Equal(got, want) {
+		t.Errorf("Flush sent %v, want %v", got, want)
+	}
+
+	ws.SetRGBAt(1, RGB{255, 0, 0})
+	if err := ws.FlushPartial(); err != nil {
+		t.Fatalf("FlushPartial: %v", err)
+	}
+	if got, want := decodeWS281x(ws), []byte{2, 1, 3, 0, 255, 0, 8, 7, 9}; !bytes.Equal(got, want) {
+		t.Errorf("FlushPartial sent %v, want %v", got, want)
+	}
+
+	if err := ws.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if err := ws.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+
+	// The DMA buffer is gone, so flushes fail rather than send from it.
+	if err := ws.Flush(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Flush after Close got %v, want %v", err, ErrClosed)
+	}
+	if err := ws.FlushContext(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Errorf("FlushContext after Close got %v, want %v", err, ErrClosed)
+	}
+	if err := ws.FlushPartial(); !errors.Is(err, ErrClosed) {
+		t.Errorf("FlushPartial after Close got %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestWS281xFlushTimeout(t *testing.T) {
+	rp := rpi.NewMockRPi()
+	ws, err := NewWS281xWithRPi(rp, WS281xConfig{
+		NumPixels:    1,
+		ColorModel:   RGBModel,
+		PWMFrequency: testPWMFrequency,
+		DMAChannel:   10,
+		GPIOPins:     []int{18},
+		FlushTimeout: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewWS281xWithRPi: %v", err)
+	}
+	defer ws.Close()
+
+	rp.StallMockDMA(true)
+	if err := ws.Flush(); err != nil {
+		t.Fatalf("first Flush: %v", err)
+	}
+	// The first frame never finishes sending, so the next flushes time out.
+	if err := ws.Flush(); !errors.Is(err, rpi.ErrDMATimeout) {
+		t.Errorf("Flush got %v, want %v", err, rpi.ErrDMATimeout)
+	}
+	if err := ws.FlushPartial(); !errors.Is(err, rpi.ErrDMATimeout) {
+		t.Errorf("FlushPartial got %v, want %v", err, rpi.ErrDMATimeout)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := ws.FlushContext(ctx); err != context.Canceled {
+		t.Errorf("FlushContext got %v, want %v", err, context.Canceled)
+	}
+
+	// Close waits for the frame too, but still closes when it never ends.
+	if err := ws.Close(); !errors.Is(err, rpi.ErrDMATimeout) {
+		t.Errorf("Close got %v, want %v", err, rpi.ErrDMATimeout)
+	}
+	if !ws.closed {
+		t.Errorf("strip wasn't closed")
+	}
+}
+
+func TestWS281xAudioCheck(t *testing.T) {
+	defer func(check func(*rpi.RPi) error) { checkPWMAudio = check }(checkPWMAudio)
+	checkPWMAudio = func(*rpi.RPi) error {
+		return fmt.Errorf("%w (faked)", rpi.ErrPWMInUse)
+	}
+
+	// By default the conflict is only a warning.
+	config := DefaultWS281xConfig(1)
+	ws, err := NewWS281xWithRPi(rpi.NewMockRPi(), config)
+	if err != nil {
+		t.Fatalf("NewWS281xWithRPi: %v", err)
+	}
+	ws.Close()
+
+	config.StrictAudioCheck = true
+	if _, err := NewWS281xWithRPi(rpi.NewMockRPi(), config); !errors.Is(err, rpi.ErrPWMInUse) {
+		t.Errorf("strict NewWS281xWithRPi got %v, want %v", err, rpi.ErrPWMInUse)
+	}
+	// The PCM doesn't share anything with the audio.
+	config = config.WithGPIOPins(21)
+	config.DMASource = PCMSource
+	ws, err = NewWS281xWithRPi(rpi.NewMockRPi(), config)
+	if err != nil {
+		t.Fatalf("strict NewWS281xWithRPi with the PCM: %v", err)
+	}
+	ws.Close()
+}
+
+func TestWS281xInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		dma    int
+		pins   []int
+		errStr string
+	}{
+		{"reserved DMA channel", 5, []int{18}, "DMA channel 5 is reserved"},
+		{"DMA channel out of range", 15, []int{18}, "out of range"},
+		{"non-PWM pin", 10, []int{17}, "valid pins are [12 18]"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewWS281xWithRPi(rpi.NewMockRPi(), WS281xConfig{
+				NumPixels:    1,
+				ColorModel:   RGBModel,
+				PWMFrequency: testPWMFrequency,
+				DMAChannel:   test.dma,
+				GPIOPins:     test.pins,
+			})
+			if err == nil || !strings.Contains(err.Error(), test.errStr) {
+				t.Errorf("got %v, want error containing %q", err, test.errStr)
+			}
+		})
+	}
+}
+
+func TestWS281xDoubleBuffering(t *testing.T) {
+	ws := testWS281x(WS281xConfig{NumPixels: 2, ColorOrder: RGBOrder, ColorModel: RGBModel})
+	ws.SetRGBs([]RGB{{1, 2, 3}, {4, 5, 6}})
+	ws.SetDoubleBuffering(true)
+
+	ws.SetRGBAt(0, RGB{7, 8, 9})
+	ws.encode(0, ws.numPixels)
+	if got, want := decodeWS281x(ws), []byte{1, 2, 3, 4, 5, 6}; !bytes.Equal(got, want) {
+		t.Errorf("before SwapBuffers encoded %v, want %v", got, want)
+	}
+	if got, want := ws.RGBAt(0), (RGB{7, 8, 9}); got != want {
+		t.Errorf("RGBAt(0) got %v, want %v", got, want)
+	}
+
+	ws.SwapBuffers()
+	ws.encode(ws.dirty.lo, ws.dirty.hi)
+	if got, want := decodeWS281x(ws), []byte{7, 8, 9, 4, 5, 6}; !bytes.Equal(got, want) {
+		t.Errorf("after SwapBuffers encoded %v, want %v", got, want)
+	}
+
+	// The back buffer still has the frame, so it can be drawn on incrementally.
+	ws.SetRGBAt(1, RGB{10, 11, 12})
+	ws.SwapBuffers()
+	ws.encode(0, ws.numPixels)
+	if got, want := decodeWS281x(ws), []byte{7, 8, 9, 10, 11, 12}; !bytes.Equal(got, want) {
+		t.Errorf("after second SwapBuffers encoded %v, want %v", got, want)
+	}
+}
+
+func TestWS281x16Bit(t *testing.T) {
+	ws := testWS281x(WS281xConfig{NumPixels: 3, ColorOrder: RGBOrder, ColorModel: RGBModel})
+	ws.SetGamma(2.2)
+	ws.SetDithering(true)
+	ws.SetRGB16At(0, RGB16{0x8000, 0, 0})
+	ws.SetRGB16At(1, RGB16{0x80FF, 0, 0})
+	ws.SetRGB16At(2, RGB16{0x80FF, 0, 0})
+	ws.SetRGBAt(2, RGB{0x80, 0, 0})
+
+	if got, want := ws.RGBAt(1), (RGB{0x80, 0, 0}); got != want {
+		t.Errorf("RGBAt(1) got %v, want %v", got, want)
+	}
+
+	// Over enough frames the dithered output averages to the exact value, so
+	// the two 16-bit values must come out apart.
+	var sums [3]int
+	for f := 0; f < 255; f++ {
+		ws.encode(0, ws.numPixels)
+		got := decodeWS281x(ws)
+		for i := range sums {
+			sums[i] += int(got[i*3])
+		}
+	}
+	if sums[0] >= sums[1] {
+		t.Errorf("0x8000 summed to %d and 0x80FF to %d, want increasing", sums[0], sums[1])
+	}
+	// 0x80 is 0x8080 in 16 bits, between the other two.
+	if sums[2] <= sums[0] || sums[2] >= sums[1] {
+		t.Errorf("8-bit 0x80 summed to %d, want between %d and %d", sums[2], sums[0], sums[1])
+	}
+}
+
+func TestWS281x16BitWriters(t *testing.T) {
+	// Every setter that only takes 8-bit values has to replace the 16-bit
+	// value of the pixels it writes, or a stale one would be shown.
+	frame := []byte{0x80, 0, 0, 0, 0, 0}
+	tests := []struct {
+		name  string
+		write func(ws *WS281x)
+		want  uint16
+	}{
+		{"SetRGBAt", func(ws *WS281x) { ws.SetRGBAt(0, RGB{0x80, 0, 0}) }, 0x8080},
+		{"SetRGBs", func(ws *WS281x) { ws.SetRGBs([]RGB{{0x80, 0, 0}, {}}) }, 0x8080},
+		{"WriteFrame", func(ws *WS281x) { ws.WriteFrame(frame) }, 0x8080},
+		{"Restore", func(ws *WS281x) { ws.Restore(frame) }, 0x8080},
+		{"Clear", func(ws *WS281x) { ws.Clear() }, 0},
+		{"Shift", func(ws *WS281x) { ws.Shift(1, RGB{0x80, 0, 0}) }, 0x8080},
+	}
+	for _, test := range tests {
+		ws := testWS281x(WS281xConfig{NumPixels: 2, ColorOrder: RGBOrder, ColorModel: RGBModel})
+		ws.SetRGB16At(0, RGB16{0x80FF, 0, 0})
+		test.write(ws)
+		if got := ws.deep[0]; got != test.want {
+			t.Errorf("%s: 16-bit value got %#x, want %#x", test.name, got, test.want)
+		}
+	}
+
+	ws := testWS281x(WS281xConfig{NumPixels: 2, ColorOrder: RGBWOrder, ColorModel: RGBWModel})
+	ws.SetRGBW16At(0, RGBW16{0x80FF, 0, 0, 0x10FF})
+	ws.SetRGBWs([]RGBW{{0x80, 0, 0, 0x10}, {}})
+	if got, want := ws.deep[:4], []uint16{0x8080, 0, 0, 0x1010}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SetRGBWs: 16-bit values got %#x, want %#x", got, want)
+	}
+}
+
+func TestWS281x16BitShiftRotate(t *testing.T) {
+	ws := testWS281x(WS281xConfig{NumPixels: 3, ColorOrder: RGBOrder, ColorModel: RGBModel})
+	ws.SetRGB16At(0, RGB16{0x1234, 0x5678, 0x9abc})
+
+	// The 16-bit values move along with the pixels.
+	ws.Rotate(-1)
+	want := []uint16{0, 0, 0, 0, 0, 0, 0x1234, 0x5678, 0x9abc}
+	if !reflect.DeepEqual(ws.deep, want) {
+		t.Errorf("after Rotate 16-bit values got %#x, want %#x", ws.deep, want)
+	}
+	ws.Shift(-2, RGB{1, 2, 3})
+	want = []uint16{0x1234, 0x5678, 0x9abc, 257, 514, 771, 257, 514, 771}
+	if !reflect.DeepEqual(ws.deep, want) {
+		t.Errorf("after Shift 16-bit values got %#x, want %#x", ws.deep, want)
+	}
+
+	// Reversed strips move them the other way, just like the pixels.
+	ws.SetReversed(true)
+	ws.Rotate(1)
+	want = []uint16{257, 514, 771, 257, 514, 771, 0x1234, 0x5678, 0x9abc}
+	if !reflect.DeepEqual(ws.deep, want) {
+		t.Errorf("after reversed Rotate 16-bit values got %#x, want %#x", ws.deep, want)
+	}
+	if got, want := ws.RGBAt(0), (RGB{0x12, 0x56, 0x9a}); got != want {
+		t.Errorf("after reversed Rotate RGBAt(0) got %v, want %v", got, want)
+	}
+}
+
+func TestWS281xPalette(t *testing.T) {
+	ws := testWS281x(WS281xConfig{NumPixels: 3, ColorOrder: GRBWOrder, ColorModel: RGBWModel})
+	ws.FillRGBW(RGBW{9, 9, 9, 9})
+
+	if err := ws.SetIndexAt(1, 1); !errors.Is(err, ErrNoPalette) {
+		t.Errorf("SetIndexAt without a palette got %v, want %v", err, ErrNoPalette)
+	}
+	if err := ws.SetPalette(make(Palette, 257)); err == nil {
+		t.Errorf("SetPalette with 257 colors got no error")
+	}
+
+	if err := ws.SetPalette(Palette{{1, 2, 3}, {4, 5, 6}}); err != nil {
+		t.Fatalf("SetPalette: %v", err)
+	}
+	ws.SetIndexAt(1, 1)
+	ws.SetIndexAt(2, 7) // past the end of the palette
+	if err := ws.SetIndexAt(3, 0); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Errorf("SetIndexAt(3) got %v, want %v", err, ErrIndexOutOfRange)
+	}
+	ws.encode(0, ws.numPixels)
+	want := []byte{2, 1, 3, 0, 5, 4, 6, 0, 0, 0, 0, 0}
+	if got := decodeWS281x(ws); !bytes.Equal(got, want) {
+		t.Errorf("indexed encoded %v, want %v", got, want)
+	}
+
+	// Changing the palette recolors every pixel.
+	ws.SetPalette(Palette{{7, 8, 9}, {10, 11, 12}, {13, 14, 15}})
+	if got := ws.IndexAt(2); got != 7 {
+		t.Errorf("IndexAt(2) got %d, want 7", got)
+	}
+	ws.encode(0, ws.numPixels)
+	want = []byte{8, 7, 9, 0, 11, 10, 12, 0, 0, 0, 0, 0}
+	if got := decodeWS281x(ws); !bytes.Equal(got, want) {
+		t.Errorf("recolored encoded %v, want %v", got, want)
+	}
+
+	ws.SetPalette(nil)
+	ws.encode(0, ws.numPixels)
+	want = []byte{9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9}
+	if got := decodeWS281x(ws); !bytes.Equal(got, want) {
+		t.Errorf("without palette encoded %v, want %v", got, want)
+	}
+}
+
+func TestDefaultWS281xConfig(t *testing.T) {
+	config := DefaultWS281xConfig(60)
+	want := WS281xConfig{
+		NumPixels:    60,
+		ColorOrder:   GRBOrder,
+		ColorModel:   RGBModel,
+		PWMFrequency: 800000,
+		DMAChannel:   10,
+		GPIOPins:     []int{18},
+	}
+	if !reflect.DeepEqual(config, want) {
+		t.Errorf("DefaultWS281xConfig(60) got %+v, want %+v", config, want)
+	}
+
+	got := config.WithColorOrder(GRBWOrder).WithColorModel(RGBWModel).WithDMAChannel(11).WithGPIOPins(12, 13)
+	want.ColorOrder = GRBWOrder
+	want.ColorModel = RGBWModel
+	want.DMAChannel = 11
+	want.GPIOPins = []int{12, 13}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("with options got %+v, want %+v", got, want)
+	}
+	if config.DMAChannel != 10 || config.GPIOPins[0] != 18 {
+		t.Errorf("options changed the original config: %+v", config)
+	}
+}
+
+func TestWS281xColorModelBridging(t *testing.T) {
+	ws := testWS281x(WS281xConfig{NumPixels: 2, ColorOrder: GRBWOrder, ColorModel: RGBWModel})
+	ws.SetRGBWAt(0, RGBW{1, 2, 3, 4})
+
+	// RGB setters turn white off by default.
+	ws.SetRGBAt(0, RGB{10, 20, 30})
+	if got, want := ws.RGBWAt(0), (RGBW{10, 20, 30, 0}); got != want {
+		t.Errorf("RGBW strip after SetRGBAt got %v, want %v", got, want)
+	}
+
+	ws.SetWhiteExtraction(WhiteMin)
+	ws.SetRGBAt(1, RGB{10, 20, 30})
+	if got, want := ws.RGBWAt(1), (RGBW{0, 10, 20, 10}); got != want {
+		t.Errorf("RGBW strip with WhiteMin got %v, want %v", got, want)
+	}
+
+	rgb := testWS281x(WS281xConfig{NumPixels: 2, ColorOrder: GRBOrder, ColorModel: RGBModel})
+	rgb.SetRGBWAt(1, RGBW{1, 2, 3, 4})
+	rgb.SetRGBWAt(0, RGBW{5, 6, 7, 8})
+	if got, want := rgb.Pixels(), []byte{6, 5, 7, 2, 1, 3}; !bytes.Equal(got, want) {
+		t.Errorf("RGB strip after SetRGBWAt pixels %v, want %v", got, want)
+	}
+	if got, want := rgb.RGBWAt(0), (RGBW{5, 6, 7, 0}); got != want {
+		t.Errorf("RGB strip RGBWAt(0) got %v, want %v", got, want)
+	}
+}
+
+func TestWS281xReversed(t *testing.T) {
+	ws := testWS281x(WS281xConfig{NumPixels: 3, ColorOrder: RGBOrder, ColorModel: RGBModel})
+	ws.SetReversed(true)
+
+	ws.SetRGBAt(0, RGB{1, 2, 3})
+	if got, want := ws.Pixels(), []byte{0, 0, 0, 0, 0, 0, 1, 2, 3}; !bytes.Equal(got, want) {
+		t.Errorf("after SetRGBAt(0) pixels %v, want %v", got, want)
+	}
+	if got, want := ws.RGBAt(0), (RGB{1, 2, 3}); got != want {
+		t.Errorf("RGBAt(0) got %v, want %v", got, want)
+	}
+
+	ws.SetRGBs([]RGB{{1, 1, 1}, {2, 2, 2}, {3, 3, 3}})
+	if got, want := ws.Pixels(), []byte{3, 3, 3, 2, 2, 2, 1, 1, 1}; !bytes.Equal(got, want) {
+		t.Errorf("after SetRGBs pixels %v, want %v", got, want)
+	}
+
+	// Shifting towards the logical end moves pixels towards the physical start.
+	ws.Shift(1, RGB{9, 9, 9})
+	for i, want := range []RGB{{9, 9, 9}, {1, 1, 1}, {2, 2, 2}} {
+		if got := ws.RGBAt(i); got != want {
+			t.Errorf("after Shift, RGBAt(%d) got %v, want %v", i, got, want)
+		}
+	}
+
+	ws.SetReversed(false)
+	if got, want := ws.RGBAt(0), (RGB{2, 2, 2}); got != want {
+		t.Errorf("not reversed, RGBAt(0) got %v, want %v", got, want)
+	}
+}
+
+func TestWS281xCopyFrom(t *testing.T) {
+	src := testWS281x(WS281xConfig{NumPixels: 4, ColorOrder: GRBWOrder, ColorModel: RGBWModel})
+	src.SetRGBWs([]RGBW{{1, 1, 1, 1}, {2, 2, 2, 2}, {3, 3, 3, 3}, {250, 0, 0, 10}})
+
+	// Same model.
+	dst := testWS281x(WS281xConfig{NumPixels: 3, ColorOrder: RGBWOrder, ColorModel: RGBWModel})
+	if err := dst.CopyFrom(src, 1, 0, 3); err != nil {
+		t.Fatalf("CopyFrom failed: %v", err)
+	}
+	for i, want := range []RGBW{{2, 2, 2, 2}, {3, 3, 3, 3}, {250, 0, 0, 10}} {
+		if got := dst.RGBWAt(i); got != want {
+			t.Errorf("same model RGBWAt(%d) got %v, want %v", i, got, want)
+		}
+	}
+
+	// RGBW to RGB adds white to the other channels, saturating.
+	rgb := testWS281x(WS281xConfig{NumPixels: 2, ColorOrder: GRBOrder, ColorModel: RGBModel})
+	if err := rgb.CopyFrom(src, 2, 0, 2); err != nil {
+		t.Fatalf("CopyFrom failed: %v", err)
+	}
+	for i, want := range []RGB{{6, 6, 6}, {255, 10, 10}} {
+		if got := rgb.RGBAt(i); got != want {
+			t.Errorf("RGBW to RGB RGBAt(%d) got %v, want %v", i, got, want)
+		}
+	}
+
+	// RGB to RGBW uses the white extraction.
+	dst.SetWhiteExtraction(WhiteMin)
+	if err := dst.CopyFrom(rgb, 0, 1, 2); err != nil {
+		t.Fatalf("CopyFrom failed: %v", err)
+	}
+	for i, want := range []RGBW{{2, 2, 2, 2}, {0, 0, 0, 6}, {245, 0, 0, 10}} {
+		if got := dst.RGBWAt(i); got != want {
+			t.Errorf("RGB to RGBW RGBWAt(%d) got %v, want %v", i, got, want)
+		}
+	}
+
+	if err := dst.CopyFrom(src, 2, 0, 3); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Errorf("CopyFrom past the end of src got %v, want ErrIndexOutOfRange", err)
+	}
+	if err := dst.CopyFrom(src, 0, 1, 3); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Errorf("CopyFrom past the end of dst got %v, want ErrIndexOutOfRange", err)
+	}
+}
+
+func TestWS281xCopyFromOverlapping(t *testing.T) {
+	tests := []struct {
+		srcStart, dstStart int
+		want               []RGB
+	}{
+		{0, 1, []RGB{{0, 0, 0}, {0, 0, 0}, {1, 1, 1}, {2, 2, 2}, {4, 4, 4}}},
+		{1, 0, []RGB{{1, 1, 1}, {2, 2, 2}, {3, 3, 3}, {3, 3, 3}, {4, 4, 4}}},
+	}
+
+	for _, test := range tests {
+		ws := testWS281x(WS281xConfig{NumPixels: 5, ColorOrder: RGBOrder, ColorModel: RGBModel})
+		ws.SetRGBs([]RGB{{0, 0, 0}, {1, 1, 1}, {2, 2, 2}, {3, 3, 3}, {4, 4, 4}})
+		if err := ws.CopyFrom(ws, test.srcStart, test.dstStart, 3); err != nil {
+			t.Fatalf("CopyFrom(%d, %d) failed: %v", test.srcStart, test.dstStart, err)
+		}
+		for i, want := range test.want {
+			if got := ws.RGBAt(i); got != want {
+				t.Errorf("CopyFrom(%d, %d) RGBAt(%d) got %v, want %v", test.srcStart, test.dstStart, i, got, want)
+			}
+		}
+	}
+}
+
+func TestWS281xPCM(t *testing.T) {
+	config := DefaultWS281xConfig(2).WithColorOrder(RGBOrder).WithGPIOPins(21)
+	if _, err := NewWS281xWithRPi(rpi.NewMockRPi(), config); err == nil {
+		t.Errorf("PWM on GPIO 21 succeeded, want error")
+	}
+
+	config.DMASource = PCMSource
+	ws, err := NewWS281xWithRPi(rpi.NewMockRPi(), config)
+	if err != nil {
+		t.Fatalf("NewWS281xWithRPi: %v", err)
+	}
+	// The PCM has one channel, so it needs half the buffer of the PWM.
+	pwm := makeWS281x(DefaultWS281xConfig(2))
+	if got, want := ws.pwmByteCount(testPWMFrequency), pwm.pwmByteCount(testPWMFrequency)/2; got != want {
+		t.Errorf("pwmByteCount got %d, want %d", got, want)
+	}
+
+	ws.SetRGBs([]RGB{{1, 2, 3}, {4, 5, 6}})
+	if err := ws.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if got, want := decodeWS281x(ws), []byte{1, 2, 3, 4, 5, 6}; !bytes.Equal(got, want) {
+		t.Errorf("encoded %v, want %v", got, want)
+	}
+	// Stopping the PWM instead would fail, since it was never set up.
+	if err := ws.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
+
+func TestWS281xChannels(t *testing.T) {
+	tests := []struct {
+		mirror bool
+		pixels int
+		want0  []byte
+		want1  []byte
+	}{
+		{true, 3, []byte{1, 2, 3, 4, 5, 6, 7, 8, 9}, []byte{1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{false, 6, []byte{1, 2, 3, 4, 5, 6, 7, 8, 9}, []byte{10, 11, 12, 13, 14, 15, 16, 17, 18}},
+	}
+	for _, test := range tests {
+		config := DefaultWS281xConfig(3).WithColorOrder(RGBOrder).WithGPIOPins(18, 13)
+		config.MirrorChannels = test.mirror
+		ws, err := NewWS281xWithRPi(rpi.NewMockRPi(), config)
+		if err != nil {
+			t.Fatalf("mirror %v: NewWS281xWithRPi: %v", test.mirror, err)
+		}
+		if got := ws.NumPixels(); got != test.pixels {
+			t.Errorf("mirror %v: NumPixels got %d, want %d", test.mirror, got, test.pixels)
+		}
+		for i := 0; i < ws.NumPixels(); i++ {
+			ws.SetRGBAt(i, RGB{uint8(3*i + 1), uint8(3*i + 2), uint8(3*i + 3)})
+		}
+		if err := ws.Flush(); err != nil {
+			t.Fatalf("mirror %v: Flush: %v", test.mirror, err)
+		}
+		if got := decodeWS281xChannel(ws, 0); !bytes.Equal(got, test.want0) {
+			t.Errorf("mirror %v: channel 0 got %v, want %v", test.mirror, got, test.want0)
+		}
+		if got := decodeWS281xChannel(ws, 1); !bytes.Equal(got, test.want1) {
+			t.Errorf("mirror %v: channel 1 got %v, want %v", test.mirror, got, test.want1)
+		}
+
+		// A partial flush of the second strip leaves the first alone.
+		ws.SetRGBAt(ws.NumPixels()-1, RGB{99, 99, 99})
+		if err := ws.FlushPartial(); err != nil {
+			t.Fatalf("mirror %v: FlushPartial: %v", test.mirror, err)
+		}
+		if got := decodeWS281xChannel(ws, 1)[8]; got != 99 {
+			t.Errorf("mirror %v: channel 1 last byte got %d, want 99", test.mirror, got)
+		}
+		if !test.mirror {
+			if got := decodeWS281xChannel(ws, 0); !bytes.Equal(got, test.want0) {
+				t.Errorf("mirror %v: channel 0 after FlushPartial got %v, want %v", test.mirror, got, test.want0)
+			}
+		}
+		ws.Close()
+	}
+}
+
+func TestWS281xSeparateChannelsReversed(t *testing.T) {
+	config := DefaultWS281xConfig(3).WithColorOrder(RGBOrder).WithGPIOPins(18, 13)
+	ws, err := NewWS281xWithRPi(rpi.NewMockRPi(), config)
+	if err != nil {
+		t.Fatalf("NewWS281xWithRPi: %v", err)
+	}
+	defer ws.Close()
+	ws.SetReversed(true)
+	for i := 0; i < ws.NumPixels(); i++ {
+		ws.SetRGBAt(i, RGB{uint8(3*i + 1), uint8(3*i + 2), uint8(3*i + 3)})
+	}
+	if err := ws.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	// Each strip is reversed on its own, rather than the two swapping.
+	want0 := []byte{7, 8, 9, 4, 5, 6, 1, 2, 3}
+	want1 := []byte{16, 17, 18, 13, 14, 15, 10, 11, 12}
+	if got := decodeWS281xChannel(ws, 0); !bytes.Equal(got, want0) {
+		t.Errorf("channel 0 got %v, want %v", got, want0)
+	}
+	if got := decodeWS281xChannel(ws, 1); !bytes.Equal(got, want1) {
+		t.Errorf("channel 1 got %v, want %v", got, want1)
+	}
+
+	// Shift and Rotate move pixels in logical order, across the strips.
+	ws.Rotate(1)
+	ws.Shift(-2, RGB{99, 99, 99})
+	want := []RGB{{4, 5, 6}, {7, 8, 9}, {10, 11, 12}, {13, 14, 15}, {99, 99, 99}, {99, 99, 99}}
+	for i := range want {
+		if got := ws.RGBAt(i); got != want[i] {
+			t.Errorf("after Rotate and Shift, RGBAt(%d) got %v, want %v", i, got, want[i])
+		}
+	}
+}
+
+func TestWS281xDMAStats(t *testing.T) {
+	tests := []struct {
+		config WS281xConfig
+		pixels int
+	}{
+		{DefaultWS281xConfig(60), 2 * 60 * 9},
+		{DefaultWS281xConfig(10).WithColorOrder(GRBWOrder).WithColorModel(RGBWModel), 2 * 10 * 12},
+		{DefaultWS281xConfig(10).WithGPIOPins(18, 13), 2 * 10 * 9},
+	}
+	for _, test := range tests {
+		ws, err := NewWS281xWithRPi(rpi.NewMockRPi(), test.config)
+		if err != nil {
+			t.Fatalf("NewWS281xWithRPi: %v", err)
+		}
+		want := int(makeWS281x(test.config).pwmByteCount(test.config.PWMFrequency))
+		if got := ws.DMABufferBytes(); got != want {
+			t.Errorf("%d pixels: DMABufferBytes got %d, want %d", test.config.NumPixels, got, want)
+		}
+		stats := ws.DMAStats()
+		if stats.AllocatedBytes != want || stats.PixelBytes != test.pixels || stats.ResetBytes != want-test.pixels {
+			t.Errorf("%d pixels: DMAStats got %+v, want %d allocated, %d for pixels", test.config.NumPixels, stats, want, test.pixels)
+		}
+		ws.Close()
+	}
+}
+
+func TestWS281xSkipUnchanged(t *testing.T) {
+	rp := rpi.NewMockRPi()
+	ws, err := NewWS281xWithRPi(rp, DefaultWS281xConfig(2))
+	if err != nil {
+		t.Fatalf("NewWS281xWithRPi: %v", err)
+	}
+	defer ws.Close()
+	ws.SetSkipUnchanged(true)
+
+	ws.SetRGBAt(0, RGB{1, 2, 3})
+	for i := 0; i < 2; i++ {
+		if err := ws.Flush(); err != nil {
+			t.Fatalf("Flush: %v", err)
+		}
+	}
+	if got, want := rp.MockDMAs(), 1; got != want {
+		t.Errorf("two identical frames started DMA %d times, want %d", got, want)
+	}
+
+	ws.SetRGBAt(1, RGB{4, 5, 6})
+	if err := ws.FlushPartial(); err != nil {
+		t.Fatalf("FlushPartial: %v", err)
+	}
+	if got, want := rp.MockDMAs(), 2; got != want {
+		t.Errorf("changed frame started DMA %d times in all, want %d", got, want)
+	}
+	if got, want := ws.SkippedFlushes(), 1; got != want {
+		t.Errorf("SkippedFlushes() got %d, want %d", got, want)
+	}
+
+	ws.SetSkipUnchanged(false)
+	if err := ws.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if got, want := rp.MockDMAs(), 3; got != want {
+		t.Errorf("with skipping off, started DMA %d times in all, want %d", got, want)
+	}
+}
+
+func TestWS281xFlushObserver(t *testing.T) {
+	ws, err := NewWS281xWithRPi(rpi.NewMockRPi(), DefaultWS281xConfig(300))
+	if err != nil {
+		t.Fatalf("NewWS281xWithRPi: %v", err)
+	}
+	defer ws.Close()
+	var got []FlushStats
+	ws.SetFlushObserver(func(s FlushStats) { got = append(got, s) })
+	ws.SetSkipUnchanged(true)
+
+	if err := ws.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	ws.SetRGBAt(10, RGB{1, 2, 3})
+	ws.SetRGBAt(12, RGB{1, 2, 3})
+	if err := ws.FlushPartial(); err != nil {
+		t.Fatalf("FlushPartial: %v", err)
+	}
+	if err := ws.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	if len(got) != 3 {
+		t.Fatalf("observer called %d times, want 3", len(got))
+	}
+	for i, want := range []struct {
+		changed int
+		skipped bool
+	}{{300, false}, {3, false}, {0, true}} {
+		s := got[i]
+		if s.PixelsChanged != want.changed || s.Skipped != want.skipped {
+			t.Errorf("flush %d: got %+v, want %d pixels changed and skipped %v", i, s, want.changed, want.skipped)
+		}
+		if s.EncodeDuration < 0 || s.EncodeDuration > time.Second {
+			t.Errorf("flush %d: implausible EncodeDuration %v", i, s.EncodeDuration)
+		}
+		// Starting the mock's DMA sleeps, so sending can't take no time.
+		if (s.TransmitDuration <= 0 && !s.Skipped) || s.TransmitDuration > time.Second {
+			t.Errorf("flush %d: implausible TransmitDuration %v", i, s.TransmitDuration)
+		}
+	}
+}
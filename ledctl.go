@@ -1,9 +1,17 @@
 package ledctl
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	rpi "github.com/mxcu/ledctl/rpi"
 )
 
 // ColorOrder is an enumeration of the possible color orders for the color
@@ -18,6 +26,11 @@ const (
 	RGBOrder
 	RBGOrder
 	GRBWOrder
+	RGBWOrder
+	BGRWOrder
+	GBRWOrder
+	BRGWOrder
+	RBGWOrder
 )
 
 // StringToOrder is a map from string representations of the color order to
@@ -30,6 +43,95 @@ var StringToOrder = map[string]ColorOrder{
 	"RGB":  RGBOrder,
 	"RBG":  RBGOrder,
 	"GRBW": GRBWOrder,
+	"RGBW": RGBWOrder,
+	"BGRW": BGRWOrder,
+	"GBRW": GBRWOrder,
+	"BRGW": BRGWOrder,
+	"RBGW": RBGWOrder,
+}
+
+// OrderToString is a map from ColorOrder to its string representation. It is
+// the reverse of StringToOrder.
+var OrderToString = func() map[ColorOrder]string {
+	m := make(map[ColorOrder]string, len(StringToOrder))
+	for s, o := range StringToOrder {
+		m[o] = s
+	}
+	return m
+}()
+
+// String returns the string representation of the color order, e.g. "GRB".
+func (o ColorOrder) String() string {
+	if s, ok := OrderToString[o]; ok {
+		return s
+	}
+	return fmt.Sprintf("ColorOrder(%d)", int(o))
+}
+
+// ParseColorOrder returns the color order for its string representation, e.g.
+// "GRB".
+func ParseColorOrder(s string) (ColorOrder, error) {
+	o, ok := StringToOrder[strings.ToUpper(s)]
+	if !ok {
+		return 0, fmt.Errorf("unknown color order %q", s)
+	}
+	return o, nil
+}
+
+// NewColorOrder returns the color order for s, which is any arrangement of
+// "RGB" or "RGBW", e.g. "WRGB". If it isn't one of the built-in orders, a new
+// one is made and registered, so that it works everywhere they do, including
+// ParseColorOrder and JSON. Registering isn't safe to do concurrently with
+// anything else that uses color orders, so it's best done at startup.
+func NewColorOrder(s string) (ColorOrder, error) {
+	s = strings.ToUpper(s)
+	if o, ok := StringToOrder[s]; ok {
+		return o, nil
+	}
+	if len(s) != 3 && len(s) != 4 {
+		return 0, fmt.Errorf("color order %q isn't 3 or 4 colors", s)
+	}
+	// The offsets are in the order G, R, B, W.
+	off := []int{-1, -1, -1, -1}
+	for i, c := range s {
+		k := strings.IndexRune("GRBW", c)
+		if k < 0 || off[k] >= 0 {
+			return 0, fmt.Errorf("color order %q isn't an arrangement of RGB or RGBW", s)
+		}
+		off[k] = i
+	}
+	if off[0] < 0 || off[1] < 0 || off[2] < 0 {
+		return 0, fmt.Errorf("color order %q isn't an arrangement of RGB or RGBW", s)
+	}
+
+	o := ColorOrder(len(offsets))
+	for _, ok := offsets[o]; ok; _, ok = offsets[o] {
+		o++
+	}
+	offsets[o] = off
+	StringToOrder[s] = o
+	OrderToString[o] = s
+	return o, nil
+}
+
+// MarshalText implements encoding.TextMarshaler, so that the color order is
+// written by name in JSON and the like.
+func (o ColorOrder) MarshalText() ([]byte, error) {
+	s, ok := OrderToString[o]
+	if !ok {
+		return nil, fmt.Errorf("unknown color order %d", int(o))
+	}
+	return []byte(s), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (o *ColorOrder) UnmarshalText(text []byte) error {
+	v, err := ParseColorOrder(string(text))
+	if err != nil {
+		return err
+	}
+	*o = v
+	return nil
 }
 
 var offsets = map[ColorOrder][]int{
@@ -40,6 +142,72 @@ var offsets = map[ColorOrder][]int{
 	RGBOrder:  {1, 0, 2, -1},
 	RBGOrder:  {2, 0, 1, -1},
 	GRBWOrder: {0, 1, 2, 3},
+	RGBWOrder: {1, 0, 2, 3},
+	BGRWOrder: {1, 2, 0, 3},
+	GBRWOrder: {0, 2, 1, 3},
+	BRGWOrder: {2, 1, 0, 3},
+	RBGWOrder: {2, 0, 1, 3},
+}
+
+var (
+	// ErrWrongColorModel is returned when an operation doesn't match the
+	// color model of the strip, e.g. setting RGB pixels on an RGBW strip.
+	ErrWrongColorModel = errors.New("wrong color model")
+	// ErrPixelCountMismatch is returned when the number of pixels given
+	// doesn't match the number of pixels in the strip.
+	ErrPixelCountMismatch = errors.New("wrong number of pixels")
+	// ErrIndexOutOfRange is returned when a pixel index is outside the strip.
+	ErrIndexOutOfRange = errors.New("pixel index out of range")
+	// ErrNoPalette is returned by SetIndexAt when the strip isn't in indexed
+	// mode.
+	ErrNoPalette = errors.New("no palette set")
+	// ErrClosed is returned when flushing a strip that has been closed.
+	ErrClosed = errors.New("strip is closed")
+
+	// These are the errors from the rpi package, so that callers don't have
+	// to import it to check for them.
+
+	// ErrNotRaspberryPi is returned by the constructors when the hardware
+	// isn't a Raspberry Pi.
+	ErrNotRaspberryPi = rpi.ErrNotRaspberryPi
+	// ErrUnsupportedModel is returned by the constructors on a Raspberry Pi
+	// that can't be driven, such as a Pi 5.
+	ErrUnsupportedModel = rpi.ErrUnsupportedModel
+	// ErrPermission is returned when the user isn't allowed to use the
+	// hardware. It's os.ErrPermission.
+	ErrPermission = rpi.ErrPermission
+	// ErrDMATimeout is returned when a flush gives up waiting for the
+	// previous frame to be sent.
+	ErrDMATimeout = rpi.ErrDMATimeout
+	// ErrPWMInUse is returned by NewWS281x when the onboard audio is using
+	// the PWM.
+	ErrPWMInUse = rpi.ErrPWMInUse
+)
+
+// checkIndex returns ErrIndexOutOfRange if i isn't a valid index for a strip
+// of n pixels.
+func checkIndex(i, n int) error {
+	if i < 0 || i >= n {
+		return fmt.Errorf("index %d not in [0, %d): %w", i, n, ErrIndexOutOfRange)
+	}
+	return nil
+}
+
+// clipRange returns how many of the count pixels from start fit in a strip of
+// n pixels, or ErrIndexOutOfRange if start isn't in [0, n] or count is
+// negative.
+func clipRange(start, count, n int) (int, error) {
+	if start < 0 || start > n {
+		return 0, fmt.Errorf("start %d not in [0, %d]: %w", start, n, ErrIndexOutOfRange)
+	}
+	if count < 0 {
+		return 0, fmt.Errorf("negative count %d: %w", count, ErrIndexOutOfRange)
+	}
+	// Not start+count > n, which overflows for a huge count.
+	if count > n-start {
+		count = n - start
+	}
+	return count, nil
 }
 
 // ColorModel is an enumeration of the possible color models for the color
@@ -63,6 +231,139 @@ func (m ColorModel) NumColors() int {
 	}
 }
 
+// StringToModel is a map from string representations of the color model to
+// the ColorModel.
+var StringToModel = map[string]ColorModel{
+	"RGBW": RGBWModel,
+	"RGB":  RGBModel,
+}
+
+// ModelToString is a map from ColorModel to its string representation. It is
+// the reverse of StringToModel.
+var ModelToString = func() map[ColorModel]string {
+	m := make(map[ColorModel]string, len(StringToModel))
+	for s, o := range StringToModel {
+		m[o] = s
+	}
+	return m
+}()
+
+// String returns the string representation of the color model, e.g. "RGBW".
+func (m ColorModel) String() string {
+	if s, ok := ModelToString[m]; ok {
+		return s
+	}
+	return fmt.Sprintf("ColorModel(%d)", int(m))
+}
+
+// ParseColorModel returns the color model for its string representation, e.g.
+// "RGBW".
+func ParseColorModel(s string) (ColorModel, error) {
+	m, ok := StringToModel[strings.ToUpper(s)]
+	if !ok {
+		return 0, fmt.Errorf("unknown color model %q", s)
+	}
+	return m, nil
+}
+
+// MarshalText implements encoding.TextMarshaler, so that the color model is
+// written by name in JSON and the like.
+func (m ColorModel) MarshalText() ([]byte, error) {
+	s, ok := ModelToString[m]
+	if !ok {
+		return nil, fmt.Errorf("unknown color model %d", int(m))
+	}
+	return []byte(s), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (m *ColorModel) UnmarshalText(text []byte) error {
+	v, err := ParseColorModel(string(text))
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// checkOrderModel returns an error unless the color order and color model
+// agree on the number of colors per pixel.
+func checkOrderModel(order ColorOrder, model ColorModel) error {
+	offsets, ok := offsets[order]
+	if !ok {
+		return fmt.Errorf("unknown color order %v", order)
+	}
+	if model.NumColors() == 0 {
+		return fmt.Errorf("unknown color model %d", model)
+	}
+	if hasWhite := offsets[3] != -1; hasWhite != (model == RGBWModel) {
+		return fmt.Errorf("color order %v doesn't match color model with %d colors: %w", order, model.NumColors(), ErrWrongColorModel)
+	}
+	return nil
+}
+
+// FlushStats describes a flush, for observers set with SetFlushObserver.
+type FlushStats struct {
+	// EncodeDuration is how long it took to encode the pixels for sending.
+	EncodeDuration time.Duration
+	// TransmitDuration is how long the flush spent sending the frame. For a
+	// WS281x, which sends it in the background with DMA, that's the wait
+	// for the previous frame to finish plus starting this one.
+	TransmitDuration time.Duration
+	// PixelsChanged is how many pixels there are from the first to the last
+	// one that changed since the previous flush.
+	PixelsChanged int
+	// Skipped is whether sending the frame was skipped because it hadn't
+	// changed, as set by SetSkipUnchanged.
+	Skipped bool
+}
+
+// dirtyRange tracks the range of pixels [lo, hi) changed since the last flush.
+type dirtyRange struct {
+	lo int
+	hi int
+}
+
+func (d *dirtyRange) mark(i int) {
+	if d.lo >= d.hi {
+		d.lo, d.hi = i, i+1
+		return
+	}
+	if i < d.lo {
+		d.lo = i
+	}
+	if i >= d.hi {
+		d.hi = i + 1
+	}
+}
+
+func (d *dirtyRange) markAll(numPixels int) {
+	d.lo, d.hi = 0, numPixels
+}
+
+func (d *dirtyRange) reset() {
+	d.lo, d.hi = 0, 0
+}
+
+func (d *dirtyRange) size() int {
+	if d.lo >= d.hi {
+		return 0
+	}
+	return d.hi - d.lo
+}
+
+func reverseBytes(b []byte) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
+
+func reverseUint16s(b []uint16) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
+
 func abs(i int) int {
 	if i < 0 {
 		return -i
@@ -70,6 +371,142 @@ func abs(i int) int {
 	return i
 }
 
+// scaleBrightness scales v by brightness/255, rounding to the nearest value so
+// that dim pixels don't go black before they have to.
+func scaleBrightness(v, brightness uint8) uint8 {
+	return uint8((uint(v)*uint(brightness) + 127) / 255)
+}
+
+// makeOutputTable returns the table that maps each value straight to
+// scaleBrightness(gammaTable[v], brightness), so that encoding a channel
+// without dithering is a single lookup.
+func makeOutputTable(gammaTable *[256]uint8, brightness uint8) [256]uint8 {
+	var table [256]uint8
+	for v := range table {
+		table[v] = scaleBrightness(gammaTable[v], brightness)
+	}
+	return table
+}
+
+// ditherBrightness is like scaleBrightness, but rounds down and carries the
+// remainder, in 255ths, over to the next call in *residue, so that over
+// several calls the output averages out to v*brightness/255.
+func ditherBrightness(v, brightness uint8, residue *uint8) uint8 {
+	n := uint(v)*uint(brightness) + uint(*residue)
+	*residue = uint8(n % 255)
+	return uint8(n / 255)
+}
+
+// scaleBrightness16 is like scaleBrightness for a 16-bit value, rounding the
+// result to 8 bits.
+func scaleBrightness16(v uint16, brightness uint8) uint8 {
+	return uint8((uint(v)*uint(brightness) + 32767) / 65535)
+}
+
+// ditherBrightness16 is like ditherBrightness for a 16-bit value. The residue
+// is in 255ths of an 8-bit step, as for ditherBrightness, so the two can share
+// residues.
+func ditherBrightness16(v uint16, brightness uint8, residue *uint8) uint8 {
+	n := uint(v)*uint(brightness)/257 + uint(*residue)
+	*residue = uint8(n % 255)
+	return uint8(n / 255)
+}
+
+// applyFloor raises out to floor if the channel it came from was on, so
+// that dim channels don't go dark. With a brightness of 0, everything stays
+// off.
+func applyFloor(out, floor uint8, on bool, brightness uint8) uint8 {
+	if out < floor && on && brightness > 0 {
+		return floor
+	}
+	return out
+}
+
+// newDither returns the residues for dithering n channels. They start at half
+// a step, so that the first frame is rounded like scaleBrightness does.
+func newDither(n int) []uint8 {
+	dither := make([]uint8, n)
+	for i := range dither {
+		dither[i] = 127
+	}
+	return dither
+}
+
+// makeGammaTable returns a lookup table mapping each 8-bit value v to
+// round(255 * (v/255)^gamma). A gamma of 1 gives the identity.
+func makeGammaTable(gamma float64) [256]uint8 {
+	var table [256]uint8
+	for i := range table {
+		table[i] = uint8(math.Round(255 * math.Pow(float64(i)/255, gamma)))
+	}
+	return table
+}
+
+// ColorCorrection is an enumeration of the ways the pixels can be corrected
+// when they're flushed.
+type ColorCorrection int
+
+const (
+	// GammaCorrection applies the power curve set by SetGamma.
+	GammaCorrection ColorCorrection = iota
+	// NoCorrection sends the pixels unchanged, whatever the gamma.
+	NoCorrection
+	// SRGBCorrection linearizes the pixels with the piecewise sRGB transfer
+	// function, which is linear near black rather than a pure power curve.
+	SRGBCorrection
+)
+
+// makeCorrectionTable returns the lookup table for the color correction c,
+// using gamma for GammaCorrection.
+func makeCorrectionTable(c ColorCorrection, gamma float64) [256]uint8 {
+	switch c {
+	case NoCorrection:
+		return makeGammaTable(1)
+	case SRGBCorrection:
+		return makeSRGBTable()
+	default:
+		return makeGammaTable(gamma)
+	}
+}
+
+// makeSRGBTable returns a lookup table mapping each 8-bit sRGB value to its
+// linear intensity, using the standard sRGB transfer function.
+func makeSRGBTable() [256]uint8 {
+	var table [256]uint8
+	for i := range table {
+		v := float64(i) / 255
+		if v <= 0.04045 {
+			v /= 12.92
+		} else {
+			v = math.Pow((v+0.055)/1.055, 2.4)
+		}
+		table[i] = uint8(math.Round(255 * v))
+	}
+	return table
+}
+
+// makeCorrectionTable16 is like makeCorrectionTable, but maps each 16-bit
+// value to a 16-bit value.
+func makeCorrectionTable16(c ColorCorrection, gamma float64) []uint16 {
+	table := make([]uint16, 1<<16)
+	for i := range table {
+		v := float64(i) / 65535
+		switch c {
+		case NoCorrection:
+		case SRGBCorrection:
+			if v <= 0.04045 {
+				v /= 12.92
+			} else {
+				v = math.Pow((v+0.055)/1.055, 2.4)
+			}
+		default:
+			v = math.Pow(v, gamma)
+		}
+		table[i] = uint16(math.Round(65535 * v))
+	}
+	return table
+}
+
 // RGBW represents a pixel with red, green, blue, and white components.
 type RGBW struct {
 	R uint8
@@ -83,11 +520,24 @@ func (p RGBW) String() string {
 	return fmt.Sprintf("#%02x%02x%02x%02x", p.R, p.G, p.B, p.W)
 }
 
-// ToUint32 returns the pixel as a uint32 in the form 0xrrggbbww.
+// ToUint32 returns the pixel as a uint32 in the form 0xrrggbbww. Unlike
+// RGB.ToUint32, red is in the top byte, so convert with ToRGB or ToRGBW
+// rather than masking or shifting the value.
 func (p RGBW) ToUint32() uint32 {
 	return uint32(p.R)<<24 | uint32(p.G)<<16 | uint32(p.B)<<8 | uint32(p.W)
 }
 
+// RGBWFromUint32 returns the pixel for a uint32 in the form 0xrrggbbww. It is
+// the inverse of RGBW.ToUint32.
+func RGBWFromUint32(v uint32) RGBW {
+	return RGBW{uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)}
+}
+
+// ToRGB returns the pixel without its white.
+func (p RGBW) ToRGB() RGB {
+	return RGB{p.R, p.G, p.B}
+}
+
 // RGB represents a pixel with red, green, and blue components.
 type RGB struct {
 	R uint8
@@ -100,11 +550,136 @@ func (p RGB) String() string {
 	return fmt.Sprintf("#%02x%02x%02x", p.R, p.G, p.B)
 }
 
-// ToUint32 returns the pixel as a uint32 in the form 0xrrggbb.
+// ToUint32 returns the pixel as a uint32 in the form 0xrrggbb. Unlike
+// RGBW.ToUint32, the top byte is unused.
 func (p RGB) ToUint32() uint32 {
 	return uint32(p.R)<<16 | uint32(p.G)<<8 | uint32(p.B)
 }
 
+// RGBFromUint32 returns the pixel for a uint32 in the form 0xrrggbb. The top
+// byte is ignored. It is the inverse of RGB.ToUint32.
+func RGBFromUint32(v uint32) RGB {
+	return RGB{uint8(v >> 16), uint8(v >> 8), uint8(v)}
+}
+
+// ToRGBW returns the pixel with the given white. RGBToRGBW derives the white
+// from the color instead.
+func (p RGB) ToRGBW(w uint8) RGBW {
+	return RGBW{p.R, p.G, p.B, w}
+}
+
+// parseHex parses s, which must be a '#' followed by n hex digits.
+func parseHex(s string, n int) (uint32, error) {
+	if len(s) != n+1 || s[0] != '#' {
+		return 0, fmt.Errorf("couldn't parse color %q: want # and %d hex digits", s, n)
+	}
+	v, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't parse color %q: %w", s, err)
+	}
+	return uint32(v), nil
+}
+
+// ParseRGB parses a pixel in the form #rrggbb, as returned by RGB.String.
+func ParseRGB(s string) (RGB, error) {
+	v, err := parseHex(s, 6)
+	if err != nil {
+		return RGB{}, err
+	}
+	return RGBFromUint32(v), nil
+}
+
+// ParseRGBW parses a pixel in the form #rrggbbww, as returned by RGBW.String.
+func ParseRGBW(s string) (RGBW, error) {
+	v, err := parseHex(s, 8)
+	if err != nil {
+		return RGBW{}, err
+	}
+	return RGBWFromUint32(v), nil
+}
+
+// MarshalJSON implements json.Marshaler, writing the pixel as a "#rrggbb"
+// string.
+func (p RGB) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler, reading a "#rrggbb" string.
+func (p *RGB) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := ParseRGB(s)
+	if err != nil {
+		return err
+	}
+	*p = v
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, writing the pixel as a "#rrggbbww"
+// string.
+func (p RGBW) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler, reading a "#rrggbbww" string.
+func (p *RGBW) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := ParseRGBW(s)
+	if err != nil {
+		return err
+	}
+	*p = v
+	return nil
+}
+
+// RGB16 represents a pixel with 16-bit red, green, and blue components.
+type RGB16 struct {
+	R uint16
+	G uint16
+	B uint16
+}
+
+// RGB returns the pixel with each component truncated to 8 bits.
+func (p RGB16) RGB() RGB {
+	return RGB{uint8(p.R >> 8), uint8(p.G >> 8), uint8(p.B >> 8)}
+}
+
+// RGBW16 represents a pixel with 16-bit red, green, blue, and white
+// components.
+type RGBW16 struct {
+	R uint16
+	G uint16
+	B uint16
+	W uint16
+}
+
+// RGBW returns the pixel with each component truncated to 8 bits.
+func (p RGBW16) RGBW() RGBW {
+	return RGBW{uint8(p.R >> 8), uint8(p.G >> 8), uint8(p.B >> 8), uint8(p.W >> 8)}
+}
+
+// Wheel returns a fully saturated color at the given position around the
+// color wheel: 0 is red, 85 is green and 170 is blue, with linear ramps
+// between them. It's the classic helper for rainbow effects.
+func Wheel(pos uint8) RGB {
+	switch {
+	case pos < 85:
+		return RGB{255 - pos*3, pos * 3, 0}
+	case pos < 170:
+		pos -= 85
+		return RGB{0, 255 - pos*3, pos * 3}
+	default:
+		pos -= 170
+		return RGB{pos * 3, 0, 255 - pos*3}
+	}
+}
+
 // Device extends io.Writer with an Fd method that returns the file descriptor
 // of the device.
 type Device interface {
@@ -113,3 +688,41 @@ type Device interface {
 }
 
 var _ Device = (*os.File)(nil)
+
+// Strip is the common set of operations supported by every LED strip
+// controller, so that code can drive whatever hardware the caller configured.
+type Strip interface {
+	// SetRGBAt sets the RGB pixel at the given index to the given value.
+	SetRGBAt(i int, rgb RGB)
+	// RGBAt returns the RGB pixel at the given index.
+	RGBAt(i int) RGB
+	// SetRGBWAt sets the RGBW pixel at the given index to the given value.
+	SetRGBWAt(i int, rgbw RGBW)
+	// RGBWAt returns the RGBW pixel at the given index.
+	RGBWAt(i int) RGBW
+	// SetRGBs sets the RGB pixels to the given values.
+	SetRGBs(pixels []RGB)
+	// SetRGBWs sets the RGBW pixels to the given values.
+	SetRGBWs(pixels []RGBW)
+	// Flush flushes the pixels to the LED strip.
+	Flush() error
+	// Close releases any resources held by the controller.
+	Close() error
+	// MaxLEDsPerChannel returns the maximum number of LEDs per channel.
+	MaxLEDsPerChannel() int
+	// NumPixels returns the number of pixels in the strip.
+	NumPixels() int
+}
+
+var (
+	_ Strip = (*WS281x)(nil)
+	_ Strip = (*LPD8806)(nil)
+	_ Strip = (*APA102)(nil)
+	_ Strip = (*WS2801)(nil)
+	_ Strip = (*WS281xSPI)(nil)
+	_ Strip = (*LPD6803)(nil)
+	_ Strip = (*P9813)(nil)
+	_ Strip = (*TermStrip)(nil)
+	_ Strip = (*GIFRecorder)(nil)
+	_ Strip = (*Null)(nil)
+)
@@ -0,0 +1,795 @@
+package ledctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	rpi "github.com/mxcu/ledctl/rpi"
+)
+
+func TestStripImplementations(t *testing.T) {
+	strips := []struct {
+		name string
+		make func() (Strip, error)
+	}{
+		{"WS281x", func() (Strip, error) {
+			return NewWS281xWithRPi(rpi.NewMockRPi(), DefaultWS281xConfig(3))
+		}},
+		{"LPD8806", func() (Strip, error) {
+			return newLPD8806(LPD8806Config{Device: &fakeDevice{}, NumPixels: 3, ColorModel: RGBModel}, nil)
+		}},
+		{"APA102", func() (Strip, error) {
+			return newAPA102(APA102Config{Device: &fakeDevice{}, NumPixels: 3, ColorOrder: RGBOrder}, nil)
+		}},
+		{"WS2801", func() (Strip, error) {
+			return newWS2801(WS2801Config{Device: &fakeDevice{}, NumPixels: 3, ColorModel: RGBModel}, nil)
+		}},
+		{"WS281xSPI", func() (Strip, error) {
+			return newWS281xSPI(WS281xSPIConfig{Device: &fakeDevice{}, NumPixels: 3, ColorOrder: GRBOrder, ColorModel: RGBModel}, nil)
+		}},
+		{"LPD6803", func() (Strip, error) {
+			return newLPD6803(LPD6803Config{Device: &fakeDevice{}, NumPixels: 3, ColorOrder: RGBOrder}, nil)
+		}},
+		{"P9813", func() (Strip, error) {
+			return newP9813(P9813Config{Device: &fakeDevice{}, NumPixels: 3}, nil)
+		}},
+		{"TermStrip", func() (Strip, error) {
+			return NewTermStrip(TermStripConfig{Writer: &bytes.Buffer{}, NumPixels: 3, Plain: true})
+		}},
+		{"GIFRecorder", func() (Strip, error) {
+			return NewGIFRecorder(GIFRecorderConfig{Writer: &bytes.Buffer{}, Matrix: MatrixConfig{Width: 3, Height: 1}})
+		}},
+		{"Null", func() (Strip, error) { return NullStrip(3, 3), nil }},
+		{"FrameBuffer", func() (Strip, error) { return NewFrameBuffer(3, RGBModel), nil }},
+	}
+
+	// Every channel is a multiple of 8 under 128, so that it survives the
+	// strips with fewer than 8 bits per color.
+	pixels := []RGB{{8, 16, 24}, {32, 40, 48}, {56, 64, 72}}
+	for _, test := range strips {
+		s, err := test.make()
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if got := s.NumPixels(); got != 3 {
+			t.Errorf("%s: NumPixels got %d, want 3", test.name, got)
+		}
+		if s.MaxLEDsPerChannel() < s.NumPixels() {
+			t.Errorf("%s: MaxLEDsPerChannel %d is less than NumPixels", test.name, s.MaxLEDsPerChannel())
+		}
+		s.SetRGBs(pixels)
+		s.SetRGBAt(2, RGB{80, 88, 96})
+		s.SetRGBWAt(0, RGBW{R: 104, G: 112, B: 120})
+		want := []RGB{{104, 112, 120}, pixels[1], {80, 88, 96}}
+		for i := range want {
+			if got := s.RGBAt(i); got != want[i] {
+				t.Errorf("%s: RGBAt(%d) got %v, want %v", test.name, i, got, want[i])
+			}
+		}
+		if err := s.Flush(); err != nil {
+			t.Errorf("%s: Flush: %v", test.name, err)
+		}
+		if err := s.Close(); err != nil {
+			t.Errorf("%s: Close: %v", test.name, err)
+		}
+	}
+}
+
+// fakeDevice is a Device that records everything written to it.
+type fakeDevice struct {
+	writes [][]byte
+	// err, if set, is returned from every Write.
+	err error
+}
+
+func (d *fakeDevice) Write(p []byte) (int, error) {
+	d.writes = append(d.writes, append([]byte(nil), p...))
+	if d.err != nil {
+		return 0, d.err
+	}
+	return len(p), nil
+}
+
+func (d *fakeDevice) Fd() uintptr {
+	return 0
+}
+
+func (d *fakeDevice) last() []byte {
+	if len(d.writes) == 0 {
+		return nil
+	}
+	return d.writes[len(d.writes)-1]
+}
+
+func TestMakeGammaTable(t *testing.T) {
+	tests := []struct {
+		gamma float64
+		in    uint8
+		want  uint8
+	}{
+		{1, 0, 0},
+		{1, 128, 128},
+		{1, 255, 255},
+		{2.2, 0, 0},
+		{2.2, 64, 12},
+		{2.2, 128, 56},
+		{2.2, 255, 255},
+	}
+
+	for _, test := range tests {
+		table := makeGammaTable(test.gamma)
+		if got := table[test.in]; got != test.want {
+			t.Errorf("gamma %v, %d got: %d, want: %d", test.gamma, test.in, got, test.want)
+		}
+	}
+}
+
+func TestMakeSRGBTable(t *testing.T) {
+	tests := []struct {
+		in   uint8
+		want uint8
+	}{
+		{0, 0},
+		{10, 1},
+		{64, 13},
+		{128, 55},
+		{200, 147},
+		{255, 255},
+	}
+
+	table := makeSRGBTable()
+	for _, test := range tests {
+		if got := table[test.in]; got != test.want {
+			t.Errorf("sRGB %d got: %d, want: %d", test.in, got, test.want)
+		}
+	}
+}
+
+func TestMakeCorrectionTable16(t *testing.T) {
+	// 0x8000 and 0x80FF both truncate to 0x80, but stay apart after gamma.
+	table := makeCorrectionTable16(GammaCorrection, 2.2)
+	if a, b := table[0x8000], table[0x80FF]; a >= b {
+		t.Errorf("gamma 2.2 got %d for 0x8000 and %d for 0x80FF, want increasing", a, b)
+	}
+	if got, want := table[0xFFFF], uint16(0xFFFF); got != want {
+		t.Errorf("gamma 2.2 0xFFFF got %d, want %d", got, want)
+	}
+
+	table = makeCorrectionTable16(NoCorrection, 2.2)
+	for _, v := range []uint16{0, 1, 0x8000, 0xFFFF} {
+		if got := table[v]; got != v {
+			t.Errorf("no correction %d got %d", v, got)
+		}
+	}
+
+	table = makeCorrectionTable16(SRGBCorrection, 1)
+	if got, want := table[128*257]>>8, uint16(55); got != want {
+		t.Errorf("sRGB 128 got %d, want %d", got, want)
+	}
+}
+
+func TestRGBWConversions(t *testing.T) {
+	rgb := RGB{0x11, 0x22, 0x33}
+	if got, want := rgb.ToRGBW(0x44), (RGBW{0x11, 0x22, 0x33, 0x44}); got != want {
+		t.Errorf("ToRGBW got: %v, want: %v", got, want)
+	}
+	if got, want := (RGBW{0x11, 0x22, 0x33, 0x44}).ToRGB(), rgb; got != want {
+		t.Errorf("ToRGB got: %v, want: %v", got, want)
+	}
+	if got := rgb.ToRGBW(0).ToRGB(); got != rgb {
+		t.Errorf("ToRGBW(0).ToRGB() got: %v, want: %v", got, rgb)
+	}
+	if got, want := rgb.ToRGBW(0).ToUint32(), rgb.ToUint32()<<8; got != want {
+		t.Errorf("ToRGBW(0).ToUint32() got: %08x, want: %08x", got, want)
+	}
+}
+
+func TestFromUint32(t *testing.T) {
+	for _, v := range []uint32{0, 1, 0x00123456, 0x12345678, 0x80808080, 0xFFFFFFFF} {
+		if got := RGBWFromUint32(v).ToUint32(); got != v {
+			t.Errorf("RGBW round-trip %08X got: %08X", v, got)
+		}
+		if got, want := RGBFromUint32(v).ToUint32(), v&0xFFFFFF; got != want {
+			t.Errorf("RGB round-trip %08X got: %08X, want: %08X", v, got, want)
+		}
+	}
+
+	if got, want := RGBFromUint32(0xAA112233), (RGB{0x11, 0x22, 0x33}); got != want {
+		t.Errorf("RGBFromUint32 got: %v, want: %v", got, want)
+	}
+	if got, want := RGBWFromUint32(0x11223344), (RGBW{0x11, 0x22, 0x33, 0x44}); got != want {
+		t.Errorf("RGBWFromUint32 got: %v, want: %v", got, want)
+	}
+	if n := testing.AllocsPerRun(10, func() { RGBWFromUint32(0x11223344) }); n != 0 {
+		t.Errorf("RGBWFromUint32 allocated %v times", n)
+	}
+}
+
+func TestColorOrderString(t *testing.T) {
+	for s, o := range StringToOrder {
+		if got := o.String(); got != s {
+			t.Errorf("%d.String() got: %q, want: %q", int(o), got, s)
+		}
+		if got := StringToOrder[o.String()]; got != o {
+			t.Errorf("StringToOrder[%q] got: %d, want: %d", s, int(got), int(o))
+		}
+	}
+
+	if got, want := ColorOrder(100).String(), "ColorOrder(100)"; got != want {
+		t.Errorf("unknown order got: %q, want: %q", got, want)
+	}
+}
+
+func TestNewColorOrder(t *testing.T) {
+	tests := []struct {
+		s     string
+		model ColorModel
+		want  []byte
+	}{
+		{"WRGB", RGBWModel, []byte{4, 1, 2, 3}},
+		{"bwgr", RGBWModel, []byte{3, 4, 2, 1}},
+		{"RGBW", RGBWModel, []byte{1, 2, 3, 4}},
+		{"BGR", RGBModel, []byte{3, 2, 1}},
+	}
+	for _, test := range tests {
+		o, err := NewColorOrder(test.s)
+		if err != nil {
+			t.Errorf("NewColorOrder(%q) failed: %v", test.s, err)
+			continue
+		}
+		if p, err := ParseColorOrder(test.s); err != nil || p != o {
+			t.Errorf("ParseColorOrder(%q) got %v, %v, want %v", test.s, p, err, o)
+		}
+		if again, _ := NewColorOrder(test.s); again != o {
+			t.Errorf("NewColorOrder(%q) again got %v, want %v", test.s, again, o)
+		}
+		if got, want := o.String(), strings.ToUpper(test.s); got != want {
+			t.Errorf("NewColorOrder(%q).String() got %q, want %q", test.s, got, want)
+		}
+
+		ws := testWS281x(WS281xConfig{NumPixels: 1, ColorOrder: o, ColorModel: test.model})
+		ws.SetRGBWAt(0, RGBW{1, 2, 3, 4})
+		if got := ws.Pixels(); !bytes.Equal(got, test.want) {
+			t.Errorf("%q: pixel got %v, want %v", test.s, got, test.want)
+		}
+	}
+
+	for _, s := range []string{"", "RG", "RGBWW", "RGGB", "RGW", "XGB"} {
+		if _, err := NewColorOrder(s); err == nil {
+			t.Errorf("NewColorOrder(%q) succeeded, want error", s)
+		}
+	}
+}
+
+func TestColorModelString(t *testing.T) {
+	for _, m := range []ColorModel{RGBWModel, RGBModel} {
+		got, err := ParseColorModel(m.String())
+		if err != nil {
+			t.Errorf("ParseColorModel(%q) failed: %v", m.String(), err)
+			continue
+		}
+		if got != m {
+			t.Errorf("ParseColorModel(%q) got: %d, want: %d", m.String(), int(got), int(m))
+		}
+	}
+
+	if got, err := ParseColorModel("rgb"); err != nil || got != RGBModel {
+		t.Errorf("ParseColorModel(\"rgb\") got: %v, %v", got, err)
+	}
+	if _, err := ParseColorModel("RGBWW"); err == nil {
+		t.Errorf("ParseColorModel(\"RGBWW\") didn't fail")
+	}
+	if got, want := ColorModel(100).String(), "ColorModel(100)"; got != want {
+		t.Errorf("unknown model got: %q, want: %q", got, want)
+	}
+}
+
+func TestBatchSetterErrors(t *testing.T) {
+	type batchSetter interface {
+		SetRGBsErr([]RGB) error
+		SetRGBWsErr([]RGBW) error
+	}
+	rgb := testWS281x(WS281xConfig{NumPixels: 2, ColorModel: RGBModel})
+	rgbw := testWS281x(WS281xConfig{NumPixels: 2, ColorOrder: GRBWOrder, ColorModel: RGBWModel})
+	la, err := newLPD8806(LPD8806Config{Device: &fakeDevice{}, NumPixels: 2, ColorModel: RGBModel}, nil)
+	if err != nil {
+		t.Fatalf("newLPD8806: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		strip    batchSetter
+		rgbs     []RGB
+		rgbws    []RGBW
+		wantRGB  error
+		wantRGBW error
+	}{
+		{"WS281x RGB", rgb, make([]RGB, 2), make([]RGBW, 2), nil, ErrWrongColorModel},
+		{"WS281x RGBW", rgbw, make([]RGB, 2), make([]RGBW, 2), ErrWrongColorModel, nil},
+		{"WS281x short", rgbw, make([]RGB, 1), make([]RGBW, 1), ErrWrongColorModel, ErrPixelCountMismatch},
+		{"LPD8806 long", la, make([]RGB, 3), make([]RGBW, 3), ErrPixelCountMismatch, ErrWrongColorModel},
+	}
+
+	for _, test := range tests {
+		if err := test.strip.SetRGBsErr(test.rgbs); !errors.Is(err, test.wantRGB) || (err == nil) != (test.wantRGB == nil) {
+			t.Errorf("%s: SetRGBsErr got: %v, want: %v", test.name, err, test.wantRGB)
+		}
+		if err := test.strip.SetRGBWsErr(test.rgbws); !errors.Is(err, test.wantRGBW) || (err == nil) != (test.wantRGBW == nil) {
+			t.Errorf("%s: SetRGBWsErr got: %v, want: %v", test.name, err, test.wantRGBW)
+		}
+	}
+}
+
+func TestCheckedAccess(t *testing.T) {
+	type checked interface {
+		RGBAtChecked(int) (RGB, error)
+		SetRGBAtChecked(int, RGB) error
+	}
+	la, err := newLPD8806(LPD8806Config{Device: &fakeDevice{}, NumPixels: 3, ColorModel: RGBModel}, nil)
+	if err != nil {
+		t.Fatalf("newLPD8806: %v", err)
+	}
+	strips := []struct {
+		name  string
+		strip checked
+	}{
+		{"WS281x", testWS281x(WS281xConfig{NumPixels: 3, ColorModel: RGBModel})},
+		{"LPD8806", la},
+	}
+
+	for _, test := range strips {
+		for _, i := range []int{-1, 3, 100} {
+			if err := test.strip.SetRGBAtChecked(i, RGB{1, 2, 3}); !errors.Is(err, ErrIndexOutOfRange) {
+				t.Errorf("%s: SetRGBAtChecked(%d) got: %v, want: %v", test.name, i, err, ErrIndexOutOfRange)
+			}
+			if _, err := test.strip.RGBAtChecked(i); !errors.Is(err, ErrIndexOutOfRange) {
+				t.Errorf("%s: RGBAtChecked(%d) got: %v, want: %v", test.name, i, err, ErrIndexOutOfRange)
+			}
+		}
+		if err := test.strip.SetRGBAtChecked(2, RGB{1, 2, 3}); err != nil {
+			t.Errorf("%s: SetRGBAtChecked(2) got: %v", test.name, err)
+		}
+		if got, err := test.strip.RGBAtChecked(2); err != nil || got != (RGB{1, 2, 3}) {
+			t.Errorf("%s: RGBAtChecked(2) got: %v, %v, want: %v", test.name, got, err, RGB{1, 2, 3})
+		}
+	}
+}
+
+func TestWheel(t *testing.T) {
+	tests := []struct {
+		pos  uint8
+		want RGB
+	}{
+		{0, RGB{255, 0, 0}},
+		{1, RGB{252, 3, 0}},
+		{84, RGB{3, 252, 0}},
+		{85, RGB{0, 255, 0}},
+		{169, RGB{0, 3, 252}},
+		{170, RGB{0, 0, 255}},
+		{255, RGB{255, 0, 0}},
+	}
+
+	for _, test := range tests {
+		if got := Wheel(test.pos); got != test.want {
+			t.Errorf("Wheel(%d) got: %v, want: %v", test.pos, got, test.want)
+		}
+	}
+
+	// Each step, including the wrap from 255 to 0, only moves each channel a little.
+	for i := 0; i < 256; i++ {
+		a, b := Wheel(uint8(i)), Wheel(uint8(i+1))
+		if abs(int(a.R)-int(b.R)) > 3 || abs(int(a.G)-int(b.G)) > 3 || abs(int(a.B)-int(b.B)) > 3 {
+			t.Errorf("Wheel(%d) = %v to Wheel(%d) = %v isn't continuous", i, a, uint8(i+1), b)
+		}
+	}
+}
+
+func TestCheckOrderModel(t *testing.T) {
+	tests := []struct {
+		order   ColorOrder
+		model   ColorModel
+		wantErr bool
+	}{
+		{GRBOrder, RGBModel, false},
+		{GRBWOrder, RGBWModel, false},
+		{RGBWOrder, RGBWModel, false},
+		{GRBWOrder, RGBModel, true},
+		{GRBOrder, RGBWModel, true},
+		{ColorOrder(100), RGBModel, true},
+		{GRBOrder, ColorModel(100), true},
+	}
+
+	for _, test := range tests {
+		if err := checkOrderModel(test.order, test.model); (err != nil) != test.wantErr {
+			t.Errorf("checkOrderModel(%v, %d) got: %v, wantErr: %v", test.order, test.model, err, test.wantErr)
+		}
+	}
+}
+
+func TestConstructorsCheckOrderModel(t *testing.T) {
+	for _, c := range []struct {
+		order ColorOrder
+		model ColorModel
+	}{{GRBWOrder, RGBModel}, {GRBOrder, RGBWModel}} {
+		if _, err := NewWS281x(WS281xConfig{NumPixels: 1, ColorOrder: c.order, ColorModel: c.model}); !errors.Is(err, ErrWrongColorModel) {
+			t.Errorf("NewWS281x(%v, %d) got: %v, want: %v", c.order, c.model, err, ErrWrongColorModel)
+		}
+		config := LPD8806Config{Device: &fakeDevice{}, NumPixels: 1, ColorOrder: c.order, ColorModel: c.model}
+		if _, err := newLPD8806(config, nil); !errors.Is(err, ErrWrongColorModel) {
+			t.Errorf("newLPD8806(%v, %d) got: %v, want: %v", c.order, c.model, err, ErrWrongColorModel)
+		}
+	}
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	la, err := newLPD8806(LPD8806Config{Device: &fakeDevice{}, NumPixels: 50, ColorModel: RGBModel}, nil)
+	if err != nil {
+		t.Fatalf("newLPD8806: %v", err)
+	}
+	ws := testWS281x(WS281xConfig{NumPixels: 50, ColorModel: RGBModel})
+
+	tests := []struct {
+		strip interface {
+			Strip
+			SetBrightness(uint8)
+			Fill(RGB)
+		}
+		flush func()
+	}{
+		{la, func() { la.Flush() }}, // Ignore error
+		// There's no DMA off a Pi, so do what Flush does without it.
+		{ws, func() {
+			ws.mu.Lock()
+			defer ws.mu.Unlock()
+			ws.encode(0, ws.numPixels)
+		}},
+	}
+
+	var wg sync.WaitGroup
+	for _, test := range tests {
+		test := test
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				test.strip.SetRGBAt(i%50, RGB{uint8(i), 0, 0})
+				test.strip.SetBrightness(uint8(i))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				test.strip.RGBAt(i % 50)
+				test.strip.Fill(RGB{1, 2, 3})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				test.flush()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestPixels(t *testing.T) {
+	la, err := newLPD8806(LPD8806Config{Device: &fakeDevice{}, NumPixels: 4, ColorOrder: RGBOrder, ColorModel: RGBModel}, nil)
+	if err != nil {
+		t.Fatalf("newLPD8806: %v", err)
+	}
+	ws := testWS281x(WS281xConfig{NumPixels: 4, ColorOrder: RGBWOrder, ColorModel: RGBWModel})
+
+	tests := []struct {
+		name  string
+		strip interface {
+			Pixels() []byte
+			NumPixels() int
+			NumColors() int
+			RGBAt(int) RGB
+		}
+		wantColors int
+	}{
+		{"LPD8806", la, 3},
+		{"WS281x", ws, 4},
+	}
+
+	for _, test := range tests {
+		if got := test.strip.NumPixels(); got != 4 {
+			t.Errorf("%s: NumPixels got: %d, want: 4", test.name, got)
+		}
+		if got := test.strip.NumColors(); got != test.wantColors {
+			t.Errorf("%s: NumColors got: %d, want: %d", test.name, got, test.wantColors)
+		}
+		pixels := test.strip.Pixels()
+		if len(pixels) != 4*test.wantColors {
+			t.Errorf("%s: len(Pixels()) got: %d, want: %d", test.name, len(pixels), 4*test.wantColors)
+			continue
+		}
+		o := 2 * test.wantColors
+		pixels[o], pixels[o+1], pixels[o+2] = 10, 20, 30
+		if got, want := test.strip.RGBAt(2), (RGB{10, 20, 30}); got != want {
+			t.Errorf("%s: RGBAt(2) got: %v, want: %v", test.name, got, want)
+		}
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	la, err := newLPD8806(LPD8806Config{Device: &fakeDevice{}, NumPixels: 3, ColorModel: RGBModel}, nil)
+	if err != nil {
+		t.Fatalf("newLPD8806: %v", err)
+	}
+	tests := []struct {
+		name  string
+		strip interface {
+			Strip
+			Fill(RGB)
+			Pixels() []byte
+			Snapshot() []byte
+			Restore([]byte) error
+		}
+	}{
+		{"WS281x", testWS281x(WS281xConfig{NumPixels: 3, ColorModel: RGBModel})},
+		{"LPD8806", la},
+	}
+
+	for _, test := range tests {
+		test.strip.SetRGBs([]RGB{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}})
+		snap := test.strip.Snapshot()
+		want := append([]byte(nil), test.strip.Pixels()...)
+
+		test.strip.Fill(RGB{100, 100, 100})
+		if bytes.Equal(snap, test.strip.Pixels()) {
+			t.Errorf("%s: Snapshot changed along with the pixels", test.name)
+		}
+
+		if err := test.strip.Restore(snap); err != nil {
+			t.Fatalf("%s: Restore: %v", test.name, err)
+		}
+		if got := test.strip.Pixels(); !bytes.Equal(got, want) {
+			t.Errorf("%s: after Restore, pixels got: %v, want: %v", test.name, got, want)
+		}
+		if err := test.strip.Restore(snap[1:]); !errors.Is(err, ErrPixelCountMismatch) {
+			t.Errorf("%s: short Restore got: %v, want: %v", test.name, err, ErrPixelCountMismatch)
+		}
+	}
+}
+
+type shifter interface {
+	Shift(int, RGB)
+	Rotate(int)
+}
+
+func TestShiftRotate(t *testing.T) {
+	a, b, c, d, f := RGB{1, 1, 1}, RGB{2, 2, 2}, RGB{3, 3, 3}, RGB{4, 4, 4}, RGB{9, 8, 7}
+	tests := []struct {
+		name string
+		op   func(s shifter)
+		want []RGB
+	}{
+		{"shift 1", func(s shifter) { s.Shift(1, f) }, []RGB{f, a, b, c}},
+		{"shift -2", func(s shifter) { s.Shift(-2, f) }, []RGB{c, d, f, f}},
+		{"shift 4", func(s shifter) { s.Shift(4, f) }, []RGB{f, f, f, f}},
+		{"shift -10", func(s shifter) { s.Shift(-10, f) }, []RGB{f, f, f, f}},
+		{"rotate 1", func(s shifter) { s.Rotate(1) }, []RGB{d, a, b, c}},
+		{"rotate -1", func(s shifter) { s.Rotate(-1) }, []RGB{b, c, d, a}},
+		{"rotate 6", func(s shifter) { s.Rotate(6) }, []RGB{c, d, a, b}},
+		{"rotate -8", func(s shifter) { s.Rotate(-8) }, []RGB{a, b, c, d}},
+	}
+
+	for _, test := range tests {
+		la, err := newLPD8806(LPD8806Config{Device: &fakeDevice{}, NumPixels: 4, ColorModel: RGBModel}, nil)
+		if err != nil {
+			t.Fatalf("newLPD8806: %v", err)
+		}
+		ws := testWS281x(WS281xConfig{NumPixels: 4, ColorOrder: GRBWOrder, ColorModel: RGBWModel})
+		ws.SetRGBWs([]RGBW{{1, 1, 1, 5}, {2, 2, 2, 5}, {3, 3, 3, 5}, {4, 4, 4, 5}})
+		la.SetRGBs([]RGB{a, b, c, d})
+
+		test.op(ws)
+		test.op(la)
+		for i, want := range test.want {
+			if got := la.RGBAt(i); got != want {
+				t.Errorf("%s: LPD8806 RGBAt(%d) got: %v, want: %v", test.name, i, got, want)
+			}
+			wantW := uint8(5)
+			if want == f {
+				wantW = 0
+			}
+			if got, want := ws.RGBWAt(i), (RGBW{want.R, want.G, want.B, wantW}); got != want {
+				t.Errorf("%s: WS281x RGBWAt(%d) got: %v, want: %v", test.name, i, got, want)
+			}
+		}
+	}
+}
+
+func TestSharedRPi(t *testing.T) {
+	rp := rpi.NewMockRPi()
+	ws, err := NewWS281xWithRPi(rp, WS281xConfig{
+		NumPixels:    2,
+		ColorModel:   RGBModel,
+		PWMFrequency: testPWMFrequency,
+		DMAChannel:   10,
+		GPIOPins:     []int{18},
+	})
+	if err != nil {
+		t.Fatalf("NewWS281xWithRPi: %v", err)
+	}
+	dev := &fakeDevice{}
+	la, err := NewLPD8806WithRPi(rp, LPD8806Config{Device: dev, NumPixels: 2, SPISpeed: 1000000, ColorModel: RGBModel})
+	if err != nil {
+		t.Fatalf("NewLPD8806WithRPi: %v", err)
+	}
+	if ws.RPi() != rp || la.RPi() != rp {
+		t.Fatalf("controllers don't share the RPi")
+	}
+
+	ws.Fill(RGB{1, 2, 3})
+	la.Fill(RGB{1, 2, 3})
+	if err := ws.Flush(); err != nil {
+		t.Errorf("WS281x Flush: %v", err)
+	}
+	if err := la.Flush(); err != nil {
+		t.Errorf("LPD8806 Flush: %v", err)
+	}
+
+	if err := la.Close(); err != nil {
+		t.Errorf("LPD8806 Close: %v", err)
+	}
+	// The WS281x still works after the other controller is closed.
+	if err := ws.Flush(); err != nil {
+		t.Errorf("WS281x Flush after LPD8806 Close: %v", err)
+	}
+	if err := ws.Close(); err != nil {
+		t.Errorf("WS281x Close: %v", err)
+	}
+}
+
+func TestParseRGB(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    RGB
+		wantErr bool
+	}{
+		{"#000000", RGB{}, false},
+		{"#12ab3F", RGB{0x12, 0xab, 0x3f}, false},
+		{"12ab3f", RGB{}, true},
+		{"#12ab3", RGB{}, true},
+		{"#12ab3g", RGB{}, true},
+		{"#12345678", RGB{}, true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseRGB(test.in)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseRGB(%q) error: %v, want error: %v", test.in, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseRGB(%q) got %v, want %v", test.in, got, test.want)
+		}
+	}
+
+	if got, err := ParseRGBW("#11223344"); err != nil || got != (RGBW{0x11, 0x22, 0x33, 0x44}) {
+		t.Errorf("ParseRGBW got %v, %v", got, err)
+	}
+	if _, err := ParseRGBW("#112233"); err == nil {
+		t.Errorf("ParseRGBW of an RGB color didn't fail")
+	}
+}
+
+func TestColorJSON(t *testing.T) {
+	type scene struct {
+		Background RGB
+		Accents    []RGBW
+	}
+	in := scene{RGB{1, 0x80, 0xff}, []RGBW{{1, 2, 3, 4}, {0xff, 0, 0, 0x10}}}
+
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	want := `{"Background":"#0180ff","Accents":["#01020304","#ff000010"]}`
+	if string(data) != want {
+		t.Errorf("Marshal got %s, want %s", data, want)
+	}
+
+	var out scene
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("round-trip got %+v, want %+v", out, in)
+	}
+
+	if err := json.Unmarshal([]byte(`{"Background":"red"}`), &out); err == nil {
+		t.Errorf("Unmarshal of a bad color didn't fail")
+	}
+}
+
+func TestConfigJSON(t *testing.T) {
+	ws := WS281xConfig{
+		NumPixels:    60,
+		ColorOrder:   RGBWOrder,
+		ColorModel:   RGBWModel,
+		PWMFrequency: 800000,
+		DMAChannel:   10,
+		GPIOPins:     []int{18},
+		ResetUs:      80,
+		FlushTimeout: time.Second,
+	}
+	data, err := json.Marshal(ws)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if !strings.Contains(string(data), `"ColorOrder":"RGBW","ColorModel":"RGBW"`) {
+		t.Errorf("Marshal got %s, want the color order and model by name", data)
+	}
+	var wsOut WS281xConfig
+	if err := json.Unmarshal(data, &wsOut); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !reflect.DeepEqual(wsOut, ws) {
+		t.Errorf("round-trip got %+v, want %+v", wsOut, ws)
+	}
+
+	la := LPD8806Config{Device: &fakeDevice{}, NumPixels: 32, SPISpeed: 12000000, ColorOrder: BRGOrder}
+	data, err = json.Marshal(la)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var laOut LPD8806Config
+	if err := json.Unmarshal(data, &laOut); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	la.Device = nil
+	if !reflect.DeepEqual(laOut, la) {
+		t.Errorf("round-trip got %+v, want %+v", laOut, la)
+	}
+
+	if err := json.Unmarshal([]byte(`{"ColorOrder":"XYZ"}`), &laOut); err == nil {
+		t.Errorf("Unmarshal of a bad color order didn't fail")
+	}
+}
+
+func TestErrorsIs(t *testing.T) {
+	rp := rpi.NewMockRPi()
+	ws, err := NewWS281xWithRPi(rp, DefaultWS281xConfig(2))
+	if err != nil {
+		t.Fatalf("NewWS281xWithRPi: %v", err)
+	}
+	defer ws.Close()
+	ws.timeout = 10 * time.Millisecond
+
+	tests := []struct {
+		name string
+		err  func() error
+		want error
+	}{
+		{"pixel count", func() error { return ws.SetRGBsErr(make([]RGB, 3)) }, ErrPixelCountMismatch},
+		{"color model", func() error { return ws.SetRGBWsErr(make([]RGBW, 2)) }, ErrWrongColorModel},
+		{"index", func() error { return ws.SetRGBAtChecked(2, RGB{}) }, ErrIndexOutOfRange},
+		{"DMA timeout", func() error {
+			rp.StallMockDMA(true)
+			defer rp.StallMockDMA(false)
+			ws.Flush() // Starts the DMA that never ends
+			return ws.Flush()
+		}, ErrDMATimeout},
+		{"permission", func() error {
+			return spiOpenError(&os.PathError{Op: "open", Path: "/dev/spidev0.0", Err: syscall.EACCES})
+		}, ErrPermission},
+	}
+	for _, test := range tests {
+		if err := test.err(); !errors.Is(err, test.want) {
+			t.Errorf("%s: got %v, want it to wrap %v", test.name, err, test.want)
+		}
+	}
+}
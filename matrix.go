@@ -0,0 +1,196 @@
+package ledctl
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// MatrixLayout is an enumeration of the ways a strip can be wired into a
+// matrix.
+type MatrixLayout int
+
+const (
+	// RowMajor has every row running in the same direction.
+	RowMajor MatrixLayout = iota
+	// ColumnMajor has every column running in the same direction.
+	ColumnMajor
+	// SerpentineRows has rows that alternate direction, zig-zagging down the
+	// matrix.
+	SerpentineRows
+	// SerpentineColumns has columns that alternate direction, zig-zagging
+	// across the matrix.
+	SerpentineColumns
+)
+
+// Corner is an enumeration of the corners of a matrix.
+type Corner int
+
+const (
+	TopLeft Corner = iota
+	TopRight
+	BottomLeft
+	BottomRight
+)
+
+// MatrixConfig is the configuration for a Matrix.
+type MatrixConfig struct {
+	// Width is the number of pixels in each row.
+	Width int
+	// Height is the number of rows.
+	Height int
+	// Layout is how the strip is wired through the matrix.
+	Layout MatrixLayout
+	// Origin is the corner where the first pixel of the strip is. (0, 0) is
+	// always the top left, wherever the strip starts.
+	Origin Corner
+}
+
+// Matrix maps the (x, y) coordinates of a 2D panel onto a Strip.
+type Matrix struct {
+	strip  Strip
+	width  int
+	height int
+	layout MatrixLayout
+	origin Corner
+}
+
+// NewMatrix creates a new Matrix on top of the given strip, which must have at
+// least Width*Height pixels, or it returns ErrPixelCountMismatch.
+func NewMatrix(strip Strip, config MatrixConfig) (*Matrix, error) {
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, fmt.Errorf("invalid matrix size %dx%d", config.Width, config.Height)
+	}
+	if config.Layout < RowMajor || config.Layout > SerpentineColumns {
+		return nil, fmt.Errorf("invalid matrix layout %d", config.Layout)
+	}
+	if config.Origin < TopLeft || config.Origin > BottomRight {
+		return nil, fmt.Errorf("invalid matrix origin %d", config.Origin)
+	}
+	if n := strip.NumPixels(); n < config.Width*config.Height {
+		return nil, fmt.Errorf("%dx%d matrix on strip of %d pixels: %w", config.Width, config.Height, n, ErrPixelCountMismatch)
+	}
+	return &Matrix{
+		strip:  strip,
+		width:  config.Width,
+		height: config.Height,
+		layout: config.Layout,
+		origin: config.Origin,
+	}, nil
+}
+
+// Width returns the width of the matrix.
+func (m *Matrix) Width() int {
+	return m.width
+}
+
+// Height returns the height of the matrix.
+func (m *Matrix) Height() int {
+	return m.height
+}
+
+// Strip returns the strip underneath the matrix.
+func (m *Matrix) Strip() Strip {
+	return m.strip
+}
+
+// Index returns the index in the strip of the pixel at (x, y). It returns
+// false if (x, y) is outside the matrix.
+func (m *Matrix) Index(x, y int) (int, bool) {
+	if x < 0 || x >= m.width || y < 0 || y >= m.height {
+		return 0, false
+	}
+
+	// Flip the coordinates so that the strip always starts at the top left.
+	if m.origin == TopRight || m.origin == BottomRight {
+		x = m.width - 1 - x
+	}
+	if m.origin == BottomLeft || m.origin == BottomRight {
+		y = m.height - 1 - y
+	}
+
+	switch m.layout {
+	case ColumnMajor:
+		return x*m.height + y, true
+	case SerpentineRows:
+		if y%2 == 1 {
+			x = m.width - 1 - x
+		}
+		return y*m.width + x, true
+	case SerpentineColumns:
+		if x%2 == 1 {
+			y = m.height - 1 - y
+		}
+		return x*m.height + y, true
+	default:
+		return y*m.width + x, true
+	}
+}
+
+// SetRGB sets the RGB pixel at (x, y) to the given value. Coordinates outside
+// the matrix are ignored.
+func (m *Matrix) SetRGB(x, y int, rgb RGB) {
+	if i, ok := m.Index(x, y); ok {
+		m.strip.SetRGBAt(i, rgb)
+	}
+}
+
+// RGB returns the RGB pixel at (x, y). Coordinates outside the matrix return
+// black.
+func (m *Matrix) RGB(x, y int) RGB {
+	if i, ok := m.Index(x, y); ok {
+		return m.strip.RGBAt(i)
+	}
+	return RGB{}
+}
+
+// SetRGBW sets the RGBW pixel at (x, y) to the given value. Coordinates
+// outside the matrix are ignored.
+func (m *Matrix) SetRGBW(x, y int, rgbw RGBW) {
+	if i, ok := m.Index(x, y); ok {
+		m.strip.SetRGBWAt(i, rgbw)
+	}
+}
+
+// RGBW returns the RGBW pixel at (x, y). Coordinates outside the matrix return
+// black.
+func (m *Matrix) RGBW(x, y int) RGBW {
+	if i, ok := m.Index(x, y); ok {
+		return m.strip.RGBWAt(i)
+	}
+	return RGBW{}
+}
+
+var _ draw.Image = (*Matrix)(nil)
+
+// ColorModel implements image.Image. It's RGBColorModel.
+func (m *Matrix) ColorModel() color.Model {
+	return RGBColorModel
+}
+
+// Bounds implements image.Image. It runs from (0, 0) to (Width, Height).
+func (m *Matrix) Bounds() image.Rectangle {
+	return image.Rect(0, 0, m.width, m.height)
+}
+
+// At implements image.Image, returning the RGB pixel at (x, y).
+func (m *Matrix) At(x, y int) color.Color {
+	return m.RGB(x, y)
+}
+
+// Set implements draw.Image, so that the matrix can be drawn on with
+// image/draw. RGBW colors are set as they are; others are converted with
+// RGBColorModel.
+func (m *Matrix) Set(x, y int, c color.Color) {
+	if rgbw, ok := c.(RGBW); ok {
+		m.SetRGBW(x, y, rgbw)
+		return
+	}
+	m.SetRGB(x, y, RGBColorModel.Convert(c).(RGB))
+}
+
+// Flush flushes the strip underneath the matrix.
+func (m *Matrix) Flush() error {
+	return m.strip.Flush()
+}
@@ -0,0 +1,140 @@
+package ledctl
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestMatrixIndex(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout MatrixLayout
+		origin Corner
+		want   [4][4]int // want[y][x]
+	}{
+		{"row major", RowMajor, TopLeft, [4][4]int{
+			{0, 1, 2, 3},
+			{4, 5, 6, 7},
+			{8, 9, 10, 11},
+			{12, 13, 14, 15},
+		}},
+		{"column major", ColumnMajor, TopLeft, [4][4]int{
+			{0, 4, 8, 12},
+			{1, 5, 9, 13},
+			{2, 6, 10, 14},
+			{3, 7, 11, 15},
+		}},
+		{"serpentine rows", SerpentineRows, TopLeft, [4][4]int{
+			{0, 1, 2, 3},
+			{7, 6, 5, 4},
+			{8, 9, 10, 11},
+			{15, 14, 13, 12},
+		}},
+		{"serpentine columns", SerpentineColumns, TopLeft, [4][4]int{
+			{0, 7, 8, 15},
+			{1, 6, 9, 14},
+			{2, 5, 10, 13},
+			{3, 4, 11, 12},
+		}},
+		{"serpentine rows from bottom right", SerpentineRows, BottomRight, [4][4]int{
+			{12, 13, 14, 15},
+			{11, 10, 9, 8},
+			{4, 5, 6, 7},
+			{3, 2, 1, 0},
+		}},
+		{"serpentine rows from top right", SerpentineRows, TopRight, [4][4]int{
+			{3, 2, 1, 0},
+			{4, 5, 6, 7},
+			{11, 10, 9, 8},
+			{12, 13, 14, 15},
+		}},
+	}
+
+	for _, test := range tests {
+		m, err := NewMatrix(NullStrip(16, 3), MatrixConfig{Width: 4, Height: 4, Layout: test.layout, Origin: test.origin})
+		if err != nil {
+			t.Fatalf("%s: NewMatrix: %v", test.name, err)
+		}
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				if got, ok := m.Index(x, y); !ok || got != test.want[y][x] {
+					t.Errorf("%s: Index(%d, %d) got: %d, %v, want: %d", test.name, x, y, got, ok, test.want[y][x])
+				}
+			}
+		}
+	}
+}
+
+func TestNewMatrixTooFewPixels(t *testing.T) {
+	_, err := NewMatrix(NullStrip(15, 3), MatrixConfig{Width: 4, Height: 4})
+	if !errors.Is(err, ErrPixelCountMismatch) {
+		t.Errorf("NewMatrix on 15 pixels got: %v, want: %v", err, ErrPixelCountMismatch)
+	}
+	if _, err := NewMatrix(NullStrip(17, 3), MatrixConfig{Width: 4, Height: 4}); err != nil {
+		t.Errorf("NewMatrix on 17 pixels: %v", err)
+	}
+}
+
+func TestMatrixSetRGB(t *testing.T) {
+	ws := testWS281x(WS281xConfig{NumPixels: 16, ColorOrder: RGBOrder, ColorModel: RGBModel})
+	m, err := NewMatrix(ws, MatrixConfig{Width: 4, Height: 4, Layout: SerpentineRows})
+	if err != nil {
+		t.Fatalf("NewMatrix: %v", err)
+	}
+
+	m.SetRGB(1, 1, RGB{1, 2, 3})
+	if got, want := ws.RGBAt(6), (RGB{1, 2, 3}); got != want {
+		t.Errorf("RGBAt(6) got: %v, want: %v", got, want)
+	}
+	if got, want := m.RGB(1, 1), (RGB{1, 2, 3}); got != want {
+		t.Errorf("RGB(1, 1) got: %v, want: %v", got, want)
+	}
+
+	// Out of bounds writes are ignored.
+	for _, c := range [][2]int{{-1, 0}, {4, 0}, {0, -1}, {0, 4}} {
+		m.SetRGB(c[0], c[1], RGB{9, 9, 9})
+	}
+	for i := 0; i < 16; i++ {
+		if got := ws.RGBAt(i); got == (RGB{9, 9, 9}) {
+			t.Errorf("out of bounds SetRGB wrote to pixel %d", i)
+		}
+	}
+}
+
+func TestMatrixDraw(t *testing.T) {
+	ws := testWS281x(WS281xConfig{NumPixels: 16, ColorOrder: RGBOrder, ColorModel: RGBModel})
+	m, err := NewMatrix(ws, MatrixConfig{Width: 4, Height: 4, Layout: SerpentineRows, Origin: BottomRight})
+	if err != nil {
+		t.Fatalf("NewMatrix: %v", err)
+	}
+	if got, want := m.Bounds(), image.Rect(0, 0, 4, 4); got != want {
+		t.Errorf("Bounds got: %v, want: %v", got, want)
+	}
+
+	// The rectangle sticks out past the right edge, which gets clipped.
+	src := image.NewUniform(color.RGBA{0x10, 0x20, 0x30, 0xff})
+	draw.Draw(m, image.Rect(1, 2, 6, 4), src, image.Point{}, draw.Src)
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			want := RGB{}
+			if x >= 1 && y >= 2 {
+				want = RGB{0x10, 0x20, 0x30}
+			}
+			if got := m.At(x, y); got != want {
+				t.Errorf("At(%d, %d) got: %v, want: %v", x, y, got, want)
+			}
+		}
+	}
+
+	// Drawing half-transparent white over it blends, like over any image.
+	draw.Draw(m, image.Rect(0, 3, 2, 4), image.NewUniform(color.NRGBA{0xff, 0xff, 0xff, 0x80}), image.Point{}, draw.Over)
+	if got, want := m.RGB(1, 3), (RGB{0x88, 0x90, 0x98}); got != want {
+		t.Errorf("RGB(1, 3) after Over got: %v, want: %v", got, want)
+	}
+	if got, want := m.RGB(0, 3), (RGB{0x80, 0x80, 0x80}); got != want {
+		t.Errorf("RGB(0, 3) after Over got: %v, want: %v", got, want)
+	}
+}
@@ -0,0 +1,44 @@
+package ledctl
+
+import "fmt"
+
+// Null is a Strip that keeps its pixels but never shows them anywhere, for
+// when there's no strip to drive. It's a FrameBuffer that counts its flushes.
+// Make one with NullStrip.
+type Null struct {
+	*FrameBuffer
+	flushes int
+}
+
+// NullStrip returns a Null with numPixels pixels of numColors colors each,
+// which has to be 3 or 4. As on a real strip, white is ignored if there are
+// only 3.
+func NullStrip(numPixels, numColors int) *Null {
+	model := RGBModel
+	switch numColors {
+	case 3:
+	case 4:
+		model = RGBWModel
+	default:
+		panic(fmt.Sprintf("NullStrip called with %d colors, want 3 or 4", numColors))
+	}
+	return &Null{FrameBuffer: NewFrameBuffer(numPixels, model)}
+}
+
+// Flush only counts that it was called.
+func (n *Null) Flush() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.flushes++
+	return nil
+}
+
+// Flushes returns how many times Flush has been called, e.g. to check in
+// tests how many frames were shown.
+func (n *Null) Flushes() int {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	return n.flushes
+}
@@ -0,0 +1,37 @@
+package ledctl
+
+import "testing"
+
+func TestNullStrip(t *testing.T) {
+	var s Strip = NullStrip(3, 3)
+	s.SetRGBAt(0, RGB{1, 2, 3})
+	s.SetRGBWAt(1, RGBW{4, 5, 6, 7})
+	for i := 0; i < 3; i++ {
+		if err := s.Flush(); err != nil {
+			t.Errorf("Flush: %v", err)
+		}
+	}
+	if got, want := s.RGBAt(0), (RGB{1, 2, 3}); got != want {
+		t.Errorf("RGBAt(0) got %v, want %v", got, want)
+	}
+	if got, want := s.RGBWAt(1), (RGBW{4, 5, 6, 0}); got != want {
+		t.Errorf("RGBWAt(1) on RGB strip got %v, want %v", got, want)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+
+	rgbw := NullStrip(2, 4)
+	rgbw.SetRGBWs([]RGBW{{1, 2, 3, 4}, {5, 6, 7, 8}})
+	if got, want := rgbw.RGBWAt(1), (RGBW{5, 6, 7, 8}); got != want {
+		t.Errorf("RGBWAt(1) got %v, want %v", got, want)
+	}
+	// Like a FrameBuffer's, SetRGBAt turns white off.
+	rgbw.SetRGBAt(1, RGB{9, 9, 9})
+	if got, want := rgbw.RGBWAt(1), (RGBW{9, 9, 9, 0}); got != want {
+		t.Errorf("RGBWAt(1) after SetRGBAt got %v, want %v", got, want)
+	}
+	if rgbw.NumPixels() != 2 || rgbw.NumColors() != 4 {
+		t.Errorf("got %d pixels of %d colors, want 2 of 4", rgbw.NumPixels(), rgbw.NumColors())
+	}
+}
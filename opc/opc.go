@@ -0,0 +1,175 @@
+// Package opc serves Open Pixel Control, the simple TCP protocol that
+// Fadecandy and many Processing sketches use to send pixels.
+package opc
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/mxcu/ledctl"
+)
+
+// Port is the TCP port OPC uses by default.
+const Port = 7890
+
+// These are the commands.
+const (
+	// SetPixelColors messages have 3 bytes of RGB per pixel.
+	SetPixelColors = 0
+	// SystemExclusive messages are specific to a kind of receiver.
+	SystemExclusive = 255
+)
+
+// Broadcast is the channel that messages for every strip are sent to.
+const Broadcast = 0
+
+// Message is an OPC message.
+type Message struct {
+	// Channel is the channel the message is for, or Broadcast.
+	Channel uint8
+	// Command is the command, such as SetPixelColors.
+	Command uint8
+	// Data is the message's data.
+	Data []byte
+}
+
+// Reader reads OPC messages.
+type Reader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+// NewReader creates a Reader that reads messages from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// ReadMessage reads the next message. Its data is only valid until the next
+// call. It returns io.EOF if r ends between messages.
+func (r *Reader) ReadMessage() (*Message, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r.r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("couldn't read header: %w", err)
+		}
+		return nil, err
+	}
+	n := int(binary.BigEndian.Uint16(header[2:]))
+	if cap(r.buf) < n {
+		r.buf = make([]byte, n)
+	}
+	buf := r.buf[:n]
+	if _, err := io.ReadFull(r.r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("couldn't read data: %w", err)
+	}
+	return &Message{Channel: header[0], Command: header[1], Data: buf}, nil
+}
+
+// Server shows the OPC messages it receives on strips, one per channel.
+type Server struct {
+	mu     sync.Mutex
+	strips map[uint8]ledctl.Strip
+}
+
+// NewServer creates a Server with no strips.
+func NewServer() *Server {
+	return &Server{strips: make(map[uint8]ledctl.Strip)}
+}
+
+// Handle shows the messages for channel on strip. Messages for Broadcast are
+// shown on every strip.
+func (s *Server) Handle(channel uint8, strip ledctl.Strip) error {
+	if channel == Broadcast {
+		return fmt.Errorf("channel %d is for broadcasts", Broadcast)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.strips[channel] = strip
+	return nil
+}
+
+// HandleMessage deals with a message. SetPixelColors messages are shown on
+// the strip for their channel, which is then flushed. Messages for channels
+// with no strip, and other commands, are ignored.
+func (s *Server) HandleMessage(m *Message) error {
+	if m.Command != SetPixelColors {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m.Channel != Broadcast {
+		strip, ok := s.strips[m.Channel]
+		if !ok {
+			return nil
+		}
+		return show(strip, m.Data)
+	}
+	for _, strip := range s.strips {
+		if err := show(strip, m.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func show(strip ledctl.Strip, data []byte) error {
+	numPixels := strip.NumPixels()
+	for i := 0; i < numPixels && 3*i+2 < len(data); i++ {
+		strip.SetRGBAt(i, ledctl.RGB{R: data[3*i], G: data[3*i+1], B: data[3*i+2]})
+	}
+	if err := strip.Flush(); err != nil {
+		return fmt.Errorf("couldn't flush strip: %w", err)
+	}
+	return nil
+}
+
+// ServeConn handles every message read from conn. It returns nil when conn
+// ends between messages.
+func (s *Server) ServeConn(conn io.Reader) error {
+	r := NewReader(conn)
+	for {
+		m, err := r.ReadMessage()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.HandleMessage(m); err != nil {
+			return err
+		}
+	}
+}
+
+// Serve accepts connections from l and serves each of them in its own
+// goroutine, until accepting fails.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			s.ServeConn(conn) // Ignore error; the client can connect again
+		}()
+	}
+}
+
+// ListenAndServe listens on the OPC port and serves s, until something goes
+// wrong.
+func (s *Server) ListenAndServe() error {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", Port))
+	if err != nil {
+		return fmt.Errorf("couldn't listen for OPC: %v", err)
+	}
+	defer l.Close()
+	return s.Serve(l)
+}
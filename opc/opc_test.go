@@ -0,0 +1,92 @@
+package opc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/mxcu/ledctl"
+)
+
+var testMessage = []byte{
+	1,          // Channel
+	0,          // Set pixel colors
+	0x00, 0x06, // Length
+	0xff, 0x80, 0x00, 0x01, 0x02, 0x03, // Data
+}
+
+func TestReadMessage(t *testing.T) {
+	r := NewReader(bytes.NewReader(testMessage))
+	m, err := r.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	if m.Channel != 1 || m.Command != SetPixelColors || !bytes.Equal(m.Data, testMessage[4:]) {
+		t.Errorf("got %+v", m)
+	}
+	if _, err := r.ReadMessage(); err != io.EOF {
+		t.Errorf("ReadMessage at end got %v, want io.EOF", err)
+	}
+
+	for _, b := range [][]byte{testMessage[:2], testMessage[:7]} {
+		_, err := NewReader(bytes.NewReader(b)).ReadMessage()
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("ReadMessage of %d bytes got %v, want io.ErrUnexpectedEOF", len(b), err)
+		}
+	}
+}
+
+// serve serves the messages over a net.Pipe and waits for ServeConn to
+// return.
+func serve(t *testing.T, s *Server, messages ...[]byte) {
+	client, server := net.Pipe()
+	go func() {
+		for _, m := range messages {
+			client.Write(m)
+		}
+		client.Close()
+	}()
+	if err := s.ServeConn(server); err != nil {
+		t.Fatalf("ServeConn: %v", err)
+	}
+}
+
+func TestServer(t *testing.T) {
+	one := ledctl.NullStrip(3, 3)
+	two := ledctl.NullStrip(1, 3)
+	s := NewServer()
+	if err := s.Handle(1, one); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if err := s.Handle(2, two); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+
+	sysex := []byte{1, SystemExclusive, 0x00, 0x01, 0x00}
+	other := append([]byte{3}, testMessage[1:]...)
+	serve(t, s, testMessage, sysex, other)
+	want := []ledctl.RGB{{R: 0xff, G: 0x80}, {R: 1, G: 2, B: 3}, {}}
+	for i := range want {
+		if one.RGBAt(i) != want[i] {
+			t.Errorf("pixel %d got %v, want %v", i, one.RGBAt(i), want[i])
+		}
+	}
+	if one.Flushes() != 1 || two.Flushes() != 0 {
+		t.Errorf("got %d and %d flushes, want 1 and 0", one.Flushes(), two.Flushes())
+	}
+
+	broadcast := append([]byte{Broadcast}, testMessage[1:]...)
+	serve(t, s, broadcast)
+	if one.Flushes() != 2 || two.Flushes() != 1 {
+		t.Errorf("broadcast: got %d and %d flushes, want 2 and 1", one.Flushes(), two.Flushes())
+	}
+	if got, want := two.RGBAt(0), (ledctl.RGB{R: 0xff, G: 0x80}); got != want {
+		t.Errorf("broadcast: pixel got %v, want %v", got, want)
+	}
+
+	if err := s.Handle(Broadcast, one); err == nil {
+		t.Errorf("Handle(Broadcast) succeeded, want error")
+	}
+}
@@ -0,0 +1,14 @@
+package ledctl
+
+// Palette is a list of up to 256 colors, for strips that store a palette index
+// per pixel instead of a color. Entries past 256 can't be indexed.
+type Palette []RGB
+
+// At returns the color at index idx, or black if the palette is too short to
+// have one.
+func (p Palette) At(idx uint8) RGB {
+	if int(idx) >= len(p) {
+		return RGB{}
+	}
+	return p[idx]
+}
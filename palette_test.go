@@ -0,0 +1,23 @@
+package ledctl
+
+import "testing"
+
+func TestPaletteAt(t *testing.T) {
+	p := Palette{{255, 0, 0}, {0, 255, 0}}
+
+	tests := []struct {
+		idx  uint8
+		want RGB
+	}{
+		{0, RGB{255, 0, 0}},
+		{1, RGB{0, 255, 0}},
+		{2, RGB{}},
+		{255, RGB{}},
+	}
+
+	for _, test := range tests {
+		if got := p.At(test.idx); got != test.want {
+			t.Errorf("At(%d) got %v, want %v", test.idx, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package ledctl
+
+// DefaultChannelMilliamps is the current typically drawn by one color channel
+// of a pixel at full brightness.
+const DefaultChannelMilliamps = 20.0
+
+// DefaultIdleMilliamps is the current typically drawn by a pixel's driver
+// chip, even when the pixel is off.
+const DefaultIdleMilliamps = 1.0
+
+// estimateMilliamps estimates the current drawn by n pixels whose channel
+// values, each out of max and before brightness is applied, add up to level.
+// A perChannel of zero or less means DefaultChannelMilliamps.
+func estimateMilliamps(level, max float64, n int, brightness uint8, perChannel, idle float64) float64 {
+	if perChannel <= 0 {
+		perChannel = DefaultChannelMilliamps
+	}
+	return float64(n)*idle + level/max*float64(brightness)/255*perChannel
+}
+
+// limitBrightness returns brightness lowered, if need be, so that the
+// estimated current stays within limit. A limit of zero or less means no
+// limit.
+func limitBrightness(level, max float64, n int, brightness uint8, limit float64) uint8 {
+	if limit <= 0 || estimateMilliamps(level, max, n, brightness, DefaultChannelMilliamps, DefaultIdleMilliamps) <= limit {
+		return brightness
+	}
+	budget := limit - float64(n)*DefaultIdleMilliamps
+	if budget <= 0 {
+		return 0
+	}
+	// The estimate is over the limit, so this is less than brightness.
+	return uint8(budget / (level / max * DefaultChannelMilliamps) * 255)
+}
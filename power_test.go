@@ -0,0 +1,76 @@
+package ledctl
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestEstimatedMilliamps(t *testing.T) {
+	ws := testWS281x(WS281xConfig{NumPixels: 10, ColorModel: RGBModel})
+	ws.Fill(RGB{255, 255, 255})
+	// 10 pixels * (3 channels * 20mA + 1mA idle)
+	if got, want := ws.EstimatedMilliamps(0, 1), 610.0; got != want {
+		t.Errorf("full white got %vmA, want %vmA", got, want)
+	}
+	ws.SetBrightness(51)
+	// 10 pixels * (3 channels * 20mA * 51/255 + 1mA idle)
+	if got, want := ws.EstimatedMilliamps(20, 1), 130.0; math.Abs(got-want) > 1e-9 {
+		t.Errorf("brightness 51 got %vmA, want %vmA", got, want)
+	}
+
+	la, err := newLPD8806(LPD8806Config{Device: &fakeDevice{}, NumPixels: 4, ColorOrder: GRBWOrder, ColorModel: RGBWModel}, nil)
+	if err != nil {
+		t.Fatalf("newLPD8806: %v", err)
+	}
+	la.FillRGBW(RGBW{127, 127, 127, 127})
+	// 4 pixels * 4 channels * 15mA
+	if got, want := la.EstimatedMilliamps(15, 0), 240.0; got != want {
+		t.Errorf("LPD8806 full white got %vmA, want %vmA", got, want)
+	}
+}
+
+func TestPowerLimit(t *testing.T) {
+	ws := testWS281x(WS281xConfig{NumPixels: 10, ColorOrder: RGBOrder, ColorModel: RGBModel})
+	ws.Fill(RGB{255, 128, 0})
+	ws.SetPowerLimit(1000) // Well above the 10*(20+10+1) = 310mA drawn
+	ws.encode(0, ws.numPixels)
+	if got, want := decodeWS281x(ws)[:3], []byte{255, 128, 0}; !bytes.Equal(got, want) {
+		t.Errorf("under the limit encoded %v, want %v", got, want)
+	}
+
+	// 150mA is left for the pixels' 300mA of channel current, so a brightness
+	// of 255*150/300, rounded down.
+	ws.SetPowerLimit(160)
+	ws.encode(0, ws.numPixels)
+	if got, want := decodeWS281x(ws)[:3], []byte{127, 64, 0}; !bytes.Equal(got, want) {
+		t.Errorf("over the limit encoded %v, want %v", got, want)
+	}
+	if got, want := ws.RGBAt(0), (RGB{255, 128, 0}); got != want {
+		t.Errorf("RGBAt(0) got %v, want %v", got, want)
+	}
+
+	dev := &fakeDevice{}
+	la, err := newLPD8806(LPD8806Config{Device: dev, NumPixels: 10, ColorModel: RGBModel}, nil)
+	if err != nil {
+		t.Fatalf("newLPD8806: %v", err)
+	}
+	la.Fill(RGB{127, 127, 127})
+	la.SetPowerLimit(310) // 300mA left for 600mA of channel current
+	if err := la.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if got, want := dev.last()[0], byte(0x80|63); got != want {
+		t.Errorf("LPD8806 over the limit wrote %#x, want %#x", got, want)
+	}
+
+	// FlushPartial re-encodes everything when the limit moves the brightness,
+	// here to 255*300/540.
+	la.SetRGBAt(0, RGB{})
+	if err := la.FlushPartial(); err != nil {
+		t.Fatalf("FlushPartial: %v", err)
+	}
+	if got, want := dev.last()[3], byte(0x80|70); got != want {
+		t.Errorf("LPD8806 after FlushPartial wrote %#x, want %#x", got, want)
+	}
+}
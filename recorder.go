@@ -0,0 +1,187 @@
+package ledctl
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"io"
+	"time"
+)
+
+// GIFRecorder is a Strip wired up as a matrix that records every Flush as a
+// frame of an animated GIF, for previewing animations without any hardware.
+// The GIF is written when it's closed.
+type GIFRecorder struct {
+	w      io.Writer
+	pixels []RGBW
+	matrix *Matrix
+	scale  int
+	delay  int
+	anim   gif.GIF
+	closed bool
+}
+
+// GIFRecorderConfig is the configuration for a GIFRecorder.
+type GIFRecorderConfig struct {
+	// Writer is where the GIF is written on Close. It isn't closed.
+	Writer io.Writer
+	// Matrix is the size and wiring of the pixels. The recorder has
+	// Width*Height pixels.
+	Matrix MatrixConfig
+	// Scale is the size in GIF pixels of each square LED. If zero, 1 is used.
+	Scale int
+	// Delay is how long each frame is shown for, rounded down to 10ms. If
+	// zero, 100ms is used.
+	Delay time.Duration
+}
+
+// NewGIFRecorder creates a new GIFRecorder.
+func NewGIFRecorder(config GIFRecorderConfig) (*GIFRecorder, error) {
+	if config.Writer == nil {
+		return nil, fmt.Errorf("no writer for GIF")
+	}
+	scale := config.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	if scale < 0 {
+		return nil, fmt.Errorf("invalid scale %d", scale)
+	}
+	delay := config.Delay
+	if delay == 0 {
+		delay = 100 * time.Millisecond
+	}
+	if delay < 0 {
+		return nil, fmt.Errorf("invalid delay %v", delay)
+	}
+
+	gr := &GIFRecorder{
+		w:     config.Writer,
+		scale: scale,
+		delay: int(delay / (10 * time.Millisecond)),
+	}
+	if config.Matrix.Width > 0 && config.Matrix.Height > 0 {
+		gr.pixels = make([]RGBW, config.Matrix.Width*config.Matrix.Height)
+	}
+	m, err := NewMatrix(gr, config.Matrix)
+	if err != nil {
+		return nil, err
+	}
+	gr.matrix = m
+	return gr, nil
+}
+
+// Frames returns the number of frames recorded so far.
+func (gr *GIFRecorder) Frames() int {
+	return len(gr.anim.Image)
+}
+
+// RGBAt returns the RGB pixel at the given index.
+func (gr *GIFRecorder) RGBAt(i int) RGB {
+	p := gr.pixels[i]
+	return RGB{p.R, p.G, p.B}
+}
+
+// SetRGBAt sets the RGB pixel at the given index, leaving its white alone.
+func (gr *GIFRecorder) SetRGBAt(i int, rgb RGB) {
+	p := &gr.pixels[i]
+	p.R, p.G, p.B = rgb.R, rgb.G, rgb.B
+}
+
+// RGBWAt returns the RGBW pixel at the given index.
+func (gr *GIFRecorder) RGBWAt(i int) RGBW {
+	return gr.pixels[i]
+}
+
+// SetRGBWAt sets the RGBW pixel at the given index. White is drawn by adding
+// it to the other colors.
+func (gr *GIFRecorder) SetRGBWAt(i int, rgbw RGBW) {
+	gr.pixels[i] = rgbw
+}
+
+// SetRGBs sets the RGB pixels to the given values.
+func (gr *GIFRecorder) SetRGBs(pixels []RGB) {
+	if len(pixels) != len(gr.pixels) {
+		panic("SetRGBs called with wrong number of pixels")
+	}
+	for i, p := range pixels {
+		gr.SetRGBAt(i, p)
+	}
+}
+
+// SetRGBWs sets the RGBW pixels to the given values.
+func (gr *GIFRecorder) SetRGBWs(pixels []RGBW) {
+	if len(pixels) != len(gr.pixels) {
+		panic("SetRGBWs called with wrong number of pixels")
+	}
+	copy(gr.pixels, pixels)
+}
+
+// Flush records the pixels as a new frame.
+func (gr *GIFRecorder) Flush() error {
+	if gr.closed {
+		return fmt.Errorf("GIF recorder is closed")
+	}
+
+	w, h := gr.matrix.Width(), gr.matrix.Height()
+	colors := make([]color.RGBA, 0, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := gr.matrix.RGBW(x, y)
+			colors = append(colors, color.RGBA{addSat(c.R, c.W), addSat(c.G, c.W), addSat(c.B, c.W), 0xff})
+		}
+	}
+
+	// Use the exact colors if they fit in a GIF palette, and the nearest
+	// Plan 9 ones if they don't.
+	var pal color.Palette
+	seen := make(map[color.RGBA]bool)
+	for _, c := range colors {
+		if !seen[c] {
+			seen[c] = true
+			pal = append(pal, c)
+		}
+	}
+	if len(pal) > 256 {
+		pal = palette.Plan9
+	}
+
+	img := image.NewPaletted(image.Rect(0, 0, w*gr.scale, h*gr.scale), pal)
+	for i, c := range colors {
+		idx := uint8(pal.Index(c))
+		x, y := i%w*gr.scale, i/w*gr.scale
+		for dy := 0; dy < gr.scale; dy++ {
+			for dx := 0; dx < gr.scale; dx++ {
+				img.SetColorIndex(x+dx, y+dy, idx)
+			}
+		}
+	}
+	gr.anim.Image = append(gr.anim.Image, img)
+	gr.anim.Delay = append(gr.anim.Delay, gr.delay)
+	return nil
+}
+
+// Close writes the recorded frames to the writer as a GIF. There has to be at
+// least one.
+func (gr *GIFRecorder) Close() error {
+	if gr.closed {
+		return nil
+	}
+	gr.closed = true
+	if err := gif.EncodeAll(gr.w, &gr.anim); err != nil {
+		return fmt.Errorf("couldn't write GIF: %w", err)
+	}
+	return nil
+}
+
+// NumPixels returns the number of pixels in the strip.
+func (gr *GIFRecorder) NumPixels() int {
+	return len(gr.pixels)
+}
+
+// MaxLEDsPerChannel returns the number of pixels in the matrix.
+func (gr *GIFRecorder) MaxLEDsPerChannel() int {
+	return len(gr.pixels)
+}
@@ -0,0 +1,76 @@
+package ledctl
+
+import (
+	"bytes"
+	"image/color"
+	"image/gif"
+	"testing"
+	"time"
+)
+
+func TestGIFRecorder(t *testing.T) {
+	var buf bytes.Buffer
+	gr, err := NewGIFRecorder(GIFRecorderConfig{
+		Writer: &buf,
+		Matrix: MatrixConfig{Width: 3, Height: 2, Layout: SerpentineRows},
+		Scale:  2,
+		Delay:  50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewGIFRecorder: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		gr.SetRGBAt(i, RGB{200, 0, 0})
+		// Index 3 is at (2, 1), since the second row runs backwards.
+		gr.SetRGBWAt(3, RGBW{0, 0, 100, 20})
+		if err := gr.Flush(); err != nil {
+			t.Fatalf("Flush: %v", err)
+		}
+	}
+	if got, want := gr.Frames(), 3; got != want {
+		t.Errorf("Frames() got %d, want %d", got, want)
+	}
+	if err := gr.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	g, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatalf("DecodeAll: %v", err)
+	}
+	if got, want := len(g.Image), 3; got != want {
+		t.Fatalf("got %d frames, want %d", got, want)
+	}
+	if got, want := g.Delay[0], 5; got != want {
+		t.Errorf("delay got %d, want %d", got, want)
+	}
+	if got, want := g.Image[0].Bounds().Dx(), 6; got != want {
+		t.Errorf("width got %d, want %d", got, want)
+	}
+	samples := []struct {
+		frame, x, y int
+		want        color.RGBA
+	}{
+		{0, 1, 1, color.RGBA{200, 0, 0, 255}},
+		{0, 2, 0, color.RGBA{0, 0, 0, 255}},
+		{2, 5, 0, color.RGBA{200, 0, 0, 255}},
+		{2, 5, 3, color.RGBA{20, 20, 120, 255}},
+	}
+	for _, s := range samples {
+		r, g, b, a := g.Image[s.frame].At(s.x, s.y).RGBA()
+		if got := (color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)}); got != s.want {
+			t.Errorf("frame %d (%d, %d) got %v, want %v", s.frame, s.x, s.y, got, s.want)
+		}
+	}
+}
+
+func TestGIFRecorderNoFrames(t *testing.T) {
+	gr, err := NewGIFRecorder(GIFRecorderConfig{Writer: &bytes.Buffer{}, Matrix: MatrixConfig{Width: 1, Height: 1}})
+	if err != nil {
+		t.Fatalf("NewGIFRecorder: %v", err)
+	}
+	if err := gr.Close(); err == nil {
+		t.Errorf("Close with no frames succeeded, want error")
+	}
+}
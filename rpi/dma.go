@@ -1,6 +1,8 @@
 package rpi
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -83,7 +85,7 @@ func (rp *RPi) GetDMABuf(bytes uint) (*DMABuf, error) {
 	var err error
 	d.pb, err = rp.getPhysBuf(calcDMABufSize(bytes))
 	if err != nil {
-		return nil, fmt.Errorf("couldn't get %d byte phyical buffer for DMA: %v", bytes, err)
+		return nil, fmt.Errorf("couldn't get %d byte phyical buffer for DMA: %w", bytes, err)
 	}
 	d.c = (*dmaControl)(unsafe.Pointer(&d.pb.buf[d.pb.offs]))
 	log.Printf("dmabuf size %d, calc %d, addr %08X\n", bytes, calcDMABufSize(bytes), uintptr(unsafe.Pointer(d.c)))
@@ -107,6 +109,25 @@ func calcDMABufSize(bytes uint) uint32 {
 	return uint32(((bytes / PAGE_SIZE) + 1) * PAGE_SIZE)
 }
 
+// reservedDMAChannels are DMA channels that are used by the firmware or kernel, and that it's not safe to take over.
+var reservedDMAChannels = map[int]string{
+	0: "used by the GPU firmware",
+	2: "used by the GPU firmware",
+	4: "used by the GPU firmware",
+	5: "used for the SD card, which it can corrupt",
+}
+
+// CheckDMAChannel returns an error if dma isn't a DMA channel that can safely be used for PWM.
+func CheckDMAChannel(dma int) error {
+	if dma < 0 || dma > 14 {
+		return fmt.Errorf("DMA channel %d out of range 0-14", dma)
+	}
+	if why, ok := reservedDMAChannels[dma]; ok {
+		return fmt.Errorf("DMA channel %d is reserved: it's %s; 10 is usually safe", dma, why)
+	}
+	return nil
+}
+
 func (rp *RPi) InitDMA(dma int) error {
 	offset, ok := dmaOffsets[dma]
 	if !ok {
@@ -119,7 +140,7 @@ func (rp *RPi) InitDMA(dma int) error {
 	)
 	rp.dmaBuf, bufOffs, err = rp.mapMem(offset, int(unsafe.Sizeof(dmaT{})))
 	if err != nil {
-		return fmt.Errorf("couldn't map dmaT at %08X: %v", offset, err)
+		return fmt.Errorf("couldn't map dmaT at %08X: %w", offset, err)
 	}
 	log.Printf("Got dmaBuf[%d], offset %d\n", len(rp.dmaBuf), bufOffs)
 	rp.dma = (*dmaT)(unsafe.Pointer(&rp.dmaBuf[bufOffs]))
@@ -147,12 +168,46 @@ func (rp *RPi) StartDMA(d *DMABuf) {
 		rpiDmaCsPanicPriority(15) |
 		rpiDmaCsPriority(15) |
 		RPI_DMA_CS_ACTIVE
+	if rp.pcmOn {
+		// Unlike the PWM, the PCM doesn't start sending until it's told to.
+		rp.pcm.cs |= RPI_PCM_CS_TXON
+	}
+	if rp.mock {
+		rp.mockDMAs++
+		if !rp.mockStall {
+			rp.dma.cs = RPI_DMA_CS_END
+		}
+	}
 }
 
 func (rp *RPi) WaitForDMAEnd() error {
+	return rp.WaitForDMAEndContext(context.Background())
+}
+
+// ErrDMATimeout is returned by WaitForDMAEndTimeout if the DMA doesn't end in time.
+var ErrDMATimeout = errors.New("timed out waiting for DMA to end")
+
+// WaitForDMAEndTimeout is like WaitForDMAEnd, but gives up and returns an error wrapping ErrDMATimeout if the DMA
+// hasn't ended after d.
+func (rp *RPi) WaitForDMAEndTimeout(d time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	err := rp.WaitForDMAEndContext(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %v", ErrDMATimeout, d)
+	}
+	return err
+}
+
+// WaitForDMAEndContext is like WaitForDMAEnd, but gives up and returns ctx.Err() if ctx is done
+// before the DMA is.
+func (rp *RPi) WaitForDMAEndContext(ctx context.Context) error {
 	var cs uint32
 	i := 0
 	for true {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		cs = rp.dma.cs
 		if (cs & RPI_DMA_CS_ACTIVE) == 0 {
 			break
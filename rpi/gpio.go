@@ -1,8 +1,10 @@
 package rpi
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"os"
 	"time"
 	"unsafe"
 )
@@ -49,7 +51,7 @@ const (
 
 func (rp *RPi) gpioSetPinFunction(pin int, fnc uint32) error {
 	if pin > pinMax {
-		return fmt.Errorf("pin %d not supported")
+		return fmt.Errorf("pin %d not supported", pin)
 	}
 	reg := pin / 10
 	offset := uint((pin % 10) * 3)
@@ -68,7 +70,7 @@ func (rp *RPi) GPIOSetOutput(pin int, pm PullMode) error {
 	}
 	err := rp.gpioSetPinFunction(pin, 1)
 	if err != nil {
-		return fmt.Errorf("couldn't set pin as output: %v", err)
+		return fmt.Errorf("couldn't set pin as output: %w", err)
 	}
 
 	// See p101 for the description of this procedure.
@@ -93,7 +95,7 @@ func (rp *RPi) gpioSetAltFunction(pin int, alt int) error {
 
 func (rp *RPi) GPIOSetPin(pin int, val bool) error {
 	if pin > pinMax {
-		return fmt.Errorf("pin %d not supported")
+		return fmt.Errorf("pin %d not supported", pin)
 	}
 	reg := pin / 32
 	offset := uint(pin % 32)
@@ -107,21 +109,44 @@ func (rp *RPi) GPIOSetPin(pin int, val bool) error {
 
 func (rp *RPi) GPIOGetPin(pin int) (bool, error) {
 	if pin > pinMax {
-		return false, fmt.Errorf("pin %d not supported")
+		return false, fmt.Errorf("pin %d not supported", pin)
 	}
 	reg := pin / 32
 	offset := uint(pin % 32)
 	return (rp.gpio.lev[reg] & (1 << offset)) != 0, nil
 }
 
+// gpioMemFile picks the file to map the GPIO registers from, and their offset in it. /dev/gpiomem has nothing but
+// the GPIO registers, but unlike /dev/mem it doesn't need root, so it's used if it can be opened.
+func gpioMemFile(canOpen func(name string) bool, periphBase uintptr) (string, uintptr) {
+	if canOpen(GPIOMEM_FILE) {
+		return GPIOMEM_FILE, 0
+	}
+	return MEM_FILE, GPIO_OFFSET + periphBase
+}
+
+// canOpen returns whether the file can be opened for reading and writing.
+func canOpen(name string) bool {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_SYNC, 0)
+	if err != nil {
+		return false
+	}
+	f.Close() // Ignore error
+	return true
+}
+
 func (rp *RPi) InitGPIO() error {
 	var (
 		bufOffs uintptr
 		err     error
 	)
-	rp.gpioBuf, bufOffs, err = rp.mapMem(GPIO_OFFSET+rp.hw.periphBase, int(unsafe.Sizeof(gpioT{})))
+	name, addr := gpioMemFile(canOpen, rp.hw.periphBase)
+	rp.gpioBuf, bufOffs, err = rp.mapFile(name, addr, int(unsafe.Sizeof(gpioT{})))
+	if errors.Is(err, os.ErrPermission) && name == MEM_FILE {
+		return fmt.Errorf("couldn't map gpioT, and %s couldn't be opened either: %w", GPIOMEM_FILE, err)
+	}
 	if err != nil {
-		return fmt.Errorf("couldn't map gpioT at %08X: %v", GPIO_OFFSET+rp.hw.periphBase, err)
+		return fmt.Errorf("couldn't map gpioT from %s at %08X: %w", name, addr, err)
 	}
 	log.Printf("Got gpioBuf[%d], offset %d\n", len(rp.gpioBuf), bufOffs)
 	rp.gpio = (*gpioT)(unsafe.Pointer(&rp.gpioBuf[bufOffs]))
@@ -0,0 +1,25 @@
+package rpi
+
+import (
+	"testing"
+)
+
+func TestGPIOMemFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]bool
+		wantName string
+		wantAddr uintptr
+	}{
+		{"gpiomem", map[string]bool{GPIOMEM_FILE: true, MEM_FILE: true}, GPIOMEM_FILE, 0},
+		{"mem only", map[string]bool{MEM_FILE: true}, MEM_FILE, PERIPH_BASE_RPI2 + GPIO_OFFSET},
+		{"neither", map[string]bool{}, MEM_FILE, PERIPH_BASE_RPI2 + GPIO_OFFSET},
+	}
+	for _, test := range tests {
+		canOpen := func(name string) bool { return test.files[name] }
+		name, addr := gpioMemFile(canOpen, PERIPH_BASE_RPI2)
+		if name != test.wantName || addr != test.wantAddr {
+			t.Errorf("%s: got %s at %08X, want %s at %08X", test.name, name, addr, test.wantName, test.wantAddr)
+		}
+	}
+}
@@ -78,3 +78,32 @@ func ioctlUint32(fd uintptr, ioctl uint32, val uint32) error {
 	}
 	return err
 }
+
+func ioctlUint8(fd uintptr, ioctl uint32, val uint8) error {
+	_, _, errno := syscall.Syscall(
+		syscall.SYS_IOCTL,
+		uintptr(fd),
+		uintptr(ioctl),
+		uintptr(unsafe.Pointer(&val)),
+	)
+	var err error
+	err = nil
+	if errno != 0 {
+		err = errno
+	}
+	return err
+}
+
+func ioctlReadUint32(fd uintptr, ioctl uint32) (uint32, error) {
+	var val uint32
+	_, _, errno := syscall.Syscall(
+		syscall.SYS_IOCTL,
+		uintptr(fd),
+		uintptr(ioctl),
+		uintptr(unsafe.Pointer(&val)),
+	)
+	if errno != 0 {
+		return 0, errno
+	}
+	return val, nil
+}
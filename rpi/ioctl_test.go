@@ -2,6 +2,7 @@ package rpi
 
 import (
 	"testing"
+	"unsafe"
 )
 
 // These tests aren't really useful for regression purposes (difficult to see how some bit
@@ -17,6 +18,7 @@ import (
 // #define MAJOR_NUM 100
 //
 // int main(void) {
+//    printf("SPI_IOC_WR_MODE: %08X\n", SPI_IOC_WR_MODE);
 //    printf("SPI_IOC_WR_BITS_PER_WORD: %08X\n", SPI_IOC_WR_BITS_PER_WORD);
 //    printf("SPI_IOC_WR_MAX_SPEED_HZ: %08X\n", SPI_IOC_WR_MAX_SPEED_HZ);
 //    printf("SPI_IOC_RD_BITS_PER_WORD: %08X\n", SPI_IOC_RD_BITS_PER_WORD);
@@ -27,6 +29,7 @@ import (
 // Which produced this output:
 //
 // $ ./spiconst
+// SPI_IOC_WR_MODE: 40016B01
 // SPI_IOC_WR_BITS_PER_WORD: 40016B03
 // SPI_IOC_WR_MAX_SPEED_HZ: 40046B04
 // SPI_IOC_RD_BITS_PER_WORD: 80016B03
@@ -40,6 +43,15 @@ const (
 	MAJOR_NUM = 100
 )
 
+// mboxPropertyWant is IOCTL_MBOX_PROPERTY for the host's pointer size. The value above came from a
+// 32-bit Pi; on 64-bit systems (including arm64 Pis) the char * argument is 8 bytes, giving C0086400.
+func mboxPropertyWant() uint32 {
+	if unsafe.Sizeof(uintptr(0)) == 8 {
+		return 0xC0086400
+	}
+	return 0xC0046400
+}
+
 func TestIow(t *testing.T) {
 	tests := []struct {
 		name string
@@ -48,6 +60,7 @@ func TestIow(t *testing.T) {
 		size interface{}
 		want uint32
 	}{
+		{"SPI_IOC_WR_MODE", SPI_IOC_MAGIC, SPI_IOC_WR_MODE, uint8(0), 0x40016B01},
 		{"SPI_IOC_WR_BITS_PER_WORD", SPI_IOC_MAGIC, 3, uint8(0), 0x40016B03},
 		{"SPI_IOC_WR_MAX_SPEED", SPI_IOC_MAGIC, 4, uint32(0), 0x40046B04},
 	}
@@ -68,7 +81,7 @@ func TestIor(t *testing.T) {
 		want uint32
 	}{
 		{"SPI_IOC_RD_BITS_PER_WORD", SPI_IOC_MAGIC, 3, uint8(0), 0x80016B03},
-		{"SPI_IOC_RD_MAX_SPEED", SPI_IOC_MAGIC, 4, uint32(0), 0x80046B04},
+		{"SPI_IOC_RD_MAX_SPEED", SPI_IOC_MAGIC, SPI_IOC_RD_MAX_SPEED_HZ, uint32(0), 0x80046B04},
 	}
 
 	for _, test := range tests {
@@ -86,7 +99,7 @@ func TestIowr(t *testing.T) {
 		size interface{}
 		want uint32
 	}{
-		{"IOCTL_MBOX_PROPERTY", MAJOR_NUM, 0, uintptr(0), 0xC0046400},
+		{"IOCTL_MBOX_PROPERTY", MAJOR_NUM, 0, uintptr(0), mboxPropertyWant()},
 	}
 
 	for _, test := range tests {
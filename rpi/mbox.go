@@ -6,7 +6,6 @@ import (
 	"log"
 	"os"
 	"path"
-	"reflect"
 	"syscall"
 	"unsafe"
 
@@ -22,7 +21,9 @@ import (
 const (
 	VIDEOCORE_MAJOR_NUM = 100
 	MEM_FILE            = "/dev/mem"
+	GPIOMEM_FILE        = "/dev/gpiomem"
 	VCIO_FILE           = "/dev/vcio"
+	VC_CMA_FILE         = "/dev/vc-cma"
 	MBOX_DEV            = 100 << 20 // Assumes devices have 12-bit major, 20-bit minor numbers
 	MBOX_MODE           = 0600
 	RPI_PWM_CHANNELS    = 2
@@ -40,16 +41,14 @@ type PhysBuf struct {
 // desired mapped area and also adds any bytes specified by offs.
 func (pb *PhysBuf) uint32Slice(offs uintptr) []uint32 {
 	offs += pb.offs
-	header := *(*reflect.SliceHeader)(unsafe.Pointer(&pb.buf))
-	header.Len -= int(offs)
-	header.Len /= 4
-	header.Cap -= int(offs)
-	header.Cap /= 4
-	header.Data += offs
-	return *(*[]uint32)(unsafe.Pointer(&header))
+	return unsafe.Slice((*uint32)(unsafe.Pointer(&pb.buf[offs])), (len(pb.buf)-int(offs))/4)
 }
 
 func (rp *RPi) FreePhysBuf(pb *PhysBuf) error {
+	if rp.mock {
+		pb.buf = nil
+		return nil
+	}
 	var err, te error
 	if pb.buf != nil {
 		err = pb.buf.Unmap()
@@ -76,21 +75,25 @@ func (rp *RPi) FreePhysBuf(pb *PhysBuf) error {
 // getPhysBuf gets a buffer of Videocore memory that can be used for DMA or other purposes.
 func (rp *RPi) getPhysBuf(size uint32) (*PhysBuf, error) {
 	pb := PhysBuf{}
+	if rp.mock {
+		pb.buf = make(mmap.MMap, size)
+		return &pb, nil
+	}
 	var err error
 	pb.handle, err = rp.allocVCMem(size)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't allocMem of size %v: %v", size, err)
+		return nil, fmt.Errorf("couldn't allocMem of size %v: %w", size, err)
 	}
 	pb.busAddr, err = rp.lockVCMem(pb.handle)
 	if err != nil {
 		rp.freeVCMem(pb.handle) // Ignore error
-		return nil, fmt.Errorf("couldn't lockMem(%X) of size %v: %v", pb.handle, size, err)
+		return nil, fmt.Errorf("couldn't lockMem(%X) of size %v: %w", pb.handle, size, err)
 	}
 	pb.buf, pb.offs, err = rp.mapMem(busToPhys(pb.busAddr), int(size))
 	if err != nil {
 		rp.unlockVCMem(pb.handle) // Ignore error
 		rp.freeVCMem(pb.handle)   // Ignore error
-		return nil, fmt.Errorf("couldn't map busAddr(%X) of size %v: %v", pb.busAddr, size, err)
+		return nil, fmt.Errorf("couldn't map busAddr(%X) of size %v: %w", pb.busAddr, size, err)
 	}
 	log.Printf("mapped %d bytes, busaddr %08X, offset %d\n", size, pb.busAddr, pb.offs)
 	return &pb, nil
@@ -106,9 +109,21 @@ func busToPhys(busAddr uintptr) uintptr {
 // nearest page boundary. mapMem returns the mapped memory and the offset that should be used to
 // access it (=physAddr%PAGE_SIZE).
 func (rp *RPi) mapMem(physAddr uintptr, size int) (mmap.MMap, uintptr, error) {
-	f, err := os.OpenFile(MEM_FILE, os.O_RDWR|os.O_SYNC, os.ModePerm)
+	return rp.mapFile(MEM_FILE, physAddr, size)
+}
+
+// mapFile is like mapMem, but maps from the given file, where physAddr is the offset in the file.
+func (rp *RPi) mapFile(name string, physAddr uintptr, size int) (mmap.MMap, uintptr, error) {
+	if rp.mock {
+		return make(mmap.MMap, size), 0, nil
+	}
+	hint := "run as root"
+	if name == GPIOMEM_FILE {
+		hint = "run as root or add the user to the gpio group"
+	}
+	f, err := openFile(name, os.O_RDWR|os.O_SYNC, os.ModePerm)
 	if err != nil {
-		return nil, 0, fmt.Errorf("couldn't open %s: %v", MEM_FILE, err)
+		return nil, 0, fmt.Errorf("couldn't open %s: %w", name, permissionError(err, "opening "+name, hint))
 	}
 
 	pagemask := ^uintptr(PAGE_SIZE - 1)
@@ -117,48 +132,82 @@ func (rp *RPi) mapMem(physAddr uintptr, size int) (mmap.MMap, uintptr, error) {
 	log.Printf("MapRegion(f, %d, RDWR, 0, %08X), physAddr %08X, mask %08X\n", size, int64(mapAddr), physAddr, pagemask)
 	mm, err := mmap.MapRegion(f, size, mmap.RDWR, 0, int64(mapAddr))
 	if err != nil {
-		return nil, 0, fmt.Errorf("couldn't map region (%v, %v): %v", physAddr, size, err)
+		f.Close() // Ignore error
+		return nil, 0, fmt.Errorf("couldn't map region (%v, %v): %w", physAddr, size, permissionError(err, "mapping "+name, hint))
 	}
 	f.Close() // Ignore error
 
 	return mm, physAddr & (PAGE_SIZE - 1), nil
 }
 
+// openFile is os.OpenFile, unless a test replaces it.
+var openFile = os.OpenFile
+
+// mknod is syscall.Mknod, unless a test replaces it.
+var mknod = syscall.Mknod
+
+// permissionError adds a hint about how to fix err to it if it's a permission error, so that users don't have to
+// work out which group they're missing from a bare EACCES. Other errors are returned unchanged.
+func permissionError(err error, doing string, hint string) error {
+	if errors.Is(err, os.ErrPermission) {
+		return fmt.Errorf("permission denied %s; %s: %w", doing, hint, err)
+	}
+	return err
+}
+
 // mboxOpenTemp creates a temporary device node for ioctl-ing with the mailbox, opens it and
 // immediately removes the node once it's open. It returns the opened node.
 func (rp *RPi) mboxOpenTemp() error {
 	tf := path.Join(os.TempDir(), fmt.Sprintf("mailbox-%d", os.Getpid()))
 	err := os.Remove(tf)
-	if err != nil && err != os.ErrNotExist {
-		return fmt.Errorf("couldn't remove temp mbox: %v", err)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("couldn't remove temp mbox: %w", err)
 	}
-	err = syscall.Mknod(tf, syscall.S_IFCHR|MBOX_MODE, MBOX_DEV)
+	err = mknod(tf, syscall.S_IFCHR|MBOX_MODE, MBOX_DEV)
 	if err != nil {
-		return fmt.Errorf("couldn't make device node: %v", err)
+		return fmt.Errorf("couldn't make device node: %w", permissionError(err, "making "+tf, "run as root"))
 	}
-	f, err := os.OpenFile(tf, os.O_RDONLY, os.ModePerm)
+	f, err := openFile(tf, os.O_RDONLY, os.ModePerm)
 	if err != nil {
-		return fmt.Errorf("couldn't open temp mbox: %v", err)
+		return fmt.Errorf("couldn't open temp mbox: %w", err)
 	}
 	err = os.Remove(tf)
 	if err != nil {
 		f.Close() // Ignore error
-		return fmt.Errorf("couldn't remove temp mbox: %v", err)
+		return fmt.Errorf("couldn't remove temp mbox: %w", err)
 	}
 	rp.mbox = f
 	return nil
 }
 
-// mboxOpen opens /dev/vcio for ioctl-ing with the mailbox. If that doesn't exist, it passes instead
-// to mboxOpenTemp to get a temporary node. It returns the opened mailbox.
+// mailboxPaths are where mboxOpen looks for the mailbox device, in order, if no path was configured.
+// Most kernels have /dev/vcio; some older ones only have /dev/vc-cma.
+var mailboxPaths = []string{VCIO_FILE, VC_CMA_FILE}
+
+// mboxOpen opens the mailbox device for ioctl-ing with the mailbox. That's rp.mboxPath if it's set, or else the
+// first of mailboxPaths that exists. If none of them do, it passes instead to mboxOpenTemp to get a temporary node.
+// It returns the opened mailbox.
 func (rp *RPi) mboxOpen() error {
+	paths := mailboxPaths
+	if rp.mboxPath != "" {
+		paths = []string{rp.mboxPath}
+	}
 	var err error
-	rp.mbox, err = os.OpenFile(VCIO_FILE, os.O_RDONLY, os.ModePerm)
-	if err == os.ErrNotExist {
-		err = rp.mboxOpenTemp()
+	for _, name := range paths {
+		rp.mbox, err = openFile(name, os.O_RDONLY, os.ModePerm)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			err = permissionError(err, "opening "+name, "run as root or add the user to the video group")
+			return fmt.Errorf("couldn't open mbox: %w", err)
+		}
 	}
-	if err != nil {
-		return fmt.Errorf("couldn't open mbox: %v", err)
+	if rp.mboxPath != "" {
+		return fmt.Errorf("couldn't open mbox: %w", err)
+	}
+	if err := rp.mboxOpenTemp(); err != nil {
+		return fmt.Errorf("couldn't open mbox: %w", err)
 	}
 	return nil
 }
@@ -175,7 +224,7 @@ func (rp *RPi) mboxProperty(buf []uint32) error {
 	mboxProperty := iowr(VIDEOCORE_MAJOR_NUM, 0, uintptr(0))
 	err := ioctlArrUint32(rp.mbox.Fd(), mboxProperty, buf)
 	if err != nil {
-		return fmt.Errorf("failed ioctl mbox property: %v", err)
+		return fmt.Errorf("failed ioctl mbox property: %w", err)
 	}
 	return nil
 }
@@ -214,7 +263,7 @@ func (rp *RPi) allocVCMem(size uint32) (uintptr, error) {
 
 	err := rp.mboxProperty(p)
 	if err != nil {
-		return 0, fmt.Errorf("mboxProperty failed: %v", err)
+		return 0, fmt.Errorf("mboxProperty failed: %w", err)
 	}
 	if p[4]&0x80000000 == 0 {
 		return 0, fmt.Errorf("response tag unset: %v", p[4])
@@ -250,7 +299,7 @@ func (rp *RPi) freeVCMem(handle uintptr) error {
 
 	err := rp.mboxProperty(p)
 	if err != nil {
-		return fmt.Errorf("mboxProperty failed: %v", err)
+		return fmt.Errorf("mboxProperty failed: %w", err)
 	}
 	if p[4]&0x80000000 == 0 {
 		return fmt.Errorf("response tag unset: %v", p[4])
@@ -287,7 +336,7 @@ func (rp *RPi) lockVCMem(handle uintptr) (uintptr, error) {
 
 	err := rp.mboxProperty(p)
 	if err != nil {
-		return 0, fmt.Errorf("mboxProperty failed: %v", err)
+		return 0, fmt.Errorf("mboxProperty failed: %w", err)
 	}
 	if p[4]&0x80000000 == 0 {
 		return 0, fmt.Errorf("response tag unset: %v", p[4])
@@ -321,7 +370,7 @@ func (rp *RPi) unlockVCMem(handle uintptr) error {
 
 	err := rp.mboxProperty(p)
 	if err != nil {
-		return fmt.Errorf("mboxProperty failed: %v", err)
+		return fmt.Errorf("mboxProperty failed: %w", err)
 	}
 	if p[4]&0x80000000 == 0 {
 		return fmt.Errorf("response tag unset: %v", p[4])
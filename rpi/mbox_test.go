@@ -0,0 +1,125 @@
+package rpi
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// denyOpen makes openFile fail with errno for the rest of the test.
+func denyOpen(t *testing.T, errno syscall.Errno) {
+	openFile = func(name string, flag int, perm os.FileMode) (*os.File, error) {
+		return nil, &os.PathError{Op: "open", Path: name, Err: errno}
+	}
+	t.Cleanup(func() { openFile = os.OpenFile })
+}
+
+func TestMboxOpenPermission(t *testing.T) {
+	denyOpen(t, syscall.EACCES)
+	rp := &RPi{}
+	err := rp.mboxOpen()
+	if !errors.Is(err, os.ErrPermission) {
+		t.Errorf("mboxOpen got %v, want it to wrap %v", err, os.ErrPermission)
+	}
+	want := "permission denied opening /dev/vcio; run as root or add the user to the video group"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("mboxOpen got %v, want %q", err, want)
+	}
+}
+
+func TestMapFilePermission(t *testing.T) {
+	tests := []struct {
+		name  string
+		errno syscall.Errno
+		want  string
+	}{
+		{MEM_FILE, syscall.EACCES, "permission denied opening /dev/mem; run as root"},
+		{MEM_FILE, syscall.EPERM, "permission denied opening /dev/mem; run as root"},
+		{GPIOMEM_FILE, syscall.EACCES, "permission denied opening /dev/gpiomem; run as root or add the user to the gpio group"},
+	}
+	for _, test := range tests {
+		denyOpen(t, test.errno)
+		rp := &RPi{}
+		_, _, err := rp.mapFile(test.name, 0, 4)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("mapFile(%s) with %v got %v, want %q", test.name, test.errno, err, test.want)
+		}
+	}
+}
+
+func TestPermissionErrorOther(t *testing.T) {
+	err := &os.PathError{Op: "open", Path: MEM_FILE, Err: syscall.ENOENT}
+	if got := permissionError(err, "opening "+MEM_FILE, "run as root"); got != error(err) {
+		t.Errorf("permissionError changed %v to %v", err, got)
+	}
+}
+
+// recordOpen makes openFile record the names it's asked for, opening a temporary file in place of exists and
+// failing with ENOENT for everything else.
+func recordOpen(t *testing.T, exists string) *[]string {
+	var names []string
+	openFile = func(name string, flag int, perm os.FileMode) (*os.File, error) {
+		names = append(names, name)
+		if name != exists {
+			return nil, &os.PathError{Op: "open", Path: name, Err: syscall.ENOENT}
+		}
+		return os.CreateTemp(t.TempDir(), "mbox")
+	}
+	t.Cleanup(func() { openFile = os.OpenFile })
+	return &names
+}
+
+func TestMboxOpenPath(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		exists string
+		want   []string
+	}{
+		{"vcio", "", VCIO_FILE, []string{VCIO_FILE}},
+		{"vc-cma", "", VC_CMA_FILE, []string{VCIO_FILE, VC_CMA_FILE}},
+		{"override", "/dev/mbox", "/dev/mbox", []string{"/dev/mbox"}},
+		{"missing override", "/dev/mbox", VCIO_FILE, []string{"/dev/mbox"}},
+	}
+	for _, test := range tests {
+		names := recordOpen(t, test.exists)
+		rp := &RPi{mboxPath: test.path}
+		err := rp.mboxOpen()
+		if test.exists == test.want[len(test.want)-1] {
+			if err != nil {
+				t.Errorf("%s: mboxOpen: %v", test.name, err)
+			} else {
+				rp.mboxClose()
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s: mboxOpen got %v, want %v", test.name, err, os.ErrNotExist)
+		}
+		if !reflect.DeepEqual(*names, test.want) {
+			t.Errorf("%s: opened %v, want %v", test.name, *names, test.want)
+		}
+	}
+}
+
+func TestMboxOpenTempFallback(t *testing.T) {
+	// None of the mailbox paths exist, and nor does a stale temp node, so
+	// only making the node can fail.
+	recordOpen(t, "")
+	var made string
+	mknod = func(path string, mode uint32, dev int) error {
+		made = path
+		return syscall.EPERM
+	}
+	t.Cleanup(func() { mknod = syscall.Mknod })
+
+	rp := &RPi{}
+	err := rp.mboxOpen()
+	if made == "" {
+		t.Fatalf("mboxOpen got %v without trying to make a temp node", err)
+	}
+	if !errors.Is(err, os.ErrPermission) || !strings.Contains(err.Error(), "couldn't make device node") {
+		t.Errorf("mboxOpen got %v, want it to fail making the node with %v", err, os.ErrPermission)
+	}
+}
@@ -0,0 +1,38 @@
+package rpi
+
+// MockEnv is the environment variable that, when set to anything, makes NewRPi
+// return a mock from NewMockRPi instead of looking for real hardware.
+const MockEnv = "LEDCTL_RPI_MOCK"
+
+// NewMockRPi returns an RPi that acts like a Pi 2 or 3, but keeps all of its
+// registers and buffers in ordinary memory and never touches the hardware, so
+// that code using it can run and be tested anywhere. DMA finishes as soon as
+// it's started.
+func NewMockRPi() *RPi {
+	return &RPi{
+		hw: &hw{
+			hwType:     RPI_HWVER_TYPE_PI2,
+			periphBase: PERIPH_BASE_RPI2,
+			vcBase:     VIDEOCORE_BASE_RPI2,
+			name:       "Mock",
+		},
+		mock: true,
+	}
+}
+
+// StallMockDMA makes DMA started on a mock never end while stall is true, as if
+// the hardware had hung. It does nothing if rp isn't a mock.
+func (rp *RPi) StallMockDMA(stall bool) {
+	rp.mockStall = stall
+}
+
+// MockDMAs returns how many times DMA has been started on a mock, which is how
+// many frames it would have sent. It returns 0 if rp isn't a mock.
+func (rp *RPi) MockDMAs() int {
+	return rp.mockDMAs
+}
+
+// IsMock returns whether rp was made by NewMockRPi.
+func (rp *RPi) IsMock() bool {
+	return rp.mock
+}
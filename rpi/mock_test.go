@@ -0,0 +1,87 @@
+package rpi
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMockRPi(t *testing.T) {
+	rp := NewMockRPi()
+	if !rp.IsMock() {
+		t.Fatalf("IsMock() got false, want true")
+	}
+
+	buf, err := rp.GetDMABuf(64)
+	if err != nil {
+		t.Fatalf("GetDMABuf: %v", err)
+	}
+	if err := rp.InitDMA(10); err != nil {
+		t.Fatalf("InitDMA: %v", err)
+	}
+	if err := rp.InitGPIO(); err != nil {
+		t.Fatalf("InitGPIO: %v", err)
+	}
+	if err := rp.InitPWM(800000, buf, 64, []int{18}); err != nil {
+		t.Fatalf("InitPWM: %v", err)
+	}
+	if got, want := buf.c.txLen, uint32(64); got != want {
+		t.Errorf("DMA txLen got %d, want %d", got, want)
+	}
+
+	words := buf.Uint32Slice()
+	words[0] = 0xdeadbeef
+	rp.StartDMA(buf)
+	if err := rp.WaitForDMAEnd(); err != nil {
+		t.Errorf("WaitForDMAEnd: %v", err)
+	}
+	if got, want := words[0], uint32(0xdeadbeef); got != want {
+		t.Errorf("DMA buffer got %08X, want %08X", got, want)
+	}
+	if got, want := rp.MockDMAs(), 1; got != want {
+		t.Errorf("MockDMAs() got %d, want %d", got, want)
+	}
+
+	rp.StopPWM()
+	if err := rp.FreeDMABuf(buf); err != nil {
+		t.Errorf("FreeDMABuf: %v", err)
+	}
+}
+
+func TestNewRPiMockEnv(t *testing.T) {
+	t.Setenv(MockEnv, "1")
+	rp, err := NewRPi()
+	if err != nil {
+		t.Fatalf("NewRPi: %v", err)
+	}
+	if !rp.IsMock() {
+		t.Errorf("IsMock() got false, want true")
+	}
+}
+
+func TestWaitForDMAEndTimeout(t *testing.T) {
+	rp := NewMockRPi()
+	buf, err := rp.GetDMABuf(64)
+	if err != nil {
+		t.Fatalf("GetDMABuf: %v", err)
+	}
+	if err := rp.InitDMA(10); err != nil {
+		t.Fatalf("InitDMA: %v", err)
+	}
+
+	rp.StartDMA(buf)
+	if err := rp.WaitForDMAEndTimeout(time.Second); err != nil {
+		t.Errorf("WaitForDMAEndTimeout: %v", err)
+	}
+
+	rp.StallMockDMA(true)
+	rp.StartDMA(buf)
+	start := time.Now()
+	err = rp.WaitForDMAEndTimeout(20 * time.Millisecond)
+	if !errors.Is(err, ErrDMATimeout) {
+		t.Errorf("WaitForDMAEndTimeout on stalled DMA got %v, want %v", err, ErrDMATimeout)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("WaitForDMAEndTimeout took %v to time out", elapsed)
+	}
+}
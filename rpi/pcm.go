@@ -0,0 +1,192 @@
+package rpi
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+const (
+	PCM_OFFSET      = uintptr(0x00203000)
+	CM_PCM_OFFSET   = uintptr(0x00101098)
+	PCM_PERIPH_PHYS = uint32(0x7e203000)
+)
+
+// Mapping of GPIO pins to which "alt" function means PCM_DOUT. See p102 of datasheet.
+var pcmPinToAlt = map[int]int{
+	21: 0,
+	31: 2,
+}
+
+const (
+	RPI_PCM_CS_DMAEN   = 1 << 9
+	RPI_PCM_CS_TXCLR   = 1 << 3
+	RPI_PCM_CS_TXON    = 1 << 2
+	RPI_PCM_CS_EN      = 1 << 0
+	RPI_PCM_TXC_CH1WEX = uint32(1 << 31)
+	RPI_PCM_TXC_CH1EN  = 1 << 30
+)
+
+type pcmT struct {
+	cs     uint32
+	fifo   uint32
+	mode   uint32
+	rxc    uint32
+	txc    uint32
+	dreq   uint32
+	inten  uint32
+	intstc uint32
+	gray   uint32
+}
+
+func rpiPcmModeFlen(val uint32) uint32 {
+	return (val & 0x3ff) << 10
+}
+
+func rpiPcmModeFslen(val uint32) uint32 {
+	return (val & 0x3ff) << 0
+}
+
+func rpiPcmTxcCh1Pos(val uint32) uint32 {
+	return (val & 0x3ff) << 20
+}
+
+func rpiPcmTxcCh1Wid(val uint32) uint32 {
+	return (val & 0xf) << 16
+}
+
+func rpiPcmDreqTxPanic(val uint32) uint32 {
+	return (val & 0x7f) << 24
+}
+
+func rpiPcmDreqTx(val uint32) uint32 {
+	return (val & 0x7f) << 8
+}
+
+// PCMPins returns the GPIO pins that PCM_DOUT can be routed to on this Pi, in ascending order.
+func (rp *RPi) PCMPins() []int {
+	if strings.Contains(rp.hw.name, "Compute Module") {
+		return []int{21, 31}
+	}
+	return []int{21}
+}
+
+// CheckPCMPins returns an error if pins isn't a single GPIO pin that PCM_DOUT can be routed to on this Pi.
+func (rp *RPi) CheckPCMPins(pins []int) error {
+	if len(pins) != 1 {
+		return fmt.Errorf("need 1 GPIO pin for PCM, got %d", len(pins))
+	}
+	valid := rp.PCMPins()
+	for _, p := range valid {
+		if p == pins[0] {
+			return nil
+		}
+	}
+	return fmt.Errorf("GPIO pin %d can't be used for PCM on %s; valid pins are %v", pins[0], rp.hw.name, valid)
+}
+
+// InitPCM is like InitPWM, but sets up the PCM to send the DMA buffer out of pin, one 32-bit frame per word. The
+// PCM is otherwise used for I2S audio, but unlike the PWM it isn't shared with the headphone jack.
+func (rp *RPi) InitPCM(freq uint, buf *DMABuf, bytes uint, pin int) error {
+	oscFreq := uint32(OSC_FREQ)
+	if rp.hw.hwType == RPI_HWVER_TYPE_PI4 {
+		oscFreq = OSC_FREQ_PI4
+	}
+
+	alt, ok := pcmPinToAlt[pin]
+	if !ok {
+		return fmt.Errorf("invalid pin %d for PCM", pin)
+	}
+	rp.gpioSetAltFunction(pin, alt)
+
+	if rp.pcmBuf == nil {
+		var (
+			bufOffs uintptr
+			err     error
+		)
+		rp.pcmBuf, bufOffs, err = rp.mapMem(PCM_OFFSET+rp.hw.periphBase, int(unsafe.Sizeof(pcmT{})))
+		if err != nil {
+			return fmt.Errorf("couldn't map pcmT at %08X: %w", PCM_OFFSET+rp.hw.periphBase, err)
+		}
+		log.Printf("Got pcmBuf[%d], offset %d\n", len(rp.pcmBuf), bufOffs)
+		rp.pcm = (*pcmT)(unsafe.Pointer(&rp.pcmBuf[bufOffs]))
+
+		rp.pcmClkBuf, bufOffs, err = rp.mapMem(CM_PCM_OFFSET+rp.hw.periphBase, int(unsafe.Sizeof(cmClkT{})))
+		if err != nil {
+			return fmt.Errorf("couldn't map cmClkT at %08X: %w", CM_PCM_OFFSET+rp.hw.periphBase, err)
+		}
+		log.Printf("Got pcmClkBuf[%d], offset %d\n", len(rp.pcmClkBuf), bufOffs)
+		rp.pcmClk = (*cmClkT)(unsafe.Pointer(&rp.pcmClkBuf[bufOffs]))
+	}
+
+	rp.StopPCM()
+
+	// Set up the clock - Use OSC @ 19.2Mhz w/ 3 clocks/tick, the same as for PWM
+	rp.pcmClk.div = CM_CLK_DIV_PASSWD | cmClkDivI(oscFreq/(3*uint32(freq)))
+	rp.pcmClk.ctl = CM_CLK_CTL_PASSWD | CM_CLK_CTL_SRC_OSC
+	rp.pcmClk.ctl = CM_CLK_CTL_PASSWD | CM_CLK_CTL_SRC_OSC | CM_CLK_CTL_ENAB
+	time.Sleep(10 * time.Microsecond)
+	log.Printf("Waiting for pcmClk busy\n")
+	i := 0
+	for !rp.mock && (rp.pcmClk.ctl&CM_CLK_CTL_BUSY) == 0 { // The mock's clock never gets busy
+		i++
+	}
+	log.Printf("Done %d\n", i)
+
+	// Set up the PCM for one 32-bit channel per frame, so that it shifts the words out back to back like the PWM
+	// serializer does. As with the PWM, use delays as the block is rumored to lock up without them.
+	rp.pcm.cs = 0
+	time.Sleep(10 * time.Microsecond)
+	rp.pcm.mode = rpiPcmModeFlen(31) | rpiPcmModeFslen(1)
+	time.Sleep(10 * time.Microsecond)
+	rp.pcm.txc = RPI_PCM_TXC_CH1WEX | RPI_PCM_TXC_CH1EN | rpiPcmTxcCh1Pos(0) | rpiPcmTxcCh1Wid(8) // 8+16 bits
+	time.Sleep(10 * time.Microsecond)
+	rp.pcm.cs |= RPI_PCM_CS_TXCLR
+	time.Sleep(10 * time.Microsecond)
+	rp.pcm.cs |= RPI_PCM_CS_DMAEN
+	time.Sleep(10 * time.Microsecond)
+	rp.pcm.dreq = rpiPcmDreqTx(0x3f) | rpiPcmDreqTxPanic(0x10)
+	time.Sleep(10 * time.Microsecond)
+	rp.pcm.cs |= RPI_PCM_CS_EN
+	rp.pcmOn = true
+
+	// Initialize the DMA control block
+	buf.c.ti = RPI_DMA_TI_NO_WIDE_BURSTS | // 32-bit transfers
+		RPI_DMA_TI_WAIT_RESP | // wait for write complete
+		RPI_DMA_TI_DEST_DREQ | // user peripheral flow control
+		rpiDmaTiPerMap(2) | // PCM TX peripheral
+		RPI_DMA_TI_SRC_INC // Increment src addr
+
+	buf.c.sourceAd = uint32(buf.pb.busAddr + unsafe.Sizeof(dmaControl{}))
+	log.Printf("DMA sourceAd %08X\n", buf.c.sourceAd)
+
+	buf.c.destAd = PCM_PERIPH_PHYS + uint32(unsafe.Offsetof(rp.pcm.fifo))
+	buf.c.txLen = uint32(bytes)
+	log.Printf("DMA txLen %d\n", buf.c.txLen)
+	buf.c.stride = 0
+	buf.c.nextconbk = 0
+
+	rp.dma.cs = 0
+	rp.dma.txLen = 0
+	return nil
+}
+
+func (rp *RPi) StopPCM() {
+	rp.pcmOn = false
+
+	// Turn off the PCM in case already running
+	rp.pcm.cs = 0
+	time.Sleep(10 * time.Microsecond)
+
+	// Kill the clock if it was already running
+	rp.pcmClk.ctl = CM_CLK_CTL_PASSWD | CM_CLK_CTL_KILL
+	time.Sleep(10 * time.Microsecond)
+	log.Printf("Waiting for pcmClk not-busy\n")
+	i := 0
+	for (rp.pcmClk.ctl & CM_CLK_CTL_BUSY) != 0 {
+		i++
+	}
+	log.Printf("Done %d\n", i)
+}
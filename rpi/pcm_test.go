@@ -0,0 +1,73 @@
+package rpi
+
+import (
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+func TestCheckPCMPins(t *testing.T) {
+	rp := NewMockRPi()
+	tests := []struct {
+		pins []int
+		want string
+	}{
+		{[]int{21}, ""},
+		{[]int{18}, "valid pins are [21]"},
+		{[]int{31}, "GPIO pin 31"},
+		{nil, "need 1"},
+		{[]int{21, 21}, "need 1"},
+	}
+	for _, test := range tests {
+		err := rp.CheckPCMPins(test.pins)
+		if test.want == "" {
+			if err != nil {
+				t.Errorf("CheckPCMPins(%v) got %v, want nil", test.pins, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("CheckPCMPins(%v) got %v, want error containing %q", test.pins, err, test.want)
+		}
+	}
+}
+
+func TestInitPCM(t *testing.T) {
+	rp := NewMockRPi()
+	buf, err := rp.GetDMABuf(64)
+	if err != nil {
+		t.Fatalf("GetDMABuf: %v", err)
+	}
+	if err := rp.InitDMA(10); err != nil {
+		t.Fatalf("InitDMA: %v", err)
+	}
+	if err := rp.InitGPIO(); err != nil {
+		t.Fatalf("InitGPIO: %v", err)
+	}
+	if err := rp.InitPCM(800000, buf, 64, 18); err == nil {
+		t.Errorf("InitPCM on pin 18 succeeded, want error")
+	}
+	if err := rp.InitPCM(800000, buf, 64, 21); err != nil {
+		t.Fatalf("InitPCM: %v", err)
+	}
+
+	if got, want := buf.c.destAd, PCM_PERIPH_PHYS+uint32(unsafe.Offsetof(pcmT{}.fifo)); got != want {
+		t.Errorf("DMA destAd got %08X, want the PCM FIFO at %08X", got, want)
+	}
+	if got, want := buf.c.ti&rpiDmaTiPerMap(0x1f), rpiDmaTiPerMap(2); got != want {
+		t.Errorf("DMA peripheral got %08X, want %08X", got, want)
+	}
+	if rp.pwm != nil {
+		t.Errorf("InitPCM set up the PWM")
+	}
+	if got, want := rp.pcm.cs, uint32(RPI_PCM_CS_DMAEN|RPI_PCM_CS_TXCLR|RPI_PCM_CS_EN); got != want {
+		t.Errorf("PCM cs got %08X, want %08X", got, want)
+	}
+
+	rp.StartDMA(buf)
+	if rp.pcm.cs&RPI_PCM_CS_TXON == 0 {
+		t.Errorf("StartDMA didn't turn on the PCM's transmitter")
+	}
+	rp.StopPCM()
+	if rp.pcm.cs != 0 {
+		t.Errorf("StopPCM left cs %08X", rp.pcm.cs)
+	}
+}
@@ -1,8 +1,12 @@
 package rpi
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"sort"
+	"strings"
 	"time"
 	"unsafe"
 )
@@ -23,6 +27,88 @@ var pwmPinToAlt = map[pwmPin]int{
 	{1, 45}: 0,
 }
 
+// headerPins are the GPIO pins that come out on the 40-pin header. The others in pwmPinToAlt are only wired up
+// on Compute Modules; on the rest, some of them drive the audio jack.
+var headerPins = map[int]bool{12: true, 13: true, 18: true, 19: true}
+
+// PWMPins returns the GPIO pins that the given PWM channel can be routed to on this Pi, in ascending order.
+func (rp *RPi) PWMPins(channel int) []int {
+	all := strings.Contains(rp.hw.name, "Compute Module")
+	var pins []int
+	for pp := range pwmPinToAlt {
+		if pp.channel == channel && (all || headerPins[pp.pin]) {
+			pins = append(pins, pp.pin)
+		}
+	}
+	sort.Ints(pins)
+	return pins
+}
+
+// CheckPWMPins returns an error if pins, where pins[i] is the GPIO pin for PWM channel i, can't be used on this Pi.
+func (rp *RPi) CheckPWMPins(pins []int) error {
+	if len(pins) == 0 || len(pins) > RPI_PWM_CHANNELS {
+		return fmt.Errorf("need 1 to %d GPIO pins, one per PWM channel, got %d", RPI_PWM_CHANNELS, len(pins))
+	}
+	for channel, pin := range pins {
+		valid := rp.PWMPins(channel)
+		ok := false
+		for _, p := range valid {
+			ok = ok || p == pin
+		}
+		if !ok {
+			return fmt.Errorf("GPIO pin %d can't be used for PWM channel %d on %s; valid pins are %v",
+				pin, channel, rp.hw.name, valid)
+		}
+	}
+	return nil
+}
+
+// ErrPWMInUse is returned by CheckPWMAudio when the onboard audio looks like it's using the PWM.
+var ErrPWMInUse = errors.New("PWM is in use by the onboard audio")
+
+// The files CheckPWMAudio looks at.
+var (
+	asoundCardsFile = "/proc/asound/cards"
+	modulesFile     = "/proc/modules"
+)
+
+// CheckPWMAudio returns an error wrapping ErrPWMInUse if the onboard analog audio is enabled. It drives the
+// headphone jack with the PWM, so sending to LEDs at the same time garbles both, or the LEDs get nothing.
+func (rp *RPi) CheckPWMAudio() error {
+	if rp.mock {
+		return nil
+	}
+	cards, _ := os.ReadFile(asoundCardsFile)
+	modules, _ := os.ReadFile(modulesFile)
+	return pwmAudioConflict(string(cards), string(modules))
+}
+
+// pwmAudioConflict checks for analog audio in the contents of /proc/asound/cards, or if that's empty or
+// missing, /proc/modules.
+func pwmAudioConflict(cards, modules string) error {
+	var found string
+	if cards != "" {
+		for _, line := range strings.Split(cards, "\n") {
+			if strings.Contains(line, "bcm2835") && (strings.Contains(line, "Headphones") || strings.Contains(line, "ALSA")) {
+				found = "sound card " + strings.TrimSpace(line)
+				break
+			}
+		}
+	} else {
+		for _, line := range strings.Split(modules, "\n") {
+			if strings.HasPrefix(line, "snd_bcm2835 ") {
+				found = "module snd_bcm2835 is loaded"
+				break
+			}
+		}
+	}
+	if found == "" {
+		return nil
+	}
+	return fmt.Errorf("%w (%s): add dtparam=audio=off to config.txt and reboot, or use the PCM instead",
+		ErrPWMInUse, found)
+}
+
 const (
 	RPI_PWM_CTL_USEF2 = 1 << 13
 	RPI_PWM_CTL_MODE2 = 1 << 9
@@ -84,7 +170,7 @@ func (rp *RPi) InitPWM(freq uint, buf *DMABuf, bytes uint, pins []int) error {
 		)
 		rp.pwmBuf, bufOffs, err = rp.mapMem(PWM_OFFSET+rp.hw.periphBase, int(unsafe.Sizeof(pwmT{})))
 		if err != nil {
-			return fmt.Errorf("couldn't map pwmT at %08X: %v", PWM_OFFSET+rp.hw.periphBase, err)
+			return fmt.Errorf("couldn't map pwmT at %08X: %w", PWM_OFFSET+rp.hw.periphBase, err)
 		}
 		log.Printf("Got pwmBuf[%d], offset %d\n", len(rp.pwmBuf), bufOffs)
 		rp.pwm = (*pwmT)(unsafe.Pointer(&rp.pwmBuf[bufOffs]))
@@ -92,7 +178,7 @@ func (rp *RPi) InitPWM(freq uint, buf *DMABuf, bytes uint, pins []int) error {
 		// This could potentially be in a clk.go. Seems not worth it yet, though.
 		rp.cmClkBuf, bufOffs, err = rp.mapMem(CM_PWM_OFFSET+rp.hw.periphBase, int(unsafe.Sizeof(cmClkT{})))
 		if err != nil {
-			return fmt.Errorf("couldn't map cmClkT at %08X: %v", CM_PWM_OFFSET+rp.hw.periphBase, err)
+			return fmt.Errorf("couldn't map cmClkT at %08X: %w", CM_PWM_OFFSET+rp.hw.periphBase, err)
 		}
 		log.Printf("Got cmClkBuf[%d], offset %d\n", len(rp.cmClkBuf), bufOffs)
 		rp.cmClk = (*cmClkT)(unsafe.Pointer(&rp.cmClkBuf[bufOffs]))
@@ -107,7 +193,7 @@ func (rp *RPi) InitPWM(freq uint, buf *DMABuf, bytes uint, pins []int) error {
 	time.Sleep(10 * time.Microsecond)
 	log.Printf("Waiting for cmClk busy\n")
 	i := 0
-	for (rp.cmClk.ctl & CM_CLK_CTL_BUSY) == 0 {
+	for !rp.mock && (rp.cmClk.ctl&CM_CLK_CTL_BUSY) == 0 { // The mock's clock never gets busy
 		i++
 	}
 	log.Printf("Done %d\n", i)
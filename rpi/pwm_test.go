@@ -0,0 +1,127 @@
+package rpi
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPWMPins(t *testing.T) {
+	tests := []struct {
+		model   string
+		channel int
+		want    []int
+	}{
+		{"Raspberry Pi 3 Model B Rev 1.2", 0, []int{12, 18}},
+		{"Raspberry Pi 4 Model B Rev 1.4", 1, []int{13, 19}},
+		{"Raspberry Pi Compute Module 4 Rev 1.0", 0, []int{12, 18, 40}},
+		{"Raspberry Pi Compute Module 4 Rev 1.0", 1, []int{13, 19, 41, 45}},
+		{"Raspberry Pi 4 Model B Rev 1.4", 2, nil},
+	}
+	for _, test := range tests {
+		hw, err := hardwareForModel(test.model)
+		if err != nil {
+			t.Fatalf("hardwareForModel(%q): %v", test.model, err)
+		}
+		rp := &RPi{hw: hw}
+		if got := rp.PWMPins(test.channel); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s PWMPins(%d) got %v, want %v", test.model, test.channel, got, test.want)
+		}
+	}
+}
+
+func TestCheckPWMPins(t *testing.T) {
+	rp := NewMockRPi()
+	tests := []struct {
+		pins []int
+		want string
+	}{
+		{[]int{18}, ""},
+		{[]int{12, 13}, ""},
+		{[]int{17}, "valid pins are [12 18]"},
+		{[]int{18, 12}, "PWM channel 1"},
+		{[]int{40}, "GPIO pin 40"},
+		{nil, "need 1 to 2"},
+		{[]int{12, 13, 18}, "need 1 to 2"},
+	}
+	for _, test := range tests {
+		err := rp.CheckPWMPins(test.pins)
+		if test.want == "" {
+			if err != nil {
+				t.Errorf("CheckPWMPins(%v) got %v, want nil", test.pins, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("CheckPWMPins(%v) got %v, want error containing %q", test.pins, err, test.want)
+		}
+	}
+}
+
+func TestCheckDMAChannel(t *testing.T) {
+	tests := []struct {
+		dma     int
+		wantErr bool
+	}{
+		{10, false},
+		{14, false},
+		{0, true},
+		{5, true},
+		{15, true},
+		{-1, true},
+	}
+	for _, test := range tests {
+		if err := CheckDMAChannel(test.dma); (err != nil) != test.wantErr {
+			t.Errorf("CheckDMAChannel(%d) got %v, want error: %v", test.dma, err, test.wantErr)
+		}
+	}
+}
+
+func TestPWMAudioConflict(t *testing.T) {
+	const (
+		headphones = " 0 [Headphones     ]: bcm2835_headpho - bcm2835 Headphones\n" +
+			"                      bcm2835 Headphones\n"
+		hdmiOnly = " 0 [vc4hdmi0       ]: vc4-hdmi - vc4-hdmi-0\n" +
+			"                      vc4-hdmi-0\n"
+		oldALSA   = " 0 [ALSA           ]: bcm2835_alsa - bcm2835 ALSA\n"
+		sndModule = "snd_bcm2835 24576 1 - Live 0x7f5c0000\nsnd_pcm 102400 1 snd_bcm2835, Live 0x7f4f0000\n"
+		noModule  = "snd_pcm 102400 0 - Live 0x7f4f0000\n"
+	)
+	tests := []struct {
+		cards, modules string
+		conflict       bool
+	}{
+		{headphones, sndModule, true},
+		{oldALSA, "", true},
+		{hdmiOnly, sndModule, false},
+		{"", sndModule, true},
+		{"", noModule, false},
+		{"", "", false},
+	}
+	for _, test := range tests {
+		err := pwmAudioConflict(test.cards, test.modules)
+		if got := errors.Is(err, ErrPWMInUse); got != test.conflict {
+			t.Errorf("cards %q, modules %q: got %v, want conflict %v", test.cards, test.modules, err, test.conflict)
+		}
+		if err != nil && !strings.Contains(err.Error(), "dtparam=audio=off") {
+			t.Errorf("error %q doesn't say how to turn the audio off", err)
+		}
+	}
+
+	// CheckPWMAudio reads the files, and a missing one counts as empty.
+	dir := t.TempDir()
+	defer func(cards, modules string) { asoundCardsFile, modulesFile = cards, modules }(asoundCardsFile, modulesFile)
+	asoundCardsFile = filepath.Join(dir, "cards")
+	modulesFile = filepath.Join(dir, "modules")
+	if err := os.WriteFile(modulesFile, []byte(sndModule), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rp := &RPi{}
+	if err := rp.CheckPWMAudio(); !errors.Is(err, ErrPWMInUse) {
+		t.Errorf("CheckPWMAudio got %v, want ErrPWMInUse", err)
+	}
+	if err := NewMockRPi().CheckPWMAudio(); err != nil {
+		t.Errorf("CheckPWMAudio on mock got %v, want nil", err)
+	}
+}
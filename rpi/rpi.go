@@ -1,9 +1,12 @@
 package rpi
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -11,30 +14,56 @@ import (
 )
 
 type RPi struct {
-	mbox     *os.File
-	mboxSize uint32
-	hw       *hw
-	dmaBuf   mmap.MMap
-	dma      *dmaT
-	pwmBuf   mmap.MMap
-	pwm      *pwmT
-	gpioBuf  mmap.MMap
-	gpio     *gpioT
-	cmClkBuf mmap.MMap
-	cmClk    *cmClkT
+	mbox      *os.File
+	mboxPath  string
+	mboxSize  uint32
+	hw        *hw
+	dmaBuf    mmap.MMap
+	dma       *dmaT
+	pwmBuf    mmap.MMap
+	pwm       *pwmT
+	gpioBuf   mmap.MMap
+	gpio      *gpioT
+	cmClkBuf  mmap.MMap
+	cmClk     *cmClkT
+	pcmBuf    mmap.MMap
+	pcm       *pcmT
+	pcmClkBuf mmap.MMap
+	pcmClk    *cmClkT
+	pcmOn     bool
+	mock      bool
+	mockStall bool
+	mockDMAs  int
+	mockSPI   uint32
+}
+
+// RPiConfig is the configuration for NewRPiWithConfig.
+type RPiConfig struct {
+	// MailboxPath is the VideoCore mailbox device to use. If empty, /dev/vcio and then /dev/vc-cma are tried, and
+	// if neither exists, a temporary device node is made.
+	MailboxPath string
 }
 
 func NewRPi() (*RPi, error) {
+	return NewRPiWithConfig(RPiConfig{})
+}
+
+// NewRPiWithConfig is like NewRPi, but with the given configuration.
+func NewRPiWithConfig(config RPiConfig) (*RPi, error) {
+	if os.Getenv(MockEnv) != "" {
+		return NewMockRPi(), nil
+	}
 	hw, err := detectHardware()
 	if err != nil {
-		return nil, fmt.Errorf("couldn't detect RPi hardware: %v", err)
+		return nil, fmt.Errorf("couldn't detect RPi hardware: %w", err)
 	}
 	rp := RPi{
-		hw: hw,
+		hw:       hw,
+		mboxPath: config.MailboxPath,
 	}
 	err = rp.mboxOpen()
 	if err != nil {
-		return nil, fmt.Errorf("couldn't open mailbox: %v", err)
+		return nil, fmt.Errorf("couldn't open mailbox: %w", err)
 	}
 	return &rp, nil
 }
@@ -60,10 +89,55 @@ const (
 	VIDEOCORE_BASE_RPI2 = 0xc0000000
 )
 
+// The files detectHardware looks at.
+var (
+	modelFile   = "/proc/device-tree/model"
+	cpuInfoFile = "/proc/cpuinfo"
+)
+
 // Detect which version of a Raspberry Pi we're running on
 // The original rpihw.c does this in two different ways, one for ARM64 only.
 // My non-64-bit RPis also support the ARM64 way, though, so this implements just that (easier) way.
+// If the model file is missing or has a model we don't know, it falls back to the Revision in
+// /proc/cpuinfo, which minimal images and containers are more likely to have.
 func detectHardware() (*hw, error) {
+	var hw *hw
+	modelb, err := os.ReadFile(modelFile)
+	if err != nil {
+		err = fmt.Errorf("couldn't open model file: %w", err)
+	} else {
+		hw, err = hardwareForModel(string(modelb))
+		if !errors.Is(err, errUnknownModel) {
+			return hw, err
+		}
+	}
+
+	cpuinfo, cerr := os.ReadFile(cpuInfoFile)
+	if cerr != nil {
+		return nil, fmt.Errorf("%w: %v, and couldn't open cpuinfo: %v", ErrNotRaspberryPi, err, cerr)
+	}
+	hw, cerr = hardwareForCPUInfo(string(cpuinfo))
+	if cerr != nil {
+		return nil, fmt.Errorf("%v, and couldn't identify Pi from cpuinfo: %w", err, cerr)
+	}
+	return hw, nil
+}
+
+var (
+	// ErrNotRaspberryPi is returned by NewRPi when the hardware can't be identified as a Raspberry Pi.
+	ErrNotRaspberryPi = errors.New("not a Raspberry Pi")
+	// ErrUnsupportedModel is returned by NewRPi for a Raspberry Pi that's recognized but can't be driven, such as
+	// a Pi 5.
+	ErrUnsupportedModel = errors.New("unsupported Raspberry Pi model")
+	// ErrPermission is os.ErrPermission, which errors from opening or mapping the hardware wrap when the user
+	// isn't allowed to. They also say how to fix it.
+	ErrPermission = os.ErrPermission
+)
+
+var errUnknownModel = errors.New("couldn't identify Pi model")
+
+// hardwareForModel finds the hardware for a model string as found in /proc/device-tree/model.
+func hardwareForModel(model string) (*hw, error) {
 	sortRasPiVariantsOnce.Do(func() {
 		sort.Slice(rasPiVariants, func(i, j int) bool {
 			if len(rasPiVariants[i].name) == len(rasPiVariants[j].name) {
@@ -74,11 +148,13 @@ func detectHardware() (*hw, error) {
 		})
 	})
 
-	modelb, err := os.ReadFile("/proc/device-tree/model")
-	if err != nil {
-		return nil, fmt.Errorf("couldn't open model file: %v", err)
+	// Check these first, so that e.g. "Compute Module 5" doesn't match the original "Compute Module".
+	for _, name := range unsupportedVariants {
+		if strings.HasPrefix(model, name) {
+			return nil, fmt.Errorf("%w: %s not yet supported: its GPIO and PWM are behind the RP1 I/O controller, "+
+				"which this package can't drive", ErrUnsupportedModel, name)
+		}
 	}
-	model := string(modelb)
 
 	for _, rp := range rasPiVariants {
 		if strings.HasPrefix(model, rp.name) {
@@ -86,7 +162,64 @@ func detectHardware() (*hw, error) {
 		}
 	}
 
-	return nil, fmt.Errorf("couldn't identify Pi model %q", model)
+	return nil, fmt.Errorf("%w %q", errUnknownModel, model)
+}
+
+const (
+	revisionNewStyle       = 1 << 23 // the rest of the revision is bit-packed
+	revisionProcessorShift = 12
+	revisionProcessorMask  = 0xf
+)
+
+// hardwareForCPUInfo finds the hardware from the Revision line of /proc/cpuinfo. See
+// https://www.raspberrypi.com/documentation/computers/raspberry-pi.html#raspberry-pi-revision-codes
+func hardwareForCPUInfo(cpuinfo string) (*hw, error) {
+	var revision string
+	sc := bufio.NewScanner(strings.NewReader(cpuinfo))
+	for sc.Scan() {
+		kv := strings.SplitN(sc.Text(), ":", 2)
+		if len(kv) == 2 && strings.TrimSpace(kv[0]) == "Revision" {
+			revision = strings.TrimSpace(kv[1])
+			break
+		}
+	}
+	if revision == "" {
+		return nil, fmt.Errorf("%w: no Revision in cpuinfo", ErrNotRaspberryPi)
+	}
+	code, err := strconv.ParseUint(revision, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse revision %q: %w", revision, err)
+	}
+
+	// Old-style revision codes were only ever used on BCM2835s.
+	processor := uint64(0)
+	if code&revisionNewStyle != 0 {
+		processor = (code >> revisionProcessorShift) & revisionProcessorMask
+	}
+
+	switch processor {
+	case 0: // BCM2835
+		return &hw{RPI_HWVER_TYPE_PI1, PERIPH_BASE_RPI, VIDEOCORE_BASE_RPI, "BCM2835 revision " + revision}, nil
+	case 1: // BCM2836
+		return &hw{RPI_HWVER_TYPE_PI2, PERIPH_BASE_RPI2, VIDEOCORE_BASE_RPI2, "BCM2836 revision " + revision}, nil
+	case 2: // BCM2837
+		return &hw{RPI_HWVER_TYPE_PI2, PERIPH_BASE_RPI2, VIDEOCORE_BASE_RPI2, "BCM2837 revision " + revision}, nil
+	case 3: // BCM2711
+		return &hw{RPI_HWVER_TYPE_PI4, PERIPH_BASE_RPI4, VIDEOCORE_BASE_RPI2, "BCM2711 revision " + revision}, nil
+	case 4: // BCM2712
+		return nil, fmt.Errorf("%w: BCM2712 (Pi 5) revision %s not yet supported", ErrUnsupportedModel, revision)
+	default:
+		return nil, fmt.Errorf("%w: unknown processor %d in revision %s", ErrNotRaspberryPi, processor, revision)
+	}
+}
+
+// unsupportedVariants are models we recognize, but can't drive. The Pi 5 family moved GPIO, PWM and
+// friends out of the SoC into the RP1 chip on the other end of a PCIe link, so there's no periphBase
+// that would work.
+var unsupportedVariants = []string{
+	"Raspberry Pi 5",
+	"Raspberry Pi 500",
+	"Raspberry Pi Compute Module 5",
 }
 
 var sortRasPiVariantsOnce sync.Once
@@ -99,6 +232,12 @@ var rasPiVariants = []hw{
 		vcBase:     VIDEOCORE_BASE_RPI,
 		name:       "Raspberry Pi Model B",
 	},
+	{
+		hwType:     RPI_HWVER_TYPE_PI1,
+		periphBase: PERIPH_BASE_RPI,
+		vcBase:     VIDEOCORE_BASE_RPI,
+		name:       "Raspberry Pi Model A",
+	},
 	{
 		hwType:     RPI_HWVER_TYPE_PI1,
 		periphBase: PERIPH_BASE_RPI,
@@ -111,12 +250,24 @@ var rasPiVariants = []hw{
 		vcBase:     VIDEOCORE_BASE_RPI,
 		name:       "Raspberry Pi Zero W",
 	},
+	{
+		hwType:     RPI_HWVER_TYPE_PI1,
+		periphBase: PERIPH_BASE_RPI,
+		vcBase:     VIDEOCORE_BASE_RPI,
+		name:       "Raspberry Pi Zero",
+	},
 	{
 		hwType:     RPI_HWVER_TYPE_PI2,
 		periphBase: PERIPH_BASE_RPI2,
 		vcBase:     VIDEOCORE_BASE_RPI2,
 		name:       "Raspberry Pi 2 Model B",
 	},
+	{
+		hwType:     RPI_HWVER_TYPE_PI2,
+		periphBase: PERIPH_BASE_RPI2,
+		vcBase:     VIDEOCORE_BASE_RPI2,
+		name:       "Raspberry Pi Zero 2 W",
+	},
 	{
 		hwType:     RPI_HWVER_TYPE_PI2,
 		periphBase: PERIPH_BASE_RPI2,
@@ -141,10 +292,28 @@ var rasPiVariants = []hw{
 		vcBase:     VIDEOCORE_BASE_RPI2,
 		name:       "Raspberry Pi 3 Model B Plus",
 	},
+	{
+		hwType:     RPI_HWVER_TYPE_PI2,
+		periphBase: PERIPH_BASE_RPI2,
+		vcBase:     VIDEOCORE_BASE_RPI2,
+		name:       "Raspberry Pi 3 Model A Plus",
+	},
 	{
 		hwType:     RPI_HWVER_TYPE_PI4,
 		periphBase: PERIPH_BASE_RPI4,
 		vcBase:     VIDEOCORE_BASE_RPI2,
 		name:       "Raspberry Pi 4 Model B",
 	},
+	{
+		hwType:     RPI_HWVER_TYPE_PI4,
+		periphBase: PERIPH_BASE_RPI4,
+		vcBase:     VIDEOCORE_BASE_RPI2,
+		name:       "Raspberry Pi Compute Module 4",
+	},
+	{
+		hwType:     RPI_HWVER_TYPE_PI4,
+		periphBase: PERIPH_BASE_RPI4,
+		vcBase:     VIDEOCORE_BASE_RPI2,
+		name:       "Raspberry Pi 400",
+	},
 }
@@ -0,0 +1,162 @@
+package rpi
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestHardwareForModelUnsupported(t *testing.T) {
+	tests := []string{
+		"Raspberry Pi 5 Model B Rev 1.0\x00",
+		"Raspberry Pi 500 Rev 1.0\x00",
+		"Raspberry Pi Compute Module 5 Rev 1.0\x00",
+	}
+
+	for _, model := range tests {
+		_, err := hardwareForModel(model)
+		if err == nil {
+			t.Errorf("%q: got no error", model)
+			continue
+		}
+		if !strings.Contains(err.Error(), "not yet supported") {
+			t.Errorf("%q: got: %v, want a not yet supported error", model, err)
+		}
+	}
+}
+
+func TestHardwareForModel(t *testing.T) {
+	tests := []struct {
+		model      string
+		hwType     int
+		periphBase uintptr
+		name       string
+	}{
+		{"Raspberry Pi Model B Rev 2\x00", RPI_HWVER_TYPE_PI1, PERIPH_BASE_RPI, "Raspberry Pi Model B"},
+		{"Raspberry Pi Model A Plus Rev 1.1\x00", RPI_HWVER_TYPE_PI1, PERIPH_BASE_RPI, "Raspberry Pi Model A"},
+		{"Raspberry Pi Zero Rev 1.3\x00", RPI_HWVER_TYPE_PI1, PERIPH_BASE_RPI, "Raspberry Pi Zero"},
+		{"Raspberry Pi Zero W Rev 1.1\x00", RPI_HWVER_TYPE_PI1, PERIPH_BASE_RPI, "Raspberry Pi Zero W"},
+		{"Raspberry Pi Zero 2 W Rev 1.0\x00", RPI_HWVER_TYPE_PI2, PERIPH_BASE_RPI2, "Raspberry Pi Zero 2 W"},
+		{"Raspberry Pi 3 Model A Plus Rev 1.0\x00", RPI_HWVER_TYPE_PI2, PERIPH_BASE_RPI2, "Raspberry Pi 3 Model A Plus"},
+		{"Raspberry Pi 3 Model B Plus Rev 1.3\x00", RPI_HWVER_TYPE_PI2, PERIPH_BASE_RPI2, "Raspberry Pi 3 Model B Plus"},
+		{"Raspberry Pi 4 Model B Rev 1.4\x00", RPI_HWVER_TYPE_PI4, PERIPH_BASE_RPI4, "Raspberry Pi 4 Model B"},
+		{"Raspberry Pi Compute Module Rev 1.0\x00", RPI_HWVER_TYPE_PI1, PERIPH_BASE_RPI, "Raspberry Pi Compute Module"},
+		{"Raspberry Pi Compute Module 3 Plus Rev 1.0\x00", RPI_HWVER_TYPE_PI2, PERIPH_BASE_RPI2, "Raspberry Pi Compute Module 3 Plus"},
+		{"Raspberry Pi Compute Module 4 Rev 1.0\x00", RPI_HWVER_TYPE_PI4, PERIPH_BASE_RPI4, "Raspberry Pi Compute Module 4"},
+		{"Raspberry Pi 400 Rev 1.0\x00", RPI_HWVER_TYPE_PI4, PERIPH_BASE_RPI4, "Raspberry Pi 400"},
+	}
+
+	for _, test := range tests {
+		hw, err := hardwareForModel(test.model)
+		if err != nil {
+			t.Errorf("%q: got error %v", test.model, err)
+			continue
+		}
+		if hw.hwType != test.hwType || hw.periphBase != test.periphBase || hw.name != test.name {
+			t.Errorf("%q got: type %d, base %08X, name %q, want: type %d, base %08X, name %q",
+				test.model, hw.hwType, hw.periphBase, hw.name, test.hwType, test.periphBase, test.name)
+		}
+	}
+}
+
+func TestHardwareForCPUInfo(t *testing.T) {
+	const cpuinfo = `processor	: 0
+BogoMIPS	: 38.40
+Features	: fp asimd evtstrm crc32 cpuid
+CPU implementer	: 0x41
+
+Hardware	: BCM2835
+Revision	: %s
+Serial		: 00000000deadbeef
+Model		: Raspberry Pi 3 Model B Rev 1.2
+`
+	tests := []struct {
+		revision   string
+		hwType     int
+		periphBase uintptr
+		wantErr    bool
+	}{
+		{"000e", RPI_HWVER_TYPE_PI1, PERIPH_BASE_RPI, false},     // 1 B
+		{"900093", RPI_HWVER_TYPE_PI1, PERIPH_BASE_RPI, false},   // Zero
+		{"a01041", RPI_HWVER_TYPE_PI2, PERIPH_BASE_RPI2, false},  // 2 B
+		{"a02082", RPI_HWVER_TYPE_PI2, PERIPH_BASE_RPI2, false},  // 3 B
+		{"1a02082", RPI_HWVER_TYPE_PI2, PERIPH_BASE_RPI2, false}, // 3 B, warranty voided
+		{"c03114", RPI_HWVER_TYPE_PI4, PERIPH_BASE_RPI4, false},  // 4 B
+		{"c04170", RPI_HWVER_TYPE_UNKNOWN, 0, true},              // 5
+		{"zzz", RPI_HWVER_TYPE_UNKNOWN, 0, true},
+	}
+
+	for _, test := range tests {
+		hw, err := hardwareForCPUInfo(strings.Replace(cpuinfo, "%s", test.revision, 1))
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: got err %v, wantErr %v", test.revision, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if hw.hwType != test.hwType || hw.periphBase != test.periphBase {
+			t.Errorf("%s got: type %d, base %08X, want: type %d, base %08X",
+				test.revision, hw.hwType, hw.periphBase, test.hwType, test.periphBase)
+		}
+	}
+
+	if _, err := hardwareForCPUInfo("processor\t: 0\n"); err == nil {
+		t.Errorf("cpuinfo without Revision got no error")
+	}
+}
+
+func TestHardwareErrors(t *testing.T) {
+	cpuinfo := func(revision string) string { return "processor\t: 0\nRevision\t: " + revision + "\n" }
+	tests := []struct {
+		name string
+		err  func() error
+		want error
+	}{
+		{"Pi 5 model", func() error { _, err := hardwareForModel("Raspberry Pi 5 Model B Rev 1.0\x00"); return err }, ErrUnsupportedModel},
+		{"Pi 5 revision", func() error { _, err := hardwareForCPUInfo(cpuinfo("c04170")); return err }, ErrUnsupportedModel},
+		{"unknown processor", func() error { _, err := hardwareForCPUInfo(cpuinfo("a0f082")); return err }, ErrNotRaspberryPi},
+		{"no revision", func() error { _, err := hardwareForCPUInfo("processor\t: 0\n"); return err }, ErrNotRaspberryPi},
+		{"permission", func() error {
+			denyOpen(t, syscall.EACCES)
+			_, _, err := (&RPi{}).mapFile(MEM_FILE, 0, 4)
+			return err
+		}, ErrPermission},
+	}
+	for _, test := range tests {
+		if err := test.err(); !errors.Is(err, test.want) {
+			t.Errorf("%s: got %v, want it to wrap %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestDetectHardwareFallbackErrors(t *testing.T) {
+	dir := t.TempDir()
+	defer func(model, cpuinfo string) { modelFile, cpuInfoFile = model, cpuinfo }(modelFile, cpuInfoFile)
+	modelFile = filepath.Join(dir, "model")
+	cpuInfoFile = filepath.Join(dir, "cpuinfo")
+	if err := os.WriteFile(modelFile, []byte("Banana Pi\x00"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// An unknown model with no cpuinfo says what was wrong with both.
+	_, err := detectHardware()
+	if !errors.Is(err, ErrNotRaspberryPi) {
+		t.Errorf("got %v, want it to wrap %v", err, ErrNotRaspberryPi)
+	}
+	if msg := err.Error(); !strings.Contains(msg, errUnknownModel.Error()) || strings.Contains(msg, "<nil>") {
+		t.Errorf("error %q doesn't say the model is unknown", msg)
+	}
+
+	// The same goes for cpuinfo without a Revision.
+	if err := os.WriteFile(cpuInfoFile, []byte("processor\t: 0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = detectHardware()
+	if msg := err.Error(); !strings.Contains(msg, errUnknownModel.Error()) || strings.Contains(msg, "<nil>") {
+		t.Errorf("error %q doesn't say the model is unknown", msg)
+	}
+}
@@ -1,10 +1,54 @@
 package rpi
 
+import (
+	"fmt"
+)
+
+// These are from include/uapi/linux/spi/spidev.h.
 const (
-	SPI_IOC_MAGIC           = 'k'
-	SPI_IOC_WR_MAX_SPEED_HZ = 4
+	SPI_IOC_MAGIC            = 'k'
+	SPI_IOC_WR_MODE          = 1
+	SPI_IOC_WR_BITS_PER_WORD = 3
+	SPI_IOC_WR_MAX_SPEED_HZ  = 4
+	SPI_IOC_RD_MAX_SPEED_HZ  = 4
+
+	SPI_MODE_0 = 0
 )
 
 func (rp *RPi) SetSPISpeed(fd uintptr, s uint32) error {
-	return ioctlUint32(fd, iow(SPI_IOC_MAGIC, SPI_IOC_WR_MAX_SPEED_HZ, uintptr(0)), s)
+	if rp.mock {
+		rp.mockSPI = s
+		return nil
+	}
+	return ioctlUint32(fd, iow(SPI_IOC_MAGIC, SPI_IOC_WR_MAX_SPEED_HZ, uint32(0)), s)
+}
+
+// SPISpeed returns the maximum speed in Hz that the SPI device open on fd is set to, which may not
+// be what was last given to SetSPISpeed if the driver adjusted it. A mock returns the last speed
+// given to SetSPISpeed.
+func (rp *RPi) SPISpeed(fd uintptr) (uint32, error) {
+	if rp.mock {
+		return rp.mockSPI, nil
+	}
+	return ioctlReadUint32(fd, ior(SPI_IOC_MAGIC, SPI_IOC_RD_MAX_SPEED_HZ, uint32(0)))
+}
+
+// ConfigureSPI sets the mode, bits per word and maximum speed in Hz of the SPI device open on fd. If
+// speed is zero, the device's speed is left alone.
+func ConfigureSPI(fd uintptr, mode uint8, bits uint8, speed uint32) error {
+	err := ioctlUint8(fd, iow(SPI_IOC_MAGIC, SPI_IOC_WR_MODE, uint8(0)), mode)
+	if err != nil {
+		return fmt.Errorf("couldn't set SPI mode %d: %w", mode, err)
+	}
+	err = ioctlUint8(fd, iow(SPI_IOC_MAGIC, SPI_IOC_WR_BITS_PER_WORD, uint8(0)), bits)
+	if err != nil {
+		return fmt.Errorf("couldn't set SPI bits per word %d: %w", bits, err)
+	}
+	if speed != 0 {
+		err = ioctlUint32(fd, iow(SPI_IOC_MAGIC, SPI_IOC_WR_MAX_SPEED_HZ, uint32(0)), speed)
+		if err != nil {
+			return fmt.Errorf("couldn't set SPI speed %d: %w", speed, err)
+		}
+	}
+	return nil
 }
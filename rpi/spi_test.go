@@ -0,0 +1,45 @@
+package rpi
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestConfigureSPINotSPI(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "spidev0.0"))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	defer f.Close()
+
+	// A plain file gets as far as the kernel, which rejects the ioctl.
+	err = ConfigureSPI(f.Fd(), SPI_MODE_0, 8, 1000000)
+	if err == nil {
+		t.Fatalf("ConfigureSPI on a plain file succeeded, want error")
+	}
+	if want := syscall.ENOTTY.Error(); !strings.Contains(err.Error(), want) {
+		t.Errorf("ConfigureSPI got %v, want %q", err, want)
+	}
+}
+
+func TestSPISpeed(t *testing.T) {
+	rp := NewMockRPi()
+	if err := rp.SetSPISpeed(0, 8000000); err != nil {
+		t.Fatalf("SetSPISpeed: %v", err)
+	}
+	if got, err := rp.SPISpeed(0); err != nil || got != 8000000 {
+		t.Errorf("mock SPISpeed got %d, %v, want 8000000", got, err)
+	}
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "spidev0.0"))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	defer f.Close()
+	if _, err := (&RPi{}).SPISpeed(f.Fd()); err != syscall.ENOTTY {
+		t.Errorf("SPISpeed on a plain file got %v, want %v", err, syscall.ENOTTY)
+	}
+}
@@ -0,0 +1,185 @@
+// Package sacn receives E1.31 (Streaming ACN, or sACN), as sent by lighting
+// software such as xLights and QLC+, and shows it on a strip.
+package sacn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/mxcu/ledctl"
+)
+
+// Port is the UDP port E1.31 is sent to.
+const Port = 5568
+
+const (
+	vectorRootData     = 0x00000004
+	vectorFramingData  = 0x00000002
+	vectorDMPSetProp   = 0x02
+	dmpAddressDataType = 0xa1
+
+	optionPreview    = 1 << 7
+	optionTerminated = 1 << 6
+
+	headerSize = 126 // Up to and including the DMX start code
+	maxSlots   = 512
+)
+
+var acnPacketIdentifier = []byte("ASC-E1.17\x00\x00\x00")
+
+// Packet is an E1.31 data packet.
+type Packet struct {
+	// SourceName is the name the sender gave itself.
+	SourceName string
+	// Priority is the sender's priority, from 0 to 200.
+	Priority uint8
+	// Sequence is the sequence number, which goes up by one with every
+	// packet the sender sends to the universe.
+	Sequence uint8
+	// Preview is set if the data is only meant for visualizers.
+	Preview bool
+	// Terminated is set if the sender is stopping sending to the universe.
+	Terminated bool
+	// Universe is the DMX universe the data is for.
+	Universe uint16
+	// StartCode is the DMX start code. 0 is ordinary level data.
+	StartCode uint8
+	// Data is the DMX slots, without the start code.
+	Data []byte
+}
+
+// ParsePacket parses an E1.31 data packet. Data refers to b, rather than
+// being a copy.
+func ParsePacket(b []byte) (*Packet, error) {
+	if len(b) < headerSize {
+		return nil, fmt.Errorf("packet too short at %d bytes", len(b))
+	}
+	if binary.BigEndian.Uint16(b[0:]) != 0x0010 || !bytes.Equal(b[4:16], acnPacketIdentifier) {
+		return nil, errors.New("not an ACN packet")
+	}
+	if v := binary.BigEndian.Uint32(b[18:]); v != vectorRootData {
+		return nil, fmt.Errorf("unsupported root vector %#x", v)
+	}
+	if v := binary.BigEndian.Uint32(b[40:]); v != vectorFramingData {
+		return nil, fmt.Errorf("unsupported framing vector %#x", v)
+	}
+	if b[117] != vectorDMPSetProp || b[118] != dmpAddressDataType {
+		return nil, fmt.Errorf("unsupported DMP vector %#x or address type %#x", b[117], b[118])
+	}
+	count := int(binary.BigEndian.Uint16(b[123:]))
+	if count < 1 || count > maxSlots+1 || headerSize-1+count > len(b) {
+		return nil, fmt.Errorf("invalid property value count %d for %d byte packet", count, len(b))
+	}
+
+	name := b[44:108]
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	return &Packet{
+		SourceName: string(name),
+		Priority:   b[108],
+		Sequence:   b[111],
+		Preview:    b[112]&optionPreview != 0,
+		Terminated: b[112]&optionTerminated != 0,
+		Universe:   binary.BigEndian.Uint16(b[113:]),
+		StartCode:  b[125],
+		Data:       b[headerSize : headerSize-1+count],
+	}, nil
+}
+
+// MulticastAddr returns the multicast address that E1.31 for universe is sent
+// to.
+func MulticastAddr(universe uint16) *net.UDPAddr {
+	return &net.UDPAddr{IP: net.IPv4(239, 255, byte(universe>>8), byte(universe)), Port: Port}
+}
+
+// Receiver shows the E1.31 data for one universe on a strip, three DMX slots
+// per RGB pixel.
+type Receiver struct {
+	universe  uint16
+	strip     ledctl.Strip
+	numPixels int
+	started   bool
+	sequence  uint8
+	lost      int
+}
+
+// NewReceiver creates a Receiver for the given universe.
+func NewReceiver(universe uint16, strip ledctl.Strip) *Receiver {
+	return &Receiver{universe: universe, strip: strip, numPixels: strip.NumPixels()}
+}
+
+// Lost returns how many packets have gone missing so far, going by the gaps
+// in the sequence numbers.
+func (r *Receiver) Lost() int {
+	return r.lost
+}
+
+// Handle shows the data from an E1.31 packet and flushes the strip. Packets
+// for other universes, preview data, data with a non-zero start code and
+// packets that arrive out of order are ignored.
+func (r *Receiver) Handle(b []byte) error {
+	p, err := ParsePacket(b)
+	if err != nil {
+		return err
+	}
+	return r.show(p)
+}
+
+func (r *Receiver) show(p *Packet) error {
+	if p.Universe != r.universe || p.Preview || p.Terminated || p.StartCode != 0 {
+		return nil
+	}
+
+	if r.started {
+		// E1.31 section 6.7.2: a packet up to 20 behind the last one is out of order.
+		diff := int8(p.Sequence - r.sequence)
+		if diff <= 0 && diff > -20 {
+			return nil
+		}
+		if diff > 1 {
+			r.lost += int(diff) - 1
+		}
+	}
+	r.started = true
+	r.sequence = p.Sequence
+
+	for i := 0; i < r.numPixels && 3*i+2 < len(p.Data); i++ {
+		r.strip.SetRGBAt(i, ledctl.RGB{R: p.Data[3*i], G: p.Data[3*i+1], B: p.Data[3*i+2]})
+	}
+	return r.strip.Flush()
+}
+
+// Serve handles every packet read from conn, until reading from it or
+// flushing the strip fails. Packets that can't be parsed are skipped.
+func (r *Receiver) Serve(conn net.PacketConn) error {
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		p, err := ParsePacket(buf[:n])
+		if err != nil {
+			continue
+		}
+		if err := r.show(p); err != nil {
+			return err
+		}
+	}
+}
+
+// ListenE1_31 joins the multicast group for universe and shows everything
+// received for it on strip, until something goes wrong.
+func ListenE1_31(universe uint16, strip ledctl.Strip) error {
+	r := NewReceiver(universe, strip)
+	conn, err := net.ListenMulticastUDP("udp4", nil, MulticastAddr(universe))
+	if err != nil {
+		return fmt.Errorf("couldn't join universe %d: %v", universe, err)
+	}
+	defer conn.Close()
+	return r.Serve(conn)
+}
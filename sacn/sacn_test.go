@@ -0,0 +1,122 @@
+package sacn
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mxcu/ledctl"
+)
+
+// testPacket is an E1.31 packet for universe 1 with sequence number 7 and six
+// slots of data, laid out like a capture from xLights.
+var testPacket = []byte{
+	// Root layer
+	0x00, 0x10, 0x00, 0x00, // Preamble and postamble size
+	'A', 'S', 'C', '-', 'E', '1', '.', '1', '7', 0x00, 0x00, 0x00, // ACN packet identifier
+	0x70, 0x74, // Flags and length
+	0x00, 0x00, 0x00, 0x04, // Vector
+	0x2d, 0xd3, 0x39, 0x1c, 0x53, 0x8e, 0x4a, 0x5c, 0x8f, 0x8b, 0x76, 0x01, 0x19, 0xd0, 0x9d, 0x8e, // CID
+
+	// Framing layer
+	0x70, 0x5e, // Flags and length
+	0x00, 0x00, 0x00, 0x02, // Vector
+	'x', 'L', 'i', 'g', 'h', 't', 's', 0, 0, 0, 0, 0, 0, 0, 0, 0, // Source name
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	100,        // Priority
+	0x00, 0x00, // Synchronization address
+	7,          // Sequence number
+	0x00,       // Options
+	0x00, 0x01, // Universe
+
+	// DMP layer
+	0x70, 0x11, // Flags and length
+	0x02,       // Vector
+	0xa1,       // Address type and data type
+	0x00, 0x00, // First property address
+	0x00, 0x01, // Address increment
+	0x00, 0x07, // Property value count
+	0x00,                               // DMX start code
+	0xff, 0x80, 0x00, 0x01, 0x02, 0x03, // Slots
+}
+
+func TestParsePacket(t *testing.T) {
+	p, err := ParsePacket(testPacket)
+	if err != nil {
+		t.Fatalf("ParsePacket: %v", err)
+	}
+	if p.SourceName != "xLights" || p.Priority != 100 || p.Sequence != 7 || p.Universe != 1 || p.StartCode != 0 {
+		t.Errorf("got %+v", p)
+	}
+	if want := []byte{0xff, 0x80, 0x00, 0x01, 0x02, 0x03}; !bytes.Equal(p.Data, want) {
+		t.Errorf("Data got % X, want % X", p.Data, want)
+	}
+}
+
+func TestParsePacketInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(b []byte) []byte
+	}{
+		{"short", func(b []byte) []byte { return b[:100] }},
+		{"identifier", func(b []byte) []byte { b[4] = 'X'; return b }},
+		{"root vector", func(b []byte) []byte { b[21] = 0x08; return b }},
+		{"framing vector", func(b []byte) []byte { b[43] = 0x01; return b }},
+		{"count", func(b []byte) []byte { b[124] = 0x20; return b }},
+	}
+	for _, test := range tests {
+		b := test.modify(append([]byte(nil), testPacket...))
+		if _, err := ParsePacket(b); err == nil {
+			t.Errorf("%s: ParsePacket succeeded, want error", test.name)
+		}
+	}
+}
+
+// withSequence returns a copy of testPacket with the given sequence number.
+func withSequence(seq uint8) []byte {
+	b := append([]byte(nil), testPacket...)
+	b[111] = seq
+	return b
+}
+
+func TestReceiver(t *testing.T) {
+	strip := ledctl.NullStrip(3, 3)
+	r := NewReceiver(1, strip)
+	if err := r.Handle(testPacket); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	want := []ledctl.RGB{{R: 0xff, G: 0x80}, {R: 1, G: 2, B: 3}, {}}
+	for i := range want {
+		if strip.RGBAt(i) != want[i] {
+			t.Errorf("pixel %d got %v, want %v", i, strip.RGBAt(i), want[i])
+		}
+	}
+
+	for _, seq := range []uint8{6, 7, 10, 11} {
+		if err := r.Handle(withSequence(seq)); err != nil {
+			t.Fatalf("Handle: %v", err)
+		}
+	}
+	// 6 and 7 are out of order, and 8 and 9 went missing.
+	if got, want := strip.Flushes(), 3; got != want {
+		t.Errorf("got %d flushes, want %d", got, want)
+	}
+	if got, want := r.Lost(), 2; got != want {
+		t.Errorf("Lost() got %d, want %d", got, want)
+	}
+
+	other := NewReceiver(2, strip)
+	if err := other.Handle(testPacket); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if got, want := strip.Flushes(), 3; got != want {
+		t.Errorf("packet for another universe flushed")
+	}
+}
+
+func TestMulticastAddr(t *testing.T) {
+	if got, want := MulticastAddr(0x0102).String(), "239.255.1.2:5568"; got != want {
+		t.Errorf("MulticastAddr got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,135 @@
+package ledctl
+
+import (
+	"fmt"
+)
+
+// Segment is a view of a range of pixels in a parent Strip, addressed from 0.
+type Segment struct {
+	parent Strip
+	start  int
+	length int
+}
+
+var _ Strip = (*Segment)(nil)
+
+// NewSegment creates a Segment of length pixels starting at start in parent.
+// It returns ErrIndexOutOfRange if they don't fit in parent.
+func NewSegment(parent Strip, start, length int) (*Segment, error) {
+	if n := parent.NumPixels(); start < 0 || length < 0 || start > n || length > n-start {
+		return nil, fmt.Errorf("segment [%d, %d) doesn't fit in %d pixels: %w", start, start+length, n, ErrIndexOutOfRange)
+	}
+	return &Segment{parent: parent, start: start, length: length}, nil
+}
+
+// Len returns the number of pixels in the segment.
+func (s *Segment) Len() int {
+	return s.length
+}
+
+// NumPixels returns the number of pixels in the segment, like Len.
+func (s *Segment) NumPixels() int {
+	return s.length
+}
+
+// Start returns the index in the parent of the first pixel in the segment.
+func (s *Segment) Start() int {
+	return s.start
+}
+
+// Parent returns the strip the segment is a view of.
+func (s *Segment) Parent() Strip {
+	return s.parent
+}
+
+func (s *Segment) inRange(i int) bool {
+	return i >= 0 && i < s.length
+}
+
+// RGBAt returns the RGB pixel at the given index in the segment. Indexes
+// outside the segment return black.
+func (s *Segment) RGBAt(i int) RGB {
+	if !s.inRange(i) {
+		return RGB{}
+	}
+	return s.parent.RGBAt(s.start + i)
+}
+
+// SetRGBAt sets the RGB pixel at the given index in the segment. Indexes
+// outside the segment are ignored.
+func (s *Segment) SetRGBAt(i int, rgb RGB) {
+	if s.inRange(i) {
+		s.parent.SetRGBAt(s.start+i, rgb)
+	}
+}
+
+// RGBAtChecked is like RGBAt, but returns ErrIndexOutOfRange if i is outside
+// the segment.
+func (s *Segment) RGBAtChecked(i int) (RGB, error) {
+	if err := checkIndex(i, s.length); err != nil {
+		return RGB{}, err
+	}
+	return s.parent.RGBAt(s.start + i), nil
+}
+
+// SetRGBAtChecked is like SetRGBAt, but returns ErrIndexOutOfRange if i is
+// outside the segment.
+func (s *Segment) SetRGBAtChecked(i int, rgb RGB) error {
+	if err := checkIndex(i, s.length); err != nil {
+		return err
+	}
+	s.parent.SetRGBAt(s.start+i, rgb)
+	return nil
+}
+
+// RGBWAt returns the RGBW pixel at the given index in the segment. Indexes
+// outside the segment return black.
+func (s *Segment) RGBWAt(i int) RGBW {
+	if !s.inRange(i) {
+		return RGBW{}
+	}
+	return s.parent.RGBWAt(s.start + i)
+}
+
+// SetRGBWAt sets the RGBW pixel at the given index in the segment. Indexes
+// outside the segment are ignored.
+func (s *Segment) SetRGBWAt(i int, rgbw RGBW) {
+	if s.inRange(i) {
+		s.parent.SetRGBWAt(s.start+i, rgbw)
+	}
+}
+
+// SetRGBs sets the RGB pixels of the segment to the given values.
+func (s *Segment) SetRGBs(pixels []RGB) {
+	if len(pixels) != s.length {
+		panic("SetRGBs called with wrong number of pixels")
+	}
+	for i, p := range pixels {
+		s.parent.SetRGBAt(s.start+i, p)
+	}
+}
+
+// SetRGBWs sets the RGBW pixels of the segment to the given values.
+func (s *Segment) SetRGBWs(pixels []RGBW) {
+	if len(pixels) != s.length {
+		panic("SetRGBWs called with wrong number of pixels")
+	}
+	for i, p := range pixels {
+		s.parent.SetRGBWAt(s.start+i, p)
+	}
+}
+
+// Flush flushes the whole parent strip, including pixels outside the segment.
+func (s *Segment) Flush() error {
+	return s.parent.Flush()
+}
+
+// Close does nothing: the parent strip has to be closed by its owner.
+func (s *Segment) Close() error {
+	return nil
+}
+
+// MaxLEDsPerChannel returns the parent's MaxLEDsPerChannel.
+func (s *Segment) MaxLEDsPerChannel() int {
+	return s.parent.MaxLEDsPerChannel()
+}
@@ -0,0 +1,49 @@
+package ledctl
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestSegment(t *testing.T) {
+	ws := testWS281x(WS281xConfig{NumPixels: 10, ColorModel: RGBModel})
+	seg, err := ws.Segment(3, 4)
+	if err != nil {
+		t.Fatalf("Segment: %v", err)
+	}
+
+	seg.SetRGBAt(0, RGB{1, 1, 1})
+	seg.SetRGBAt(3, RGB{2, 2, 2})
+	seg.SetRGBAt(4, RGB{9, 9, 9})  // Out of range, ignored
+	seg.SetRGBAt(-1, RGB{9, 9, 9}) // Out of range, ignored
+	want := map[int]RGB{3: {1, 1, 1}, 6: {2, 2, 2}}
+	for i := 0; i < 10; i++ {
+		if got := ws.RGBAt(i); got != want[i] {
+			t.Errorf("RGBAt(%d) got: %v, want: %v", i, got, want[i])
+		}
+	}
+	if got, want := seg.RGBAt(3), (RGB{2, 2, 2}); got != want {
+		t.Errorf("segment RGBAt(3) got: %v, want: %v", got, want)
+	}
+
+	seg.SetRGBs([]RGB{{5, 5, 5}, {6, 6, 6}, {7, 7, 7}, {8, 8, 8}})
+	if got, want := ws.RGBAt(5), (RGB{7, 7, 7}); got != want {
+		t.Errorf("after SetRGBs, RGBAt(5) got: %v, want: %v", got, want)
+	}
+	if err := seg.SetRGBAtChecked(4, RGB{}); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Errorf("SetRGBAtChecked(4) got: %v, want: %v", err, ErrIndexOutOfRange)
+	}
+
+	if _, err := ws.Segment(8, 3); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Errorf("Segment(8, 3) got: %v, want: %v", err, ErrIndexOutOfRange)
+	}
+	for _, r := range [][2]int{{-1, 2}, {11, 0}, {2, -1}, {0, 11}, {5, math.MaxInt}} {
+		if _, err := NewSegment(NullStrip(10, 3), r[0], r[1]); !errors.Is(err, ErrIndexOutOfRange) {
+			t.Errorf("NewSegment(%d, %d) got: %v, want: %v", r[0], r[1], err, ErrIndexOutOfRange)
+		}
+	}
+	if _, err := NewSegment(NullStrip(10, 3), 10, 0); err != nil {
+		t.Errorf("NewSegment(10, 0): %v", err)
+	}
+}
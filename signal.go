@@ -0,0 +1,50 @@
+package ledctl
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// CleanupOnSignal blanks and closes strip when the process gets one of
+// signals, then raises the signal again, so that the process still ends the
+// way it would have, just without leaving the LEDs lit. With no signals, it
+// uses SIGINT and SIGTERM.
+func CleanupOnSignal(strip Strip, signals ...os.Signal) {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	go func() {
+		sig := <-ch
+		// The process is going away, so there's nobody to tell if this fails.
+		blankAndClose(strip)
+		signal.Reset(signals...)
+		if p, err := os.FindProcess(os.Getpid()); err == nil {
+			p.Signal(sig)
+		}
+	}()
+}
+
+// blankAndClose turns off all the pixels of strip, flushes them, and closes
+// it. Strips are blanked with their Clear method if they have one, or else
+// pixel by pixel.
+func blankAndClose(strip Strip) error {
+	if s, ok := strip.(interface{ Clear() }); ok {
+		s.Clear()
+	} else {
+		for i := 0; i < strip.NumPixels(); i++ {
+			strip.SetRGBWAt(i, RGBW{})
+		}
+	}
+	ferr := strip.Flush()
+	if err := strip.Close(); err != nil {
+		return fmt.Errorf("couldn't close strip: %w", err)
+	}
+	if ferr != nil {
+		return fmt.Errorf("couldn't flush blank frame: %w", ferr)
+	}
+	return nil
+}
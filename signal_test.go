@@ -0,0 +1,76 @@
+package ledctl
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	rpi "github.com/mxcu/ledctl/rpi"
+)
+
+func TestBlankAndClose(t *testing.T) {
+	ws, err := NewWS281xWithRPi(rpi.NewMockRPi(), DefaultWS281xConfig(3))
+	if err != nil {
+		t.Fatalf("NewWS281xWithRPi: %v", err)
+	}
+	ws.Fill(RGB{10, 20, 30})
+	if err := ws.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	if err := blankAndClose(ws); err != nil {
+		t.Fatalf("blankAndClose: %v", err)
+	}
+	if got, want := decodeWS281x(ws), make([]byte, 9); !bytes.Equal(got, want) {
+		t.Errorf("sent %v, want %v", got, want)
+	}
+	if !ws.closed {
+		t.Errorf("strip wasn't closed")
+	}
+
+	ts, err := NewTermStrip(TermStripConfig{Writer: &bytes.Buffer{}, NumPixels: 2, Plain: true})
+	if err != nil {
+		t.Fatalf("NewTermStrip: %v", err)
+	}
+	ts.SetRGBAt(1, RGB{1, 2, 3})
+	if err := blankAndClose(ts); err != nil {
+		t.Fatalf("blankAndClose: %v", err)
+	}
+	if got := ts.RGBWAt(1); got != (RGBW{}) {
+		t.Errorf("TermStrip pixel got %v, want black", got)
+	}
+}
+
+func TestCleanupOnSignal(t *testing.T) {
+	ws, err := NewWS281xWithRPi(rpi.NewMockRPi(), DefaultWS281xConfig(3))
+	if err != nil {
+		t.Fatalf("NewWS281xWithRPi: %v", err)
+	}
+	ws.Fill(RGB{10, 20, 30})
+	if err := ws.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	// SIGWINCH is ignored by default, so raising it again doesn't end the test.
+	CleanupOnSignal(ws, syscall.SIGWINCH)
+	if err := syscall.Kill(os.Getpid(), syscall.SIGWINCH); err != nil {
+		t.Fatalf("Kill: %v", err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		ws.mu.RLock()
+		closed := ws.closed
+		ws.mu.RUnlock()
+		if closed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("strip wasn't closed after the signal")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got, want := decodeWS281x(ws), make([]byte, 9); !bytes.Equal(got, want) {
+		t.Errorf("sent %v, want %v", got, want)
+	}
+}
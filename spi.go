@@ -0,0 +1,64 @@
+package ledctl
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+
+	rpi "github.com/mxcu/ledctl/rpi"
+)
+
+// OpenSPI opens the SPI device at path, usually "/dev/spidev0.0", and sets it
+// up for LED strips: mode 0, 8 bits per word and the given speed in Hz. If
+// speed is zero, the device's speed is left alone. The Device it returns can
+// be used in the configs of the SPI controllers.
+func OpenSPI(path string, speed uint32) (Device, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, spiOpenError(err)
+	}
+	err = rpi.ConfigureSPI(f.Fd(), rpi.SPI_MODE_0, 8, speed)
+	if err != nil {
+		f.Close() // Ignore error
+		return nil, fmt.Errorf("couldn't configure %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// spiOpenError wraps an error from opening an SPI device, with a hint if it's
+// the usual permissions problem.
+func spiOpenError(err error) error {
+	if errors.Is(err, os.ErrPermission) {
+		return fmt.Errorf("couldn't open SPI device (is the user in the spi group?): %w", err)
+	}
+	return fmt.Errorf("couldn't open SPI device: %w", err)
+}
+
+// spiSpeedTolerance is how far, as a fraction, the SPI speed a device reports
+// can be from the one asked for before it's worth a warning.
+const spiSpeedTolerance = 0.05
+
+// spiSpeedMismatch returns whether actual is too far from requested.
+func spiSpeedMismatch(requested, actual uint32) bool {
+	d := float64(actual) - float64(requested)
+	return math.Abs(d) > spiSpeedTolerance*float64(requested)
+}
+
+// setSPISpeed sets the speed of the SPI device open on fd, then reads it back
+// and logs a warning if the driver didn't take it, since the strip then runs
+// at a different rate than configured.
+func setSPISpeed(rp *rpi.RPi, fd uintptr, speed uint32) error {
+	err := rp.SetSPISpeed(fd, speed)
+	if err != nil {
+		return fmt.Errorf("couldn't set SPI speed: %w", err)
+	}
+	actual, err := rp.SPISpeed(fd)
+	if err != nil {
+		log.Printf("couldn't read back SPI speed: %v\n", err)
+	} else if spiSpeedMismatch(speed, actual) {
+		log.Printf("warning: asked for SPI speed %d Hz, but the device is at %d Hz\n", speed, actual)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package ledctl
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestOpenSPI(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spidev0.0")
+	if _, err := OpenSPI(path, 1000000); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("OpenSPI on a missing device got %v, want %v", err, os.ErrNotExist)
+	}
+
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	_, err := OpenSPI(path, 1000000)
+	if err == nil || !strings.Contains(err.Error(), syscall.ENOTTY.Error()) {
+		t.Errorf("OpenSPI on a plain file got %v, want %v", err, syscall.ENOTTY)
+	}
+}
+
+func TestSPIOpenErrorPermission(t *testing.T) {
+	err := spiOpenError(&os.PathError{Op: "open", Path: "/dev/spidev0.0", Err: syscall.EACCES})
+	if !errors.Is(err, os.ErrPermission) {
+		t.Errorf("got %v, want it to wrap %v", err, os.ErrPermission)
+	}
+	if !strings.Contains(err.Error(), "spi group") {
+		t.Errorf("got %q, want a hint about the spi group", err)
+	}
+}
+
+func TestSPISpeedMismatch(t *testing.T) {
+	tests := []struct {
+		requested, actual uint32
+		want              bool
+	}{
+		{12000000, 12000000, false},
+		{12000000, 11500000, false},
+		{12000000, 12500000, false},
+		{12000000, 8000000, true},
+		{12000000, 16000000, true},
+		{12000000, 0, true},
+	}
+
+	for _, test := range tests {
+		if got := spiSpeedMismatch(test.requested, test.actual); got != test.want {
+			t.Errorf("spiSpeedMismatch(%d, %d) got %v, want %v", test.requested, test.actual, got, test.want)
+		}
+	}
+}
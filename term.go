@@ -0,0 +1,159 @@
+package ledctl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+// TermStrip is a Strip that draws its pixels on a terminal instead of LEDs,
+// for trying out animations without any hardware.
+type TermStrip struct {
+	w         io.Writer
+	pixels    []RGBW
+	width     int
+	plain     bool
+	drawnRows int
+}
+
+// TermStripConfig is the configuration for a TermStrip.
+type TermStripConfig struct {
+	// Writer is where the pixels are drawn. If nil, os.Stdout is used.
+	Writer io.Writer
+	// NumPixels is the number of pixels in the strip.
+	NumPixels int
+	// Width is the number of pixels drawn per line. If zero, every Flush draws
+	// the whole strip as a new line. Otherwise, every Flush redraws the same
+	// block of lines, which suits a RowMajor Matrix with this width.
+	Width int
+	// Plain draws each pixel as its hex value instead of a colored block. It's
+	// also used if the NO_COLOR environment variable is set, or if Writer is a
+	// file that isn't a terminal.
+	Plain bool
+}
+
+// NewTermStrip creates a new TermStrip.
+func NewTermStrip(config TermStripConfig) (*TermStrip, error) {
+	if config.NumPixels <= 0 {
+		return nil, fmt.Errorf("invalid number of pixels %d", config.NumPixels)
+	}
+	if config.Width < 0 {
+		return nil, fmt.Errorf("invalid width %d", config.Width)
+	}
+	w := config.Writer
+	if w == nil {
+		w = os.Stdout
+	}
+	width := config.Width
+	if width == 0 {
+		width = config.NumPixels
+	}
+	return &TermStrip{
+		w:      w,
+		pixels: make([]RGBW, config.NumPixels),
+		width:  width,
+		plain:  config.Plain || os.Getenv("NO_COLOR") != "" || !isTerminal(w),
+	}, nil
+}
+
+// isTerminal returns whether w is a terminal. Writers that aren't files are
+// assumed to be.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return true
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// RGBAt returns the RGB pixel at the given index.
+func (ts *TermStrip) RGBAt(i int) RGB {
+	p := ts.pixels[i]
+	return RGB{p.R, p.G, p.B}
+}
+
+// SetRGBAt sets the RGB pixel at the given index, leaving its white alone.
+func (ts *TermStrip) SetRGBAt(i int, rgb RGB) {
+	p := &ts.pixels[i]
+	p.R, p.G, p.B = rgb.R, rgb.G, rgb.B
+}
+
+// RGBWAt returns the RGBW pixel at the given index.
+func (ts *TermStrip) RGBWAt(i int) RGBW {
+	return ts.pixels[i]
+}
+
+// SetRGBWAt sets the RGBW pixel at the given index. White is drawn by adding
+// it to the other colors.
+func (ts *TermStrip) SetRGBWAt(i int, rgbw RGBW) {
+	ts.pixels[i] = rgbw
+}
+
+// SetRGBs sets the RGB pixels to the given values.
+func (ts *TermStrip) SetRGBs(pixels []RGB) {
+	if len(pixels) != len(ts.pixels) {
+		panic("SetRGBs called with wrong number of pixels")
+	}
+	for i, p := range pixels {
+		ts.SetRGBAt(i, p)
+	}
+}
+
+// SetRGBWs sets the RGBW pixels to the given values.
+func (ts *TermStrip) SetRGBWs(pixels []RGBW) {
+	if len(pixels) != len(ts.pixels) {
+		panic("SetRGBWs called with wrong number of pixels")
+	}
+	copy(ts.pixels, pixels)
+}
+
+// Flush draws the pixels.
+func (ts *TermStrip) Flush() error {
+	bw := bufio.NewWriter(ts.w)
+	rows := (len(ts.pixels) + ts.width - 1) / ts.width
+	if !ts.plain && ts.drawnRows > 0 && ts.width != len(ts.pixels) {
+		// Go back up to draw over the last frame.
+		fmt.Fprintf(bw, "\x1b[%dA", ts.drawnRows)
+	}
+	for y := 0; y < rows; y++ {
+		end := (y + 1) * ts.width
+		if end > len(ts.pixels) {
+			end = len(ts.pixels)
+		}
+		for x, p := range ts.pixels[y*ts.width : end] {
+			r, g, b := addSat(p.R, p.W), addSat(p.G, p.W), addSat(p.B, p.W)
+			if ts.plain {
+				if x > 0 {
+					bw.WriteByte(' ')
+				}
+				fmt.Fprintf(bw, "%02x%02x%02x", r, g, b)
+			} else {
+				fmt.Fprintf(bw, "\x1b[48;2;%d;%d;%dm  ", r, g, b)
+			}
+		}
+		if !ts.plain {
+			bw.WriteString("\x1b[0m")
+		}
+		bw.WriteByte('\n')
+	}
+	ts.drawnRows = rows
+	return bw.Flush()
+}
+
+// Close does nothing. The writer isn't closed.
+func (ts *TermStrip) Close() error {
+	return nil
+}
+
+// NumPixels returns the number of pixels in the strip.
+func (ts *TermStrip) NumPixels() int {
+	return len(ts.pixels)
+}
+
+// MaxLEDsPerChannel returns the number of pixels in the strip, since a
+// terminal has no limit of its own.
+func (ts *TermStrip) MaxLEDsPerChannel() int {
+	return len(ts.pixels)
+}
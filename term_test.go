@@ -0,0 +1,77 @@
+package ledctl
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTermStrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		config TermStripConfig
+		want   string
+	}{
+		{
+			name:   "color",
+			config: TermStripConfig{NumPixels: 2},
+			want:   "\x1b[48;2;255;0;16m  \x1b[48;2;10;20;30m  \x1b[0m\n",
+		},
+		{
+			name:   "plain",
+			config: TermStripConfig{NumPixels: 2, Plain: true},
+			want:   "ff0010 0a141e\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("NO_COLOR", "")
+			var buf bytes.Buffer
+			test.config.Writer = &buf
+			ts, err := NewTermStrip(test.config)
+			if err != nil {
+				t.Fatalf("NewTermStrip: %v", err)
+			}
+			ts.SetRGBAt(0, RGB{255, 0, 16})
+			ts.SetRGBWAt(1, RGBW{0, 10, 20, 10}) // White is added to the others
+			if err := ts.Flush(); err != nil {
+				t.Fatalf("Flush: %v", err)
+			}
+			if got := buf.String(); got != test.want {
+				t.Errorf("Flush wrote %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTermStripNoColor(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+	var buf bytes.Buffer
+	ts, err := NewTermStrip(TermStripConfig{Writer: &buf, NumPixels: 1})
+	if err != nil {
+		t.Fatalf("NewTermStrip: %v", err)
+	}
+	ts.SetRGBAt(0, RGB{1, 2, 3})
+	if err := ts.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if got, want := buf.String(), "010203\n"; got != want {
+		t.Errorf("Flush wrote %q, want %q", got, want)
+	}
+}
+
+func TestTermStripWidth(t *testing.T) {
+	var buf bytes.Buffer
+	ts, err := NewTermStrip(TermStripConfig{Writer: &buf, NumPixels: 4, Width: 2, Plain: true})
+	if err != nil {
+		t.Fatalf("NewTermStrip: %v", err)
+	}
+	ts.SetRGBAt(3, RGB{255, 255, 255})
+	for i := 0; i < 2; i++ {
+		if err := ts.Flush(); err != nil {
+			t.Fatalf("Flush: %v", err)
+		}
+	}
+	if got, want := buf.String(), "000000 000000\n000000 ffffff\n000000 000000\n000000 ffffff\n"; got != want {
+		t.Errorf("Flush wrote %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,72 @@
+package ledctl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TestPatternPhases is the number of phases SetTestPattern cycles through:
+// red, green, blue and white.
+const TestPatternPhases = 4
+
+// testPatternColor returns the color for a phase of the test pattern. White
+// is the white channel alone on an RGBW strip, so that it can be told apart
+// from the others too.
+func testPatternColor(phase, numColors int) RGBW {
+	phase %= TestPatternPhases
+	if phase < 0 {
+		phase += TestPatternPhases
+	}
+	switch phase {
+	case 0:
+		return RGBW{R: 255}
+	case 1:
+		return RGBW{G: 255}
+	case 2:
+		return RGBW{B: 255}
+	}
+	if numColors == 4 {
+		return RGBW{W: 255}
+	}
+	return RGBW{R: 255, G: 255, B: 255}
+}
+
+// GuessColorOrder works out the color order of a strip from what it shows for
+// the test pattern while it's set up with the configured order. seen has the
+// color that lit, as 'R', 'G', 'B' or 'W', for each of the red, green and blue
+// phases, and for the white phase of an RGBW strip. For example, if a strip
+// set up as GRB shows green, red and blue, it's really RGB:
+//
+//	order, err := GuessColorOrder(GRBOrder, "GRB") // RGBOrder
+func GuessColorOrder(configured ColorOrder, seen string) (ColorOrder, error) {
+	cfg, ok := offsets[configured]
+	if !ok {
+		return 0, fmt.Errorf("unknown color order %v", configured)
+	}
+	numColors := 3
+	if cfg[3] >= 0 {
+		numColors = 4
+	}
+	if len(seen) != numColors {
+		return 0, fmt.Errorf("need %d seen colors for %v, got %q", numColors, configured, seen)
+	}
+
+	// The phases set the red, green, blue and white offsets, which are at
+	// these indexes of the offsets.
+	phaseOffsets := []int{1, 0, 2, 3}
+	got := []int{-1, -1, -1, -1}
+	for phase, c := range strings.ToUpper(seen) {
+		i := strings.IndexRune("GRBW", c)
+		if i < 0 || i >= numColors || got[i] >= 0 {
+			return 0, fmt.Errorf("seen colors %q aren't each of R, G, B (and W) once", seen)
+		}
+		got[i] = cfg[phaseOffsets[phase]]
+	}
+
+	for order, o := range offsets {
+		if o[0] == got[0] && o[1] == got[1] && o[2] == got[2] && o[3] == got[3] {
+			return order, nil
+		}
+	}
+	return 0, fmt.Errorf("no color order matches seen colors %q for %v", seen, configured)
+}
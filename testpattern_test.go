@@ -0,0 +1,58 @@
+package ledctl
+
+import "testing"
+
+func TestSetTestPattern(t *testing.T) {
+	rgb := testWS281x(WS281xConfig{NumPixels: 2, ColorOrder: GRBOrder, ColorModel: RGBModel})
+	rgbw := testWS281x(WS281xConfig{NumPixels: 2, ColorOrder: GRBWOrder, ColorModel: RGBWModel})
+	tests := []struct {
+		phase    int
+		wantRGB  RGBW
+		wantRGBW RGBW
+	}{
+		{0, RGBW{R: 255}, RGBW{R: 255}},
+		{1, RGBW{G: 255}, RGBW{G: 255}},
+		{2, RGBW{B: 255}, RGBW{B: 255}},
+		{3, RGBW{R: 255, G: 255, B: 255}, RGBW{W: 255}},
+		{4, RGBW{R: 255}, RGBW{R: 255}},
+		{-1, RGBW{R: 255, G: 255, B: 255}, RGBW{W: 255}},
+	}
+	for _, test := range tests {
+		rgb.SetTestPattern(test.phase)
+		rgbw.SetTestPattern(test.phase)
+		if got := rgb.RGBWAt(1); got != test.wantRGB {
+			t.Errorf("phase %d on RGB strip got %v, want %v", test.phase, got, test.wantRGB)
+		}
+		if got := rgbw.RGBWAt(1); got != test.wantRGBW {
+			t.Errorf("phase %d on RGBW strip got %v, want %v", test.phase, got, test.wantRGBW)
+		}
+	}
+}
+
+func TestGuessColorOrder(t *testing.T) {
+	tests := []struct {
+		configured ColorOrder
+		seen       string
+		want       ColorOrder
+		wantErr    bool
+	}{
+		{GRBOrder, "RGB", GRBOrder, false},
+		{GRBOrder, "GRB", RGBOrder, false},
+		{RGBOrder, "grb", GRBOrder, false},
+		{GRBOrder, "BGR", GBROrder, false},
+		{GRBWOrder, "GRBW", RGBWOrder, false},
+		{GRBOrder, "RRB", 0, true},
+		{GRBOrder, "RGBW", 0, true},
+		{GRBWOrder, "RGWB", 0, true},
+	}
+	for _, test := range tests {
+		got, err := GuessColorOrder(test.configured, test.seen)
+		if (err != nil) != test.wantErr {
+			t.Errorf("GuessColorOrder(%v, %q) got error %v, want error %v", test.configured, test.seen, err, test.wantErr)
+			continue
+		}
+		if err == nil && got != test.want {
+			t.Errorf("GuessColorOrder(%v, %q) got %v, want %v", test.configured, test.seen, got, test.want)
+		}
+	}
+}
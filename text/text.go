@@ -0,0 +1,85 @@
+// Package text draws and scrolls text on LED matrices, using fonts from
+// golang.org/x/image/font.
+package text
+
+import (
+	"image"
+
+	"github.com/mxcu/ledctl"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// DrawText draws s onto the matrix in color c with the given font face, with
+// the start of its baseline at (originX, originY). Anti-aliased edges are
+// blended with what's already there, and anything off the matrix is clipped.
+// It doesn't flush.
+func DrawText(m *ledctl.Matrix, s string, face font.Face, c ledctl.RGB, originX, originY int) {
+	mask := image.NewAlpha(image.Rect(0, 0, m.Width(), m.Height()))
+	d := font.Drawer{
+		Dst:  mask,
+		Src:  image.Opaque,
+		Face: face,
+		Dot:  fixed.P(originX, originY),
+	}
+	d.DrawString(s)
+
+	for y := 0; y < m.Height(); y++ {
+		for x := 0; x < m.Width(); x++ {
+			switch a := mask.AlphaAt(x, y).A; a {
+			case 0:
+			case 0xff:
+				m.SetRGB(x, y, c)
+			default:
+				m.SetRGB(x, y, ledctl.Blend(m.RGB(x, y), c, a))
+			}
+		}
+	}
+}
+
+// TextScroller scrolls a line of text across a matrix, as made by ScrollText.
+type TextScroller struct {
+	m     *ledctl.Matrix
+	s     string
+	face  font.Face
+	c     ledctl.RGB
+	x     int
+	y     int
+	width int
+}
+
+// ScrollText returns a TextScroller that scrolls s from right to left across
+// the matrix, in color c with its baseline at originY. Each call to Step
+// moves it one pixel.
+func ScrollText(m *ledctl.Matrix, s string, face font.Face, c ledctl.RGB, originY int) *TextScroller {
+	return &TextScroller{
+		m:     m,
+		s:     s,
+		face:  face,
+		c:     c,
+		x:     m.Width(),
+		y:     originY,
+		width: font.MeasureString(face, s).Ceil(),
+	}
+}
+
+// X returns where the start of the text will be drawn by the next Step.
+func (t *TextScroller) X() int {
+	return t.x
+}
+
+// Step clears the matrix, draws the text, and moves it one pixel to the left
+// for next time. Once the text has gone off the left edge, it starts again
+// from the right. It doesn't flush.
+func (t *TextScroller) Step() {
+	for y := 0; y < t.m.Height(); y++ {
+		for x := 0; x < t.m.Width(); x++ {
+			t.m.SetRGB(x, y, ledctl.RGB{})
+		}
+	}
+	DrawText(t.m, t.s, t.face, t.c, t.x, t.y)
+	t.x--
+	if t.x+t.width < 0 {
+		t.x = t.m.Width()
+	}
+}
@@ -0,0 +1,81 @@
+package text
+
+import (
+	"io"
+	"testing"
+
+	"github.com/mxcu/ledctl"
+	"golang.org/x/image/font/basicfont"
+)
+
+func newTextMatrix(t *testing.T) *ledctl.Matrix {
+	t.Helper()
+	ts, err := ledctl.NewTermStrip(ledctl.TermStripConfig{Writer: io.Discard, NumPixels: 7 * 13})
+	if err != nil {
+		t.Fatalf("NewTermStrip: %v", err)
+	}
+	m, err := ledctl.NewMatrix(ts, ledctl.MatrixConfig{Width: 7, Height: 13, Layout: ledctl.SerpentineRows})
+	if err != nil {
+		t.Fatalf("NewMatrix: %v", err)
+	}
+	return m
+}
+
+// checkCells checks that the cells in lit are c and the ones in unlit black.
+func checkCells(t *testing.T, name string, m *ledctl.Matrix, c ledctl.RGB, lit, unlit [][2]int) {
+	t.Helper()
+	for _, p := range lit {
+		if got := m.RGB(p[0], p[1]); got != c {
+			t.Errorf("%s: (%d, %d) is %v, want %v", name, p[0], p[1], got, c)
+		}
+	}
+	for _, p := range unlit {
+		if got := m.RGB(p[0], p[1]); got != (ledctl.RGB{}) {
+			t.Errorf("%s: (%d, %d) is %v, want black", name, p[0], p[1], got)
+		}
+	}
+}
+
+func TestDrawText(t *testing.T) {
+	c := ledctl.RGB{R: 255, G: 128}
+
+	// In the 7x13 font, T is a bar across row 2 from x=1 to 5, with a stem
+	// down x=3 to the baseline.
+	m := newTextMatrix(t)
+	DrawText(m, "T", basicfont.Face7x13, c, 0, 11)
+	checkCells(t, "T", m, c,
+		[][2]int{{1, 2}, {5, 2}, {3, 3}, {3, 10}},
+		[][2]int{{0, 2}, {6, 2}, {2, 5}, {4, 5}, {3, 1}, {3, 11}})
+
+	// Clipped off the left edge.
+	m = newTextMatrix(t)
+	DrawText(m, "T", basicfont.Face7x13, c, -3, 11)
+	checkCells(t, "clipped T", m, c,
+		[][2]int{{0, 2}, {2, 2}, {0, 10}},
+		[][2]int{{3, 2}, {1, 5}})
+}
+
+func TestScrollText(t *testing.T) {
+	c := ledctl.RGB{B: 255}
+	m := newTextMatrix(t)
+	s := ScrollText(m, "T", basicfont.Face7x13, c, 11)
+
+	for i := 0; i < 4; i++ {
+		s.Step()
+	}
+	// The fourth step drew T at x=4, so only the left of the bar shows.
+	checkCells(t, "step 4", m, c,
+		[][2]int{{5, 2}, {6, 2}},
+		[][2]int{{4, 2}, {6, 5}})
+	if got, want := s.X(), 3; got != want {
+		t.Errorf("X after 4 steps got %d, want %d", got, want)
+	}
+
+	// T is 7 pixels wide, so it's gone after x=-7 and starts again.
+	for i := 4; i < 15; i++ {
+		s.Step()
+	}
+	if got, want := s.X(), 7; got != want {
+		t.Errorf("X after 15 steps got %d, want %d", got, want)
+	}
+}
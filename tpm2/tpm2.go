@@ -0,0 +1,121 @@
+// Package tpm2 reads TPM2, the simple framing that many LED tools send over
+// USB serial links, and shows it on a strip.
+package tpm2
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/mxcu/ledctl"
+)
+
+const (
+	startByte = 0xC9
+	endByte   = 0x36
+)
+
+// These are the frame types.
+const (
+	// TypeData frames have pixel data, 3 bytes of RGB per pixel.
+	TypeData = 0xDA
+	// TypeCommand frames have a command for the receiver.
+	TypeCommand = 0xC0
+	// TypeResponse frames are the answer to a command.
+	TypeResponse = 0xAA
+)
+
+// ErrMalformed is returned when a frame doesn't start or end with the right
+// byte.
+var ErrMalformed = errors.New("malformed TPM2 frame")
+
+// Frame is a TPM2 frame.
+type Frame struct {
+	// Type is the frame type, such as TypeData.
+	Type byte
+	// Payload is the frame's data.
+	Payload []byte
+}
+
+// Reader reads TPM2 frames.
+type Reader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+// NewReader creates a Reader that reads frames from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// ReadFrame reads the next frame. Its payload is only valid until the next
+// call. It returns io.EOF if r ends between frames, and an error wrapping
+// ErrMalformed if the frame is broken.
+func (r *Reader) ReadFrame() (*Frame, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r.r, header[:1]); err != nil {
+		return nil, err
+	}
+	if header[0] != startByte {
+		return nil, fmt.Errorf("%w: start byte %#02x", ErrMalformed, header[0])
+	}
+	if _, err := io.ReadFull(r.r, header[1:]); err != nil {
+		return nil, fmt.Errorf("couldn't read header: %w", noEOF(err))
+	}
+	switch header[1] {
+	case TypeData, TypeCommand, TypeResponse:
+	default:
+		return nil, fmt.Errorf("%w: frame type %#02x", ErrMalformed, header[1])
+	}
+
+	n := int(binary.BigEndian.Uint16(header[2:])) + 1 // Including the end byte
+	if cap(r.buf) < n {
+		r.buf = make([]byte, n)
+	}
+	buf := r.buf[:n]
+	if _, err := io.ReadFull(r.r, buf); err != nil {
+		return nil, fmt.Errorf("couldn't read payload: %w", noEOF(err))
+	}
+	if buf[n-1] != endByte {
+		return nil, fmt.Errorf("%w: end byte %#02x", ErrMalformed, buf[n-1])
+	}
+	return &Frame{Type: header[1], Payload: buf[:n-1]}, nil
+}
+
+// noEOF turns io.EOF into io.ErrUnexpectedEOF, for when a frame is cut off.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Play reads frames from r and shows each data frame on strip, flushing it
+// after every one. Commands and responses are skipped, since there's no way
+// to answer them. It returns nil when r ends between frames.
+func Play(r io.Reader, strip ledctl.Strip) error {
+	numPixels := strip.NumPixels()
+
+	fr := NewReader(r)
+	for {
+		f, err := fr.ReadFrame()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if f.Type != TypeData {
+			continue
+		}
+		p := f.Payload
+		for i := 0; i < numPixels && 3*i+2 < len(p); i++ {
+			strip.SetRGBAt(i, ledctl.RGB{R: p[3*i], G: p[3*i+1], B: p[3*i+2]})
+		}
+		if err := strip.Flush(); err != nil {
+			return fmt.Errorf("couldn't flush frame: %w", err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package tpm2
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/mxcu/ledctl"
+)
+
+var dataFrame = []byte{
+	0xC9,       // Start
+	0xDA,       // Data frame
+	0x00, 0x06, // Payload size
+	0xff, 0x80, 0x00, 0x01, 0x02, 0x03, // Payload
+	0x36, // End
+}
+
+func TestReadFrame(t *testing.T) {
+	f, err := NewReader(bytes.NewReader(dataFrame)).ReadFrame()
+	if err != nil {
+		t.Fatalf("ReadFrame: %v", err)
+	}
+	if f.Type != TypeData {
+		t.Errorf("Type got %#02x, want %#02x", f.Type, TypeData)
+	}
+	if want := []byte{0xff, 0x80, 0x00, 0x01, 0x02, 0x03}; !bytes.Equal(f.Payload, want) {
+		t.Errorf("Payload got % X, want % X", f.Payload, want)
+	}
+}
+
+func TestReadFrameMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+		want error
+	}{
+		{"start byte", append([]byte{0xC8}, dataFrame[1:]...), ErrMalformed},
+		{"frame type", append([]byte{0xC9, 0x12}, dataFrame[2:]...), ErrMalformed},
+		{"end byte", append(append([]byte(nil), dataFrame[:len(dataFrame)-1]...), 0x37), ErrMalformed},
+		{"cut off", dataFrame[:7], io.ErrUnexpectedEOF},
+	}
+	for _, test := range tests {
+		_, err := NewReader(bytes.NewReader(test.b)).ReadFrame()
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: ReadFrame got %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestPlay(t *testing.T) {
+	command := []byte{0xC9, 0xC0, 0x00, 0x01, 0x0A, 0x36}
+	var stream []byte
+	stream = append(stream, command...)
+	stream = append(stream, dataFrame...)
+
+	strip := ledctl.NullStrip(3, 3)
+	if err := Play(bytes.NewReader(stream), strip); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	if strip.Flushes() != 1 {
+		t.Errorf("got %d flushes, want 1", strip.Flushes())
+	}
+	want := []ledctl.RGB{{R: 0xff, G: 0x80}, {R: 1, G: 2, B: 3}, {}}
+	for i := range want {
+		if strip.RGBAt(i) != want[i] {
+			t.Errorf("pixel %d got %v, want %v", i, strip.RGBAt(i), want[i])
+		}
+	}
+
+	if err := Play(bytes.NewReader([]byte{0x00}), strip); !errors.Is(err, ErrMalformed) {
+		t.Errorf("Play on garbage got %v, want %v", err, ErrMalformed)
+	}
+}
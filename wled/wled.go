@@ -0,0 +1,201 @@
+// Package wled receives the UDP realtime protocols of WLED, which many LED
+// apps and tools can send, and shows them on a strip.
+package wled
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/mxcu/ledctl"
+)
+
+// Port is the UDP port WLED listens on for realtime data.
+const Port = 21324
+
+// Protocol is an enumeration of the WLED realtime protocols, as given by the
+// first byte of each packet.
+type Protocol uint8
+
+const (
+	WARLS Protocol = 1
+	DRGB  Protocol = 2
+	DRGBW Protocol = 3
+	DNRGB Protocol = 4
+)
+
+// noTimeout is the timeout byte that keeps realtime mode on until further
+// notice.
+const noTimeout = 255
+
+// Forever is the Timeout of packets that keep realtime mode on until further
+// notice.
+const Forever time.Duration = -1
+
+// Packet is a WLED realtime packet.
+type Packet struct {
+	// Protocol is which of the protocols the packet is in.
+	Protocol Protocol
+	// Timeout is how long after this packet to go back to normal operation
+	// if no more arrive, or Forever. Zero means to go back at once, without
+	// showing Data, as WLED does.
+	Timeout time.Duration
+	// Start is the index of the first pixel in Data.
+	Start int
+	// Data is the pixels: three bytes each, R, G and B, for DRGB and DNRGB;
+	// four bytes each, R, G, B and W, for DRGBW; and four bytes each, the
+	// pixel's index then R, G and B, for WARLS.
+	Data []byte
+}
+
+// ParsePacket parses a packet in any of the protocols. Data refers to b,
+// rather than being a copy.
+func ParsePacket(b []byte) (*Packet, error) {
+	if len(b) < 2 {
+		return nil, fmt.Errorf("packet too short at %d bytes", len(b))
+	}
+	p := &Packet{Protocol: Protocol(b[0]), Timeout: Forever}
+	if b[1] != noTimeout {
+		p.Timeout = time.Duration(b[1]) * time.Second
+	}
+	switch p.Protocol {
+	case WARLS, DRGB, DRGBW:
+		p.Data = b[2:]
+	case DNRGB:
+		if len(b) < 4 {
+			return nil, fmt.Errorf("DNRGB packet too short at %d bytes", len(b))
+		}
+		p.Start = int(binary.BigEndian.Uint16(b[2:]))
+		p.Data = b[4:]
+	default:
+		return nil, fmt.Errorf("unsupported protocol %d", b[0])
+	}
+	return p, nil
+}
+
+// Receiver shows WLED realtime data on a strip.
+type Receiver struct {
+	strip     ledctl.Strip
+	numPixels int
+	onTimeout func()
+	active    bool
+	deadline  time.Time // zero if the last packet had no timeout
+	now       func() time.Time
+}
+
+// NewReceiver creates a Receiver for the strip. When realtime data stops for
+// longer than its timeout, or a packet with a zero timeout arrives, onTimeout
+// is called, if it isn't nil, so that the caller can go back to showing
+// whatever it was showing before.
+func NewReceiver(strip ledctl.Strip, onTimeout func()) *Receiver {
+	return &Receiver{strip: strip, numPixels: strip.NumPixels(), onTimeout: onTimeout, now: time.Now}
+}
+
+// Active returns whether realtime data is being shown: a packet has arrived
+// and its timeout hasn't run out yet.
+func (r *Receiver) Active() bool {
+	return r.active && (r.deadline.IsZero() || r.now().Before(r.deadline))
+}
+
+// Handle shows the pixels from a realtime packet and flushes the strip, or
+// ends realtime mode if the packet's timeout is zero. Pixels past the end of
+// the strip are ignored.
+func (r *Receiver) Handle(b []byte) error {
+	p, err := ParsePacket(b)
+	if err != nil {
+		return err
+	}
+	return r.show(p)
+}
+
+func (r *Receiver) show(p *Packet) error {
+	if p.Timeout == 0 {
+		r.exit()
+		return nil
+	}
+	r.active = true
+	r.deadline = time.Time{}
+	if p.Timeout != Forever {
+		r.deadline = r.now().Add(p.Timeout)
+	}
+
+	d := p.Data
+	switch p.Protocol {
+	case WARLS:
+		for k := 0; 4*k+3 < len(d); k++ {
+			if i := int(d[4*k]); i < r.numPixels {
+				r.strip.SetRGBAt(i, ledctl.RGB{R: d[4*k+1], G: d[4*k+2], B: d[4*k+3]})
+			}
+		}
+	case DRGBW:
+		for k := 0; 4*k+3 < len(d) && p.Start+k < r.numPixels; k++ {
+			r.strip.SetRGBWAt(p.Start+k, ledctl.RGBW{R: d[4*k], G: d[4*k+1], B: d[4*k+2], W: d[4*k+3]})
+		}
+	default:
+		for k := 0; 3*k+2 < len(d) && p.Start+k < r.numPixels; k++ {
+			r.strip.SetRGBAt(p.Start+k, ledctl.RGB{R: d[3*k], G: d[3*k+1], B: d[3*k+2]})
+		}
+	}
+	return r.strip.Flush()
+}
+
+// checkTimeout ends realtime mode if its timeout has run out.
+func (r *Receiver) checkTimeout() {
+	if r.active && !r.Active() {
+		r.exit()
+	}
+}
+
+// exit ends realtime mode, calling onTimeout, if it's on.
+func (r *Receiver) exit() {
+	if !r.active {
+		return
+	}
+	r.active = false
+	r.deadline = time.Time{}
+	if r.onTimeout != nil {
+		r.onTimeout()
+	}
+}
+
+// Serve handles every packet read from conn, until reading from it or
+// flushing the strip fails. Packets that can't be parsed are skipped.
+func (r *Receiver) Serve(conn net.PacketConn) error {
+	buf := make([]byte, 1500)
+	for {
+		// Wake up when the timeout runs out, even if nothing arrives.
+		if err := conn.SetReadDeadline(r.deadline); err != nil {
+			return err
+		}
+		n, _, err := conn.ReadFrom(buf)
+		r.checkTimeout()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return err
+		}
+		p, err := ParsePacket(buf[:n])
+		if err != nil {
+			continue
+		}
+		if err := r.show(p); err != nil {
+			return err
+		}
+	}
+}
+
+// ListenAndServe listens for WLED realtime data on Port and shows it on
+// strip, until something goes wrong. onTimeout is as for NewReceiver.
+func ListenAndServe(strip ledctl.Strip, onTimeout func()) error {
+	r := NewReceiver(strip, onTimeout)
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: Port})
+	if err != nil {
+		return fmt.Errorf("couldn't listen on port %d: %v", Port, err)
+	}
+	defer conn.Close()
+	return r.Serve(conn)
+}
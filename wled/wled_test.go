@@ -0,0 +1,140 @@
+package wled
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/mxcu/ledctl"
+)
+
+var (
+	drgbPacket  = []byte{2, 5, 0xff, 0x80, 0x00, 0x01, 0x02, 0x03}
+	dnrgbPacket = []byte{4, 255, 0x00, 0x02, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f}
+	warlsPacket = []byte{1, 255, 0x02, 0x04, 0x05, 0x06, 0x09, 0x07, 0x08, 0x09}
+	drgbwPacket = []byte{3, 255, 0x01, 0x02, 0x03, 0x04}
+	exitPacket  = []byte{2, 0, 0x09, 0x09, 0x09}
+)
+
+func TestParsePacket(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+		want Packet
+	}{
+		{"DRGB", drgbPacket, Packet{Protocol: DRGB, Timeout: 5 * time.Second, Data: drgbPacket[2:]}},
+		{"DNRGB", dnrgbPacket, Packet{Protocol: DNRGB, Timeout: Forever, Start: 2, Data: dnrgbPacket[4:]}},
+		{"WARLS", warlsPacket, Packet{Protocol: WARLS, Timeout: Forever, Data: warlsPacket[2:]}},
+		{"DRGBW", drgbwPacket, Packet{Protocol: DRGBW, Timeout: Forever, Data: drgbwPacket[2:]}},
+		{"zero timeout", exitPacket, Packet{Protocol: DRGB, Data: exitPacket[2:]}},
+	}
+	for _, test := range tests {
+		p, err := ParsePacket(test.b)
+		if err != nil {
+			t.Fatalf("%s: ParsePacket: %v", test.name, err)
+		}
+		if p.Protocol != test.want.Protocol || p.Timeout != test.want.Timeout || p.Start != test.want.Start || !bytes.Equal(p.Data, test.want.Data) {
+			t.Errorf("%s: got %+v, want %+v", test.name, p, test.want)
+		}
+	}
+
+	for _, b := range [][]byte{{2}, {4, 1, 0}, {5, 1, 0, 1, 2, 3}} {
+		if _, err := ParsePacket(b); err == nil {
+			t.Errorf("ParsePacket(% X) succeeded, want error", b)
+		}
+	}
+}
+
+func TestReceiver(t *testing.T) {
+	strip := ledctl.NullStrip(3, 3)
+	timeouts := 0
+	r := NewReceiver(strip, func() { timeouts++ })
+	now := time.Unix(1000, 0)
+	r.now = func() time.Time { return now }
+
+	if err := r.Handle(drgbPacket); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	// The DNRGB packet starts at pixel 2, and its second pixel is off the end.
+	if err := r.Handle(dnrgbPacket); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	want := []ledctl.RGB{{R: 0xff, G: 0x80}, {R: 1, G: 2, B: 3}, {R: 0x0a, G: 0x0b, B: 0x0c}}
+	for i := range want {
+		if strip.RGBAt(i) != want[i] {
+			t.Errorf("pixel %d got %v, want %v", i, strip.RGBAt(i), want[i])
+		}
+	}
+	if strip.Flushes() != 2 {
+		t.Errorf("got %d flushes, want 2", strip.Flushes())
+	}
+
+	// The DNRGB packet had no timeout.
+	now = now.Add(time.Hour)
+	r.checkTimeout()
+	if !r.Active() || timeouts != 0 {
+		t.Errorf("no timeout: Active() %v after %d timeouts, want true after 0", r.Active(), timeouts)
+	}
+
+	if err := r.Handle(drgbPacket); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	now = now.Add(4 * time.Second)
+	r.checkTimeout()
+	if !r.Active() || timeouts != 0 {
+		t.Errorf("before timeout: Active() %v after %d timeouts, want true after 0", r.Active(), timeouts)
+	}
+	now = now.Add(time.Second)
+	r.checkTimeout()
+	r.checkTimeout()
+	if r.Active() || timeouts != 1 {
+		t.Errorf("after timeout: Active() %v after %d timeouts, want false after 1", r.Active(), timeouts)
+	}
+}
+
+func TestReceiverProtocols(t *testing.T) {
+	strip := ledctl.NullStrip(3, 4)
+	r := NewReceiver(strip, nil)
+
+	// WARLS sets pixels by index, and ignores the ones off the end.
+	if err := r.Handle(warlsPacket); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if got, want := strip.RGBAt(2), (ledctl.RGB{R: 4, G: 5, B: 6}); got != want {
+		t.Errorf("WARLS: pixel 2 got %v, want %v", got, want)
+	}
+	if err := r.Handle(drgbwPacket); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if got, want := strip.RGBWAt(0), (ledctl.RGBW{R: 1, G: 2, B: 3, W: 4}); got != want {
+		t.Errorf("DRGBW: pixel 0 got %v, want %v", got, want)
+	}
+}
+
+func TestReceiverZeroTimeout(t *testing.T) {
+	strip := ledctl.NullStrip(3, 3)
+	timeouts := 0
+	r := NewReceiver(strip, func() { timeouts++ })
+
+	// A zero timeout ends realtime mode at once, without showing the data.
+	if err := r.Handle(dnrgbPacket); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if err := r.Handle(exitPacket); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if r.Active() || timeouts != 1 {
+		t.Errorf("Active() %v after %d timeouts, want false after 1", r.Active(), timeouts)
+	}
+	if strip.RGBAt(0) != (ledctl.RGB{}) || strip.Flushes() != 1 {
+		t.Errorf("zero timeout packet was shown")
+	}
+
+	// It does nothing more when realtime mode is already off.
+	if err := r.Handle(exitPacket); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if timeouts != 1 {
+		t.Errorf("got %d timeouts, want 1", timeouts)
+	}
+}